@@ -21,6 +21,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 func GetDirSize(dir string) int64 {
@@ -38,6 +39,15 @@ func GetDirSize(dir string) int64 {
 	return size
 }
 
+// GetDiskFree returns the bytes available to unprivileged users on the filesystem holding path.
+func GetDiskFree(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
 func Command(key string, arg ...string) string {
 	cmd := exec.Command(key, arg...)
 	b, _ := cmd.CombinedOutput()
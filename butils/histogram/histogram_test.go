@@ -0,0 +1,69 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package histogram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketIndex(t *testing.T) {
+	for usec := int64(0); usec < 1<<20; usec++ {
+		i := bucketIndex(usec)
+		if upper := bucketUpper(i); upper < usec {
+			t.Fatalf("usec:%d bucket:%d upper:%d", usec, i, upper)
+		}
+		if i > 0 && bucketUpper(i-1) >= usec {
+			t.Fatalf("usec:%d bucket:%d prev upper:%d", usec, i, bucketUpper(i-1))
+		}
+	}
+	if i := bucketIndex(int64(time.Hour / time.Microsecond)); i != numBuckets-1 {
+		t.Fatalf("overflow bucket:%d", i)
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	h := New()
+	for i := int64(1); i <= 1000; i++ {
+		h.RecordUsec(i)
+	}
+	if n := h.Count(); n != 1000 {
+		t.Fatalf("count:%d", n)
+	}
+	if m := h.Max(); m != 1000 {
+		t.Fatalf("max:%d", m)
+	}
+
+	ps := h.Percentiles(50, 99, 99.9, 100)
+	expect := []int64{500, 990, 999, 1000}
+	for i, p := range ps {
+		if p < expect[i] || float64(p) > float64(expect[i])*1.125 {
+			t.Fatalf("percentile:%d got:%d expect:%d", i, p, expect[i])
+		}
+	}
+
+	bounds, cumulative := h.PowerOfTwoBuckets()
+	if len(bounds) == 0 || bounds[len(bounds)-1] != 1024 || cumulative[len(cumulative)-1] != 1000 {
+		t.Fatalf("bounds:%v cumulative:%v", bounds, cumulative)
+	}
+	if bounds[0] != 2 || cumulative[0] != 1 {
+		t.Fatalf("bounds:%v cumulative:%v", bounds, cumulative)
+	}
+
+	h.Reset()
+	if h.Count() != 0 || h.Max() != 0 || h.Percentile(99) != 0 {
+		t.Fatal("reset fail")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package promtext writes metrics in the Prometheus text exposition format.
+package promtext
+
+import (
+	"io"
+	"sort"
+	"strconv"
+)
+
+const (
+	typeGauge   = "gauge"
+	typeCounter = "counter"
+)
+
+type sample struct {
+	name   string
+	typ    string
+	labels string
+	value  float64
+}
+
+// Writer collects the samples of one scrape. Every sample carries the common
+// labels, series of the same name are written together under one # TYPE line.
+type Writer struct {
+	prefix  string
+	labels  string
+	samples []sample
+}
+
+func NewWriter(prefix, labels string) *Writer {
+	return &Writer{prefix: prefix, labels: labels}
+}
+
+// Gauge adds a value that can go up and down.
+func (w *Writer) Gauge(name, labels string, v float64) {
+	w.add(name, typeGauge, labels, v)
+}
+
+// Counter adds a value that only grows until the process restarts, its name
+// should end with _total.
+func (w *Writer) Counter(name, labels string, v float64) {
+	w.add(name, typeCounter, labels, v)
+}
+
+func (w *Writer) add(name, typ, labels string, v float64) {
+	if len(labels) > 0 && len(w.labels) > 0 {
+		labels = w.labels + "," + labels
+	} else if len(labels) == 0 {
+		labels = w.labels
+	}
+	w.samples = append(w.samples, sample{name: w.prefix + name, typ: typ, labels: labels, value: v})
+}
+
+// WriteTo writes the samples sorted by name. A name keeps the type it was
+// first added with.
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	sort.SliceStable(w.samples, func(i, j int) bool {
+		return w.samples[i].name < w.samples[j].name
+	})
+
+	var buf []byte
+	for i, s := range w.samples {
+		if i == 0 || s.name != w.samples[i-1].name {
+			buf = append(buf, "# TYPE "...)
+			buf = append(buf, s.name...)
+			buf = append(buf, ' ')
+			buf = append(buf, s.typ...)
+			buf = append(buf, '\n')
+		}
+		buf = append(buf, s.name...)
+		if len(s.labels) > 0 {
+			buf = append(buf, '{')
+			buf = append(buf, s.labels...)
+			buf = append(buf, '}')
+		}
+		buf = append(buf, ' ')
+		buf = strconv.AppendFloat(buf, s.value, 'g', -1, 64)
+		buf = append(buf, '\n')
+	}
+	n, err := out.Write(buf)
+	return int64(n), err
+}
+
+func BoolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promtext
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	w := NewWriter("bitalosproxy_", `product="test",node="127.0.0.1:8790",role="proxy"`)
+	w.Counter("command_calls_total", `command="get"`, 12)
+	w.Gauge("up", "", BoolToFloat(true))
+	w.Counter("command_calls_total", `command="set"`, 3)
+
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE bitalosproxy_command_calls_total counter
+bitalosproxy_command_calls_total{product="test",node="127.0.0.1:8790",role="proxy",command="get"} 12
+bitalosproxy_command_calls_total{product="test",node="127.0.0.1:8790",role="proxy",command="set"} 3
+# TYPE bitalosproxy_up gauge
+bitalosproxy_up{product="test",node="127.0.0.1:8790",role="proxy"} 1
+`
+	if out := buf.String(); out != want {
+		t.Fatalf("bad output:\n%s", out)
+	}
+
+	buf.Reset()
+	w = NewWriter("x_", "")
+	w.Gauge("ratio", `kind="a"`, 0.5)
+	w.Gauge("items", "", 1e6)
+	w.WriteTo(&buf)
+	for _, line := range []string{`x_ratio{kind="a"} 0.5`, `x_items 1e+06`} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatalf("missing %q in:\n%s", line, buf.String())
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+)
+
+// Command is the RESP extension carrying a trace context to the next hop, the
+// request "TRACE <traceparent> <cmd> [arg ...]" runs <cmd> as a child of the
+// given context and replies exactly what <cmd> replies.
+const Command = "TRACE"
+
+// WrapCommand prepends the TRACE prefix to a command about to be sent with a
+// redigo style Do(commandName, args...).
+func WrapCommand(sc SpanContext, commandName string, args []interface{}) (string, []interface{}) {
+	wrapped := make([]interface{}, 0, len(args)+2)
+	wrapped = append(wrapped, sc.Traceparent(), commandName)
+	return Command, append(wrapped, args...)
+}
+
+// SplitCommand strips the TRACE prefix from a parsed request, a request
+// without the prefix is returned unchanged with an invalid SpanContext.
+func SplitCommand(reqData [][]byte) ([][]byte, SpanContext) {
+	if len(reqData) < 3 || !bytes.EqualFold(reqData[0], unsafe2.ByteSlice(Command)) {
+		return reqData, SpanContext{}
+	}
+	sc, _ := ParseTraceparent(unsafe2.String(reqData[1]))
+	return reqData[2:], sc
+}
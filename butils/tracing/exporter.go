@@ -0,0 +1,246 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ExporterFile = "file"
+	ExporterOTLP = "otlp"
+
+	scopeName = "github.com/zuoyebang/bitalostored"
+)
+
+type Exporter interface {
+	Export(resource []Attribute, spans []*Span) error
+	Close() error
+}
+
+// NewExporter builds the exporter by name, target is a file path for the file
+// exporter and an OTLP/HTTP traces url for the otlp exporter.
+func NewExporter(name, target string) (Exporter, error) {
+	switch name {
+	case ExporterFile:
+		return NewFileExporter(target)
+	case ExporterOTLP:
+		return NewOTLPExporter(target, 3*time.Second), nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", name)
+	}
+}
+
+// FileExporter appends one OTLP/JSON ExportTraceServiceRequest per line,
+// the same layout the OpenTelemetry collector file exporter writes.
+type FileExporter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	if len(path) == 0 {
+		return nil, errors.New("tracing file exporter path is empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{f: f}, nil
+}
+
+func (e *FileExporter) Export(resource []Attribute, spans []*Span) error {
+	b, err := json.Marshal(encodeOTLP(resource, spans))
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.f.Write(b)
+	return err
+}
+
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.f.Close()
+}
+
+// OTLPExporter posts OTLP/JSON to an OTLP/HTTP receiver, e.g. http://127.0.0.1:4318/v1/traces.
+type OTLPExporter struct {
+	url    string
+	client *http.Client
+}
+
+func NewOTLPExporter(url string, timeout time.Duration) *OTLPExporter {
+	return &OTLPExporter{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (e *OTLPExporter) Export(resource []Attribute, spans []*Span) error {
+	b, err := json.Marshal(encodeOTLP(resource, spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func encodeOTLP(resource []Attribute, spans []*Span) *otlpRequest {
+	ss := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(spans))}
+	ss.Scope.Name = scopeName
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceId:           s.sc.TraceID.String(),
+			SpanId:            s.sc.SpanID.String(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        encodeAttributes(s.attrs),
+		}
+		if s.errMsg != "" {
+			span.Status = &otlpStatus{Code: 2, Message: s.errMsg}
+		}
+		s.mu.Unlock()
+		if s.parent.IsValid() {
+			span.ParentSpanId = s.parent.String()
+		}
+		ss.Spans = append(ss.Spans, span)
+	}
+	return &otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource:   otlpResource{Attributes: encodeAttributes(resource)},
+			ScopeSpans: []otlpScopeSpans{ss},
+		}},
+	}
+}
+
+func encodeAttributes(attrs []Attribute) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		kv := otlpKeyValue{Key: a.Key}
+		switch v := a.Value.(type) {
+		case string:
+			kv.Value.StringValue = &v
+		case []byte:
+			str := string(v)
+			kv.Value.StringValue = &str
+		case int:
+			str := strconv.Itoa(v)
+			kv.Value.IntValue = &str
+		case int64:
+			str := strconv.FormatInt(v, 10)
+			kv.Value.IntValue = &str
+		case uint32:
+			str := strconv.FormatUint(uint64(v), 10)
+			kv.Value.IntValue = &str
+		case uint64:
+			str := strconv.FormatUint(v, 10)
+			kv.Value.IntValue = &str
+		case float64:
+			kv.Value.DoubleValue = &v
+		case bool:
+			kv.Value.BoolValue = &v
+		default:
+			str := fmt.Sprint(v)
+			kv.Value.StringValue = &str
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs
+}
@@ -0,0 +1,235 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultQueueSize     = 4096
+	DefaultBatchSize     = 256
+	DefaultFlushInterval = time.Second
+)
+
+type Config struct {
+	ServiceName   string
+	SampleRatio   float64
+	Exporter      Exporter
+	Attributes    []Attribute
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// Tracer samples root spans by trace id ratio, child spans follow the sampling
+// decision of their parent. Ended spans are exported in batches by a background
+// goroutine and dropped when the queue is full.
+type Tracer struct {
+	cfg       Config
+	threshold uint64
+	queue     chan *Span
+	dropped   atomic.Int64
+	exported  atomic.Int64
+	closeOnce sync.Once
+	closeC    chan struct{}
+	wg        sync.WaitGroup
+}
+
+func NewTracer(cfg Config) *Tracer {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	t := &Tracer{
+		cfg:    cfg,
+		queue:  make(chan *Span, cfg.QueueSize),
+		closeC: make(chan struct{}),
+	}
+	switch {
+	case cfg.SampleRatio >= 1:
+		t.threshold = math.MaxUint64
+	case cfg.SampleRatio > 0:
+		t.threshold = uint64(cfg.SampleRatio * math.MaxUint64)
+	}
+	t.wg.Add(1)
+	go t.run()
+	return t
+}
+
+// Start creates a span, a valid parent decides the sampling, otherwise a new
+// trace is started. It returns nil when the span is not sampled.
+func (t *Tracer) Start(name string, kind SpanKind, parent SpanContext) *Span {
+	return t.StartAt(name, kind, parent, time.Now())
+}
+
+func (t *Tracer) StartAt(name string, kind SpanKind, parent SpanContext, start time.Time) *Span {
+	if t == nil {
+		return nil
+	}
+	if parent.IsValid() {
+		if !parent.Sampled {
+			return nil
+		}
+		return t.newSpan(name, kind, parent.TraceID, parent.SpanID, start)
+	}
+	var traceId TraceID
+	randomId(traceId[:])
+	if t.threshold == 0 || binary.BigEndian.Uint64(traceId[8:]) > t.threshold {
+		return nil
+	}
+	return t.newSpan(name, kind, traceId, SpanID{}, start)
+}
+
+func (t *Tracer) newSpan(name string, kind SpanKind, traceId TraceID, parent SpanID, start time.Time) *Span {
+	s := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		parent: parent,
+		start:  start,
+	}
+	s.sc.TraceID = traceId
+	s.sc.Sampled = true
+	randomId(s.sc.SpanID[:])
+	return s
+}
+
+func (t *Tracer) enqueue(s *Span) {
+	select {
+	case t.queue <- s:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+func (t *Tracer) Dropped() int64 {
+	if t == nil {
+		return 0
+	}
+	return t.dropped.Load()
+}
+
+func (t *Tracer) Exported() int64 {
+	if t == nil {
+		return 0
+	}
+	return t.exported.Load()
+}
+
+func (t *Tracer) run() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if t.cfg.Exporter != nil {
+			if err := t.cfg.Exporter.Export(t.resource(), batch); err != nil {
+				t.dropped.Add(int64(len(batch)))
+			} else {
+				t.exported.Add(int64(len(batch)))
+			}
+		}
+		batch = make([]*Span, 0, t.cfg.BatchSize)
+	}
+
+	for {
+		select {
+		case s := <-t.queue:
+			batch = append(batch, s)
+			if len(batch) >= t.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.closeC:
+			for {
+				select {
+				case s := <-t.queue:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) resource() []Attribute {
+	attrs := make([]Attribute, 0, len(t.cfg.Attributes)+1)
+	attrs = append(attrs, Attribute{Key: "service.name", Value: t.cfg.ServiceName})
+	return append(attrs, t.cfg.Attributes...)
+}
+
+// Close flushes the queued spans and closes the exporter.
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.closeOnce.Do(func() {
+		close(t.closeC)
+		t.wg.Wait()
+		if t.cfg.Exporter != nil {
+			t.cfg.Exporter.Close()
+		}
+	})
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetDefault installs the process wide tracer used by Start, nil disables tracing.
+func SetDefault(t *Tracer) {
+	if old := defaultTracer.Swap(t); old != nil && old != t {
+		old.Close()
+	}
+}
+
+func Default() *Tracer {
+	return defaultTracer.Load()
+}
+
+func Start(name string, kind SpanKind, parent SpanContext) *Span {
+	return defaultTracer.Load().Start(name, kind, parent)
+}
+
+func StartAt(name string, kind SpanKind, parent SpanContext, start time.Time) *Span {
+	return defaultTracer.Load().StartAt(name, kind, parent, start)
+}
+
+var idRand = struct {
+	sync.Mutex
+	r *rand.Rand
+}{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+func randomId(b []byte) {
+	idRand.Lock()
+	idRand.r.Read(b)
+	idRand.Unlock()
+}
@@ -0,0 +1,154 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTraceparent(t *testing.T) {
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(tp)
+	if !ok || !sc.Sampled {
+		t.Fatalf("parse traceparent:%+v ok:%v", sc, ok)
+	}
+	if s := sc.Traceparent(); s != tp {
+		t.Fatalf("traceparent:%s", s)
+	}
+	for _, s := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		if _, ok = ParseTraceparent(s); ok {
+			t.Fatalf("invalid traceparent parsed:%s", s)
+		}
+	}
+}
+
+func TestSampling(t *testing.T) {
+	var nilTracer *Tracer
+	if s := nilTracer.Start("get", SpanKindServer, SpanContext{}); s != nil {
+		t.Fatal("nil tracer should not sample")
+	}
+	var nilSpan *Span
+	nilSpan.SetAttr("k", "v")
+	nilSpan.End()
+	if c := nilSpan.StartChild("child", SpanKindClient); c != nil {
+		t.Fatal("child of nil span should be nil")
+	}
+
+	never := NewTracer(Config{SampleRatio: 0})
+	defer never.Close()
+	always := NewTracer(Config{SampleRatio: 1})
+	defer always.Close()
+	for i := 0; i < 100; i++ {
+		if never.Start("get", SpanKindServer, SpanContext{}) != nil {
+			t.Fatal("ratio 0 sampled")
+		}
+		if always.Start("get", SpanKindServer, SpanContext{}) == nil {
+			t.Fatal("ratio 1 not sampled")
+		}
+	}
+
+	parent := always.Start("set", SpanKindServer, SpanContext{})
+	if s := never.Start("apply", SpanKindInternal, parent.Context()); s == nil || s.Context().TraceID != parent.Context().TraceID {
+		t.Fatal("sampled parent should be followed")
+	}
+	unsampled := parent.Context()
+	unsampled.Sampled = false
+	if s := always.Start("apply", SpanKindInternal, unsampled); s != nil {
+		t.Fatal("unsampled parent should be followed")
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace", "spans.json")
+	exporter, err := NewExporter(ExporterFile, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := NewTracer(Config{
+		ServiceName:   "bitalosproxy",
+		SampleRatio:   1,
+		Exporter:      exporter,
+		FlushInterval: time.Hour,
+	})
+
+	root := tracer.Start("SET", SpanKindServer, SpanContext{})
+	root.SetAttr("db.statement", "SET")
+	child := root.StartChild("stored SET", SpanKindClient)
+	child.SetAttr("bitalos.group_id", 1)
+	child.SetError(errors.New("ERR timeout"))
+	child.End()
+	root.End()
+	tracer.Close()
+	if n := tracer.Exported(); n != 2 {
+		t.Fatalf("exported:%d", n)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		t.Fatal("no exported line")
+	}
+	var req otlpRequest
+	if err = json.Unmarshal(scanner.Bytes(), &req); err != nil {
+		t.Fatal(err)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("spans:%+v", spans)
+	}
+	if *req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue != "bitalosproxy" {
+		t.Fatalf("resource:%+v", req.ResourceSpans[0].Resource)
+	}
+	if spans[0].Name != "stored SET" || spans[0].ParentSpanId != root.Context().SpanID.String() ||
+		spans[0].Status == nil || spans[0].Status.Code != 2 || *spans[0].Attributes[0].Value.IntValue != "1" {
+		t.Fatalf("child span:%+v", spans[0])
+	}
+	if spans[1].TraceId != spans[0].TraceId || spans[1].ParentSpanId != "" {
+		t.Fatalf("root span:%+v", spans[1])
+	}
+}
+
+func TestCommand(t *testing.T) {
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	name, args := WrapCommand(sc, "SET", []interface{}{"k", "v"})
+	if name != Command || len(args) != 4 || args[1] != "SET" {
+		t.Fatalf("wrap command:%s %v", name, args)
+	}
+
+	reqData := [][]byte{[]byte("trace"), []byte(args[0].(string)), []byte("set"), []byte("k"), []byte("v")}
+	inner, parent := SplitCommand(reqData)
+	if len(inner) != 3 || string(inner[0]) != "set" || parent != sc {
+		t.Fatalf("split command:%q %+v", inner, parent)
+	}
+	plain := [][]byte{[]byte("get"), []byte("k")}
+	if inner, parent = SplitCommand(plain); len(inner) != 2 || parent.IsValid() {
+		t.Fatalf("split plain command:%q %+v", inner, parent)
+	}
+}
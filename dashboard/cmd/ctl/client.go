@@ -0,0 +1,152 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/rpc"
+)
+
+// ApiClient talks to the dashboard api, it logs in with the admin account
+// before the first PUT since mutating calls are checked against the session.
+// With an api token it sends the token instead and never logs in.
+type ApiClient struct {
+	addr     string
+	xauth    string
+	username string
+	password string
+	token    string
+	dryRun   bool
+	login    bool
+	client   *http.Client
+}
+
+func NewApiClient(addr, product, username, password string) *ApiClient {
+	jar, _ := cookiejar.New(nil)
+	return &ApiClient{
+		addr:     addr,
+		xauth:    rpc.NewXAuth(product),
+		username: username,
+		password: password,
+		client:   &http.Client{Jar: jar, Timeout: time.Minute},
+	}
+}
+
+func (c *ApiClient) encodeURL(format string, args ...interface{}) string {
+	return rpc.EncodeURL(c.addr, format, args...)
+}
+
+func (c *ApiClient) Get(reply interface{}, format string, args ...interface{}) error {
+	return c.request(http.MethodGet, c.encodeURL(format, args...), nil, reply)
+}
+
+func (c *ApiClient) GetQuery(reply interface{}, query url.Values, format string, args ...interface{}) error {
+	u := c.encodeURL(format, args...)
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	return c.request(http.MethodGet, u, nil, reply)
+}
+
+// Put runs a mutating call, in dry run mode it only prints the call.
+func (c *ApiClient) Put(args, reply interface{}, format string, a ...interface{}) error {
+	u := c.encodeURL(format, a...)
+	if c.dryRun {
+		fmt.Printf("dry-run: PUT %s\n", strings.Replace(u, c.xauth, "{xauth}", 1))
+		return nil
+	}
+	if err := c.Login(); err != nil {
+		return err
+	}
+	var body []byte
+	if args != nil {
+		b, err := json.Marshal(args)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		body = b
+	}
+	return c.request(http.MethodPut, u, body, reply)
+}
+
+func (c *ApiClient) Login() error {
+	if c.login || c.username == "" || c.token != "" {
+		return nil
+	}
+	form := url.Values{"username": {c.username}, "password": {c.password}}
+	rsp, err := c.client.PostForm(c.encodeURL("/login"), form)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := decodeResponse(rsp, nil); err != nil {
+		return errors.Errorf("login as %s failed, %s", c.username, err)
+	}
+	c.login = true
+	return nil
+}
+
+func (c *ApiClient) request(method, u string, body []byte, reply interface{}) error {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return decodeResponse(rsp, reply)
+}
+
+func decodeResponse(rsp *http.Response, reply interface{}) error {
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch rsp.StatusCode {
+	case 200:
+		if reply == nil {
+			return nil
+		}
+		if err := json.Unmarshal(b, &rpc.ApiRes{Data: reply}); err != nil {
+			return errors.Trace(err)
+		}
+		return nil
+	case 800, 1500:
+		res := &rpc.ApiRes{}
+		if err := json.Unmarshal(b, res); err != nil || res.ErrMsg == nil {
+			return errors.Errorf("[%d] %s", rsp.StatusCode, bytes.TrimSpace(b))
+		}
+		return errors.New(res.ErrMsg.Cause)
+	default:
+		return errors.Errorf("[%d] %s - %s", rsp.StatusCode, http.StatusText(rsp.StatusCode), rsp.Request.URL.Path)
+	}
+}
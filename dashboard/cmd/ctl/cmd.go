@@ -0,0 +1,402 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/dashboard/dashcore"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+func (cmd *command) stats() (*dashcore.Stats, error) {
+	stats := &dashcore.Stats{}
+	if err := cmd.c.Get(stats, "/api/topom/stats/%s", cmd.c.xauth); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (cmd *command) slots() ([]*models.SlotMapping, error) {
+	var slots []*models.SlotMapping
+	if err := cmd.c.Get(&slots, "/api/topom/slots/%s", cmd.c.xauth); err != nil {
+		return nil, err
+	}
+	return slots, nil
+}
+
+func (cmd *command) group() error {
+	c, d := cmd.c, cmd.d
+	if d["list"].(bool) {
+		return cmd.groupList()
+	}
+	gid, err := cmd.int("<gid>")
+	if err != nil {
+		return err
+	}
+	addr := cmd.str("<addr>")
+	switch {
+	case d["create"].(bool):
+		err = c.Put(nil, nil, "/api/topom/group/create/%s/%d", c.xauth, gid)
+	case d["add"].(bool):
+		cloudtype := cmd.str("--cloudtype")
+		if cloudtype == "" {
+			return errors.New("option --cloudtype is required")
+		}
+		err = c.Put(nil, nil, "/api/topom/group/add/%s/%d/%s/%s/%s", c.xauth, gid, addr, cloudtype, cmd.str("--role"))
+	case d["promote"].(bool):
+		if err = c.Put(nil, nil, "/api/topom/group/promote/%s/%d/%s", c.xauth, gid, addr); err == nil && cmd.wait && !cmd.dryRun {
+			err = cmd.waitPromote(gid, addr)
+		}
+	case d["deraft"].(bool):
+		token := optionOrEnv(d, "<token>", "BITALOS_DERAFT_TOKEN")
+		if token == "" {
+			return errors.New("deraft token is required, set $BITALOS_DERAFT_TOKEN")
+		}
+		err = c.Put(nil, nil, "/api/topom/group/deraft/%s/%d/%s/%s", c.xauth, gid, addr, token)
+	case d["logcompact"].(bool):
+		err = c.Put(nil, nil, "/api/topom/group/logcompact/%s/%d", c.xauth, gid)
+	}
+	if err != nil || cmd.dryRun {
+		return err
+	}
+	cmd.p.Done("OK")
+	return nil
+}
+
+func (cmd *command) groupList() error {
+	stats, err := cmd.stats()
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, g := range stats.Group.Models {
+		for i, x := range g.Servers {
+			role := "slave"
+			if i == 0 {
+				role = "master"
+			}
+			rows = append(rows, []string{
+				strconv.Itoa(g.Id), x.Addr, role, x.ServerRole, x.CloudType, x.DataCenter, g.Promoting.State,
+				strconv.FormatBool(g.OutOfSync),
+			})
+		}
+	}
+	header := []string{"GID", "SERVER", "ROLE", "SERVER_ROLE", "CLOUDTYPE", "DATACENTER", "PROMOTING", "OUT_OF_SYNC"}
+	return cmd.p.Table(stats.Group.Models, header, rows)
+}
+
+// waitPromote waits until addr is the master of the group and the
+// promotion is over.
+func (cmd *command) waitPromote(gid int, addr string) error {
+	return cmd.poll(func() (bool, string, error) {
+		stats, err := cmd.stats()
+		if err != nil {
+			return false, "", err
+		}
+		for _, g := range stats.Group.Models {
+			if g.Id != gid {
+				continue
+			}
+			if g.Promoting.State == models.ActionNothing && len(g.Servers) != 0 && g.Servers[0].Addr == addr {
+				return true, "", nil
+			}
+			return false, fmt.Sprintf("group-[%d] promoting %s", gid, g.Promoting.State), nil
+		}
+		return false, "", errors.Errorf("group-[%d] doesn't exist", gid)
+	})
+}
+
+func (cmd *command) slot() error {
+	c, d := cmd.c, cmd.d
+	switch {
+	case d["list"].(bool):
+		return cmd.slotList()
+	case d["migrate-status"].(bool):
+		return cmd.slotMigrateStatus()
+	case d["rebalance"].(bool):
+		return cmd.slotRebalance()
+	}
+
+	beg, err := cmd.int("<begin>")
+	if err != nil {
+		return err
+	}
+	end, err := cmd.int("<end>")
+	if err != nil {
+		return err
+	}
+	gid, err := cmd.int("<gid>")
+	if err != nil {
+		return err
+	}
+	notMigrate := 0
+	if d["--not-migrate"].(bool) {
+		notMigrate = 1
+	}
+	if cmd.dryRun {
+		slots, err := cmd.slots()
+		if err != nil {
+			return err
+		}
+		var moves []int
+		for _, m := range slots {
+			if m.Id >= beg && m.Id <= end && m.GroupId != gid && m.Action.State == models.ActionNothing {
+				moves = append(moves, m.Id)
+			}
+		}
+		fmt.Printf("dry-run: %d slots of [%d,%d] would move to group-[%d]\n", len(moves), beg, end, gid)
+	}
+	if err := c.Put(nil, nil, "/api/topom/slots/action/create-range/%s/%d/%d/%d/%d", c.xauth, beg, end, gid, notMigrate); err != nil || cmd.dryRun {
+		return err
+	}
+	if cmd.wait {
+		var sids []int
+		for sid := beg; sid <= end; sid++ {
+			sids = append(sids, sid)
+		}
+		if err := cmd.waitSlots(sids); err != nil {
+			return err
+		}
+	}
+	cmd.p.Done("OK")
+	return nil
+}
+
+func (cmd *command) slotList() error {
+	slots, err := cmd.slots()
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for i := 0; i < len(slots); {
+		j := i
+		for j+1 < len(slots) && slots[j+1].GroupId == slots[i].GroupId && slots[j+1].Action == slots[i].Action {
+			j++
+		}
+		m := slots[i]
+		target := ""
+		if m.Action.State != models.ActionNothing {
+			target = strconv.Itoa(m.Action.TargetId)
+		}
+		rows = append(rows, []string{fmt.Sprintf("%d-%d", m.Id, slots[j].Id), strconv.Itoa(m.GroupId), m.Action.State, target})
+		i = j + 1
+	}
+	return cmd.p.Table(slots, []string{"SLOTS", "GID", "ACTION", "TARGET"}, rows)
+}
+
+func (cmd *command) slotMigrateStatus() error {
+	var list []*models.Migrate
+	if err := cmd.c.Get(&list, "/api/topom/migratelist/%s", cmd.c.xauth); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, m := range list {
+		row := []string{strconv.Itoa(m.SID), strconv.Itoa(m.SourceGroupID), strconv.Itoa(m.TargetGroupID), "", "", "", "", "", m.UpdateTime}
+		if st := m.Status; st != nil {
+			row[3] = strconv.Itoa(st.Status)
+			row[4] = strconv.FormatInt(st.Total, 10)
+			row[5] = strconv.FormatInt(st.Fails, 10)
+			row[6] = st.SuccPercent
+			row[7] = strconv.FormatBool(st.Paused)
+		}
+		rows = append(rows, row)
+	}
+	header := []string{"SID", "FROM", "TO", "STATUS", "TOTAL", "FAILS", "SUCC", "PAUSED", "UPDATE_TIME"}
+	return cmd.p.Table(list, header, rows)
+}
+
+// slotRebalance runs the load rebalance, in dry run mode it prints the plan
+// the dashboard would apply.
+func (cmd *command) slotRebalance() error {
+	c := cmd.c
+	plan := &dashcore.SlotsRebalancePlan{}
+	if cmd.dryRun {
+		if err := c.Get(plan, "/api/topom/slots/rebalance/%s", c.xauth); err != nil {
+			return err
+		}
+	} else if err := c.Put(nil, plan, "/api/topom/slots/rebalance/%s", c.xauth); err != nil {
+		return err
+	}
+
+	var sids []int
+	for sid := range plan.Plans {
+		sids = append(sids, sid)
+	}
+	sort.Ints(sids)
+	var rows [][]string
+	for _, sid := range sids {
+		rows = append(rows, []string{strconv.Itoa(sid), strconv.Itoa(plan.Plans[sid])})
+	}
+	if err := cmd.p.Table(plan, []string{"SID", "TARGET"}, rows); err != nil {
+		return err
+	}
+	if cmd.wait && !cmd.dryRun && len(sids) != 0 {
+		return cmd.waitSlots(sids)
+	}
+	return nil
+}
+
+// waitSlots waits until none of the slots has a pending or running action.
+func (cmd *command) waitSlots(sids []int) error {
+	wanted := make(map[int]bool, len(sids))
+	for _, sid := range sids {
+		wanted[sid] = true
+	}
+	return cmd.poll(func() (bool, string, error) {
+		slots, err := cmd.slots()
+		if err != nil {
+			return false, "", err
+		}
+		busy := 0
+		for _, m := range slots {
+			if wanted[m.Id] && m.Action.State != models.ActionNothing {
+				busy++
+			}
+		}
+		return busy == 0, fmt.Sprintf("%d/%d slots migrating", busy, len(sids)), nil
+	})
+}
+
+// pollInterval is how often --wait checks the dashboard.
+var pollInterval = 2 * time.Second
+
+func (cmd *command) poll(check func() (bool, string, error)) error {
+	deadline := time.Now().Add(cmd.timeout)
+	for {
+		done, progress, err := check()
+		if err != nil || done {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return errors.Errorf("wait timeout, %s", progress)
+		}
+		fmt.Fprintf(os.Stderr, "waiting: %s\n", progress)
+		time.Sleep(pollInterval)
+	}
+}
+
+func (cmd *command) proxy() error {
+	c, d := cmd.c, cmd.d
+	var err error
+	switch {
+	case d["list"].(bool):
+		return cmd.proxyList()
+	case d["online"].(bool):
+		err = c.Put(nil, nil, "/api/topom/proxy/online/%s/%s", c.xauth, cmd.str("<addr>"))
+	case d["reinit"].(bool):
+		err = c.Put(nil, nil, "/api/topom/proxy/reinit/%s/%s", c.xauth, cmd.str("<token>"))
+	}
+	if err != nil || cmd.dryRun {
+		return err
+	}
+	cmd.p.Done("OK")
+	return nil
+}
+
+func (cmd *command) proxyList() error {
+	stats, err := cmd.stats()
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, p := range stats.Proxy.Models {
+		rows = append(rows, []string{p.Token, p.AdminAddr, p.ProxyAddr, p.CloudType, p.StartTime})
+	}
+	return cmd.p.Table(stats.Proxy.Models, []string{"TOKEN", "ADMIN_ADDR", "PROXY_ADDR", "CLOUDTYPE", "START_TIME"}, rows)
+}
+
+func (cmd *command) pconfig() error {
+	c := cmd.c
+	if cmd.d["update"].(bool) {
+		b, err := os.ReadFile(cmd.str("<file>"))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		p := &models.Pconfig{}
+		if err := json.Unmarshal(b, p); err != nil {
+			return errors.Errorf("decode pconfig %s failed, %s", cmd.str("<file>"), err)
+		}
+		if err := c.Put(p, nil, "/api/topom/pconfig/update/%s", c.xauth); err != nil || cmd.dryRun {
+			return err
+		}
+		cmd.p.Done("pconfig-[%s] updated", p.Name)
+		return nil
+	}
+
+	var list []*models.Pconfig
+	if err := c.Get(&list, "/api/topom/pconfig/list/%s", c.xauth); err != nil {
+		return err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	if name := cmd.str("<name>"); name != "" {
+		for _, p := range list {
+			if p.Name == name {
+				return cmd.p.Json(p)
+			}
+		}
+		return errors.Errorf("pconfig-[%s] doesn't exist", name)
+	}
+	var rows [][]string
+	for _, p := range list {
+		var n int
+		if p.Content != nil {
+			n = len(p.Content.White) + len(p.Content.Black) + len(p.Content.WhitePrefixes) + len(p.Content.BlackPrefixes) +
+				len(p.Content.RateLimits) + len(p.Content.PrefixRules)
+		}
+		rows = append(rows, []string{p.Name, strings.TrimSpace(p.Remark), strconv.Itoa(n), strconv.FormatBool(p.OutOfSync)})
+	}
+	return cmd.p.Table(list, []string{"NAME", "REMARK", "ENTRIES", "OUT_OF_SYNC"}, rows)
+}
+
+func (cmd *command) compact() error {
+	c := cmd.c
+	if err := c.Put(nil, nil, "/api/topom/group/compact/%s/%s/%s", c.xauth, cmd.str("<addr>"), cmd.str("<dbtype>")); err != nil || cmd.dryRun {
+		return err
+	}
+	cmd.p.Done("OK")
+	return nil
+}
+
+func (cmd *command) audit() error {
+	q := url.Values{}
+	for _, name := range []string{"user", "endpoint", "result", "since", "until", "limit"} {
+		if v := cmd.str("--" + name); v != "" {
+			q.Set(name, v)
+		}
+	}
+	if err := cmd.c.Login(); err != nil {
+		return err
+	}
+	var records []*models.AuditRecord
+	if err := cmd.c.GetQuery(&records, q, "/api/audit/%s", cmd.c.xauth); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, r := range records {
+		rows = append(rows, []string{r.Time, r.User, r.SourceIP, r.Method, r.Endpoint, r.Result, r.Error, strconv.FormatInt(r.DurationMs, 10)})
+	}
+	return cmd.p.Table(records, []string{"TIME", "USER", "SOURCE_IP", "METHOD", "ENDPOINT", "RESULT", "ERROR", "DURATION_MS"}, rows)
+}
@@ -0,0 +1,218 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docopt/docopt-go"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/rpc"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+const testProduct = "demo"
+
+// fakeDashboard records the requests it gets as "METHOD path", with the
+// xauth of the path replaced by {xauth}.
+type fakeDashboard struct {
+	mu    sync.Mutex
+	reqs  []string
+	slots func(n int) []*models.SlotMapping
+	n     int
+}
+
+func (f *fakeDashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := strings.Replace(r.URL.Path, rpc.NewXAuth(testProduct), "{xauth}", 1)
+	f.reqs = append(f.reqs, r.Method+" "+path)
+
+	var data interface{}
+	if r.Method == http.MethodGet && strings.HasPrefix(path, "/api/topom/slots/") && f.slots != nil {
+		data = f.slots(f.n)
+		f.n++
+	}
+	json.NewEncoder(w).Encode(&rpc.ApiRes{Data: data})
+}
+
+func (f *fakeDashboard) requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.reqs...)
+}
+
+func runTestCommand(t *testing.T, f *fakeDashboard, args ...string) (string, error) {
+	t.Setenv("BITALOS_USERNAME", "")
+	t.Setenv("BITALOS_TOKEN", "")
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	argv := append([]string{"--dashboard=" + srv.Listener.Addr().String(), "--product=" + testProduct}, args...)
+	d, err := docopt.ParseArgs(usage, argv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := newCommand(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	cmd.p.w = out
+	err = cmd.run()
+	return out.String(), err
+}
+
+func testSlots(groups ...int) []*models.SlotMapping {
+	slots := make([]*models.SlotMapping, len(groups))
+	for i, gid := range groups {
+		slots[i] = &models.SlotMapping{Id: i, GroupId: gid}
+	}
+	return slots
+}
+
+func TestCtlRequests(t *testing.T) {
+	t.Setenv("BITALOS_DERAFT_TOKEN", "tk")
+	for _, c := range []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"group", "create", "3"}, "PUT /api/topom/group/create/{xauth}/3"},
+		{[]string{"group", "add", "3", "10.0.0.1:6001", "--cloudtype=cloud1"}, "PUT /api/topom/group/add/{xauth}/3/10.0.0.1:6001/cloud1/master_slave_node"},
+		{[]string{"group", "promote", "3", "10.0.0.1:6001"}, "PUT /api/topom/group/promote/{xauth}/3/10.0.0.1:6001"},
+		{[]string{"group", "deraft", "3", "10.0.0.1:6001"}, "PUT /api/topom/group/deraft/{xauth}/3/10.0.0.1:6001/tk"},
+		{[]string{"group", "logcompact", "3"}, "PUT /api/topom/group/logcompact/{xauth}/3"},
+		{[]string{"slot", "assign", "0", "9", "3", "--not-migrate"}, "PUT /api/topom/slots/action/create-range/{xauth}/0/9/3/1"},
+		{[]string{"proxy", "online", "10.0.0.2:7001"}, "PUT /api/topom/proxy/online/{xauth}/10.0.0.2:7001"},
+		{[]string{"compact", "10.0.0.1:6001", "string"}, "PUT /api/topom/group/compact/{xauth}/10.0.0.1:6001/string"},
+		{[]string{"audit", "--user=u"}, "GET /api/audit/{xauth}"},
+	} {
+		f := &fakeDashboard{}
+		if _, err := runTestCommand(t, f, c.args...); err != nil {
+			t.Fatalf("%v: %s", c.args, err)
+		}
+		if reqs := f.requests(); len(reqs) != 1 || reqs[0] != c.expect {
+			t.Fatalf("%v: requests %v, want %s", c.args, reqs, c.expect)
+		}
+	}
+
+	f := &fakeDashboard{}
+	if _, err := runTestCommand(t, f, "--username=admin", "--password=pw", "group", "create", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if reqs := f.requests(); len(reqs) != 2 || reqs[0] != "POST /login" {
+		t.Fatalf("login not sent before the PUT: %v", reqs)
+	}
+
+	t.Setenv("BITALOS_DERAFT_TOKEN", "")
+	f = &fakeDashboard{}
+	if _, err := runTestCommand(t, f, "group", "deraft", "3", "10.0.0.1:6001"); err == nil || len(f.requests()) != 0 {
+		t.Fatalf("deraft without token err:%v requests:%v", err, f.requests())
+	}
+}
+
+func TestCtlDryRun(t *testing.T) {
+	f := &fakeDashboard{slots: func(int) []*models.SlotMapping { return testSlots(1, 1, 3) }}
+	for _, args := range [][]string{
+		{"--dry-run", "group", "create", "3"},
+		{"--dry-run", "--wait", "slot", "assign", "0", "2", "3"},
+		{"--dry-run", "--username=admin", "proxy", "online", "10.0.0.2:7001"},
+	} {
+		if _, err := runTestCommand(t, f, args...); err != nil {
+			t.Fatalf("%v: %s", args, err)
+		}
+	}
+	for _, req := range f.requests() {
+		if !strings.HasPrefix(req, http.MethodGet+" ") {
+			t.Fatalf("dry run sent %s", req)
+		}
+	}
+}
+
+func TestCtlWait(t *testing.T) {
+	defer func(d time.Duration) { pollInterval = d }(pollInterval)
+	pollInterval = time.Millisecond
+
+	f := &fakeDashboard{slots: func(n int) []*models.SlotMapping {
+		slots := testSlots(1, 1, 3)
+		if n < 2 {
+			slots[0].Action.State = models.ActionMigrating
+			slots[1].Action.State = models.ActionPending
+		}
+		return slots
+	}}
+	out, err := runTestCommand(t, f, "--wait", "slot", "assign", "0", "1", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs := f.requests()
+	if len(reqs) != 4 || reqs[0] != "PUT /api/topom/slots/action/create-range/{xauth}/0/1/3/0" || reqs[3] != "GET /api/topom/slots/{xauth}" {
+		t.Fatalf("unexpected requests %v", reqs)
+	}
+	if strings.TrimSpace(out) != "OK" {
+		t.Fatalf("unexpected output %q", out)
+	}
+
+	f = &fakeDashboard{slots: func(int) []*models.SlotMapping {
+		slots := testSlots(1)
+		slots[0].Action.State = models.ActionMigrating
+		return slots
+	}}
+	if _, err = runTestCommand(t, f, "--wait", "--timeout=1", "slot", "assign", "0", "0", "3"); err == nil || !strings.Contains(err.Error(), "wait timeout") {
+		t.Fatalf("wait err:%v, want a timeout", err)
+	}
+}
+
+func TestCtlOutput(t *testing.T) {
+	f := &fakeDashboard{slots: func(int) []*models.SlotMapping { return testSlots(1, 1, 3) }}
+	out, err := runTestCommand(t, f, "slot", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || strings.Fields(lines[0])[0] != "SLOTS" {
+		t.Fatalf("unexpected table %q", out)
+	}
+	if fields := strings.Fields(lines[1]); len(fields) != 2 || fields[0] != "0-1" || fields[1] != "1" {
+		t.Fatalf("unexpected row %q", lines[1])
+	}
+
+	out, err = runTestCommand(t, f, "--output=json", "slot", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slots []*models.SlotMapping
+	if err = json.Unmarshal([]byte(out), &slots); err != nil {
+		t.Fatalf("decode %q: %s", out, err)
+	}
+	if len(slots) != 3 || slots[2].GroupId != 3 {
+		t.Fatalf("unexpected json %q", out)
+	}
+
+	out, err = runTestCommand(t, f, "--output=json", "group", "create", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(strings.Fields(out), "") != `{"result":"OK"}` {
+		t.Fatalf("unexpected json result %q", out)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/docopt/docopt-go"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/utils"
+)
+
+const usage = `
+Usage:
+	bitalosctl [options] group list
+	bitalosctl [options] group create <gid>
+	bitalosctl [options] group add <gid> <addr> [--cloudtype=CLOUD] [--role=ROLE]
+	bitalosctl [options] group promote <gid> <addr>
+	bitalosctl [options] group deraft <gid> <addr> [<token>]
+	bitalosctl [options] group logcompact <gid>
+	bitalosctl [options] slot list
+	bitalosctl [options] slot assign <begin> <end> <gid> [--not-migrate]
+	bitalosctl [options] slot rebalance
+	bitalosctl [options] slot migrate-status
+	bitalosctl [options] proxy list
+	bitalosctl [options] proxy online <addr>
+	bitalosctl [options] proxy reinit <token>
+	bitalosctl [options] pconfig get [<name>]
+	bitalosctl [options] pconfig update <file>
+	bitalosctl [options] compact <addr> <dbtype>
+	bitalosctl [options] audit [--user=USER] [--endpoint=PATH] [--result=RESULT] [--since=TIME] [--until=TIME] [--limit=N]
+	bitalosctl --version
+
+Options:
+	--dashboard=ADDR      set the dashboard admin address, default is $BITALOS_DASHBOARD.
+	--product=NAME        set the product name, default is $BITALOS_PRODUCT.
+	--username=USER       set the admin username used by mutating commands, default is $BITALOS_USERNAME.
+	--password=PASS       set the admin password, default is $BITALOS_PASSWORD.
+	--token=TOKEN         use an api token instead of the admin account, default is $BITALOS_TOKEN.
+	--output=FORMAT       print results as table or json [default: table].
+	--wait                wait until slot migrations or a promotion finish.
+	--timeout=SECONDS     give up waiting after SECONDS [default: 600].
+	--dry-run             print the changes instead of applying them.
+	--cloudtype=CLOUD     set the cloudtype of the added server.
+	--role=ROLE           set the server_role of the added server [default: master_slave_node].
+	--not-migrate         assign the slots without migrating their data.
+	--user=USER           list the audit records of USER.
+	--endpoint=PATH       list the audit records of endpoints containing PATH.
+	--result=RESULT       list the audit records whose result is ok or error.
+	--since=TIME          list the audit records since TIME, unix seconds or "2006-01-02 15:04:05".
+	--until=TIME          list the audit records until TIME.
+	--limit=N             list at most N audit records [default: 100].
+
+Secrets:
+	Arguments are visible in the process list and the shell history, prefer
+	$BITALOS_PASSWORD and $BITALOS_TOKEN to --password and --token. The token of
+	group deraft defaults to $BITALOS_DERAFT_TOKEN and is best left out of argv.
+`
+
+type command struct {
+	c       *ApiClient
+	p       *printer
+	d       map[string]interface{}
+	wait    bool
+	dryRun  bool
+	timeout time.Duration
+}
+
+func main() {
+	d, err := docopt.ParseArgs(usage, nil, "")
+	if err != nil {
+		fatal(err)
+	}
+	if d["--version"].(bool) {
+		fmt.Println("version:", utils.Version)
+		fmt.Println("compile:", utils.Compile)
+		return
+	}
+
+	cmd, err := newCommand(d)
+	if err != nil {
+		fatal(err)
+	}
+	if err = cmd.run(); err != nil {
+		fatal(err)
+	}
+}
+
+func newCommand(d map[string]interface{}) (*command, error) {
+	addr := optionOrEnv(d, "--dashboard", "BITALOS_DASHBOARD")
+	product := optionOrEnv(d, "--product", "BITALOS_PRODUCT")
+	if addr == "" || product == "" {
+		return nil, errors.New("both --dashboard and --product are required")
+	}
+	cmd := &command{
+		c:      NewApiClient(addr, product, optionOrEnv(d, "--username", "BITALOS_USERNAME"), optionOrEnv(d, "--password", "BITALOS_PASSWORD")),
+		d:      d,
+		wait:   d["--wait"].(bool),
+		dryRun: d["--dry-run"].(bool),
+	}
+	cmd.c.dryRun = cmd.dryRun
+	cmd.c.token = optionOrEnv(d, "--token", "BITALOS_TOKEN")
+	switch s, _ := d["--output"].(string); s {
+	case "table":
+		cmd.p = &printer{w: os.Stdout}
+	case "json":
+		cmd.p = &printer{w: os.Stdout, json: true}
+	default:
+		return nil, errors.Errorf("invalid --output = %s", s)
+	}
+	n, err := strconv.Atoi(d["--timeout"].(string))
+	if err != nil || n <= 0 {
+		return nil, errors.Errorf("invalid --timeout = %v", d["--timeout"])
+	}
+	cmd.timeout = time.Duration(n) * time.Second
+	return cmd, nil
+}
+
+func (cmd *command) run() (err error) {
+	d := cmd.d
+	switch {
+	case d["group"].(bool):
+		err = cmd.group()
+	case d["slot"].(bool):
+		err = cmd.slot()
+	case d["proxy"].(bool):
+		err = cmd.proxy()
+	case d["pconfig"].(bool):
+		err = cmd.pconfig()
+	case d["compact"].(bool):
+		err = cmd.compact()
+	case d["audit"].(bool):
+		err = cmd.audit()
+	}
+	return err
+}
+
+func optionOrEnv(d map[string]interface{}, name, env string) string {
+	if s, ok := d[name].(string); ok && s != "" {
+		return s
+	}
+	return os.Getenv(env)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+func (cmd *command) str(name string) string {
+	s, _ := cmd.d[name].(string)
+	return s
+}
+
+func (cmd *command) int(name string) (int, error) {
+	n, err := strconv.Atoi(cmd.str(name))
+	if err != nil {
+		return 0, errors.Errorf("invalid %s = %s", name, cmd.str(name))
+	}
+	return n, nil
+}
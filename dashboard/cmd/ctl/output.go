@@ -0,0 +1,59 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// printer writes the result of a command as a table or, with --output=json,
+// as the indented json of the api data.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func (p *printer) Table(data interface{}, header []string, rows [][]string) error {
+	if p.json {
+		return p.Json(data)
+	}
+	w := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+func (p *printer) Json(data interface{}) error {
+	b, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(p.w, string(b))
+	return nil
+}
+
+func (p *printer) Done(msg string, args ...interface{}) {
+	if p.json {
+		p.Json(map[string]string{"result": fmt.Sprintf(msg, args...)})
+		return
+	}
+	fmt.Fprintf(p.w, msg+"\n", args...)
+}
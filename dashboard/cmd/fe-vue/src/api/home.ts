@@ -9,7 +9,9 @@ import {
   MigrateSome,
   PcConfigItem,
   ProxyModels,
-  Enable
+  Enable,
+  SlotStatsReport,
+  SlotsRebalancePlan
 } from '../interfaces/home'
 import { getBitalosproxyName, getBitalosproxyXName, getXAuth } from '../commons'
 import { ajax, ajaxGet, ajaxPut } from './index'
@@ -32,6 +34,7 @@ export const bindDepartment = (value) => ajaxPut(`/api/topom/department/${getXAu
 export const addProxy = (ip: string, type: string) => ajaxPut(`/api/topom/proxy/create/${getBitalosproxyXName()}/${ip}/${type}?forward=${getBitalosproxyName()}`)
 export const deleteProxy = (proxy: ProxyModels) => ajaxPut(`/api/topom/proxy/remove/${getBitalosproxyXName()}/${proxy.token}/0?forward=${getBitalosproxyName()}`)
 export const syncProxy = (proxy: ProxyModels) => ajaxPut(`/api/topom/proxy/reinit/${getBitalosproxyXName()}/${proxy.token}?forward=${getBitalosproxyName()}`)
+export const reloadProxy = (proxy: ProxyModels) => ajaxPut(`/api/topom/proxy/reloadconfig/${getBitalosproxyXName()}/${proxy.token}?forward=${getBitalosproxyName()}`)
 export const forceDel = (proxy: ProxyModels) => ajaxPut(`/api/topom/proxy/remove/${getBitalosproxyXName()}/${proxy.token}/1?forward=${getBitalosproxyName()}`)
 export const hotkeys = () => ajaxGet<CommonResponse<any>>(`/api/topom/proxy/stat/${getXAuth(getBitalosproxyName())}/hotkeys?forward=${getBitalosproxyName()}`)
 export const slowkeys = () => ajaxGet<CommonResponse<any>>(`/api/topom/proxy/stat/${getXAuth(getBitalosproxyName())}/slowkeys?forward=${getBitalosproxyName()}`)
@@ -42,6 +45,9 @@ export const getLog = (address, ip, query, queryTime) => ajax.post(`http://${ip}
 export const createRange = ({ from, to, group, migrate }: MigrateRange) => ajaxPut(`/api/topom/slots/action/create-range/${getBitalosproxyXName()}/${from}/${to}/${group}/${migrate}?forward=${getBitalosproxyName()}`)
 export const createSome = ({ from, to, slots }: MigrateSome) => ajaxPut(`/api/topom/slots/action/create-some/${getBitalosproxyXName()}/${from}/${to}/${slots}?forward=${getBitalosproxyName()}`)
 export const initSlots = () => ajaxPut(`/api/topom/slots/action/create/init/${getXAuth(getBitalosproxyName())}?forward=${getBitalosproxyName()}`)
+export const getSlotStats = () => ajaxGet<CommonResponse<SlotStatsReport>>(`/api/topom/slots/stats/${getBitalosproxyXName()}?forward=${getBitalosproxyName()}`)
+export const getRebalancePlan = () => ajaxGet<CommonResponse<SlotsRebalancePlan>>(`/api/topom/slots/rebalance/${getBitalosproxyXName()}?forward=${getBitalosproxyName()}`)
+export const applyRebalancePlan = () => ajaxPut(`/api/topom/slots/rebalance/${getBitalosproxyXName()}?forward=${getBitalosproxyName()}`)
 export const searchSlot = key => ajax(`/api/topom/tools/whichgroupkey/${key}?forward=${getBitalosproxyName()}`)
 
 // group
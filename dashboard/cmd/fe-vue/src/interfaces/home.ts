@@ -312,3 +312,24 @@ export interface MigrateTableItem {
   total: number
   unixtime: number
 }
+
+export interface SlotStatsItem {
+  id: number
+  group_id: number
+  keys: number
+  bytes: number
+  read_qps: number
+  write_qps: number
+}
+
+export interface SlotStatsReport {
+  slots: SlotStatsItem[]
+  groups: { [gid: string]: { slots: number, keys: number, bytes: number, read_qps: number, write_qps: number } }
+  errors?: { [addr: string]: string }
+}
+
+export interface SlotsRebalancePlan {
+  plans: { [sid: string]: number }
+  before: { [gid: string]: number }
+  after: { [gid: string]: number }
+}
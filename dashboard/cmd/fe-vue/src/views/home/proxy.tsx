@@ -1,6 +1,6 @@
 import Vue from 'vue'
 import { CLOUD_TYPE_LIST } from '@/constant'
-import { addProxy, deleteProxy, syncProxy, forceDel, hotkeys, slowkeys, crossCloud } from '@/api'
+import { addProxy, deleteProxy, syncProxy, reloadProxy, forceDel, hotkeys, slowkeys, crossCloud } from '@/api'
 import AppMenu from '@/components/app-menu'
 import AppModal from '@/components/app-modal'
 import { ProxyModels } from '@/interfaces/home'
@@ -113,6 +113,13 @@ export default Vue.extend({
                 activator={(on) => <v-btn x-small color='success' onclick={on.click}>sync</v-btn>}
               />
 
+              <delete-menu
+                title={`Reload config file of proxy:`}
+                content={<pre>{JSON.stringify(i, null, 2)}</pre>}
+                onconfirm={() => this.onReload(i)}
+                activator={(on) => <v-btn x-small class='ml-1' color='primary' onclick={on.click}>reload</v-btn>}
+              />
+
               <delete-menu
                 item={i}
                 onconfirm={this.onConfirmDeleteProxy}
@@ -176,6 +183,10 @@ export default Vue.extend({
       await syncProxy(item)
       this.$emit('update')
     },
+    async onReload(item) {
+      await reloadProxy(item)
+      this.$emit('update')
+    },
     async onConfirmDeleteProxy(item: ProxyModels) {
       await deleteProxy(item)
       this.$emit('update')
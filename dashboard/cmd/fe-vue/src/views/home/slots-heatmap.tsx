@@ -0,0 +1,122 @@
+import {Vue, Component, Emit} from 'vue-property-decorator'
+import {SlotStatsItem, SlotsRebalancePlan} from '@/interfaces/home'
+import {getSlotStats, getRebalancePlan, applyRebalancePlan} from '@/api'
+
+const metrics = [
+  {text: 'Bytes', value: 'bytes'},
+  {text: 'Keys', value: 'keys'},
+  {text: 'Read QPS', value: 'read_qps'},
+  {text: 'Write QPS', value: 'write_qps'},
+]
+
+const percent = (v: number) => (v * 100).toFixed(1) + '%'
+
+@Component
+export default class SlotsHeatmap extends Vue {
+  metric = 'bytes'
+  slots: SlotStatsItem[] = []
+  errors: { [addr: string]: string } = {}
+  plan: SlotsRebalancePlan | null = null
+  dialog = false
+
+  mounted() {
+    this.refresh()
+  }
+
+  async refresh() {
+    const res = await getSlotStats()
+    if (res && res.data && res.data.data) {
+      this.slots = res.data.data.slots || []
+      this.errors = res.data.data.errors || {}
+    }
+  }
+
+  async showPlan() {
+    const res = await getRebalancePlan()
+    if (res && res.data && res.data.data) {
+      this.plan = res.data.data
+      this.dialog = true
+    }
+  }
+
+  @Emit('update')
+  async applyPlan() {
+    this.dialog = false
+    await applyRebalancePlan()
+  }
+
+  render() {
+    return <v-card-text class='pt-0'>
+      <v-layout class='align-center'>
+        <v-flex shrink class='pr-2'>
+          <v-select
+            dense
+            outlined
+            hide-details
+            items={metrics}
+            value={this.metric}
+            oninput={(val: string) => this.metric = val}
+          />
+        </v-flex>
+        <v-flex shrink class='pr-2'>
+          <v-btn onclick={this.refresh}>refresh</v-btn>
+        </v-flex>
+        <v-flex shrink>
+          <v-btn color='primary' onclick={this.showPlan}>rebalance by load</v-btn>
+        </v-flex>
+      </v-layout>
+      {Object.keys(this.errors).map((addr) => <div class='error--text'>{addr}: {this.errors[addr]}</div>)}
+      {this.genHeatmap()}
+      {this.genPlanDialog()}
+    </v-card-text>
+  }
+
+  genHeatmap() {
+    const {metric, maxValue} = this
+    return <div class='mt-3' style={{display: 'grid', gridTemplateColumns: 'repeat(64, 1fr)', gap: '1px'}}>
+      {this.slots.map((i) => {
+        const v = i[metric] || 0
+        const alpha = maxValue > 0 ? 0.05 + 0.95 * v / maxValue : 0.05
+        return <div
+          title={`Slot: ${i.id}\nGroup: ${i.group_id}\nKeys: ${i.keys}\nBytes: ${i.bytes}\nRead QPS: ${i.read_qps}\nWrite QPS: ${i.write_qps}`}
+          style={{height: '12px', backgroundColor: `rgba(211, 47, 47, ${alpha})`}}
+        />
+      })}
+    </div>
+  }
+
+  genPlanDialog() {
+    const {plan} = this
+    return <v-dialog v-model={this.dialog} width='500'>
+      <v-card>
+        <v-card-title>Rebalance Plan</v-card-title>
+        <v-card-text>
+          {plan && <div>
+            Moves: {Object.keys(plan.plans).length}
+            <v-simple-table dense>
+              <thead>
+              <tr><th>Group</th><th>Load Before</th><th>Load After</th></tr>
+              </thead>
+              <tbody>
+              {Object.keys(plan.before).map((gid) => <tr>
+                <td>{gid}</td>
+                <td>{percent(plan.before[gid])}</td>
+                <td>{percent(plan.after[gid])}</td>
+              </tr>)}
+              </tbody>
+            </v-simple-table>
+          </div>}
+        </v-card-text>
+        <v-card-actions>
+          <v-spacer/>
+          <v-btn onclick={() => this.dialog = false}>cancel</v-btn>
+          <v-btn color='primary' disabled={!plan || Object.keys(plan.plans).length === 0} onclick={this.applyPlan}>apply</v-btn>
+        </v-card-actions>
+      </v-card>
+    </v-dialog>
+  }
+
+  get maxValue() {
+    return this.slots.reduce((max, i) => Math.max(max, i[this.metric] || 0), 0)
+  }
+}
@@ -233,7 +233,7 @@ Options:
 		path := req.URL.Path
 		name := req.URL.Query().Get("forward")
 		if len(name) == 0 {
-			if strings.Contains(path, "/admin") || strings.HasPrefix(path, "/login") || strings.HasPrefix(path, "/logout") {
+			if strings.Contains(path, "/admin") || strings.HasPrefix(path, "/login") || strings.HasPrefix(path, "/logout") || strings.HasPrefix(path, "/oidc/") {
 				names := router.GetNames()
 				sort.Sort(sort.StringSlice(names))
 				if len(names) > 0 {
@@ -16,11 +16,14 @@ package dashcore
 
 import (
 	"bytes"
+	"net"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 
 	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
 	"github.com/zuoyebang/bitalostored/dashboard/internal/log"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
 )
 
 const DefaultConfig = `
@@ -45,6 +48,57 @@ admin_addr = "0.0.0.0:18080"
 # Set Stored raft
 admin_model  = "raft"
 
+# Set how many slots of a group migrate at the same time.
+migrate_slots_per_group = 4
+
+# Trust X-Real-IP and X-Forwarded-For only on requests from these addresses or
+# CIDRs, the audit log records the client behind such a proxy.
+trusted_proxies = []
+
+# Move raft leaders so every machine leads about as many groups, dry_run only
+# logs the transfers. A round starts every interval seconds and transfers at
+# most max_transfers leaders, transfer_interval seconds apart. Servers of the
+# preferred datacenter (or cloudtype) and servers in preferred_leaders lead
+# their group first.
+[leader_balance]
+enabled = false
+dry_run = true
+interval = 60
+max_transfers = 1
+transfer_interval = 10
+datacenter = ""
+preferred_leaders = []
+
+# Check admin passwords against the admin table ("local") or with an LDAP
+# simple bind of bind_dn, where %s is the username ("ldap"). An ldap or oidc
+# user alice has the role of the admin named ldap:alice or oidc:alice, never
+# the one of the local admin alice, else default_role (1 super, 2 op, 3 read).
+# A login lasts session_ttl seconds.
+[auth]
+provider = "local"
+default_role = 3
+session_ttl = 43200
+# Sign and encrypt the session cookie with this secret, shared by every
+# dashboard behind the same address. A random one ends the logins on restart.
+session_secret = ""
+
+[auth.ldap]
+addr = ""
+tls = false
+bind_dn = "uid=%s,ou=people,dc=example,dc=com"
+timeout = 5
+
+# Single sign-on at /oidc/login with the authorization code flow of the
+# issuer, redirect_url must point to /oidc/callback of this dashboard. The
+# username is username_claim alone, an "email" claim has to be verified.
+[auth.oidc]
+enabled = false
+issuer = ""
+client_id = ""
+client_secret = ""
+redirect_url = ""
+username_claim = "preferred_username"
+
 [database]
 username = "demo"
 password = "demo"
@@ -63,6 +117,15 @@ type Config struct {
 
 	ReadCrossCloud int `toml:"read_cross_cloud" json:"read_cross_cloud"`
 
+	MigrateSlotsPerGroup int `toml:"migrate_slots_per_group" json:"migrate_slots_per_group"`
+
+	LeaderBalance LeaderBalanceConfig `toml:"leader_balance" json:"leader_balance"`
+
+	Auth AuthConfig `toml:"auth" json:"auth"`
+
+	TrustedProxies []string `toml:"trusted_proxies" json:"trusted_proxies"`
+	trustedProxies []*net.IPNet
+
 	ProductName string   `toml:"product_name" json:"product_name"`
 	ProductAuth string   `toml:"product_auth" json:"product_auth"`
 	Database    DBConfig `toml:"database"`
@@ -111,9 +174,144 @@ func (c *Config) Validate() error {
 	if c.AdminModel != "raft" {
 		return errors.New("invalid admin model raft")
 	}
+	if c.MigrateSlotsPerGroup < 0 {
+		return errors.New("invalid migrate_slots_per_group")
+	} else if c.MigrateSlotsPerGroup == 0 {
+		c.MigrateSlotsPerGroup = 1
+	}
+	if c.LeaderBalance.Interval < 0 {
+		return errors.New("invalid leader_balance.interval")
+	} else if c.LeaderBalance.Interval == 0 {
+		c.LeaderBalance.Interval = 60
+	}
+	if c.LeaderBalance.MaxTransfers < 0 {
+		return errors.New("invalid leader_balance.max_transfers")
+	} else if c.LeaderBalance.MaxTransfers == 0 {
+		c.LeaderBalance.MaxTransfers = 1
+	}
+	if c.LeaderBalance.TransferInterval < 0 {
+		return errors.New("invalid leader_balance.transfer_interval")
+	}
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
+	proxies, err := parseTrustedProxies(c.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	c.trustedProxies = proxies
+	return nil
+}
+
+// parseTrustedProxies parses addresses and CIDRs, an address is a network of
+// its own.
+func parseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range list {
+		if _, n, err := net.ParseCIDR(s); err == nil {
+			nets = append(nets, n)
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.Errorf("invalid trusted_proxies = %s", s)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
+
+func (c *Config) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	for _, n := range c.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *AuthConfig) validate() error {
+	switch c.Provider {
+	case "":
+		c.Provider = AuthProviderLocal
+	case AuthProviderLocal:
+	case AuthProviderLdap:
+		if c.Ldap.Addr == "" {
+			return errors.New("invalid auth.ldap.addr")
+		}
+		if !strings.Contains(c.Ldap.BindDN, "%s") {
+			return errors.New("invalid auth.ldap.bind_dn, missing %s")
+		}
+	default:
+		return errors.Errorf("invalid auth.provider = %s", c.Provider)
+	}
+	if c.DefaultRole == 0 {
+		c.DefaultRole = models.READADMIN
+	} else if c.DefaultRole < models.SUPERADMIN || c.DefaultRole > models.READADMIN {
+		return errors.New("invalid auth.default_role")
+	}
+	if c.SessionTTL < 0 {
+		return errors.New("invalid auth.session_ttl")
+	} else if c.SessionTTL == 0 {
+		c.SessionTTL = 43200
+	}
+	if c.Ldap.Timeout <= 0 {
+		c.Ldap.Timeout = 5
+	}
+	if c.Oidc.Enabled {
+		if c.Oidc.Issuer == "" || c.Oidc.ClientId == "" || c.Oidc.RedirectURL == "" {
+			return errors.New("invalid auth.oidc, issuer, client_id and redirect_url are required")
+		}
+		if c.Oidc.UsernameClaim == "" {
+			c.Oidc.UsernameClaim = "preferred_username"
+		}
+	}
 	return nil
 }
 
+type AuthConfig struct {
+	Provider      string           `toml:"provider" json:"provider"`
+	DefaultRole   models.AdminRole `toml:"default_role" json:"default_role"`
+	SessionTTL    int64            `toml:"session_ttl" json:"session_ttl"`
+	SessionSecret string           `toml:"session_secret" json:"-"`
+	Ldap          LdapConfig       `toml:"ldap" json:"ldap"`
+	Oidc          OidcConfig       `toml:"oidc" json:"oidc"`
+}
+
+type LdapConfig struct {
+	Addr    string `toml:"addr" json:"addr"`
+	TLS     bool   `toml:"tls" json:"tls"`
+	BindDN  string `toml:"bind_dn" json:"bind_dn"`
+	Timeout int    `toml:"timeout" json:"timeout"`
+}
+
+type OidcConfig struct {
+	Enabled       bool   `toml:"enabled" json:"enabled"`
+	Issuer        string `toml:"issuer" json:"issuer"`
+	ClientId      string `toml:"client_id" json:"client_id"`
+	ClientSecret  string `toml:"client_secret" json:"-"`
+	RedirectURL   string `toml:"redirect_url" json:"redirect_url"`
+	UsernameClaim string `toml:"username_claim" json:"username_claim"`
+}
+
+type LeaderBalanceConfig struct {
+	Enabled          bool     `toml:"enabled" json:"enabled"`
+	DryRun           bool     `toml:"dry_run" json:"dry_run"`
+	Interval         int      `toml:"interval" json:"interval"`
+	MaxTransfers     int      `toml:"max_transfers" json:"max_transfers"`
+	TransferInterval int      `toml:"transfer_interval" json:"transfer_interval"`
+	DataCenter       string   `toml:"datacenter" json:"datacenter"`
+	PreferredLeaders []string `toml:"preferred_leaders" json:"preferred_leaders"`
+}
+
 type DBConfig struct {
 	Username string `toml:"username"`
 	Password string `toml:"password"`
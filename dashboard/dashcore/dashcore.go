@@ -84,6 +84,24 @@ type DashCore struct {
 		masters map[int]string
 	}
 
+	leader struct {
+		running atomic2.Bool
+	}
+
+	topology struct {
+		running atomic2.Bool
+	}
+
+	audit struct {
+		seq atomic2.Int64
+	}
+
+	auth struct {
+		provider AuthProvider
+		oidc     *oidcProvider
+		secret   []byte
+	}
+
 	groupsyncStats   map[int][]error
 	forceRefillCache atomic2.Int64
 }
@@ -129,6 +147,16 @@ func New(client models.Client, config *Config) (*DashCore, error) {
 	}
 	s.store = models.NewStore(client, config.ProductName)
 
+	s.auth.provider = newAuthProvider(s, &config.Auth)
+	if config.Auth.Oidc.Enabled {
+		s.auth.oidc = newOidcProvider(&config.Auth.Oidc)
+	}
+	secret, err := newSessionSecret(config.Auth.SessionSecret)
+	if err != nil {
+		return nil, err
+	}
+	s.auth.secret = secret
+
 	s.stats.redisp = uredis.NewPool(config.ProductAuth, time.Minute*10)
 	s.stats.servers = make(map[string]*RedisStats)
 	s.stats.proxies = make(map[string]*ProxyStats)
@@ -229,8 +257,10 @@ func (s *DashCore) Start(routines bool) error {
 	go func() {
 		s.InitDefaultPconfig()
 	}()
+	go s.migrateAdminPasswords()
 
 	s.crontabCheckMasterByRaft()
+	s.crontabLeaderBalance()
 
 	go func() {
 		for !s.IsClosed() {
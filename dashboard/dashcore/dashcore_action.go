@@ -17,58 +17,80 @@ package dashcore
 import (
 	"errors"
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/zuoyebang/bitalostored/butils"
-	"github.com/zuoyebang/bitalostored/dashboard/internal/sync2"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/uredis"
 
 	"github.com/zuoyebang/bitalostored/butils/math2"
 	"github.com/zuoyebang/bitalostored/dashboard/internal/log"
 	"github.com/zuoyebang/bitalostored/dashboard/models"
 )
 
+const slotActionParallel = 36
+
+// ProcessSlotAction keeps up to migrate_slots_per_group slots of every group
+// in flight, a slot is scheduled as soon as another one of its groups is done.
 func (s *DashCore) ProcessSlotAction() error {
-	for s.IsOnline() {
-		var (
-			marks = make(map[int]bool)
-			plans = make(map[int]bool)
-		)
-		var accept = func(m *models.SlotMapping) bool {
-			if marks[m.GroupId] || marks[m.Action.TargetId] {
-				return false
-			}
-			if plans[m.Id] {
-				return false
-			}
-			return true
+	type slotActionResult struct {
+		sid int
+		err error
+	}
+
+	var (
+		perGroup = math2.MaxInt(1, s.config.MigrateSlotsPerGroup)
+		groups   = make(map[int]int)
+		plans    = make(map[int][2]int)
+		picked   = -1
+		done     = make(chan slotActionResult)
+		firstErr error
+	)
+	var accept = func(m *models.SlotMapping) bool {
+		if groups[m.GroupId] >= perGroup || groups[m.Action.TargetId] >= perGroup {
+			return false
 		}
-		var update = func(m *models.SlotMapping) bool {
-			if m.GroupId != 0 {
-				marks[m.GroupId] = true
-			}
-			marks[m.Action.TargetId] = true
-			plans[m.Id] = true
-			return true
+		if _, ok := plans[m.Id]; ok {
+			return false
 		}
-		var parallel = math2.MaxInt(1, 36)
-		for parallel > len(plans) {
-			_, ok, err := s.SlotActionPrepareFilter(accept, update)
+		return true
+	}
+	var update = func(m *models.SlotMapping) bool {
+		if m.GroupId != 0 {
+			groups[m.GroupId]++
+		}
+		groups[m.Action.TargetId]++
+		plans[m.Id] = [2]int{m.GroupId, m.Action.TargetId}
+		picked = m.Id
+		return true
+	}
+	var release = func(sid int) {
+		gids, ok := plans[sid]
+		if !ok {
+			return
+		}
+		if gids[0] != 0 {
+			groups[gids[0]]--
+		}
+		groups[gids[1]]--
+		delete(plans, sid)
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		for firstErr == nil && s.IsOnline() && len(plans) < slotActionParallel {
+			picked = -1
+			sid, ok, err := s.SlotActionPrepareFilter(accept, update)
 			if err != nil {
-				return err
+				release(picked)
+				firstErr = err
+				break
 			} else if !ok {
 				break
 			}
-		}
-		if len(plans) == 0 {
-			return nil
-		}
-		log.Infof("ProcessSlotAction plans len: %d, plans : %v", len(plans), plans)
-		var fut sync2.Future
-		for sid, _ := range plans {
-			fut.Add()
+
+			log.Infof("ProcessSlotAction schedule slot-[%d], plans len: %d", sid, len(plans))
 			go func(sid int) {
-				//log.Warnf("slot-[%d] process action", sid)
 				err := s.processSlotAction(sid)
 				if err != nil {
 					status := fmt.Sprintf("Migrate Slot[%04d] [ERROR:%s]", sid, err.Error())
@@ -77,17 +99,22 @@ func (s *DashCore) ProcessSlotAction() error {
 				} else {
 					s.action.progress.status.Store("")
 				}
-				fut.Done(strconv.Itoa(sid), err)
+				done <- slotActionResult{sid: sid, err: err}
 			}(sid)
 		}
-		for _, v := range fut.Wait() {
-			if v != nil {
-				return v.(error)
+		if len(plans) == 0 {
+			return firstErr
+		}
+
+		select {
+		case r := <-done:
+			release(r.sid)
+			if r.err != nil && firstErr == nil {
+				firstErr = r.err
 			}
+		case <-ticker.C:
 		}
-		time.Sleep(time.Millisecond * 10)
 	}
-	return nil
 }
 
 func (s *DashCore) processSlotAction(sid int) error {
@@ -97,6 +124,10 @@ func (s *DashCore) processSlotAction(sid int) error {
 		log.Infof("slot-[%d] migrate action executor end, cost : %s", sid, butils.FmtDuration(end))
 	}()
 	for s.IsOnline() {
+		if s.slotActionStopped(sid) {
+			log.Warnf("slot-[%d] migrate action stopped", sid)
+			return nil
+		}
 		if exec, err := s.newSlotActionExecutor(sid); err != nil {
 			if errors.Is(err, ErrInitGroupID) {
 				return s.SlotActionComplete("", sid)
@@ -106,7 +137,10 @@ func (s *DashCore) processSlotAction(sid int) error {
 			time.Sleep(time.Second)
 		} else {
 			needMirgate, sourceAddr, sourceGroupID, targetGroupID, err := exec()
-			if err != nil {
+			if uredis.IsMigrateRunning(err) {
+				time.Sleep(time.Second)
+				continue
+			} else if err != nil {
 				return err
 			}
 			log.Infof("slot-[%d] migrate action executor start, [sourceAddr:%s] [sourceGroupID:%d] [targetGroupID:%d]", sid, sourceAddr, sourceGroupID, targetGroupID)
@@ -129,7 +163,17 @@ func (s *DashCore) processSlotAction(sid int) error {
 				}
 				s.dirtyMigrateCache(sid)
 				if migrateStatus := s.cronMonitorSlotActionComplete(sourceAddr, sid); migrateStatus != nil {
-					if migrateStatus.Status == models.MigrateFinshed {
+					if migrateStatus.Status == models.MigrateRolledBack {
+						migrate.Status = migrateStatus
+						migrate.UpdateTime = time.Now().Format("2006-01-02 15:04:05")
+						if err := s.storeUpdateMigrate(migrate); err != nil {
+							return err
+						}
+						s.dirtyMigrateCache(sid)
+						status := fmt.Sprintf("Migrate Slot[%04d] [Rolled Back]", sid)
+						s.action.progress.status.Store(status)
+						return s.SlotActionRollback(sourceAddr, sid)
+					} else if migrateStatus.Status == models.MigrateFinshed {
 						migrate.Status = migrateStatus
 						migrate.UpdateTime = time.Now().Format("2006-01-02 15:04:05")
 						if err := s.storeUpdateMigrate(migrate); err != nil {
@@ -151,12 +195,15 @@ func (s *DashCore) processSlotAction(sid int) error {
 func (s *DashCore) cronMonitorSlotActionComplete(sourceAddr string, sid int) *models.MigrateStatus {
 	retry := 3
 	for s.IsOnline() {
+		if s.slotActionStopped(sid) {
+			return nil
+		}
 		if migrateStatus, err := s.getSlotActionMigrateStatus(sourceAddr, sid); err != nil {
 			time.Sleep(time.Second)
 			log.Warnf("slot-[%d] migrate action sourceAddr :%s, err : %s", sid, sourceAddr, err.Error())
 		} else {
 			log.Infof("slot-[%d] migrate action executor sourceAddr :%s, running status : %s", sid, sourceAddr, string(migrateStatus.Encode()))
-			if migrateStatus.Status == models.MigrateFinshed {
+			if migrateStatus.Status == models.MigrateFinshed || migrateStatus.Status == models.MigrateRolledBack {
 				return migrateStatus
 			} else if migrateStatus.Status == models.MigrateRunning {
 				time.Sleep(time.Second)
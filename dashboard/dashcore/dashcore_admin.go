@@ -15,6 +15,11 @@
 package dashcore
 
 import (
+	"crypto/hmac"
+	"crypto/subtle"
+	"strings"
+	"time"
+
 	"github.com/martini-contrib/sessions"
 
 	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
@@ -26,56 +31,59 @@ var AdminKey = "user_token"
 var NeedLoginErr = errors.New("need login first")
 
 func (s *DashCore) GetLoginAdmin(session sessions.Session) (*models.Admin, error) {
-	if res := session.Get(AdminKey); res != nil {
-		adminByte := res.([]byte)
-		admin := models.Admin{}
-
-		if err := models.JsonDecode(&admin, adminByte); err != nil {
+	res := session.Get(AdminKey)
+	if res == nil {
+		return nil, NeedLoginErr
+	}
+	adminByte, _ := res.([]byte)
+	ls := &loginSession{}
+	if err := models.JsonDecode(ls, adminByte); err != nil || ls.Username == "" || ls.Provider == "" {
+		return nil, NeedLoginErr
+	}
+	if time.Now().Unix() >= ls.ExpireAt || !s.loginProviderEnabled(ls.Provider) {
+		return nil, NeedLoginErr
+	}
+	if ls.Provider != AuthProviderLocal {
+		if !strings.HasPrefix(ls.Username, ls.Provider+":") || !hmac.Equal([]byte(ls.Stamp), []byte(s.externalStamp(ls))) {
 			return nil, NeedLoginErr
 		}
+		return s.externalAdmin(ls.Username), nil
+	}
 
-		if len(admin.Username) <= 0 || len(admin.Password) <= 0 {
-			return nil, errors.Errorf("invalid params username = %s, password = %s", admin.Username, admin.Password)
-		}
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		if storeAdmin, _ := s.storeGetAdmin(admin.Username); storeAdmin == nil {
-			return nil, errors.Errorf("admin-[%s] not exists", admin.Username)
-		} else {
-			if storeAdmin.Username == admin.Username && storeAdmin.Password == admin.Password {
-				return storeAdmin.Snapshot(), nil
-			}
-		}
-		return nil, NeedLoginErr
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if storeAdmin, _ := s.storeGetAdmin(ls.Username); storeAdmin == nil {
+		return nil, errors.Errorf("admin-[%s] not exists", ls.Username)
+	} else if subtle.ConstantTimeCompare([]byte(passwordStamp(storeAdmin.Password)), []byte(ls.Stamp)) == 1 {
+		return storeAdmin.Snapshot(), nil
 	}
 	return nil, NeedLoginErr
 }
 
+// AdminLogin checks the password with the configured auth provider and keeps
+// the login in the session.
 func (s *DashCore) AdminLogin(session sessions.Session, admin *models.Admin) (*models.Admin, error) {
 	if len(admin.Username) <= 0 || len(admin.Password) <= 0 {
-		return nil, errors.Errorf("invalid params username = %s, password = %s", admin.Username, admin.Password)
+		return nil, errors.Errorf("invalid params username = %s", admin.Username)
 	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if storeAdmin, _ := s.storeGetAdmin(admin.Username); storeAdmin == nil {
-		return nil, errors.Errorf("admin-[%s] not exists", admin.Username)
-	} else {
-		if storeAdmin.Username == admin.Username && storeAdmin.Password == admin.Password {
-			session.Set(AdminKey, admin.Encode())
-			return storeAdmin.Snapshot(), nil
-		}
-
-		return nil, errors.New("username or password error")
+	p := s.auth.provider
+	a, err := p.Authenticate(admin.Username, admin.Password)
+	if err != nil {
+		return nil, err
 	}
-
+	if p.Name() != AuthProviderLocal {
+		a = s.externalAdmin(externalUsername(p.Name(), a.Username))
+	}
+	s.setLoginSession(session, a, p.Name())
+	return a.Snapshot(), nil
 }
 
 func (s *DashCore) CreateAdmin(admin *models.Admin) error {
 	if len(admin.Username) <= 0 {
-		return errors.Errorf("invalid params username = %s, password = %s, role = %v", admin.Username, admin.Password, admin.Role)
+		return errors.Errorf("invalid params username = %s, role = %v", admin.Username, admin.Role)
 	}
 	if admin.Role != models.SUPERADMIN && admin.Role != models.OPADMIN && admin.Role != models.READADMIN {
-		return errors.Errorf("invalid params username = %s, password = %s, role = %v", admin.Username, admin.Password, admin.Role)
+		return errors.Errorf("invalid params username = %s, role = %v", admin.Username, admin.Role)
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -86,20 +94,33 @@ func (s *DashCore) CreateAdmin(admin *models.Admin) error {
 	if len(admin.Password) <= 0 {
 		admin.Password = admin.Username
 	}
-	log.Warnf("CreateAdmin data : %v", admin)
+	hash, err := models.HashPassword(admin.Password)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	admin.Password = hash
+	log.Warnf("CreateAdmin data : username = %s, role = %v", admin.Username, admin.Role)
 	return s.storeCreateAdmin(admin)
 }
 
 func (s *DashCore) UpdateAdmin(admin *models.Admin) error {
 	if len(admin.Username) <= 0 {
-		return errors.Errorf("invalid params username = %s, password = %s", admin.Username, admin.Password)
+		return errors.Errorf("invalid params username = %s", admin.Username)
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if admin, _ := s.storeGetAdmin(admin.Username); admin == nil {
+	storeAdmin, _ := s.storeGetAdmin(admin.Username)
+	if storeAdmin == nil {
 		return errors.Errorf("admin-[%s] not exists", admin.Username)
 	}
+	if len(admin.Password) <= 0 {
+		admin.Password = storeAdmin.Password
+	} else if hash, err := models.HashPassword(admin.Password); err != nil {
+		return errors.Trace(err)
+	} else {
+		admin.Password = hash
+	}
 
 	return s.storeUpdateAdmin(admin)
 }
@@ -16,6 +16,7 @@ package dashcore
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	_ "net/http/pprof"
 	"strconv"
@@ -45,7 +46,8 @@ func newApiServer(d *DashCore) http.Handler {
 	m := martini.New()
 	m.Use(martini.Recovery())
 	m.Use(render.Renderer())
-	store := sessions.NewCookieStore([]byte("secret123"))
+	store := sessions.NewCookieStore(d.sessionKeys())
+	store.Options(sessions.Options{Path: "/", MaxAge: int(d.config.Auth.SessionTTL), HttpOnly: true})
 	m.Use(sessions.Sessions("utoken", store))
 
 	m.Use(func(session sessions.Session, w http.ResponseWriter, req *http.Request, c martini.Context) {
@@ -69,6 +71,7 @@ func newApiServer(d *DashCore) http.Handler {
 	})
 
 	api := &apiServer{dashCore: d}
+	m.Use(api.audit)
 
 	r := martini.NewRouter()
 
@@ -78,6 +81,9 @@ func newApiServer(d *DashCore) http.Handler {
 
 	r.Post("/login", binding.Form(models.Admin{}), api.Login)
 	r.Get("/logout", api.LogOut)
+	r.Get("/oidc/login", api.OidcLogin)
+	r.Get("/oidc/callback", api.OidcCallback)
+	r.Get("/metrics", api.Metrics)
 
 	r.Group("/topom", func(r martini.Router) {
 		r.Get("", api.Overview)
@@ -91,6 +97,8 @@ func newApiServer(d *DashCore) http.Handler {
 		r.Get("/stats/:xauth", api.Stats)
 		r.Get("/slots/:xauth", api.Slots)
 		r.Get("/migratelist/:xauth", api.MigrateList)
+		r.Get("/slowlog/:xauth", api.SlowLog)
+		r.Get("/slowlog/:xauth/:num", api.SlowLog)
 		r.Put("/department/:xauth/:value", api.UpdateDepartment)
 
 		r.Put("/reload/:xauth", api.Reload)
@@ -100,6 +108,8 @@ func newApiServer(d *DashCore) http.Handler {
 			r.Put("/create/:xauth/:addr", api.CreateProxy)
 			r.Put("/online/:xauth/:addr", api.OnlineProxy)
 			r.Put("/reinit/:xauth/:token", api.ReinitProxy)
+			r.Put("/reloadconfig/:xauth/:token", api.ReloadProxyConfig)
+			r.Put("/reloadconfig-all/:xauth", api.ReloadProxyConfigAll)
 			r.Put("/remove/:xauth/:token/:force", api.RemoveProxy)
 			r.Put("/readcrosscloud/:xauth/:flag", api.ReadCrossCloud)
 		})
@@ -124,6 +134,8 @@ func newApiServer(d *DashCore) http.Handler {
 			r.Get("/getnodehostinfo/:xauth/:gid/:addr", api.GetNodeHostInfo)
 
 			r.Put("/promote/:xauth/:gid/:addr", api.GroupPromoteServer)
+			r.Get("/leader-balance/:xauth", api.LeaderBalancePlan)
+			r.Put("/leader-balance/:xauth", api.LeaderBalance)
 
 			r.Group("/action", func(r martini.Router) {
 				r.Put("/create/:xauth/:addr", api.SyncCreateAction)
@@ -140,11 +152,22 @@ func newApiServer(d *DashCore) http.Handler {
 				r.Put("/create-some/:xauth/:src/:dst/:num", api.SlotCreateActionSome)
 				r.Put("/create-range/:xauth/:beg/:end/:gid/:not_migrate", api.SlotCreateActionRange)
 				r.Put("/remove/:xauth/:sid", api.SlotRemoveAction)
+				r.Put("/pause/:xauth/:sid", api.SlotPauseAction)
+				r.Put("/resume/:xauth/:sid", api.SlotResumeAction)
+				r.Put("/cancel/:xauth/:sid", api.SlotCancelAction)
 				r.Put("/disabled/:xauth/:value", api.SetSlotActionDisabled)
 			})
+			r.Get("/stats/:xauth", api.SlotStats)
+			r.Get("/rebalance/:xauth", api.SlotsRebalancePlan)
+			r.Put("/rebalance/:xauth", api.SlotsRebalanceByLoad)
 			r.Put("/assign/:xauth", binding.Json([]*models.SlotMapping{}), api.SlotsAssignGroup)
 			r.Put("/assign/:xauth/offline", binding.Json([]*models.SlotMapping{}), api.SlotsAssignOffline)
 		})
+		r.Group("/topology", func(r martini.Router) {
+			r.Get("/:xauth", api.TopologyPlan)
+			r.Put("/plan/:xauth", api.PlanTopology)
+			r.Put("/apply/:xauth", api.ApplyTopology)
+		})
 		r.Group("/tools", func(r martini.Router) {
 			r.Get("/whichgroupkey/:key", api.FindKeyGroup)
 		})
@@ -160,9 +183,16 @@ func newApiServer(d *DashCore) http.Handler {
 			r.Put("/add", binding.Json(models.Admin{}), api.AddAdmin)
 			r.Put("/update", binding.Json(models.Admin{}), api.UpdateAdmin)
 			r.Put("/del/:username", api.DelAdmin)
+			r.Get("/token/list", api.ListApiToken)
+			r.Put("/token/create", binding.Json(ApiTokenRequest{}), api.CreateApiToken)
+			r.Put("/token/revoke/:id", api.RevokeApiToken)
 		})
 	})
 
+	r.Group("/api/audit", func(r martini.Router) {
+		r.Get("/:xauth", api.AuditList)
+	})
+
 	m.MapTo(r, (*martini.Routes)(nil))
 	m.Action(r.Handle)
 	return m
@@ -186,7 +216,7 @@ func (s *apiServer) verifyLogin(session sessions.Session, req *http.Request) err
 	if s.dashCore.IsClosed() {
 		return ErrClosedDashCore
 	}
-	if admin, err := s.dashCore.GetLoginAdmin(session); admin != nil && err == nil {
+	if admin, err := s.dashCore.GetRequestAdmin(session, req); admin != nil && err == nil {
 		if req.Method == "PUT" {
 			path := req.URL.Path
 			if strings.Contains(path, "/admin/") {
@@ -253,6 +283,25 @@ func (s *apiServer) MigrateList(params martini.Params) (int, string) {
 	}
 }
 
+func (s *apiServer) SlowLog(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	num := 128
+	if v := params["num"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return rpc.ApiResponseError(errors.Errorf("invalid num = %s", v))
+		}
+		num = n
+	}
+	if report, err := s.dashCore.SlowLog(num, 3*time.Second); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(report)
+	}
+}
+
 func (s *apiServer) Stats(params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -419,6 +468,32 @@ func (s *apiServer) ReinitProxy(params martini.Params) (int, string) {
 	}
 }
 
+func (s *apiServer) ReloadProxyConfig(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	token, err := s.parseToken(params)
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.dashCore.ReloadProxyConfig(token); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
+func (s *apiServer) ReloadProxyConfigAll(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.dashCore.ReloadProxyConfigAll(); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
 func (s *apiServer) ReadCrossCloud(params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -993,6 +1068,110 @@ func (s *apiServer) SlotCreateAction(session sessions.Session, req *http.Request
 	}
 }
 
+func (s *apiServer) SlotStats(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if report, err := s.dashCore.SlotStats(3 * time.Second); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(report)
+	}
+}
+
+func (s *apiServer) SlotsRebalancePlan(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if plan, err := s.dashCore.SlotsRebalanceByLoad(false, 3*time.Second); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(plan)
+	}
+}
+
+func (s *apiServer) SlotsRebalanceByLoad(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.verifyLogin(session, req); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if plan, err := s.dashCore.SlotsRebalanceByLoad(true, 3*time.Second); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(plan)
+	}
+}
+
+func (s *apiServer) LeaderBalancePlan(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if plan, err := s.dashCore.LeaderBalance(false); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(plan)
+	}
+}
+
+func (s *apiServer) LeaderBalance(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.verifyLogin(session, req); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if plan, err := s.dashCore.LeaderBalance(true); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(plan)
+	}
+}
+
+func (s *apiServer) TopologyPlan(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if plan, err := s.dashCore.GetTopologyPlan(); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(plan)
+	}
+}
+
+func (s *apiServer) PlanTopology(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.verifyLogin(session, req); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if plan, err := s.dashCore.PlanTopology(data); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(plan)
+	}
+}
+
+func (s *apiServer) ApplyTopology(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.verifyLogin(session, req); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if plan, err := s.dashCore.ApplyTopology(); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(plan)
+	}
+}
+
 func (s *apiServer) SlotCreateActionSome(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -1081,6 +1260,36 @@ func (s *apiServer) SlotRemoveAction(session sessions.Session, req *http.Request
 	}
 }
 
+func (s *apiServer) SlotPauseAction(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
+	return s.slotActionControl(session, req, params, s.dashCore.SlotPauseAction)
+}
+
+func (s *apiServer) SlotResumeAction(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
+	return s.slotActionControl(session, req, params, s.dashCore.SlotResumeAction)
+}
+
+func (s *apiServer) SlotCancelAction(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
+	return s.slotActionControl(session, req, params, s.dashCore.SlotCancelAction)
+}
+
+func (s *apiServer) slotActionControl(session sessions.Session, req *http.Request, params martini.Params, control func(sid int) error) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.verifyLogin(session, req); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	sid, err := s.parseInteger(params, "sid")
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := control(sid); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
 func (s *apiServer) LogLevel(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -1179,9 +1388,9 @@ func (s *apiServer) AddAdmin(session sessions.Session, req *http.Request, admin
 	if err := s.verifyLogin(session, req); err != nil {
 		return rpc.ApiResponseError(err)
 	}
-	log.Info("AddAdmin:", admin)
+	log.Infof("AddAdmin: username = %s, role = %v", admin.Username, admin.Role)
 	if len(admin.Username) <= 0 {
-		return rpc.ApiResponseError(errors.Errorf("params err, admin : %v", admin))
+		return rpc.ApiResponseError(errors.Errorf("params err, role = %v", admin.Role))
 	}
 
 	if err := s.dashCore.CreateAdmin(&admin); err != nil {
@@ -1194,7 +1403,7 @@ func (s *apiServer) UpdateAdmin(session sessions.Session, req *http.Request, adm
 	if err := s.verifyLogin(session, req); err != nil {
 		return rpc.ApiResponseError(err)
 	}
-	log.Info("UpdateAdmin:", admin)
+	log.Infof("UpdateAdmin: username = %s, role = %v", admin.Username, admin.Role)
 
 	if err := s.dashCore.UpdateAdmin(&admin); err != nil {
 		return rpc.ApiResponseError(err)
@@ -1334,6 +1543,43 @@ func (s *apiServer) DetailPconfig(params martini.Params) (int, string) {
 	}
 }
 
+// AuditList returns the audit records, filtered by the user, endpoint,
+// result, since, until and limit query parameters. With format=csv the
+// records are exported as a csv file. Only a superadmin may read them.
+func (s *apiServer) AuditList(session sessions.Session, w http.ResponseWriter, req *http.Request, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if admin, err := s.dashCore.GetRequestAdmin(session, req); err != nil {
+		return rpc.ApiResponseError(err)
+	} else if admin == nil || !admin.CheckAddRolePower() {
+		return rpc.ApiResponseError(errors.New("no power to read audit records"))
+	}
+	query := req.URL.Query()
+	filter, err := parseAuditFilter(query)
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	records, err := s.dashCore.ListAudit(filter)
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	switch query.Get("format") {
+	case "", "json":
+		return rpc.ApiResponseJson(records)
+	case "csv":
+		data, err := encodeAuditCSV(records)
+		if err != nil {
+			return rpc.ApiResponseError(err)
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		return 200, data
+	default:
+		return rpc.ApiResponseError(errors.Errorf("invalid format = %s", query.Get("format")))
+	}
+}
+
 func (s *apiServer) Login(session sessions.Session, req *http.Request, admin models.Admin, params martini.Params) (int, string) {
 	if admin, err := s.dashCore.AdminLogin(session, &admin); admin != nil && err == nil {
 		return rpc.ApiResponseJson(admin)
@@ -1342,6 +1588,30 @@ func (s *apiServer) Login(session sessions.Session, req *http.Request, admin mod
 	}
 }
 
+// OidcLogin redirects the browser to the oidc provider.
+func (s *apiServer) OidcLogin(session sessions.Session, w http.ResponseWriter) (int, string) {
+	u, err := s.dashCore.OidcAuthURL(session)
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	w.Header().Set("Location", u)
+	return http.StatusFound, ""
+}
+
+// OidcCallback is the redirect_url of the oidc provider, a successful login
+// returns to the overview.
+func (s *apiServer) OidcCallback(session sessions.Session, w http.ResponseWriter, req *http.Request) (int, string) {
+	query := req.URL.Query()
+	if e := query.Get("error"); e != "" {
+		return rpc.ApiResponseError(errors.Errorf("oidc login failed, %s %s", e, query.Get("error_description")))
+	}
+	if _, err := s.dashCore.OidcLogin(session, query.Get("state"), query.Get("code")); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	w.Header().Set("Location", "/")
+	return http.StatusFound, ""
+}
+
 func (s *apiServer) LogOut(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
 	session.Delete(AdminKey)
 	session.Options(sessions.Options{
@@ -1349,3 +1619,50 @@ func (s *apiServer) LogOut(session sessions.Session, req *http.Request, params m
 	})
 	return rpc.ApiResponseJson("OK")
 }
+
+func (s *apiServer) ListApiToken(session sessions.Session, req *http.Request) (int, string) {
+	if admin, err := s.dashCore.GetRequestAdmin(session, req); err != nil {
+		return rpc.ApiResponseError(err)
+	} else if admin == nil || !admin.CheckAddRolePower() {
+		return rpc.ApiResponseError(errors.New("no power to manage api tokens"))
+	}
+	if tokens, err := s.dashCore.ListApiToken(); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(tokens)
+	}
+}
+
+// CreateApiToken creates a token owned by the login admin. A token can not
+// create tokens, so a leaked token can not outlive its own expiry.
+func (s *apiServer) CreateApiToken(session sessions.Session, req *http.Request, r ApiTokenRequest) (int, string) {
+	if err := s.verifyLogin(session, req); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if req.Header.Get("Authorization") != "" {
+		return rpc.ApiResponseError(errors.New("api tokens can only be created by a login session"))
+	}
+	admin, err := s.dashCore.GetLoginAdmin(session)
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if res, err := s.dashCore.CreateApiToken(admin.Username, &r); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(res)
+	}
+}
+
+func (s *apiServer) RevokeApiToken(session sessions.Session, req *http.Request, params martini.Params) (int, string) {
+	if err := s.verifyLogin(session, req); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	id := params["id"]
+	if id == "" {
+		return rpc.ApiResponseError(errors.New("missing api token id"))
+	}
+	if err := s.dashCore.RevokeApiToken(id); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
@@ -0,0 +1,371 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/sessions"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/log"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+const (
+	auditMaxParams    = 4096
+	auditMaxResponse  = 1 << 20
+	auditDefaultLimit = 100
+	auditMaxLimit     = 10000
+	auditRedacted     = "******"
+)
+
+// auditSecretRoutes are the routes whose last path segment is a secret.
+var auditSecretRoutes = []string{
+	"/api/topom/group/deraft/",
+	"/api/topom/group/deraftcluster/",
+}
+
+type AuditFilter struct {
+	User     string
+	Endpoint string
+	Result   string
+	Since    int64
+	Until    int64
+	Limit    int
+}
+
+func (f *AuditFilter) match(r *models.AuditRecord) bool {
+	if f.User != "" && r.User != f.User {
+		return false
+	}
+	if f.Endpoint != "" && !strings.Contains(r.Endpoint, f.Endpoint) {
+		return false
+	}
+	if f.Result != "" && r.Result != f.Result {
+		return false
+	}
+	if f.Since != 0 && r.Unixtime < f.Since {
+		return false
+	}
+	if f.Until != 0 && r.Unixtime > f.Until {
+		return false
+	}
+	return true
+}
+
+func (s *DashCore) AppendAudit(r *models.AuditRecord) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosedDashCore
+	}
+	r.Id = fmt.Sprintf("%020d-%04d", time.Now().UnixNano(), s.audit.seq.Incr()%10000)
+	return s.store.CreateAuditRecord(r)
+}
+
+// ListAudit returns the newest records matching f first, at most f.Limit of
+// them.
+func (s *DashCore) ListAudit(f *AuditFilter) ([]*models.AuditRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosedDashCore
+	}
+	paths, err := s.store.ListAuditPaths()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*models.AuditRecord, 0)
+	for i := len(paths) - 1; i >= 0 && len(records) < f.Limit; i-- {
+		// ids carry the time a call finished, which is never before it started
+		if f.Since != 0 && auditPathUnixtime(paths[i]) < f.Since {
+			break
+		}
+		r, err := s.store.LoadAuditRecord(paths[i])
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && f.match(r) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+func auditPathUnixtime(path string) int64 {
+	id := filepath.Base(path)
+	if i := strings.IndexByte(id, '-'); i > 0 {
+		id = id[:i]
+	}
+	n, _ := strconv.ParseInt(id, 10, 64)
+	return n / int64(time.Second)
+}
+
+func parseAuditFilter(q url.Values) (*AuditFilter, error) {
+	f := &AuditFilter{
+		User:     q.Get("user"),
+		Endpoint: q.Get("endpoint"),
+		Result:   q.Get("result"),
+		Limit:    auditDefaultLimit,
+	}
+	if f.Result != "" && f.Result != models.AuditResultOK && f.Result != models.AuditResultError {
+		return nil, errors.Errorf("invalid result = %s", f.Result)
+	}
+	for _, t := range []struct {
+		name string
+		v    *int64
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(t.name); v != "" {
+			n, err := parseAuditTime(v)
+			if err != nil {
+				return nil, errors.Errorf("invalid %s = %s", t.name, v)
+			}
+			*t.v = n
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, errors.Errorf("invalid limit = %s", v)
+		}
+		f.Limit = n
+	}
+	if f.Limit > auditMaxLimit {
+		f.Limit = auditMaxLimit
+	}
+	return f, nil
+}
+
+func parseAuditTime(v string) (int64, error) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", v, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+func encodeAuditCSV(records []*models.AuditRecord) (string, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"id", "time", "user", "role", "source_ip", "method", "endpoint", "params", "result", "status", "error", "duration_ms"})
+	for _, r := range records {
+		w.Write([]string{
+			r.Id, r.Time, r.User, strconv.Itoa(int(r.Role)), r.SourceIP, r.Method, r.Endpoint, r.Params,
+			r.Result, strconv.Itoa(r.Status), r.Error, strconv.FormatInt(r.DurationMs, 10),
+		})
+	}
+	w.Flush()
+	return b.String(), w.Error()
+}
+
+// auditResponseWriter keeps the status and the body of an error response,
+// the cause of the error goes to the audit record.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if n := auditMaxResponse - w.body.Len(); w.status != http.StatusOK && n > 0 {
+		if len(b) < n {
+			n = len(b)
+		}
+		w.body.Write(b[:n])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// audit records every call that is not a GET once it is served.
+func (s *apiServer) audit(session sessions.Session, w http.ResponseWriter, req *http.Request, c martini.Context) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+		c.Next()
+		return
+	}
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	rw := &auditResponseWriter{ResponseWriter: w}
+	c.MapTo(rw, (*http.ResponseWriter)(nil))
+
+	start := time.Now()
+	c.Next()
+
+	r := &models.AuditRecord{
+		Unixtime:   start.Unix(),
+		Time:       start.Format("2006-01-02 15:04:05"),
+		SourceIP:   auditSourceIP(req, s.dashCore.Config()),
+		Method:     req.Method,
+		Endpoint:   auditEndpoint(req.URL.Path, s.dashCore.XAuth()),
+		Params:     auditParams(req, body),
+		Status:     rw.status,
+		DurationMs: time.Since(start).Milliseconds(),
+		Result:     models.AuditResultOK,
+	}
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	if r.Status != http.StatusOK {
+		r.Result = models.AuditResultError
+		var res struct {
+			ErrMsg struct {
+				Cause string `json:"cause"`
+			} `json:"errmsg"`
+		}
+		if err := json.Unmarshal(rw.body.Bytes(), &res); err == nil && res.ErrMsg.Cause != "" {
+			r.Error = res.ErrMsg.Cause
+		} else {
+			r.Error = fmt.Sprintf("status %d", r.Status)
+		}
+	}
+	if admin, _ := s.dashCore.GetRequestAdmin(session, req); admin != nil {
+		r.User, r.Role = admin.Username, admin.Role
+	} else if form, err := url.ParseQuery(string(body)); err == nil {
+		r.User = form.Get("username")
+	}
+	if err := s.dashCore.AppendAudit(r); err != nil {
+		log.WarnErrorf(err, "append audit record of %s %s failed", r.Method, r.Endpoint)
+	}
+}
+
+// auditSourceIP returns the address of the client. The proxy headers are
+// anyone's to set, they only count on requests from a trusted proxy, and
+// X-Forwarded-For is read from the right up to the first untrusted hop.
+func auditSourceIP(req *http.Request, c *Config) string {
+	addr := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if !c.isTrustedProxy(addr) {
+		return addr
+	}
+	if v := strings.TrimSpace(req.Header.Get("X-Real-IP")); v != "" {
+		return v
+	}
+	if v := req.Header.Get("X-Forwarded-For"); v != "" {
+		hops := strings.Split(v, ",")
+		for i := len(hops) - 1; i > 0; i-- {
+			if !c.isTrustedProxy(hops[i]) {
+				return strings.TrimSpace(hops[i])
+			}
+		}
+		return strings.TrimSpace(hops[0])
+	}
+	return addr
+}
+
+func auditEndpoint(path, xauth string) string {
+	if xauth != "" {
+		path = strings.Replace(path, "/"+xauth, "/{xauth}", 1)
+	}
+	for _, prefix := range auditSecretRoutes {
+		if strings.HasPrefix(path, prefix) {
+			if i := strings.LastIndexByte(path, '/'); i >= len(prefix) {
+				path = path[:i+1] + auditRedacted
+			}
+		}
+	}
+	return path
+}
+
+func auditSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range []string{"password", "auth", "token", "secret"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditParams returns the query and the body of the call with the values of
+// secret looking keys redacted.
+func auditParams(req *http.Request, body []byte) string {
+	var parts []string
+	if q := req.URL.Query(); len(q) != 0 {
+		parts = append(parts, redactAuditForm(q))
+	}
+	if body = bytes.TrimSpace(body); len(body) != 0 {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			b, _ := json.Marshal(redactAuditJson(v))
+			parts = append(parts, string(b))
+		} else if form, err := url.ParseQuery(string(body)); err == nil && strings.Contains(req.Header.Get("Content-Type"), "form") {
+			parts = append(parts, redactAuditForm(form))
+		} else {
+			parts = append(parts, string(body))
+		}
+	}
+	params := strings.Join(parts, " ")
+	if len(params) > auditMaxParams {
+		params = params[:auditMaxParams] + "..."
+	}
+	return params
+}
+
+func redactAuditForm(form url.Values) string {
+	for k := range form {
+		if auditSecretKey(k) {
+			form[k] = []string{auditRedacted}
+		}
+	}
+	return form.Encode()
+}
+
+func redactAuditJson(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, e := range x {
+			if auditSecretKey(k) {
+				x[k] = auditRedacted
+			} else {
+				x[k] = redactAuditJson(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = redactAuditJson(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,108 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+func TestAuditEndpoint(t *testing.T) {
+	for path, expect := range map[string]string{
+		"/api/topom/group/create/xa/3":                    "/api/topom/group/create/{xauth}/3",
+		"/api/topom/group/deraft/xa/3/10.0.0.1:6001/tk":   "/api/topom/group/deraft/{xauth}/3/10.0.0.1:6001/" + auditRedacted,
+		"/api/topom/group/deraftcluster/xa/cloud1/tk":     "/api/topom/group/deraftcluster/{xauth}/cloud1/" + auditRedacted,
+		"/api/topom/slots/action/create-range/xa/0/9/3/0": "/api/topom/slots/action/create-range/{xauth}/0/9/3/0",
+	} {
+		if v := auditEndpoint(path, "xa"); v != expect {
+			t.Fatalf("auditEndpoint(%s) = %s, want %s", path, v, expect)
+		}
+	}
+}
+
+func TestAuditSourceIP(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{trustedProxies: proxies}
+	for _, x := range []struct {
+		remote, realIP, forwarded, expect string
+	}{
+		{"1.2.3.4:5000", "9.9.9.9", "8.8.8.8", "1.2.3.4"},
+		{"10.0.0.1:5000", "9.9.9.9", "8.8.8.8", "9.9.9.9"},
+		{"10.0.0.1:5000", "", "6.6.6.6, 8.8.8.8, 192.168.1.1", "8.8.8.8"},
+		{"192.168.3.3:5000", "", "192.168.1.1, 10.0.0.1", "192.168.1.1"},
+		{"10.0.0.2:5000", "", "8.8.8.8", "10.0.0.2"},
+	} {
+		req, _ := http.NewRequest(http.MethodPut, "/api/topom/group/create/xa/3", nil)
+		req.RemoteAddr = x.remote
+		if x.realIP != "" {
+			req.Header.Set("X-Real-IP", x.realIP)
+		}
+		req.Header.Set("X-Forwarded-For", x.forwarded)
+		if v := auditSourceIP(req, c); v != x.expect {
+			t.Fatalf("auditSourceIP(%+v) = %s, want %s", x, v, x.expect)
+		}
+	}
+	if _, err := parseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Fatal("invalid trusted proxy should fail")
+	}
+}
+
+func TestAuditParams(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPut, "/api/topom/admin/add?auth=x&v=1", nil)
+	params := auditParams(req, []byte(`{"username":"u","password":"p","nested":[{"product_auth":"a"}]}`))
+	if strings.Contains(params, `"p"`) || strings.Contains(params, `"a"`) || strings.Contains(params, "auth=x") {
+		t.Fatalf("secrets not redacted: %s", params)
+	}
+	if !strings.Contains(params, `"username":"u"`) || !strings.Contains(params, "v=1") {
+		t.Fatalf("unexpected params: %s", params)
+	}
+
+	req, _ = http.NewRequest(http.MethodPost, "/login", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if params := auditParams(req, []byte("username=u&password=p")); params != "password=%2A%2A%2A%2A%2A%2A&username=u" {
+		t.Fatalf("unexpected form params: %s", params)
+	}
+}
+
+func TestAuditFilter(t *testing.T) {
+	if _, err := parseAuditFilter(url.Values{"result": {"fine"}}); err == nil {
+		t.Fatal("invalid result should fail")
+	}
+	f, err := parseAuditFilter(url.Values{"user": {"u"}, "result": {"error"}, "since": {"100"}, "limit": {"99999"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Limit != auditMaxLimit || f.Since != 100 {
+		t.Fatalf("unexpected filter %+v", f)
+	}
+	r := &models.AuditRecord{User: "u", Result: models.AuditResultError, Unixtime: 200}
+	if !f.match(r) {
+		t.Fatal("record should match")
+	}
+	r.Unixtime = 50
+	if f.match(r) {
+		t.Fatal("record before since should not match")
+	}
+	if auditPathUnixtime("/stored/demo/audit/01792353459000000001-0001") != 1792353459 {
+		t.Fatal("unexpected audit path time")
+	}
+}
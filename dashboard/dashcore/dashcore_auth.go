@@ -0,0 +1,398 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martini-contrib/sessions"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/log"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+const (
+	AuthProviderLocal = "local"
+	AuthProviderLdap  = "ldap"
+	AuthProviderOidc  = "oidc"
+
+	apiTokenPrefix = "bst"
+)
+
+// AuthProvider checks the password of a login. The local provider returns
+// the admin of the admin table, the others return an admin without a role,
+// the role is then taken from the admin table or auth.default_role.
+//
+// Users of an external provider live in a namespace of their own, an ldap
+// user alice is the admin named ldap:alice. A local admin alice is another
+// user, so an identity provider can never log in as a local admin.
+type AuthProvider interface {
+	Name() string
+	Authenticate(username, password string) (*models.Admin, error)
+}
+
+func newAuthProvider(s *DashCore, conf *AuthConfig) AuthProvider {
+	switch conf.Provider {
+	case AuthProviderLdap:
+		return newLdapAuthProvider(&conf.Ldap)
+	default:
+		return &localAuthProvider{s: s}
+	}
+}
+
+type localAuthProvider struct {
+	s *DashCore
+}
+
+func (p *localAuthProvider) Name() string {
+	return AuthProviderLocal
+}
+
+// Authenticate checks the password against the admin table, a password still
+// stored in plain text is replaced by its hash on the first login.
+func (p *localAuthProvider) Authenticate(username, password string) (*models.Admin, error) {
+	if isExternalUsername(username) {
+		return nil, errors.Errorf("admin-[%s] is an external user, password login is not allowed", username)
+	}
+	s := p.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	admin, _ := s.storeGetAdmin(username)
+	if admin == nil {
+		return nil, errors.Errorf("admin-[%s] not exists", username)
+	}
+	if !admin.CheckPassword(password) {
+		return nil, errors.New("username or password error")
+	}
+	if admin.NeedRehash() {
+		if err := s.rehashAdminPassword(admin, password); err != nil {
+			log.WarnErrorf(err, "rehash password of admin-[%s] failed", username)
+		}
+	}
+	return admin, nil
+}
+
+func (s *DashCore) rehashAdminPassword(admin *models.Admin, password string) error {
+	hash, err := models.HashPassword(password)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	admin.Password = hash
+	return s.storeUpdateAdmin(admin)
+}
+
+// migrateAdminPasswords hashes the passwords still stored in plain text.
+func (s *DashCore) migrateAdminPasswords() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	admins, err := s.storeGetAdminList()
+	if err != nil {
+		log.WarnErrorf(err, "list admins failed, passwords are hashed on login")
+		return
+	}
+	for _, admin := range admins {
+		if !admin.NeedRehash() {
+			continue
+		}
+		if err := s.rehashAdminPassword(admin, admin.Password); err != nil {
+			log.WarnErrorf(err, "hash password of admin-[%s] failed", admin.Username)
+		} else {
+			log.Warnf("admin-[%s] password hashed", admin.Username)
+		}
+	}
+}
+
+// loginSession is what a login keeps in the session cookie. For a local
+// admin Stamp is derived from the password hash, a password change ends the
+// sessions of the admin. For an external user Stamp is an hmac of the login
+// with the session secret, only this dashboard can issue one.
+type loginSession struct {
+	Username string           `json:"username"`
+	Role     models.AdminRole `json:"role"`
+	Provider string           `json:"provider"`
+	Stamp    string           `json:"stamp,omitempty"`
+	ExpireAt int64            `json:"expire_at"`
+}
+
+func passwordStamp(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// newSessionSecret returns the configured session secret, or a random one.
+func newSessionSecret(secret string) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Trace(err)
+	}
+	log.Warnf("auth.session_secret is not set, logins end when the dashboard restarts")
+	return b, nil
+}
+
+// sessionKeys returns the hash and the encryption key of the session cookie.
+func (s *DashCore) sessionKeys() ([]byte, []byte) {
+	hashKey := hmac.New(sha256.New, s.auth.secret)
+	hashKey.Write([]byte("cookie-hash"))
+	blockKey := hmac.New(sha256.New, s.auth.secret)
+	blockKey.Write([]byte("cookie-block"))
+	return hashKey.Sum(nil), blockKey.Sum(nil)
+}
+
+func (s *DashCore) externalStamp(ls *loginSession) string {
+	h := hmac.New(sha256.New, s.auth.secret)
+	h.Write([]byte(ls.Provider + "\x00" + ls.Username + "\x00" + strconv.FormatInt(ls.ExpireAt, 10)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loginProviderEnabled reports whether a session of provider can still be
+// used, the provider of a session must be configured.
+func (s *DashCore) loginProviderEnabled(provider string) bool {
+	if s.auth.provider != nil && provider == s.auth.provider.Name() {
+		return true
+	}
+	return provider == AuthProviderOidc && s.auth.oidc != nil
+}
+
+func (s *DashCore) setLoginSession(session sessions.Session, admin *models.Admin, provider string) {
+	ls := &loginSession{
+		Username: admin.Username,
+		Role:     admin.Role,
+		Provider: provider,
+		ExpireAt: time.Now().Unix() + s.config.Auth.SessionTTL,
+	}
+	if provider == AuthProviderLocal {
+		ls.Stamp = passwordStamp(admin.Password)
+	} else {
+		ls.Stamp = s.externalStamp(ls)
+	}
+	b, _ := json.Marshal(ls)
+	session.Set(AdminKey, b)
+}
+
+// externalUsername is the admin name of the user name of an external provider.
+func externalUsername(provider, name string) string {
+	return provider + ":" + name
+}
+
+func isExternalUsername(username string) bool {
+	for _, provider := range []string{AuthProviderLdap, AuthProviderOidc} {
+		if strings.HasPrefix(username, provider+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// externalAdmin gives an external user, named by externalUsername, the role
+// of the admin of the same name, or the default role.
+func (s *DashCore) externalAdmin(username string) *models.Admin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.externalAdminLocked(username)
+}
+
+func (s *DashCore) externalAdminLocked(username string) *models.Admin {
+	if isExternalUsername(username) {
+		if admin, _ := s.storeGetAdmin(username); admin != nil {
+			return admin.Snapshot()
+		}
+	}
+	return &models.Admin{Username: username, Role: s.config.Auth.DefaultRole}
+}
+
+// tokenOwnerLocked returns the admin owning an api token, nil if a local
+// owner was removed.
+func (s *DashCore) tokenOwnerLocked(owner string) *models.Admin {
+	if isExternalUsername(owner) {
+		return s.externalAdminLocked(owner)
+	}
+	admin, _ := s.storeGetAdmin(owner)
+	return admin
+}
+
+// GetRequestAdmin returns the admin of an api token given as a bearer token,
+// or else the admin of the login session.
+func (s *DashCore) GetRequestAdmin(session sessions.Session, req *http.Request) (*models.Admin, error) {
+	if v := req.Header.Get("Authorization"); strings.HasPrefix(v, "Bearer ") {
+		return s.GetTokenAdmin(strings.TrimSpace(strings.TrimPrefix(v, "Bearer ")))
+	}
+	return s.GetLoginAdmin(session)
+}
+
+type ApiTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	TTL    int64    `json:"ttl"`
+}
+
+type ApiTokenResponse struct {
+	Token string           `json:"token"`
+	Info  *models.ApiToken `json:"info"`
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Trace(err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseApiToken splits a token into its id and secret, tokens look like
+// bst.<id>.<secret>.
+func parseApiToken(token string) (string, string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != apiTokenPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// CreateApiToken creates a token owned by owner, ttl is in seconds and 0
+// never expires. The token is only returned here, the store keeps its hash.
+func (s *DashCore) CreateApiToken(owner string, r *ApiTokenRequest) (*ApiTokenResponse, error) {
+	if r.Name == "" {
+		return nil, errors.New("missing token name")
+	}
+	if err := models.ValidateTokenScopes(r.Scopes); err != nil {
+		return nil, err
+	}
+	if r.TTL < 0 {
+		return nil, errors.Errorf("invalid token ttl = %d", r.TTL)
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	t := &models.ApiToken{
+		Id:         id,
+		Name:       r.Name,
+		Owner:      owner,
+		Scopes:     r.Scopes,
+		Hash:       hashTokenSecret(secret),
+		CreateTime: now.Format("2006-01-02 15:04:05"),
+	}
+	if r.TTL != 0 {
+		t.ExpireAt = now.Unix() + r.TTL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosedDashCore
+	}
+	if s.tokenOwnerLocked(owner) == nil {
+		return nil, errors.Errorf("admin-[%s] not exists", owner)
+	}
+	if err := s.store.UpdateApiToken(t); err != nil {
+		log.ErrorErrorf(err, "store: create api token-[%s] failed", t.Id)
+		return nil, errors.Errorf("store: create api token-[%s] failed", t.Id)
+	}
+	log.Warnf("create api token-[%s] %s of %s, scopes = %v", t.Id, t.Name, t.Owner, t.Scopes)
+	return &ApiTokenResponse{Token: apiTokenPrefix + "." + id + "." + secret, Info: t.Snapshot()}, nil
+}
+
+func (s *DashCore) RevokeApiToken(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosedDashCore
+	}
+	if t, err := s.store.LoadApiToken(id); err != nil {
+		return err
+	} else if t == nil {
+		return errors.Errorf("api token-[%s] not exists", id)
+	}
+	if err := s.store.DeleteApiToken(id); err != nil {
+		log.ErrorErrorf(err, "store: remove api token-[%s] failed", id)
+		return errors.Errorf("store: remove api token-[%s] failed", id)
+	}
+	log.Warnf("revoke api token-[%s]", id)
+	return nil
+}
+
+func (s *DashCore) ListApiToken() ([]*models.ApiToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosedDashCore
+	}
+	tokens, err := s.store.ListApiToken()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*models.ApiToken, 0, len(tokens))
+	for _, t := range tokens {
+		list = append(list, t.Snapshot())
+	}
+	return list, nil
+}
+
+// GetTokenAdmin returns the admin an api token acts as, its role follows the
+// widest scope of the token but never exceeds the current role of its owner.
+// The tokens of a removed admin are rejected.
+func (s *DashCore) GetTokenAdmin(token string) (*models.Admin, error) {
+	id, secret, ok := parseApiToken(token)
+	if !ok {
+		return nil, errors.New("invalid api token")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosedDashCore
+	}
+	t, err := s.store.LoadApiToken(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hashTokenSecret(secret))) != 1 {
+		return nil, errors.New("invalid api token")
+	}
+	if t.Expired(time.Now()) {
+		return nil, errors.Errorf("api token-[%s] expired", t.Id)
+	}
+	owner := s.tokenOwnerLocked(t.Owner)
+	if owner == nil {
+		return nil, errors.Errorf("api token-[%s] owner admin-[%s] not exists", t.Id, t.Owner)
+	}
+	role := t.Role()
+	if owner.Role > role {
+		role = owner.Role
+	}
+	return &models.Admin{Username: t.Owner + "[token-" + t.Id + "]", Role: role}, nil
+}
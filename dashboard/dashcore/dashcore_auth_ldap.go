@@ -0,0 +1,250 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+const (
+	berTagSequence    = 0x30
+	berTagInteger     = 0x02
+	berTagOctetString = 0x04
+	berTagEnumerated  = 0x0a
+
+	ldapTagBindRequest  = 0x60
+	ldapTagBindResponse = 0x61
+	ldapTagUnbind       = 0x42
+	ldapTagSimpleAuth   = 0x80
+
+	ldapResultSuccess            = 0
+	ldapResultInvalidCredentials = 49
+
+	berMaxLength = 1 << 20
+)
+
+// ldapAuthProvider authenticates with an LDAPv3 simple bind as the bind_dn
+// of the user, the directory is not searched. github.com/go-ldap/ldap is not
+// vendored and the build has no module proxy, a bind only takes the few BER
+// messages encoded below.
+type ldapAuthProvider struct {
+	conf *LdapConfig
+}
+
+func newLdapAuthProvider(conf *LdapConfig) *ldapAuthProvider {
+	return &ldapAuthProvider{conf: conf}
+}
+
+func (p *ldapAuthProvider) Name() string {
+	return AuthProviderLdap
+}
+
+func (p *ldapAuthProvider) Authenticate(username, password string) (*models.Admin, error) {
+	// a bind with an empty password is an unauthenticated bind, which succeeds
+	if username == "" || password == "" {
+		return nil, errors.New("username or password error")
+	}
+	dn := strings.Replace(p.conf.BindDN, "%s", escapeLdapDN(username), 1)
+	if err := ldapBind(p.conf, dn, password); err != nil {
+		return nil, err
+	}
+	return &models.Admin{Username: username}, nil
+}
+
+func ldapBind(conf *LdapConfig, dn, password string) error {
+	timeout := time.Duration(conf.Timeout) * time.Second
+	dialer := &net.Dialer{Timeout: timeout}
+	var c net.Conn
+	var err error
+	if conf.TLS {
+		host, _, _ := net.SplitHostPort(conf.Addr)
+		c, err = tls.DialWithDialer(dialer, "tcp", conf.Addr, &tls.Config{ServerName: host})
+	} else {
+		c, err = dialer.Dial("tcp", conf.Addr)
+	}
+	if err != nil {
+		return errors.Errorf("ldap dial %s failed, %s", conf.Addr, err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(timeout))
+
+	bind := berTLV(ldapTagBindRequest, berInt(3), berTLV(berTagOctetString, []byte(dn)), berTLV(ldapTagSimpleAuth, []byte(password)))
+	if _, err := c.Write(berTLV(berTagSequence, berInt(1), bind)); err != nil {
+		return errors.Errorf("ldap bind failed, %s", err)
+	}
+	code, diag, err := readLdapBindResponse(bufio.NewReader(c))
+	if err != nil {
+		return errors.Errorf("ldap bind failed, %s", err)
+	}
+	c.Write(berTLV(berTagSequence, berInt(2), []byte{ldapTagUnbind, 0}))
+
+	switch code {
+	case ldapResultSuccess:
+		return nil
+	case ldapResultInvalidCredentials:
+		return errors.New("username or password error")
+	default:
+		return errors.Errorf("ldap bind failed, result code %d %s", code, diag)
+	}
+}
+
+func readLdapBindResponse(r *bufio.Reader) (int, string, error) {
+	tag, msg, err := readBer(r)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != berTagSequence {
+		return 0, "", errors.Errorf("unexpected ldap message tag 0x%x", tag)
+	}
+	if tag, _, msg, err = parseBer(msg); err != nil || tag != berTagInteger {
+		return 0, "", errors.New("invalid ldap message id")
+	}
+	tag, op, _, err := parseBer(msg)
+	if err != nil || tag != ldapTagBindResponse {
+		return 0, "", errors.Errorf("unexpected ldap response tag 0x%x", tag)
+	}
+	tag, code, op, err := parseBer(op)
+	if err != nil || tag != berTagEnumerated || len(code) == 0 {
+		return 0, "", errors.New("invalid ldap result code")
+	}
+	var diag []byte
+	if _, _, op, err = parseBer(op); err == nil {
+		_, diag, _, _ = parseBer(op)
+	}
+	return berIntValue(code), string(diag), nil
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func berTLV(tag byte, values ...[]byte) []byte {
+	var v []byte
+	for _, x := range values {
+		v = append(v, x...)
+	}
+	b := append([]byte{tag}, berLength(len(v))...)
+	return append(b, v...)
+}
+
+func berInt(n int) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+		if n == 0 && b[0] < 0x80 {
+			break
+		}
+	}
+	return berTLV(berTagInteger, b)
+}
+
+func berIntValue(b []byte) int {
+	n := 0
+	for _, x := range b {
+		n = n<<8 | int(x)
+	}
+	return n
+}
+
+func readBer(r *bufio.Reader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	l, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n := int(l)
+	if l&0x80 != 0 {
+		if l&0x7f == 0 || l&0x7f > 4 {
+			return 0, nil, errors.New("invalid ber length")
+		}
+		n = 0
+		for i := 0; i < int(l&0x7f); i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	if n > berMaxLength {
+		return 0, nil, errors.New("ber message too large")
+	}
+	v := make([]byte, n)
+	if _, err := io.ReadFull(r, v); err != nil {
+		return 0, nil, err
+	}
+	return tag, v, nil
+}
+
+// parseBer splits the first element off b.
+func parseBer(b []byte) (byte, []byte, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errors.New("invalid ber element")
+	}
+	tag, n, hdr := b[0], int(b[1]), 2
+	if b[1]&0x80 != 0 {
+		k := int(b[1] & 0x7f)
+		if k == 0 || k > 4 || len(b) < 2+k {
+			return 0, nil, nil, errors.New("invalid ber length")
+		}
+		n = 0
+		for _, x := range b[2 : 2+k] {
+			n = n<<8 | int(x)
+		}
+		hdr += k
+	}
+	if n < 0 || n > len(b)-hdr {
+		return 0, nil, nil, errors.New("invalid ber element")
+	}
+	return tag, b[hdr : hdr+n], b[hdr+n:], nil
+}
+
+// escapeLdapDN escapes a value of a distinguished name, see RFC 4514.
+func escapeLdapDN(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 0:
+			b.WriteString(`\00`)
+			continue
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(s)-1 && c == ' ':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
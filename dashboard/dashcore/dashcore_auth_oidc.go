@@ -0,0 +1,344 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/martini-contrib/sessions"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/log"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+const oidcMaxResponse = 1 << 20
+
+// oidcProvider logs users in with the authorization code flow of an OpenID
+// Connect provider. The endpoints come from the discovery document of the
+// issuer, the signing keys from its jwks_uri. It is written on net/http and
+// crypto/rsa since github.com/coreos/go-oidc is not vendored and the build has
+// no module proxy, so only RS256 signed id tokens are supported.
+type oidcProvider struct {
+	conf   *OidcConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type oidcJwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func newOidcProvider(conf *OidcConfig) *oidcProvider {
+	return &oidcProvider{
+		conf:   conf,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *oidcProvider) readResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponse))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("oidc %s returns %d, %s", resp.Request.URL, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.Errorf("oidc %s returns invalid json, %s", resp.Request.URL, err)
+	}
+	return nil
+}
+
+func (p *oidcProvider) getJson(u string, v interface{}) error {
+	resp, err := p.client.Get(u)
+	if err != nil {
+		return errors.Errorf("oidc get %s failed, %s", u, err)
+	}
+	return p.readResponse(resp, v)
+}
+
+func (p *oidcProvider) getDiscovery() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	d := &oidcDiscovery{}
+	if err := p.getJson(strings.TrimSuffix(p.conf.Issuer, "/")+"/.well-known/openid-configuration", d); err != nil {
+		return nil, err
+	}
+	if !sameIssuer(d.Issuer, p.conf.Issuer) {
+		return nil, errors.Errorf("oidc issuer mismatch, discovery = %s", d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JwksURI == "" {
+		return nil, errors.New("oidc discovery misses an endpoint")
+	}
+	p.discovery = d
+	return d, nil
+}
+
+func sameIssuer(a, b string) bool {
+	return strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
+}
+
+// AuthCodeURL returns where to send the browser to log in.
+func (p *oidcProvider) AuthCodeURL(state, nonce string) (string, error) {
+	d, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.conf.ClientId)
+	v.Set("redirect_uri", p.conf.RedirectURL)
+	v.Set("scope", "openid profile email")
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange redeems the code of the callback and returns the username_claim of
+// the verified id token. An email is only a username once the issuer verified
+// it, other claims are never used instead.
+func (p *oidcProvider) Exchange(code, nonce string) (string, error) {
+	d, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.conf.RedirectURL)
+	v.Set("client_id", p.conf.ClientId)
+	v.Set("client_secret", p.conf.ClientSecret)
+	resp, err := p.client.PostForm(d.TokenEndpoint, v)
+	if err != nil {
+		return "", errors.Errorf("oidc token request failed, %s", err)
+	}
+	var tr struct {
+		IdToken string `json:"id_token"`
+	}
+	if err := p.readResponse(resp, &tr); err != nil {
+		return "", err
+	}
+	if tr.IdToken == "" {
+		return "", errors.New("oidc token response misses id_token")
+	}
+	claims, err := p.verifyIdToken(tr.IdToken, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return "", errors.New("oidc id_token nonce mismatch")
+	}
+	name, _ := claims[p.conf.UsernameClaim].(string)
+	if name == "" {
+		return "", errors.Errorf("oidc id_token misses claim %s", p.conf.UsernameClaim)
+	}
+	if p.conf.UsernameClaim == "email" {
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return "", errors.Errorf("oidc email %s is not verified", name)
+		}
+	}
+	return name, nil
+}
+
+func (p *oidcProvider) verifyIdToken(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid oidc id_token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJwtPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, errors.Errorf("unsupported oidc id_token alg %s", header.Alg)
+	}
+	key, err := p.publicKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid oidc id_token signature")
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+		return nil, errors.New("invalid oidc id_token signature")
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodeJwtPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); !sameIssuer(iss, p.conf.Issuer) {
+		return nil, errors.Errorf("oidc id_token issuer mismatch, iss = %s", iss)
+	}
+	if !audienceContains(claims["aud"], p.conf.ClientId) {
+		return nil, errors.New("oidc id_token audience mismatch")
+	}
+	if exp, _ := claims["exp"].(float64); int64(exp) <= now.Unix() {
+		return nil, errors.New("oidc id_token expired")
+	}
+	return claims, nil
+}
+
+func decodeJwtPart(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errors.New("invalid oidc id_token encoding")
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.New("invalid oidc id_token json")
+	}
+	return nil
+}
+
+func audienceContains(aud interface{}, clientId string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientId
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publicKey returns the signing key of kid, an unknown kid refetches the
+// jwks as the provider may have rotated its keys.
+func (p *oidcProvider) publicKey(kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key := p.keys[kid]
+	p.mu.Unlock()
+	if key != nil {
+		return key, nil
+	}
+
+	d, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []*oidcJwk `json:"keys"`
+	}
+	if err := p.getJson(d.JwksURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	if key = keys[kid]; key == nil {
+		return nil, errors.Errorf("oidc signing key %s not found", kid)
+	}
+	return key, nil
+}
+
+const (
+	oidcStateKey = "oidc_state"
+	oidcNonceKey = "oidc_nonce"
+)
+
+// OidcAuthURL starts an oidc login, the state and nonce are kept in the
+// session until the callback.
+func (s *DashCore) OidcAuthURL(session sessions.Session) (string, error) {
+	if s.auth.oidc == nil {
+		return "", errors.New("oidc login is not enabled")
+	}
+	state, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	session.Set(oidcStateKey, state)
+	session.Set(oidcNonceKey, nonce)
+	return s.auth.oidc.AuthCodeURL(state, nonce)
+}
+
+// OidcLogin finishes an oidc login from the state and code of the callback.
+func (s *DashCore) OidcLogin(session sessions.Session, state, code string) (*models.Admin, error) {
+	if s.auth.oidc == nil {
+		return nil, errors.New("oidc login is not enabled")
+	}
+	want, _ := session.Get(oidcStateKey).(string)
+	nonce, _ := session.Get(oidcNonceKey).(string)
+	session.Delete(oidcStateKey)
+	session.Delete(oidcNonceKey)
+	if want == "" || subtle.ConstantTimeCompare([]byte(state), []byte(want)) != 1 {
+		return nil, errors.New("invalid oidc state, please login again")
+	}
+	username, err := s.auth.oidc.Exchange(code, nonce)
+	if err != nil {
+		return nil, err
+	}
+	admin := s.externalAdmin(externalUsername(AuthProviderOidc, username))
+	s.setLoginSession(session, admin, AuthProviderOidc)
+	log.Warnf("admin-[%s] login with oidc", admin.Username)
+	return admin.Snapshot(), nil
+}
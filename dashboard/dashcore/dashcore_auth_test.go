@@ -0,0 +1,568 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martini-contrib/sessions"
+
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+// ldapStandIn answers simple binds, a bind succeeds when the password of the
+// dn matches.
+type ldapStandIn struct {
+	l     net.Listener
+	users map[string]string
+
+	mu  sync.Mutex
+	dns []string
+}
+
+func newLdapStandIn(t *testing.T, users map[string]string) *ldapStandIn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &ldapStandIn{l: l, users: users}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *ldapStandIn) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	_, msg, err := readBer(r)
+	if err != nil {
+		return
+	}
+	_, msgid, msg, err := parseBer(msg)
+	if err != nil {
+		return
+	}
+	tag, op, _, err := parseBer(msg)
+	if err != nil || tag != ldapTagBindRequest {
+		return
+	}
+	_, _, op, _ = parseBer(op)
+	_, dn, op, _ := parseBer(op)
+	_, password, _, _ := parseBer(op)
+
+	s.mu.Lock()
+	s.dns = append(s.dns, string(dn))
+	s.mu.Unlock()
+
+	code := byte(ldapResultInvalidCredentials)
+	if p, ok := s.users[string(dn)]; ok && p == string(password) {
+		code = ldapResultSuccess
+	}
+	res := berTLV(ldapTagBindResponse, berTLV(berTagEnumerated, []byte{code}), berTLV(berTagOctetString, nil), berTLV(berTagOctetString, nil))
+	c.Write(berTLV(berTagSequence, berTLV(berTagInteger, msgid), res))
+	readBer(r)
+}
+
+func (s *ldapStandIn) lastDN() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.dns) == 0 {
+		return ""
+	}
+	return s.dns[len(s.dns)-1]
+}
+
+func TestLdapAuthProvider(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	srv := newLdapStandIn(t, map[string]string{
+		"uid=alice,ou=people,dc=example,dc=com":    "secret",
+		`uid=a\,b\+c,ou=people,dc=example,dc=com`:  "secret",
+		"uid=longpass,ou=people,dc=example,dc=com": long,
+	})
+	p := newLdapAuthProvider(&LdapConfig{
+		Addr:    srv.l.Addr().String(),
+		BindDN:  "uid=%s,ou=people,dc=example,dc=com",
+		Timeout: 5,
+	})
+
+	if a, err := p.Authenticate("alice", "secret"); err != nil || a.Username != "alice" {
+		t.Fatalf("authenticate alice = %v, %v", a, err)
+	}
+	if _, err := p.Authenticate("alice", "wrong"); err == nil {
+		t.Fatal("wrong password authenticated")
+	}
+	if _, err := p.Authenticate("a,b+c", "secret"); err != nil {
+		t.Fatalf("authenticate escaped dn failed, %v, dn = %s", err, srv.lastDN())
+	}
+	if _, err := p.Authenticate("longpass", long); err != nil {
+		t.Fatalf("authenticate with long password failed, %v", err)
+	}
+
+	n := len(srv.dns)
+	if _, err := p.Authenticate("alice", ""); err == nil {
+		t.Fatal("empty password authenticated")
+	}
+	if len(srv.dns) != n {
+		t.Fatal("empty password sent to the directory")
+	}
+
+	down := newLdapAuthProvider(&LdapConfig{Addr: "127.0.0.1:1", BindDN: "uid=%s", Timeout: 1})
+	if _, err := down.Authenticate("alice", "secret"); err == nil {
+		t.Fatal("authenticated without a directory")
+	}
+}
+
+func TestEscapeLdapDN(t *testing.T) {
+	for s, expect := range map[string]string{
+		"alice":    "alice",
+		"a,b":      `a\,b`,
+		` #a `:     `\ #a\ `,
+		"#a":       `\#a`,
+		`x="y";<>`: `x\=\"y\"\;\<\>`,
+		"a\x00":    `a\00`,
+	} {
+		if v := escapeLdapDN(s); v != expect {
+			t.Fatalf("escapeLdapDN(%q) = %s, want %s", s, v, expect)
+		}
+	}
+}
+
+func TestBer(t *testing.T) {
+	for _, n := range []int{0, 1, 127, 128, 255, 256, 70000} {
+		b := berTLV(berTagOctetString, make([]byte, n))
+		tag, v, rest, err := parseBer(append(b, 0x05, 0x00))
+		if err != nil || tag != berTagOctetString || len(v) != n || len(rest) != 2 {
+			t.Fatalf("parseBer of length %d = %x %d %d %v", n, tag, len(v), len(rest), err)
+		}
+	}
+	for _, n := range []int{0, 3, 127, 128, 65535} {
+		_, v, _, err := parseBer(berInt(n))
+		if err != nil || berIntValue(v) != n {
+			t.Fatalf("berInt(%d) = %x", n, berInt(n))
+		}
+	}
+	if _, _, _, err := parseBer([]byte{0x04, 0x05, 0x01}); err == nil {
+		t.Fatal("parseBer of truncated element")
+	}
+}
+
+// oidcStandIn is an issuer serving discovery, jwks and a token endpoint, the
+// id token returned for a code is set by the test.
+type oidcStandIn struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	kid     string
+	key     *rsa.PrivateKey
+	signer  *rsa.PrivateKey
+	claims  map[string]interface{}
+	jwksHit int
+}
+
+func newOidcStandIn(t *testing.T) *oidcStandIn {
+	s := &oidcStandIn{kid: "k1", key: newTestRSAKey(t)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.URL,
+			"authorization_endpoint": s.URL + "/authorize",
+			"token_endpoint":         s.URL + "/token",
+			"jwks_uri":               s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.jwksHit++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": s.kid,
+				"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "good-code" || r.PostFormValue("client_secret") != "cs" ||
+			r.PostFormValue("grant_type") != "authorization_code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		signer := s.key
+		if s.signer != nil {
+			signer = s.signer
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signTestJwt(t, signer, s.kid, s.claims)})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signTestJwt(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOidcProvider(t *testing.T) {
+	srv := newOidcStandIn(t)
+	p := newOidcProvider(&OidcConfig{
+		Enabled:       true,
+		Issuer:        srv.URL,
+		ClientId:      "dashboard",
+		ClientSecret:  "cs",
+		RedirectURL:   "http://127.0.0.1/oidc/callback",
+		UsernameClaim: "preferred_username",
+	})
+
+	u, err := p.AuthCodeURL("st", "nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u, srv.URL+"/authorize?") || !strings.Contains(u, "state=st") || !strings.Contains(u, "nonce=nc") {
+		t.Fatalf("AuthCodeURL = %s", u)
+	}
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":                srv.URL,
+			"aud":                []string{"other", "dashboard"},
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"nonce":              "nc",
+			"sub":                "u-1",
+			"preferred_username": "alice",
+		}
+	}
+	srv.claims = valid()
+	if name, err := p.Exchange("good-code", "nc"); err != nil || name != "alice" {
+		t.Fatalf("Exchange = %s, %v", name, err)
+	}
+	if _, err := p.Exchange("bad-code", "nc"); err == nil {
+		t.Fatal("Exchange of bad code")
+	}
+
+	delete(srv.claims, "preferred_username")
+	srv.claims["email"] = "alice@example.com"
+	if name, err := p.Exchange("good-code", "nc"); err == nil {
+		t.Fatalf("Exchange falls back to another claim, got %s", name)
+	}
+
+	p.conf.UsernameClaim = "email"
+	if name, err := p.Exchange("good-code", "nc"); err == nil {
+		t.Fatalf("Exchange accepts an unverified email %s", name)
+	}
+	srv.claims["email_verified"] = true
+	if name, err := p.Exchange("good-code", "nc"); err != nil || name != "alice@example.com" {
+		t.Fatalf("Exchange of verified email = %s, %v", name, err)
+	}
+	p.conf.UsernameClaim = "preferred_username"
+
+	for name, mutate := range map[string]func(c map[string]interface{}){
+		"nonce":    func(c map[string]interface{}) { c["nonce"] = "other" },
+		"issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"audience": func(c map[string]interface{}) { c["aud"] = "other" },
+		"expired":  func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+	} {
+		srv.claims = valid()
+		mutate(srv.claims)
+		if _, err := p.Exchange("good-code", "nc"); err == nil {
+			t.Fatalf("Exchange accepts bad %s", name)
+		}
+	}
+
+	srv.claims = valid()
+	srv.signer = newTestRSAKey(t)
+	if _, err := p.Exchange("good-code", "nc"); err == nil {
+		t.Fatal("Exchange accepts a token of another key")
+	}
+	srv.signer = nil
+
+	// a rotated key has a new kid, the provider refetches the jwks once
+	srv.mu.Lock()
+	srv.kid, srv.key = "k2", newTestRSAKey(t)
+	hits := srv.jwksHit
+	srv.mu.Unlock()
+	if _, err := p.Exchange("good-code", "nc"); err != nil {
+		t.Fatalf("Exchange after key rotation failed, %v", err)
+	}
+	if _, err := p.Exchange("good-code", "nc"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.jwksHit != hits+1 {
+		t.Fatalf("jwks fetched %d times after rotation", srv.jwksHit-hits)
+	}
+}
+
+func TestParseApiToken(t *testing.T) {
+	if id, secret, ok := parseApiToken("bst.ab12.cd34"); !ok || id != "ab12" || secret != "cd34" {
+		t.Fatalf("parseApiToken = %s %s %v", id, secret, ok)
+	}
+	for _, token := range []string{"", "bst.ab12", "xyz.ab12.cd34", "bst..cd34", "bst.ab12.", "bst.a.b.c"} {
+		if _, _, ok := parseApiToken(token); ok {
+			t.Fatalf("parseApiToken(%q) should fail", token)
+		}
+	}
+	if hashTokenSecret("a") == hashTokenSecret("b") || hashTokenSecret("a") != hashTokenSecret("a") {
+		t.Fatal("hashTokenSecret")
+	}
+	if passwordStamp("$2a$10$x") == passwordStamp("$2a$10$y") {
+		t.Fatal("passwordStamp of different hashes")
+	}
+}
+
+// memClient is an in-memory coordinator.
+type memClient struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (c *memClient) Create(path string, data []byte) error {
+	return c.Update(path, data)
+}
+
+func (c *memClient) Update(path string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[path] = data
+	return nil
+}
+
+func (c *memClient) Delete(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, path)
+	return nil
+}
+
+func (c *memClient) Read(path string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.data[path], nil
+}
+
+func (c *memClient) List(path string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var list []string
+	for p := range c.data {
+		if strings.HasPrefix(p, path+"/") {
+			list = append(list, p)
+		}
+	}
+	return list, nil
+}
+
+func (c *memClient) Details(path string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var list []string
+	for p, b := range c.data {
+		if strings.HasPrefix(p, path+"/") {
+			list = append(list, string(b))
+		}
+	}
+	return list, nil
+}
+
+func (c *memClient) SubList(subPath string) (interface{}, error) {
+	return nil, nil
+}
+
+func (c *memClient) Close() error {
+	return nil
+}
+
+func newAuthTestDashCore() *DashCore {
+	s := &DashCore{
+		config: NewDefaultConfig(),
+		store:  models.NewStore(&memClient{data: make(map[string][]byte)}, "demo"),
+	}
+	s.auth.provider = newAuthProvider(s, &s.config.Auth)
+	s.auth.secret = []byte("test-secret")
+	return s
+}
+
+// mapSession is a session kept in memory.
+type mapSession map[interface{}]interface{}
+
+func (m mapSession) Get(key interface{}) interface{}      { return m[key] }
+func (m mapSession) Set(key interface{}, val interface{}) { m[key] = val }
+func (m mapSession) Delete(key interface{})               { delete(m, key) }
+func (m mapSession) Clear() {
+	for k := range m {
+		delete(m, k)
+	}
+}
+func (m mapSession) AddFlash(value interface{}, vars ...string) {}
+func (m mapSession) Flashes(vars ...string) []interface{}       { return nil }
+func (m mapSession) Options(sessions.Options)                   {}
+
+func TestLoginSessionForged(t *testing.T) {
+	s := newAuthTestDashCore()
+	s.store.UpdateAdmin(&models.Admin{Username: "ldap:root", Password: "x", Role: models.SUPERADMIN})
+
+	forge := func(ls *loginSession) mapSession {
+		b, _ := json.Marshal(ls)
+		return mapSession{AdminKey: b}
+	}
+	expireAt := time.Now().Add(time.Hour).Unix()
+	ls := &loginSession{Username: "ldap:root", Provider: AuthProviderLdap, ExpireAt: expireAt}
+	ls.Stamp = s.externalStamp(ls)
+	if a, err := s.GetLoginAdmin(forge(ls)); err == nil {
+		t.Fatalf("ldap session accepted by a local dashboard as %v", a)
+	}
+
+	s.auth.provider = newLdapAuthProvider(&LdapConfig{})
+	ls.Stamp = ""
+	if a, err := s.GetLoginAdmin(forge(ls)); err == nil {
+		t.Fatalf("ldap session without stamp accepted as %v", a)
+	}
+	ls.Stamp = hex.EncodeToString(make([]byte, sha256.Size))
+	if a, err := s.GetLoginAdmin(forge(ls)); err == nil {
+		t.Fatalf("ldap session with a forged stamp accepted as %v", a)
+	}
+
+	session := mapSession{}
+	s.setLoginSession(session, &models.Admin{Username: "ldap:root"}, AuthProviderLdap)
+	if a, err := s.GetLoginAdmin(session); err != nil || a.Role != models.SUPERADMIN {
+		t.Fatalf("issued ldap session = %v, %v", a, err)
+	}
+	s.auth.secret = []byte("other-secret")
+	if a, err := s.GetLoginAdmin(session); err == nil {
+		t.Fatalf("session of another secret accepted as %v", a)
+	}
+}
+
+func TestApiTokenOwner(t *testing.T) {
+	s := newAuthTestDashCore()
+	alice := &models.Admin{Username: "alice", Password: "x", Role: models.OPADMIN}
+	if err := s.store.UpdateAdmin(alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateApiToken("nobody", &ApiTokenRequest{Name: "ci", Scopes: []string{models.TokenScopeRead}}); err == nil {
+		t.Fatal("token created for a missing admin")
+	}
+	res, err := s.CreateApiToken("alice", &ApiTokenRequest{Name: "ci", Scopes: []string{models.TokenScopeAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, err := s.GetTokenAdmin(res.Token); err != nil || a.Role != models.OPADMIN {
+		t.Fatalf("token role = %v, %v, want the role of its owner", a, err)
+	}
+
+	alice.Role = models.READADMIN
+	s.store.UpdateAdmin(alice)
+	if a, err := s.GetTokenAdmin(res.Token); err != nil || a.Role != models.READADMIN {
+		t.Fatalf("token role = %v, %v, want the current role of its owner", a, err)
+	}
+
+	s.store.DeleteAdmin("alice")
+	if a, err := s.GetTokenAdmin(res.Token); err == nil {
+		t.Fatalf("token of a removed admin accepted as %v", a)
+	}
+
+	res, err = s.CreateApiToken("oidc:bob", &ApiTokenRequest{Name: "ci", Scopes: []string{models.TokenScopeWrite}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, err := s.GetTokenAdmin(res.Token); err != nil || a.Role != models.READADMIN {
+		t.Fatalf("token of an external user = %v, %v, want the default role", a, err)
+	}
+}
+
+func TestExternalAdminNamespace(t *testing.T) {
+	s := newAuthTestDashCore()
+	s.store.UpdateAdmin(&models.Admin{Username: "alice", Password: "x", Role: models.SUPERADMIN})
+	s.store.UpdateAdmin(&models.Admin{Username: "oidc:bob", Password: "oidc:bob", Role: models.OPADMIN})
+
+	if a := s.externalAdmin(externalUsername(AuthProviderOidc, "alice")); a.Username != "oidc:alice" || a.Role != models.READADMIN {
+		t.Fatalf("oidc alice = %v, the local admin alice must not apply", a)
+	}
+	if a := s.externalAdmin("alice"); a.Role != models.READADMIN {
+		t.Fatalf("unprefixed external user = %v", a)
+	}
+	if a := s.externalAdmin(externalUsername(AuthProviderOidc, "bob")); a.Role != models.OPADMIN {
+		t.Fatalf("oidc bob = %v, want the role of admin oidc:bob", a)
+	}
+
+	p := &localAuthProvider{s: s}
+	if _, err := p.Authenticate("oidc:bob", "oidc:bob"); err == nil {
+		t.Fatal("external user logged in with a password")
+	}
+}
+
+func TestMigrateAdminPasswords(t *testing.T) {
+	s := newAuthTestDashCore()
+	s.store.UpdateAdmin(&models.Admin{Username: "bob", Password: "demo", Role: models.OPADMIN})
+	s.store.UpdateAdmin(&models.Admin{Username: "carol", Password: "pw", Role: models.READADMIN})
+
+	p := &localAuthProvider{s: s}
+	if _, err := p.Authenticate("carol", "pw"); err != nil {
+		t.Fatalf("login with a plain text password failed, %v", err)
+	}
+	if a, _ := s.store.LoadAdmin("carol"); !models.IsPasswordHash(a.Password) {
+		t.Fatal("password not rehashed on login")
+	}
+
+	s.migrateAdminPasswords()
+	a, _ := s.store.LoadAdmin("bob")
+	if !models.IsPasswordHash(a.Password) || !a.CheckPassword("demo") || a.Role != models.OPADMIN {
+		t.Fatalf("migrated admin = %+v", a)
+	}
+	if _, err := p.Authenticate("bob", "demo"); err != nil {
+		t.Fatalf("login after migration failed, %v", err)
+	}
+}
@@ -329,7 +329,7 @@ func (s *DashCore) storeGetAdmin(username string) (*models.Admin, error) {
 }
 
 func (s *DashCore) storeCreateAdmin(admin *models.Admin) error {
-	log.Warnf("create admin-[%s]: %s", admin.Username, admin.Encode())
+	log.Warnf("create admin-[%s], role = %v", admin.Username, admin.Role)
 	if err := s.store.UpdateAdmin(admin); err != nil {
 		log.ErrorErrorf(err, "store: create pconfig-[%s] failed", admin.Username)
 		return errors.Errorf("store: create pconfig-[%s] failed", admin.Username)
@@ -338,7 +338,7 @@ func (s *DashCore) storeCreateAdmin(admin *models.Admin) error {
 }
 
 func (s *DashCore) storeUpdateAdmin(admin *models.Admin) error {
-	log.Warnf("update admin-[%s]: %s", admin.Username, admin.Encode())
+	log.Warnf("update admin-[%s], role = %v", admin.Username, admin.Role)
 	if err := s.store.UpdateAdmin(admin); err != nil {
 		log.ErrorErrorf(err, "store: update pconfig-[%s] failed", admin.Username)
 		return errors.Errorf("store: update pconfig-[%s] failed", admin.Username)
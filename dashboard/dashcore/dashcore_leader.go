@@ -0,0 +1,337 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/log"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/uredis"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+type LeaderTransfer struct {
+	GroupId int    `json:"group_id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	NodeId  int    `json:"node_id"`
+	Reason  string `json:"reason"`
+	Done    bool   `json:"done"`
+	Error   string `json:"error,omitempty"`
+}
+
+type LeaderBalancePlan struct {
+	DryRun    bool              `json:"dry_run"`
+	Before    map[string]int    `json:"before"`
+	After     map[string]int    `json:"after"`
+	Transfers []*LeaderTransfer `json:"transfers"`
+	Skipped   map[int]string    `json:"skipped,omitempty"`
+}
+
+type leaderCandidate struct {
+	addr      string
+	machine   string
+	nodeId    int
+	preferred bool
+	local     bool
+}
+
+type leaderGroup struct {
+	id         int
+	leader     string
+	candidates []*leaderCandidate
+}
+
+func (s *DashCore) crontabLeaderBalance() {
+	go func() {
+		for !s.IsClosed() {
+			conf := s.config.LeaderBalance
+			if conf.Enabled && s.IsOnline() {
+				if plan, err := s.LeaderBalance(!conf.DryRun); err != nil {
+					log.WarnErrorf(err, "leader balance failed")
+				} else if len(plan.Transfers) != 0 {
+					log.Warnf("leader balance dry_run = %t, transfers : %d", plan.DryRun, len(plan.Transfers))
+				}
+			}
+			time.Sleep(time.Duration(conf.Interval) * time.Second)
+		}
+	}()
+}
+
+// LeaderBalance plans raft leader transfers that spread the leaders of the
+// groups over the machines, the load of a machine is the number of groups it
+// leads. A group is led by one of its preferred_leaders or, failing that, by
+// a server of the preferred datacenter if it has a healthy one. If confirm is
+// true at most max_transfers leaders are transferred, transfer_interval
+// seconds apart, the others wait for the next round.
+func (s *DashCore) LeaderBalance(confirm bool) (*LeaderBalancePlan, error) {
+	if !s.leader.running.CompareAndSwap(false, true) {
+		return nil, errors.New("leader balance is running")
+	}
+	defer s.leader.running.Set(false)
+
+	conf := s.config.LeaderBalance
+	groups, skipped, err := s.leaderGroups(conf)
+	if err != nil {
+		return nil, err
+	}
+	plan := planLeaderBalance(groups)
+	plan.DryRun = !confirm
+	for gid, reason := range skipped {
+		plan.Skipped[gid] = reason
+	}
+	if !confirm {
+		for _, t := range plan.Transfers {
+			log.Warnf("group-[%d] leader balance dry run: transfer leader %s -> %s (%s)", t.GroupId, t.From, t.To, t.Reason)
+		}
+		return plan, nil
+	}
+
+	for i, t := range plan.Transfers {
+		if i >= conf.MaxTransfers {
+			break
+		}
+		if i != 0 {
+			time.Sleep(time.Duration(conf.TransferInterval) * time.Second)
+		}
+		if err := s.transferGroupLeader(t); err != nil {
+			log.WarnErrorf(err, "group-[%d] transfer leader %s -> %s failed", t.GroupId, t.From, t.To)
+			t.Error = err.Error()
+		} else {
+			log.Warnf("group-[%d] transfer leader %s -> %s (%s)", t.GroupId, t.From, t.To, t.Reason)
+			t.Done = true
+		}
+	}
+	return plan, nil
+}
+
+func (s *DashCore) transferGroupLeader(t *LeaderTransfer) error {
+	s.mu.Lock()
+	ctx, err := s.newContext()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if master := ctx.getGroupMaster(t.GroupId); master != t.From {
+		return errors.Errorf("group-[%d] leader changed to %s", t.GroupId, master)
+	}
+
+	c, err := s.ha.redisp.GetClient(t.From)
+	if err != nil {
+		return err
+	}
+	defer s.ha.redisp.PutClient(c)
+	return c.TransferLeader(t.NodeId)
+}
+
+// leaderGroups collects the healthy raft servers of the groups that may change
+// their leader, groups promoting a server or moving slots keep it.
+func (s *DashCore) leaderGroups(conf LeaderBalanceConfig) ([]*leaderGroup, map[int]string, error) {
+	s.mu.Lock()
+	ctx, err := s.newContext()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	busy := make(map[int]bool)
+	for _, m := range ctx.slots {
+		if m.Action.State != models.ActionNothing {
+			busy[m.GroupId] = true
+			busy[m.Action.TargetId] = true
+		}
+	}
+	preferred := make(map[string]bool, len(conf.PreferredLeaders))
+	for _, addr := range conf.PreferredLeaders {
+		preferred[addr] = true
+	}
+
+	var groups []*leaderGroup
+	skipped := make(map[int]string)
+	cache := uredis.NewInfoCache(s.config.ProductAuth, time.Second, s.stats.redisp)
+	for _, g := range ctx.group {
+		if len(g.Servers) == 0 {
+			continue
+		}
+		if ctx.isGroupPromoting(g.Id) {
+			skipped[g.Id] = "promoting"
+			continue
+		}
+		if busy[g.Id] {
+			skipped[g.Id] = "slot action"
+			continue
+		}
+		lg := &leaderGroup{id: g.Id, leader: ctx.getGroupMaster(g.Id)}
+		for _, x := range g.Servers {
+			if x.ServerRole == models.ServerDeRaftNode {
+				lg = nil
+				break
+			}
+			if len(x.ServerRole) != 0 && x.ServerRole != models.ServerMasterSlaveNode {
+				continue
+			}
+			info, err := cache.GetNodeRaftInfo(x.Addr, false)
+			if err != nil || !info.NodeStatus || info.StartModel != "normal" {
+				continue
+			}
+			nodeId, err := strconv.Atoi(info.CurrentNodeId)
+			if err != nil {
+				continue
+			}
+			lg.candidates = append(lg.candidates, &leaderCandidate{
+				addr:      x.Addr,
+				machine:   leaderMachine(x.Addr),
+				nodeId:    nodeId,
+				preferred: preferred[x.Addr],
+				local:     conf.DataCenter != "" && (x.DataCenter == conf.DataCenter || x.CloudType == conf.DataCenter),
+			})
+		}
+		if lg == nil {
+			skipped[g.Id] = "deraft"
+			continue
+		}
+		groups = append(groups, lg)
+	}
+	return groups, skipped, nil
+}
+
+func leaderMachine(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// planLeaderBalance keeps every leader that may lead its group and moves the
+// others to the least loaded machine they may use, then moves leaders off the
+// most loaded machine while it leads two groups more than another machine one
+// of its groups may use.
+func planLeaderBalance(groups []*leaderGroup) *LeaderBalancePlan {
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].id < groups[j].id
+	})
+
+	plan := &LeaderBalancePlan{
+		Before:  make(map[string]int),
+		After:   make(map[string]int),
+		Skipped: make(map[int]string),
+	}
+	pools := make(map[int][]*leaderCandidate)
+	reasons := make(map[int]string)
+	assigned := make(map[int]*leaderCandidate)
+	for _, g := range groups {
+		if g.leader != "" {
+			plan.Before[leaderMachine(g.leader)]++
+		}
+		for _, c := range g.candidates {
+			plan.After[c.machine] += 0
+		}
+	}
+
+	pick := func(pool []*leaderCandidate) *leaderCandidate {
+		var best *leaderCandidate
+		for _, c := range pool {
+			if best == nil || plan.After[c.machine] < plan.After[best.machine] {
+				best = c
+			}
+		}
+		return best
+	}
+
+	for _, g := range groups {
+		var pool []*leaderCandidate
+		reason := "balance"
+		for _, c := range g.candidates {
+			if c.preferred {
+				pool = append(pool, c)
+				reason = "preferred leader"
+			}
+		}
+		if len(pool) == 0 {
+			for _, c := range g.candidates {
+				if c.local {
+					pool = append(pool, c)
+					reason = "datacenter"
+				}
+			}
+		}
+		if len(pool) == 0 {
+			pool = g.candidates
+		}
+		if len(pool) == 0 {
+			plan.Skipped[g.id] = "no healthy server"
+			continue
+		}
+		pools[g.id], reasons[g.id] = pool, reason
+		for _, c := range pool {
+			if c.addr == g.leader {
+				assigned[g.id] = c
+			}
+		}
+	}
+	for _, g := range groups {
+		if c := assigned[g.id]; c != nil {
+			plan.After[c.machine]++
+		}
+	}
+	for _, g := range groups {
+		if pools[g.id] != nil && assigned[g.id] == nil {
+			c := pick(pools[g.id])
+			assigned[g.id] = c
+			plan.After[c.machine]++
+		}
+	}
+
+	for moves := 0; moves < len(groups); moves++ {
+		var from *leaderGroup
+		var to *leaderCandidate
+		for _, g := range groups {
+			cur := assigned[g.id]
+			if cur == nil {
+				continue
+			}
+			c := pick(pools[g.id])
+			if plan.After[cur.machine]-plan.After[c.machine] < 2 {
+				continue
+			}
+			if from == nil || plan.After[cur.machine] > plan.After[assigned[from.id].machine] {
+				from, to = g, c
+			}
+		}
+		if from == nil {
+			break
+		}
+		plan.After[assigned[from.id].machine]--
+		plan.After[to.machine]++
+		assigned[from.id] = to
+	}
+
+	for _, g := range groups {
+		if c := assigned[g.id]; c != nil && c.addr != g.leader {
+			plan.Transfers = append(plan.Transfers, &LeaderTransfer{
+				GroupId: g.id,
+				From:    g.leader,
+				To:      c.addr,
+				NodeId:  c.nodeId,
+				Reason:  reasons[g.id],
+			})
+		}
+	}
+	return plan
+}
@@ -0,0 +1,84 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newTestLeaderGroup(id int, leader string, machines ...string) *leaderGroup {
+	g := &leaderGroup{id: id, leader: leader}
+	for i, m := range machines {
+		addr := fmt.Sprintf("%s:%d", m, 6000+id)
+		g.candidates = append(g.candidates, &leaderCandidate{addr: addr, machine: m, nodeId: i + 1})
+	}
+	return g
+}
+
+func TestPlanLeaderBalance(t *testing.T) {
+	var groups []*leaderGroup
+	for id := 1; id <= 6; id++ {
+		groups = append(groups, newTestLeaderGroup(id, fmt.Sprintf("10.0.0.1:%d", 6000+id), "10.0.0.1", "10.0.0.2", "10.0.0.3"))
+	}
+	plan := planLeaderBalance(groups)
+	if plan.Before["10.0.0.1"] != 6 {
+		t.Fatalf("unexpected leaders before %v", plan.Before)
+	}
+	for _, m := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if plan.After[m] != 2 {
+			t.Fatalf("unexpected leaders after %v", plan.After)
+		}
+	}
+	if len(plan.Transfers) != 4 {
+		t.Fatalf("unexpected transfers %d", len(plan.Transfers))
+	}
+
+	// a balanced layout is left alone
+	plan = planLeaderBalance([]*leaderGroup{
+		newTestLeaderGroup(1, "10.0.0.1:6001", "10.0.0.1", "10.0.0.2"),
+		newTestLeaderGroup(2, "10.0.0.1:6002", "10.0.0.1", "10.0.0.2"),
+		newTestLeaderGroup(3, "10.0.0.2:6003", "10.0.0.1", "10.0.0.2"),
+	})
+	if len(plan.Transfers) != 0 {
+		t.Fatalf("balanced layout moved %d leaders", len(plan.Transfers))
+	}
+}
+
+func TestPlanLeaderBalancePreferred(t *testing.T) {
+	g1 := newTestLeaderGroup(1, "10.0.0.1:6001", "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	g1.candidates[2].preferred = true
+	g2 := newTestLeaderGroup(2, "10.0.0.1:6002", "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	g2.candidates[1].local = true
+	g3 := newTestLeaderGroup(3, "10.0.0.9:6003", "10.0.0.1", "10.0.0.2")
+
+	plan := planLeaderBalance([]*leaderGroup{g3, g2, g1})
+	if len(plan.Transfers) != 3 {
+		t.Fatalf("unexpected transfers %d", len(plan.Transfers))
+	}
+	expect := []struct {
+		to     string
+		reason string
+	}{
+		{"10.0.0.3:6001", "preferred leader"},
+		{"10.0.0.2:6002", "datacenter"},
+		{"10.0.0.1:6003", "balance"},
+	}
+	for i, e := range expect {
+		if tr := plan.Transfers[i]; tr.To != e.to || tr.Reason != e.reason {
+			t.Fatalf("transfer %d to %s (%s), expect %s (%s)", i, tr.To, tr.Reason, e.to, e.reason)
+		}
+	}
+}
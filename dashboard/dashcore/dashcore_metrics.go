@@ -0,0 +1,138 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/martini-contrib/sessions"
+	"github.com/zuoyebang/bitalostored/butils/promtext"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+const metricsPrefix = "bitalosdashboard_"
+
+var serverStatsMetrics = map[string]string{
+	"instantaneous_ops_per_sec": "server_qps",
+	"connected_clients":         "server_connected_clients",
+	"used_size":                 "server_used_size_bytes",
+	"data_size":                 "server_data_size_bytes",
+	"raft_log_index":            "server_raft_log_index",
+	"raft_apply_lag_us":         "server_raft_apply_lag_us",
+	"sync_queue_length":         "server_raft_queue_length",
+	"is_migrate":                "server_migrating",
+}
+
+var serverStatsCounters = map[string]string{
+	"total_commands_processed": "server_commands_total",
+}
+
+// Metrics serves the prometheus metrics to a login session or an api token,
+// scrapers send a token of the read scope as "Authorization: Bearer <token>".
+func (s *apiServer) Metrics(session sessions.Session, w http.ResponseWriter, req *http.Request) {
+	if err := s.verifyLogin(session, req); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.dashCore.WritePrometheus(w)
+}
+
+// WritePrometheus writes the product topology, the last collected server
+// and proxy stats and the slot migration progress in Prometheus text format.
+func (s *DashCore) WritePrometheus(w io.Writer) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	mw := promtext.NewWriter(metricsPrefix, fmt.Sprintf(`product=%q`, s.config.ProductName))
+
+	mw.Gauge("up", "", promtext.BoolToFloat(s.online && !s.closed))
+	mw.Gauge("groups", "", float64(len(s.cache.group)))
+	mw.Gauge("proxies", "", float64(len(s.cache.proxy)))
+
+	for _, g := range s.cache.group {
+		for _, x := range g.Servers {
+			labels := fmt.Sprintf(`group="%d",node=%q,role=%q`, g.Id, x.Addr, x.ServerRole)
+			v := s.stats.servers[x.Addr]
+			mw.Gauge("server_up", labels, promtext.BoolToFloat(v != nil && v.Error == nil && !v.Timeout))
+			if v == nil || v.Stats == nil {
+				continue
+			}
+			if role := v.Stats["role"]; role != "" {
+				labels = fmt.Sprintf(`group="%d",node=%q,role=%q`, g.Id, x.Addr, role)
+			}
+			for field, name := range serverStatsMetrics {
+				if f, err := strconv.ParseFloat(v.Stats[field], 64); err == nil {
+					mw.Gauge(name, labels, f)
+				}
+			}
+			for field, name := range serverStatsCounters {
+				if f, err := strconv.ParseFloat(v.Stats[field], 64); err == nil {
+					mw.Counter(name, labels, f)
+				}
+			}
+		}
+	}
+
+	for _, p := range s.cache.proxy {
+		labels := fmt.Sprintf(`node=%q,role="proxy"`, p.ProxyAddr)
+		v := s.stats.proxies[p.Token]
+		mw.Gauge("proxy_up", labels, promtext.BoolToFloat(v != nil && v.Error == nil && !v.Timeout))
+		if v == nil || v.Stats == nil {
+			continue
+		}
+		mw.Gauge("proxy_online", labels, promtext.BoolToFloat(v.Stats.Online))
+		mw.Gauge("proxy_qps", labels, float64(v.Stats.CmdOps.QPS))
+		mw.Counter("proxy_commands_total", labels, float64(v.Stats.CmdOps.Total))
+		mw.Counter("proxy_commands_failed_total", labels, float64(v.Stats.CmdOps.Fails))
+		mw.Gauge("proxy_sessions_alive", labels, float64(v.Stats.Sessions.Alive))
+	}
+
+	slotStates := map[string]int{}
+	for _, m := range s.cache.slots {
+		if m.Action.State != models.ActionNothing {
+			slotStates[m.Action.State]++
+		}
+	}
+	for _, state := range []string{
+		models.ActionPending,
+		models.ActionPreparing,
+		models.ActionPrepared,
+		models.ActionMigrating,
+		models.ActionFinished,
+		models.ActionSyncing,
+	} {
+		mw.Gauge("slot_actions", fmt.Sprintf(`state=%q`, state), float64(slotStates[state]))
+	}
+	mw.Gauge("slot_action_disabled", "", promtext.BoolToFloat(s.action.disabled.Bool()))
+
+	for _, m := range s.cache.migrate {
+		if m.Status == nil {
+			continue
+		}
+		labels := fmt.Sprintf(`slot="%d",source_group="%d",target_group="%d"`, m.SID, m.SourceGroupID, m.TargetGroupID)
+		mw.Gauge("migrate_status", labels, float64(m.Status.Status))
+		mw.Gauge("migrate_keys", labels, float64(m.Status.Total))
+		mw.Counter("migrate_failed_keys_total", labels, float64(m.Status.Fails))
+		mw.Gauge("migrate_duration_seconds", labels, float64(m.Status.Costs)/1e3)
+	}
+
+	mw.WriteTo(w)
+	metrics.WritePrometheus(w, true)
+}
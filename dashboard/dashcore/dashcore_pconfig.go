@@ -41,6 +41,9 @@ func (s *DashCore) CreatePConfig(pconfig *models.Pconfig) error {
 	if len(pconfig.Name) <= 0 {
 		return errors.Errorf("invalid params name = %s, content = %+v", pconfig.Name, pconfig.Content)
 	}
+	if err := checkPconfigContent(pconfig); err != nil {
+		return err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	ctx, err := s.newContext()
@@ -59,6 +62,23 @@ func (s *DashCore) CreatePConfig(pconfig *models.Pconfig) error {
 	return s.storeCreatePconfig(pconfig)
 }
 
+func checkPconfigContent(pconfig *models.Pconfig) error {
+	if pconfig.Content == nil {
+		return errors.Errorf("pconfig-[%s] missing content", pconfig.Name)
+	}
+	switch pconfig.Name {
+	case models.Rate_Limit:
+		for _, rule := range pconfig.Content.RateLimits {
+			if err := rule.Validate(); err != nil {
+				return err
+			}
+		}
+	case models.Prefix_Rules:
+		return models.ValidatePrefixRules(pconfig.Content.PrefixRules)
+	}
+	return nil
+}
+
 func updateBlackWhiteList(pconfig *models.Pconfig) {
 	if len(pconfig.Content.Black) > 0 {
 		pconfig.Content.BlackMap = make(map[string]bool)
@@ -79,6 +99,9 @@ func (s *DashCore) UpdatePConfig(pconfig *models.Pconfig) error {
 	if len(pconfig.Name) <= 0 {
 		return errors.Errorf("invalid params name = %s, content = %+v", pconfig.Name, pconfig.Content)
 	}
+	if err := checkPconfigContent(pconfig); err != nil {
+		return err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	ctx, err := s.newContext()
@@ -140,6 +140,55 @@ func (s *DashCore) ReinitProxy(token string) error {
 	return s.reinitProxy(ctx, p, c)
 }
 
+func (s *DashCore) ReloadProxyConfig(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+
+	p, err := ctx.getProxy(token)
+	if err != nil {
+		return err
+	}
+	if err := s.newProxyClient(p).ReloadConfig(); err != nil {
+		log.ErrorErrorf(err, "proxy-[%s] reload config failed", p.Token)
+		return errors.Errorf("proxy-[%s] reload config failed, %s", p.Token, err)
+	}
+	return nil
+}
+
+func (s *DashCore) ReloadProxyConfigAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+
+	var fut sync2.Future
+	for _, p := range ctx.proxy {
+		fut.Add()
+		go func(p *models.Proxy) {
+			err := s.newProxyClient(p).ReloadConfig()
+			if err != nil {
+				log.ErrorErrorf(err, "proxy-[%s] reload config failed", p.Token)
+			}
+			fut.Done(p.Token, err)
+		}(p)
+	}
+	for t, v := range fut.Wait() {
+		switch err := v.(type) {
+		case error:
+			if err != nil {
+				return errors.Errorf("proxy-[%s] reload config failed", t)
+			}
+		}
+	}
+	return nil
+}
+
 func (s *DashCore) newProxyClient(p *models.Proxy) *proxy.ApiClient {
 	c := proxy.NewApiClient(p.AdminAddr)
 	c.SetXAuth(s.config.ProductName, s.config.ProductAuth, p.Token)
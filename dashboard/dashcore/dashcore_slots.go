@@ -21,6 +21,7 @@ import (
 
 	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
 	"github.com/zuoyebang/bitalostored/dashboard/internal/log"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/uredis"
 	"github.com/zuoyebang/bitalostored/dashboard/models"
 
 	rbtree "github.com/emirpasic/gods/trees/redblacktree"
@@ -271,6 +272,131 @@ func (s *DashCore) SlotRemoveAction(sid int) error {
 	return s.storeUpdateSlotMapping(m)
 }
 
+// SlotPauseAction parks the action of a slot, a migrating slot stops copying
+// data on its source while the keys already moved stay readable.
+func (s *DashCore) SlotPauseAction(sid int) error {
+	return s.setSlotActionPaused(sid, true)
+}
+
+func (s *DashCore) SlotResumeAction(sid int) error {
+	return s.setSlotActionPaused(sid, false)
+}
+
+func (s *DashCore) setSlotActionPaused(sid int, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+
+	m, err := ctx.getSlotMapping(sid)
+	if err != nil {
+		return err
+	}
+	if m.Action.State == models.ActionNothing {
+		return errors.Errorf("slot-[%d] action doesn't exist", sid)
+	}
+	if m.Action.Paused == paused {
+		return nil
+	}
+
+	if m.Action.State == models.ActionMigrating && !m.Action.NotMigrateData {
+		if from := ctx.getGroupMaster(m.GroupId); from != "" {
+			c, err := s.action.redisp.GetClient(from)
+			if err != nil {
+				return err
+			}
+			defer s.action.redisp.PutClient(c)
+			if paused {
+				err = c.MigratePause(sid)
+			} else {
+				err = c.MigrateResume(sid)
+			}
+			if err != nil && !uredis.IsMigrateNotExist(err) {
+				return err
+			}
+		}
+	}
+	defer s.dirtySlotsCache(m.Id)
+
+	m.Action.Paused = paused
+	log.Warnf("slot-[%d] action paused = %t", m.Id, paused)
+	return s.storeUpdateSlotMapping(m)
+}
+
+// SlotCancelAction drops the action of a slot. A migrating slot is dropped
+// only if its source has not moved any key yet, otherwise it is paused and
+// has to be resumed to finish.
+func (s *DashCore) SlotCancelAction(sid int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+
+	m, err := ctx.getSlotMapping(sid)
+	if err != nil {
+		return err
+	}
+	switch m.Action.State {
+	case models.ActionNothing:
+		return errors.Errorf("slot-[%d] action doesn't exist", sid)
+	case models.ActionPending, models.ActionPreparing, models.ActionPrepared:
+	case models.ActionMigrating:
+		if !m.Action.NotMigrateData {
+			from := ctx.getGroupMaster(m.GroupId)
+			if from == "" {
+				return errors.Errorf("slot-[%d] source group-[%d] has no master", sid, m.GroupId)
+			}
+			c, err := s.action.redisp.GetClient(from)
+			if err != nil {
+				return err
+			}
+			defer s.action.redisp.PutClient(c)
+			dropped, err := c.MigrateCancel(sid)
+			if err != nil && !uredis.IsMigrateNotExist(err) {
+				return err
+			}
+			if err == nil && !dropped {
+				defer s.dirtySlotsCache(m.Id)
+				m.Action.Paused = true
+				if err := s.storeUpdateSlotMapping(m); err != nil {
+					return err
+				}
+				return errors.Errorf("slot-[%d] has moved keys to group-[%d], action is paused, resume it to finish", sid, m.Action.TargetId)
+			}
+		}
+	default:
+		return errors.Errorf("slot-[%d] action can't be canceled in state %s", sid, m.Action.State)
+	}
+	defer s.dirtySlotsCache(m.Id)
+
+	log.Warnf("slot-[%d] action canceled : %s", m.Id, m.Encode())
+	m = &models.SlotMapping{
+		Id:      m.Id,
+		GroupId: m.GroupId,
+	}
+	return s.storeUpdateSlotMapping(m)
+}
+
+// slotActionStopped reports whether the action of a slot was paused or
+// canceled while it is processed.
+func (s *DashCore) slotActionStopped(sid int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return false
+	}
+	m, err := ctx.getSlotMapping(sid)
+	if err != nil {
+		return false
+	}
+	return m.Action.Paused || m.Action.State == models.ActionNothing
+}
+
 func (s *DashCore) SlotActionPrepare() (int, bool, error) {
 	return s.SlotActionPrepareFilter(nil, nil)
 }
@@ -301,7 +427,7 @@ func (s *DashCore) SlotActionPrepareFilter(accept, update func(m *models.SlotMap
 
 	var minActionIndex = func(filter func(m *models.SlotMapping) bool) (picked *models.SlotMapping) {
 		for _, m := range ctx.slots {
-			if m.Action.State == models.ActionNothing {
+			if m.Action.State == models.ActionNothing || m.Action.Paused {
 				continue
 			}
 			if filter(m) {
@@ -434,6 +560,43 @@ func (s *DashCore) SlotActionComplete(sourceAddr string, sid int) error {
 	}
 }
 
+// SlotActionRollback keeps a slot on its source after the copy on the target
+// failed the verification, the source already dropped the copy and owns every
+// key of the slot.
+func (s *DashCore) SlotActionRollback(sourceAddr string, sid int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+
+	m, err := ctx.getSlotMapping(sid)
+	if err != nil {
+		return err
+	}
+	if m.Action.State != models.ActionMigrating {
+		return errors.Errorf("slot-[%d] action state is invalid", m.Id)
+	}
+
+	c, err := s.action.redisp.GetClient(sourceAddr)
+	if err != nil {
+		return err
+	}
+	defer s.action.redisp.PutClient(c)
+	if err := c.MigrateEnd(sid); err != nil {
+		return err
+	}
+	defer s.dirtySlotsCache(m.Id)
+
+	log.Warnf("slot-[%d] action rolled back : %s", m.Id, m.Encode())
+	m = &models.SlotMapping{
+		Id:      m.Id,
+		GroupId: m.GroupId,
+	}
+	return s.storeUpdateSlotMapping(m)
+}
+
 func (s *DashCore) newSlotActionExecutor(sid int) (func() (needMigrate bool, sourceAddr string, sourceGroupID, targetGroupID int, err error), error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -751,9 +914,17 @@ func (s *DashCore) SlotsRebalance(confirm bool) (map[int]int, error) {
 	if !confirm {
 		return plans, nil
 	}
+	if err := s.createRebalanceActions(ctx, plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
 
+// createRebalanceActions turns a rebalance plan of slot id to target group id
+// into pending slot actions, in slot id order.
+func (s *DashCore) createRebalanceActions(ctx *context, plans map[int]int) error {
 	var slotIds []int
-	for sid, _ := range plans {
+	for sid := range plans {
 		slotIds = append(slotIds, sid)
 	}
 	sort.Ints(slotIds)
@@ -761,7 +932,7 @@ func (s *DashCore) SlotsRebalance(confirm bool) (map[int]int, error) {
 	for _, sid := range slotIds {
 		m, err := ctx.getSlotMapping(sid)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		defer s.dirtySlotsCache(m.Id)
 
@@ -769,8 +940,8 @@ func (s *DashCore) SlotsRebalance(confirm bool) (map[int]int, error) {
 		m.Action.Index = ctx.maxSlotActionIndex() + 1
 		m.Action.TargetId = plans[sid]
 		if err := s.storeUpdateSlotMapping(m); err != nil {
-			return nil, err
+			return err
 		}
 	}
-	return plans, nil
+	return nil
 }
@@ -0,0 +1,324 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"sort"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/sync2"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/uredis"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+const (
+	// a rebalance stops once the heaviest and the lightest group differ by
+	// less than this fraction of the average group load
+	rebalanceLoadTolerance = 0.05
+	rebalanceMaxMoves      = models.MaxSlotNum
+)
+
+type SlotStats struct {
+	Id      int `json:"id"`
+	GroupId int `json:"group_id"`
+
+	uredis.SlotStats
+}
+
+type GroupLoad struct {
+	Slots    int   `json:"slots"`
+	Keys     int64 `json:"keys"`
+	Bytes    int64 `json:"bytes"`
+	ReadQPS  int64 `json:"read_qps"`
+	WriteQPS int64 `json:"write_qps"`
+}
+
+type SlotStatsReport struct {
+	Slots  []*SlotStats       `json:"slots"`
+	Groups map[int]*GroupLoad `json:"groups"`
+	Errors map[string]string  `json:"errors,omitempty"`
+}
+
+type slotStatsResult struct {
+	stats map[int]*uredis.SlotStats
+	err   error
+}
+
+// SlotStats collects the per-slot stats from the master of every group, the
+// stats of a slot are taken from the group it is mapped to.
+func (s *DashCore) SlotStats(timeout time.Duration) (*SlotStatsReport, error) {
+	s.mu.Lock()
+	ctx, err := s.newContext()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var fut sync2.Future
+	masters := ctx.getGroupMasters()
+	for _, addr := range masters {
+		addr := addr
+		fut.Add()
+		go func() {
+			ch := make(chan *slotStatsResult, 1)
+			go func() {
+				stats, err := s.serverSlotStats(addr)
+				ch <- &slotStatsResult{stats: stats, err: err}
+			}()
+			select {
+			case res := <-ch:
+				fut.Done(addr, res)
+			case <-time.After(timeout):
+				fut.Done(addr, &slotStatsResult{err: ErrSlotStatsTimeout})
+			}
+		}()
+	}
+
+	results := make(map[string]*slotStatsResult)
+	report := &SlotStatsReport{
+		Slots:  make([]*SlotStats, 0, len(ctx.slots)),
+		Groups: make(map[int]*GroupLoad),
+	}
+	for addr, v := range fut.Wait() {
+		res := v.(*slotStatsResult)
+		if res.err != nil {
+			if report.Errors == nil {
+				report.Errors = make(map[string]string)
+			}
+			report.Errors[addr] = res.err.Error()
+			continue
+		}
+		results[addr] = res
+	}
+	for gid, addr := range masters {
+		if results[addr] != nil {
+			report.Groups[gid] = &GroupLoad{}
+		}
+	}
+
+	for _, m := range ctx.slots {
+		st := &SlotStats{Id: m.Id, GroupId: m.GroupId}
+		if res := results[masters[m.GroupId]]; res != nil {
+			if x := res.stats[m.Id]; x != nil {
+				st.SlotStats = *x
+			}
+			g := report.Groups[m.GroupId]
+			g.Slots++
+			g.Keys += st.Keys
+			g.Bytes += st.Bytes
+			g.ReadQPS += st.ReadQPS
+			g.WriteQPS += st.WriteQPS
+		}
+		report.Slots = append(report.Slots, st)
+	}
+	return report, nil
+}
+
+func (s *DashCore) serverSlotStats(addr string) (map[int]*uredis.SlotStats, error) {
+	c, err := s.stats.redisp.GetClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer s.stats.redisp.PutClient(c)
+	return c.SlotStats()
+}
+
+type SlotsRebalancePlan struct {
+	Plans  map[int]int     `json:"plans"`
+	Before map[int]float64 `json:"before"`
+	After  map[int]float64 `json:"after"`
+}
+
+// SlotsRebalanceByLoad plans slot moves that even out the size and the
+// traffic of the groups instead of their slot count. The load of a slot is its
+// share of the total bytes plus its share of the total QPS, the plan moves
+// slots from the heaviest to the lightest group until the groups are within
+// rebalanceLoadTolerance of each other. If confirm is true the moves are
+// created as pending slot actions.
+func (s *DashCore) SlotsRebalanceByLoad(confirm bool, timeout time.Duration) (*SlotsRebalancePlan, error) {
+	report, err := s.SlotStats(timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(report.Errors) != 0 {
+		for addr, e := range report.Errors {
+			return nil, errors.Errorf("get slot stats of %s failed: %s", addr, e)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return nil, err
+	}
+
+	var groupIds []int
+	for _, g := range ctx.group {
+		if len(g.Servers) != 0 {
+			groupIds = append(groupIds, g.Id)
+		}
+	}
+	sort.Ints(groupIds)
+	if len(groupIds) == 0 {
+		return nil, errors.Errorf("no valid group could be found")
+	}
+
+	plan := planLoadRebalance(ctx.slots, groupIds, slotLoadWeights(report.Slots))
+	if !confirm {
+		return plan, nil
+	}
+	if err := s.createRebalanceActions(ctx, plan.Plans); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// planLoadRebalance assigns unmapped slots to the lightest groups, heaviest
+// slot first, then moves slots from the heaviest to the lightest group.
+func planLoadRebalance(slots []*models.SlotMapping, groupIds []int, weights map[int]float64) *SlotsRebalancePlan {
+	var (
+		load     = make(map[int]float64)
+		movable  = make(map[int][]int)
+		docking  []int
+		plans    = make(map[int]int)
+		totLoad  float64
+		avgLoad  float64
+		inGroups = make(map[int]bool)
+	)
+	for _, gid := range groupIds {
+		inGroups[gid] = true
+		load[gid] = 0
+	}
+	for _, m := range slots {
+		w := weights[m.Id]
+		totLoad += w
+		switch {
+		case m.Action.State != models.ActionNothing:
+			load[m.Action.TargetId] += w
+		case m.GroupId == 0 || !inGroups[m.GroupId]:
+			docking = append(docking, m.Id)
+		default:
+			load[m.GroupId] += w
+			movable[m.GroupId] = append(movable[m.GroupId], m.Id)
+		}
+	}
+	avgLoad = totLoad / float64(len(groupIds))
+
+	before := make(map[int]float64, len(groupIds))
+	for _, gid := range groupIds {
+		before[gid] = load[gid]
+	}
+
+	lightest := func() int {
+		dest := groupIds[0]
+		for _, gid := range groupIds[1:] {
+			if load[gid] < load[dest] {
+				dest = gid
+			}
+		}
+		return dest
+	}
+	heaviest := func() int {
+		from := groupIds[0]
+		for _, gid := range groupIds[1:] {
+			if load[gid] > load[from] {
+				from = gid
+			}
+		}
+		return from
+	}
+
+	sort.Slice(docking, func(i, j int) bool {
+		if weights[docking[i]] != weights[docking[j]] {
+			return weights[docking[i]] > weights[docking[j]]
+		}
+		return docking[i] < docking[j]
+	})
+	for _, sid := range docking {
+		dest := lightest()
+		plans[sid] = dest
+		load[dest] += weights[sid]
+	}
+
+	for moves := 0; moves < rebalanceMaxMoves && len(groupIds) >= 2; moves++ {
+		from, dest := heaviest(), lightest()
+		gap := load[from] - load[dest]
+		if gap <= avgLoad*rebalanceLoadTolerance {
+			break
+		}
+		// the best slot brings both groups closest to the middle of the gap,
+		// slots not lighter than the gap would only swap the roles of the groups
+		pick, best := -1, 0.0
+		for i, sid := range movable[from] {
+			w := weights[sid]
+			if w <= 0 || w >= gap {
+				continue
+			}
+			if gain := w * (gap - w); gain > best {
+				pick, best = i, gain
+			}
+		}
+		if pick < 0 {
+			break
+		}
+		sid := movable[from][pick]
+		movable[from] = append(movable[from][:pick], movable[from][pick+1:]...)
+		plans[sid] = dest
+		load[from] -= weights[sid]
+		load[dest] += weights[sid]
+	}
+
+	plan := &SlotsRebalancePlan{
+		Plans:  plans,
+		Before: make(map[int]float64, len(groupIds)),
+		After:  make(map[int]float64, len(groupIds)),
+	}
+	for _, gid := range groupIds {
+		if totLoad > 0 {
+			plan.Before[gid] = before[gid] / totLoad
+			plan.After[gid] = load[gid] / totLoad
+		}
+	}
+	return plan
+}
+
+// slotLoadWeights weights every slot by its share of the total bytes plus its
+// share of the total read and write QPS. Without any stats all slots weigh
+// the same and the plan falls back to balancing the slot count.
+func slotLoadWeights(slots []*SlotStats) map[int]float64 {
+	var totBytes, totQPS int64
+	for _, st := range slots {
+		totBytes += st.Bytes
+		totQPS += st.ReadQPS + st.WriteQPS
+	}
+
+	weights := make(map[int]float64, len(slots))
+	for _, st := range slots {
+		var w float64
+		if totBytes > 0 {
+			w += float64(st.Bytes) / float64(totBytes)
+		}
+		if totQPS > 0 {
+			w += float64(st.ReadQPS+st.WriteQPS) / float64(totQPS)
+		}
+		if totBytes == 0 && totQPS == 0 {
+			w = 1
+		}
+		weights[st.Id] = w
+	}
+	return weights
+}
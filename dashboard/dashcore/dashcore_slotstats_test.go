@@ -0,0 +1,98 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"math"
+	"testing"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/uredis"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+func newTestSlots(groups ...int) []*models.SlotMapping {
+	slots := make([]*models.SlotMapping, models.MaxSlotNum)
+	for i := range slots {
+		slots[i] = &models.SlotMapping{Id: i, GroupId: groups[i*len(groups)/len(slots)]}
+	}
+	return slots
+}
+
+func TestSlotLoadWeights(t *testing.T) {
+	slots := []*SlotStats{
+		{Id: 0, SlotStats: uredis.SlotStats{Bytes: 300, ReadQPS: 10}},
+		{Id: 1, SlotStats: uredis.SlotStats{Bytes: 100, WriteQPS: 30}},
+		{Id: 2},
+	}
+	w := slotLoadWeights(slots)
+	if math.Abs(w[0]-1.0) > 1e-9 || math.Abs(w[1]-1.0) > 1e-9 || w[2] != 0 {
+		t.Fatalf("unexpected weights %v", w)
+	}
+
+	w = slotLoadWeights([]*SlotStats{{Id: 0}, {Id: 1}})
+	if w[0] != 1 || w[1] != 1 {
+		t.Fatalf("empty stats should weigh every slot the same, weights %v", w)
+	}
+}
+
+func TestPlanLoadRebalance(t *testing.T) {
+	slots := newTestSlots(1, 2)
+	weights := make(map[int]float64)
+	for i := range slots {
+		weights[i] = 1
+	}
+	// group 1 holds ten hot slots
+	for i := 0; i < 10; i++ {
+		weights[i] = 100
+	}
+
+	plan := planLoadRebalance(slots, []int{1, 2}, weights)
+	if len(plan.Plans) == 0 {
+		t.Fatal("rebalance plan should move slots")
+	}
+	for sid, gid := range plan.Plans {
+		if gid != 2 || slots[sid].GroupId != 1 {
+			t.Fatalf("slot %d should move from group 1 to 2, target %d", sid, gid)
+		}
+	}
+	if gap := math.Abs(plan.After[1] - plan.After[2]); gap > rebalanceLoadTolerance/2 {
+		t.Fatalf("groups are still unbalanced after %v", plan.After)
+	}
+	if plan.Before[1] <= plan.After[1] {
+		t.Fatalf("heavy group load should drop before %v after %v", plan.Before, plan.After)
+	}
+}
+
+func TestPlanLoadRebalanceUnassigned(t *testing.T) {
+	slots := newTestSlots(0)
+	weights := make(map[int]float64)
+	for i := range slots {
+		weights[i] = 1
+	}
+
+	plan := planLoadRebalance(slots, []int{1, 2, 3}, weights)
+	if len(plan.Plans) != models.MaxSlotNum {
+		t.Fatalf("all slots should be assigned, planned %d", len(plan.Plans))
+	}
+	count := make(map[int]int)
+	for _, gid := range plan.Plans {
+		count[gid]++
+	}
+	for _, gid := range []int{1, 2, 3} {
+		if n := count[gid]; n < models.MaxSlotNum/3 || n > models.MaxSlotNum/3+1 {
+			t.Fatalf("group %d got %d slots", gid, n)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"sort"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/sync2"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/uredis"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+const (
+	SlowLogRoleProxy  = "proxy"
+	SlowLogRoleServer = "server"
+)
+
+type SlowLogEntry struct {
+	Role    string `json:"role"`
+	Node    string `json:"node"`
+	GroupId int    `json:"group_id,omitempty"`
+
+	uredis.SlowLogEntry
+}
+
+type SlowLogReport struct {
+	Entries []*SlowLogEntry   `json:"entries"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+type slowLogResult struct {
+	entries []*SlowLogEntry
+	err     error
+}
+
+// SlowLog collects the slow log rings of all proxies and group servers, the merged
+// entries are ordered from newest to oldest and at most num entries are returned.
+func (s *DashCore) SlowLog(num int, timeout time.Duration) (*SlowLogReport, error) {
+	s.mu.Lock()
+	ctx, err := s.newContext()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var fut sync2.Future
+	goSlowLog := func(key string, do func() ([]*SlowLogEntry, error)) {
+		fut.Add()
+		go func() {
+			ch := make(chan *slowLogResult, 1)
+			go func() {
+				entries, err := do()
+				ch <- &slowLogResult{entries: entries, err: err}
+			}()
+			select {
+			case res := <-ch:
+				fut.Done(key, res)
+			case <-time.After(timeout):
+				fut.Done(key, &slowLogResult{err: ErrSlowLogTimeout})
+			}
+		}()
+	}
+
+	for _, p := range ctx.proxy {
+		p := p
+		goSlowLog(SlowLogRoleProxy+"-"+p.Token, func() ([]*SlowLogEntry, error) {
+			return s.proxySlowLog(p, num)
+		})
+	}
+	for _, g := range ctx.group {
+		for _, x := range g.Servers {
+			gid, addr := g.Id, x.Addr
+			goSlowLog(SlowLogRoleServer+"-"+addr, func() ([]*SlowLogEntry, error) {
+				return s.serverSlowLog(gid, addr, num)
+			})
+		}
+	}
+
+	report := &SlowLogReport{Entries: make([]*SlowLogEntry, 0, 64)}
+	for key, v := range fut.Wait() {
+		res := v.(*slowLogResult)
+		if res.err != nil {
+			if report.Errors == nil {
+				report.Errors = make(map[string]string)
+			}
+			report.Errors[key] = res.err.Error()
+			continue
+		}
+		report.Entries = append(report.Entries, res.entries...)
+	}
+	sort.Slice(report.Entries, func(i, j int) bool {
+		a, b := report.Entries[i], report.Entries[j]
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		return a.DurationUs > b.DurationUs
+	})
+	if num >= 0 && len(report.Entries) > num {
+		report.Entries = report.Entries[:num]
+	}
+	return report, nil
+}
+
+func (s *DashCore) proxySlowLog(p *models.Proxy, num int) ([]*SlowLogEntry, error) {
+	list, err := s.newProxyClient(p).SlowLog(num)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*SlowLogEntry, 0, len(list))
+	for _, e := range list {
+		entries = append(entries, &SlowLogEntry{
+			Role: SlowLogRoleProxy,
+			Node: p.ProxyAddr,
+			SlowLogEntry: uredis.SlowLogEntry{
+				Id:         e.Id,
+				Time:       e.Time,
+				DurationUs: e.DurationUs,
+				Args:       e.Args,
+				Addr:       e.Addr,
+				Name:       e.Name,
+			},
+		})
+	}
+	return entries, nil
+}
+
+func (s *DashCore) serverSlowLog(gid int, addr string, num int) ([]*SlowLogEntry, error) {
+	c, err := s.stats.redisp.GetClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer s.stats.redisp.PutClient(c)
+
+	list, err := c.SlowLogGet(num)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*SlowLogEntry, 0, len(list))
+	for _, e := range list {
+		entries = append(entries, &SlowLogEntry{
+			Role:         SlowLogRoleServer,
+			Node:         addr,
+			GroupId:      gid,
+			SlowLogEntry: *e,
+		})
+	}
+	return entries, nil
+}
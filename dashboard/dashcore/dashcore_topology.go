@@ -0,0 +1,426 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/log"
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+// PlanTopology parses a json or yaml topology spec, diffs it against the
+// product and stores the ordered plan, the plan is only applied by
+// ApplyTopology.
+func (s *DashCore) PlanTopology(data []byte) (*models.TopologyPlan, error) {
+	spec, err := models.ParseTopologySpec(data)
+	if err != nil {
+		return nil, err
+	}
+	if !s.topology.running.CompareAndSwap(false, true) {
+		return nil, errors.New("topology apply is running")
+	}
+	defer s.topology.running.Set(false)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planTopology(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	plan.CreateTime = time.Now().Format("2006-01-02 15:04:05")
+	plan.UpdateTime = plan.CreateTime
+	if err := s.store.UpdateTopologyPlan(plan); err != nil {
+		log.ErrorErrorf(err, "store: update topology plan failed")
+		return nil, errors.Errorf("store: update topology plan failed")
+	}
+	log.Warnf("topology plan created, steps : %d", len(plan.Steps))
+	return plan, nil
+}
+
+func (s *DashCore) GetTopologyPlan() (*models.TopologyPlan, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosedDashCore
+	}
+	return s.store.LoadTopologyPlan()
+}
+
+// ApplyTopology applies the stored plan from its first pending step, each
+// step is saved once done so a failed or interrupted apply resumes where it
+// stopped. A step the product already satisfies is marked done untouched.
+func (s *DashCore) ApplyTopology() (*models.TopologyPlan, error) {
+	if !s.topology.running.CompareAndSwap(false, true) {
+		return nil, errors.New("topology apply is running")
+	}
+	defer s.topology.running.Set(false)
+
+	plan, err := s.GetTopologyPlan()
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, errors.New("topology plan not found")
+	}
+	if plan.State == models.TopologyApplied {
+		return plan, nil
+	}
+
+	for plan.Next < len(plan.Steps) {
+		step := plan.Steps[plan.Next]
+		plan.State = models.TopologyApplying
+		if err := s.applyTopologyStep(step); err != nil {
+			log.WarnErrorf(err, "topology step-[%d] %s failed", plan.Next, step.Op)
+			step.Error = err.Error()
+			plan.State = models.TopologyFailed
+			if err := s.updateTopologyPlan(plan); err != nil {
+				return nil, err
+			}
+			return plan, err
+		}
+		log.Warnf("topology step-[%d] %s done", plan.Next, step.Op)
+		step.Done, step.Error = true, ""
+		plan.Next++
+		if err := s.updateTopologyPlan(plan); err != nil {
+			return nil, err
+		}
+	}
+	plan.State = models.TopologyApplied
+	return plan, s.updateTopologyPlan(plan)
+}
+
+func (s *DashCore) updateTopologyPlan(plan *models.TopologyPlan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosedDashCore
+	}
+	plan.UpdateTime = time.Now().Format("2006-01-02 15:04:05")
+	if err := s.store.UpdateTopologyPlan(plan); err != nil {
+		log.ErrorErrorf(err, "store: update topology plan failed")
+		return errors.Errorf("store: update topology plan failed")
+	}
+	return nil
+}
+
+func (s *DashCore) applyTopologyStep(step *models.TopologyStep) error {
+	s.mu.Lock()
+	ctx, err := s.newContext()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if topologyStepSatisfied(ctx, step) {
+		return nil
+	}
+
+	switch step.Op {
+	case models.TopologyCreateGroup:
+		return s.CreateGroup(step.GroupId)
+	case models.TopologyAddServer:
+		return s.GroupAddServer(step.GroupId, step.Role, step.CloudType, step.Addr)
+	case models.TopologyMountServer:
+		return s.GroupMountOrOfflineNode(topologyMountModel(step.Role), step.GroupId, step.Addr, step.RaftAddr, step.NodeId)
+	case models.TopologyChangeRole:
+		return s.ChangeServerRole(step.GroupId, step.Role, step.Addr)
+	case models.TopologyCreateProxy:
+		return s.CreateProxy(step.Addr)
+	case models.TopologyCreatePconfig:
+		return s.CreatePConfig(copyPconfig(step.Pconfig))
+	case models.TopologyUpdatePconfig:
+		return s.UpdatePConfig(copyPconfig(step.Pconfig))
+	case models.TopologyAssignSlots:
+		return s.SlotCreateActionRange(step.Begin, step.End, step.GroupId, false, step.NotMigrateData)
+	default:
+		return errors.Errorf("invalid topology op %s", step.Op)
+	}
+}
+
+func copyPconfig(p *models.Pconfig) *models.Pconfig {
+	c := *p
+	if p.Content != nil {
+		content := *p.Content
+		c.Content = &content
+	}
+	return &c
+}
+
+func topologyMountModel(role string) int {
+	switch role {
+	case models.ServerOberserNode:
+		return 2
+	case models.ServerWitnessNode:
+		return 4
+	default:
+		return 1
+	}
+}
+
+func topologyStepSatisfied(ctx *context, step *models.TopologyStep) bool {
+	switch step.Op {
+	case models.TopologyCreateGroup:
+		return ctx.group[step.GroupId] != nil
+	case models.TopologyAddServer:
+		return topologyFindServer(ctx, step.GroupId, step.Addr) != nil
+	case models.TopologyChangeRole:
+		x := topologyFindServer(ctx, step.GroupId, step.Addr)
+		return x != nil && x.ServerRole == step.Role
+	case models.TopologyCreateProxy:
+		return topologyFindProxy(ctx, step.Addr) != nil
+	case models.TopologyCreatePconfig:
+		return ctx.pconfig[step.Pconfig.Name] != nil
+	case models.TopologyUpdatePconfig:
+		return pconfigEqual(ctx.pconfig[step.Pconfig.Name], step.Pconfig)
+	case models.TopologyAssignSlots:
+		for sid := step.Begin; sid <= step.End && sid < len(ctx.slots); sid++ {
+			if !slotTargetsGroup(ctx.slots[sid], step.GroupId) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func topologyFindServer(ctx *context, gid int, addr string) *models.GroupServer {
+	if g := ctx.group[gid]; g != nil {
+		for _, x := range g.Servers {
+			if x.Addr == addr {
+				return x
+			}
+		}
+	}
+	return nil
+}
+
+func topologyFindProxy(ctx *context, addr string) *models.Proxy {
+	for _, p := range ctx.proxy {
+		if p.AdminAddr == addr {
+			return p
+		}
+	}
+	return nil
+}
+
+func slotTargetsGroup(m *models.SlotMapping, gid int) bool {
+	if m.Action.State != models.ActionNothing {
+		return m.Action.TargetId == gid
+	}
+	return m.GroupId == gid
+}
+
+func pconfigEqual(a, b *models.Pconfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Remark != b.Remark {
+		return false
+	}
+	x, err := json.Marshal(a.Content)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b.Content)
+	if err != nil {
+		return false
+	}
+	return string(x) == string(y)
+}
+
+// planTopology orders the changes from the product in ctx to spec: groups,
+// their servers, mounts and roles, then proxies, pconfigs and last the slot
+// ranges, whose groups exist by then. Nothing is removed, groups and servers
+// missing from the spec are reported as unmanaged.
+func planTopology(ctx *context, spec *models.TopologySpec) (*models.TopologyPlan, error) {
+	if err := validateTopologySpec(ctx, spec); err != nil {
+		return nil, err
+	}
+	plan := &models.TopologyPlan{Spec: spec, State: models.TopologyPlanned}
+
+	var mounts, roles []*models.TopologyStep
+	managed := make(map[string]bool)
+	for _, gs := range spec.Groups {
+		g := ctx.group[gs.Id]
+		if g == nil {
+			plan.Steps = append(plan.Steps, &models.TopologyStep{Op: models.TopologyCreateGroup, GroupId: gs.Id})
+		}
+		first := g == nil || len(g.Servers) == 0
+		for _, ss := range gs.Servers {
+			managed[ss.Addr] = true
+			role := ss.Role
+			if role == "" {
+				role = models.ServerMasterSlaveNode
+			}
+			if x := topologyFindServer(ctx, gs.Id, ss.Addr); x != nil {
+				if x.ServerRole != role {
+					roles = append(roles, &models.TopologyStep{
+						Op: models.TopologyChangeRole, GroupId: gs.Id, Addr: ss.Addr, Role: role,
+					})
+				}
+				continue
+			}
+			plan.Steps = append(plan.Steps, &models.TopologyStep{
+				Op: models.TopologyAddServer, GroupId: gs.Id, Addr: ss.Addr, Role: role, CloudType: ss.CloudType,
+			})
+			if !first && ss.RaftAddr != "" && ss.NodeId > 0 && role != models.ServerDeRaftNode {
+				mounts = append(mounts, &models.TopologyStep{
+					Op: models.TopologyMountServer, GroupId: gs.Id, Addr: ss.Addr, Role: role,
+					RaftAddr: ss.RaftAddr, NodeId: ss.NodeId,
+				})
+			}
+			first = false
+		}
+	}
+	plan.Steps = append(plan.Steps, mounts...)
+	plan.Steps = append(plan.Steps, roles...)
+
+	for _, addr := range spec.Proxies {
+		if topologyFindProxy(ctx, addr) == nil {
+			plan.Steps = append(plan.Steps, &models.TopologyStep{Op: models.TopologyCreateProxy, Addr: addr})
+		}
+	}
+
+	for _, p := range spec.Pconfigs {
+		if x := ctx.pconfig[p.Name]; x == nil {
+			plan.Steps = append(plan.Steps, &models.TopologyStep{Op: models.TopologyCreatePconfig, Pconfig: p})
+		} else if !pconfigEqual(x, p) {
+			plan.Steps = append(plan.Steps, &models.TopologyStep{Op: models.TopologyUpdatePconfig, Pconfig: p})
+		}
+	}
+
+	for _, r := range spec.Slots {
+		var step *models.TopologyStep
+		for sid := r.Begin; sid <= r.End; sid++ {
+			if sid < len(ctx.slots) && slotTargetsGroup(ctx.slots[sid], r.GroupId) {
+				step = nil
+				continue
+			}
+			if step == nil {
+				step = &models.TopologyStep{
+					Op: models.TopologyAssignSlots, GroupId: r.GroupId, Begin: sid, NotMigrateData: r.NotMigrateData,
+				}
+				plan.Steps = append(plan.Steps, step)
+			}
+			step.End = sid
+		}
+	}
+
+	var gids []int
+	for gid := range ctx.group {
+		gids = append(gids, gid)
+	}
+	sort.Ints(gids)
+	specGroups := make(map[int]bool)
+	for _, gs := range spec.Groups {
+		specGroups[gs.Id] = true
+	}
+	for _, gid := range gids {
+		if !specGroups[gid] {
+			plan.Unmanaged = append(plan.Unmanaged, fmt.Sprintf("group-[%d]", gid))
+			continue
+		}
+		for _, x := range ctx.group[gid].Servers {
+			if !managed[x.Addr] {
+				plan.Unmanaged = append(plan.Unmanaged, "server-["+x.Addr+"]")
+			}
+		}
+	}
+	return plan, nil
+}
+
+func validateTopologySpec(ctx *context, spec *models.TopologySpec) error {
+	groups := make(map[int]bool)
+	nonEmpty := make(map[int]bool)
+	addrs := make(map[string]int)
+	for _, g := range ctx.group {
+		for _, x := range g.Servers {
+			addrs[x.Addr] = g.Id
+			nonEmpty[g.Id] = true
+		}
+	}
+	seen := make(map[string]bool)
+	for _, gs := range spec.Groups {
+		if gs.Id <= 0 || gs.Id > models.MaxGroupId {
+			return errors.Errorf("invalid group id = %d, out of range", gs.Id)
+		}
+		if groups[gs.Id] {
+			return errors.Errorf("group-[%d] is duplicated", gs.Id)
+		}
+		groups[gs.Id] = true
+		for _, ss := range gs.Servers {
+			if ss.Addr == "" {
+				return errors.Errorf("group-[%d] has a server without address", gs.Id)
+			}
+			if seen[ss.Addr] {
+				return errors.Errorf("server-[%s] is duplicated", ss.Addr)
+			}
+			seen[ss.Addr] = true
+			nonEmpty[gs.Id] = true
+			if gid, ok := addrs[ss.Addr]; ok && gid != gs.Id {
+				return errors.Errorf("server-[%s] already exists in group-[%d]", ss.Addr, gid)
+			}
+			if ss.Role != "" && !models.CheckInServerRole(ss.Role) {
+				return errors.Errorf("server-[%s] invalid server_role %s", ss.Addr, ss.Role)
+			}
+		}
+	}
+
+	var owner [MaxSlotNum]bool
+	for _, r := range spec.Slots {
+		if !(r.Begin >= 0 && r.Begin <= r.End && r.End < MaxSlotNum) {
+			return errors.Errorf("invalid slot range [%d,%d]", r.Begin, r.End)
+		}
+		if !groups[r.GroupId] && ctx.group[r.GroupId] == nil {
+			return errors.Errorf("slot range [%d,%d] group-[%d] doesn't exist", r.Begin, r.End, r.GroupId)
+		}
+		if !nonEmpty[r.GroupId] {
+			return errors.Errorf("slot range [%d,%d] group-[%d] is empty", r.Begin, r.End, r.GroupId)
+		}
+		for sid := r.Begin; sid <= r.End; sid++ {
+			if owner[sid] {
+				return errors.Errorf("slot-[%d] is assigned twice", sid)
+			}
+			owner[sid] = true
+		}
+	}
+
+	proxies := make(map[string]bool)
+	for _, addr := range spec.Proxies {
+		if addr == "" || proxies[addr] {
+			return errors.Errorf("invalid proxy address %q", addr)
+		}
+		proxies[addr] = true
+	}
+	pconfigs := make(map[string]bool)
+	for _, p := range spec.Pconfigs {
+		if p == nil || len(p.Name) == 0 || pconfigs[p.Name] {
+			return errors.New("invalid or duplicated pconfig name")
+		}
+		pconfigs[p.Name] = true
+		if err := checkPconfigContent(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dashcore
+
+import (
+	"testing"
+
+	"github.com/zuoyebang/bitalostored/dashboard/models"
+)
+
+func newTestTopologyContext() *context {
+	ctx := &context{
+		group: map[int]*models.Group{
+			1: {Id: 1, Servers: []*models.GroupServer{
+				{Addr: "10.0.0.1:6001", ServerRole: models.ServerMasterSlaveNode},
+				{Addr: "10.0.0.2:6001", ServerRole: models.ServerMasterSlaveNode},
+			}},
+			3: {Id: 3, Servers: []*models.GroupServer{{Addr: "10.0.0.9:6003"}}},
+		},
+		proxy:   map[string]*models.Proxy{"t1": {Token: "t1", AdminAddr: "10.0.1.1:2110"}},
+		pconfig: map[string]*models.Pconfig{},
+	}
+	for sid := 0; sid < MaxSlotNum; sid++ {
+		m := &models.SlotMapping{Id: sid}
+		if sid < 512 {
+			m.GroupId = 1
+		}
+		ctx.slots = append(ctx.slots, m)
+	}
+	return ctx
+}
+
+func TestParseTopologySpec(t *testing.T) {
+	yamlSpec := `
+groups:
+  - id: 2
+    servers:
+      - addr: 10.0.0.1:6002
+      - addr: 10.0.0.2:6002
+        server_role: observer_node
+        raft_addr: 10.0.0.2:16002
+        node_id: 2
+slots:
+  - {begin: 512, end: 1023, group_id: 2}
+proxies: [10.0.1.2:2110]
+`
+	spec, err := models.ParseTopologySpec([]byte(yamlSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Groups) != 1 || len(spec.Groups[0].Servers) != 2 || spec.Groups[0].Servers[1].NodeId != 2 {
+		t.Fatalf("unexpected groups %+v", spec.Groups)
+	}
+	if len(spec.Slots) != 1 || spec.Slots[0].Begin != 512 || spec.Slots[0].GroupId != 2 {
+		t.Fatalf("unexpected slots %+v", spec.Slots)
+	}
+
+	jsonSpec := `{"groups":[{"id":2,"servers":[{"addr":"10.0.0.1:6002"}]}],"proxies":["10.0.1.2:2110"]}`
+	if spec, err = models.ParseTopologySpec([]byte(jsonSpec)); err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Groups) != 1 || len(spec.Proxies) != 1 {
+		t.Fatalf("unexpected spec %+v", spec)
+	}
+	if _, err := models.ParseTopologySpec([]byte("  ")); err == nil {
+		t.Fatal("empty spec should fail")
+	}
+}
+
+func TestPlanTopology(t *testing.T) {
+	ctx := newTestTopologyContext()
+	ctx.slots[600].Action.State = models.ActionPending
+	ctx.slots[600].Action.TargetId = 2
+	spec := &models.TopologySpec{
+		Groups: []*models.GroupSpec{
+			{Id: 1, Servers: []*models.ServerSpec{
+				{Addr: "10.0.0.1:6001"},
+				{Addr: "10.0.0.2:6001", Role: models.ServerWitnessNode},
+				{Addr: "10.0.0.3:6001", RaftAddr: "10.0.0.3:16001", NodeId: 3},
+			}},
+			{Id: 2, Servers: []*models.ServerSpec{
+				{Addr: "10.0.0.1:6002", RaftAddr: "10.0.0.1:16002", NodeId: 1},
+				{Addr: "10.0.0.2:6002", Role: models.ServerOberserNode, RaftAddr: "10.0.0.2:16002", NodeId: 2},
+			}},
+		},
+		Slots: []*models.SlotRangeSpec{
+			{Begin: 0, End: 511, GroupId: 1},
+			{Begin: 512, End: 1023, GroupId: 2},
+		},
+		Proxies: []string{"10.0.1.1:2110", "10.0.1.2:2110"},
+		Pconfigs: []*models.Pconfig{
+			{Name: "blacklist", Content: &models.WhiteAndBlackList{Black: []string{"k"}}},
+		},
+	}
+	plan, err := planTopology(ctx, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []models.TopologyStep{
+		{Op: models.TopologyAddServer, GroupId: 1, Addr: "10.0.0.3:6001"},
+		{Op: models.TopologyCreateGroup, GroupId: 2},
+		{Op: models.TopologyAddServer, GroupId: 2, Addr: "10.0.0.1:6002"},
+		{Op: models.TopologyAddServer, GroupId: 2, Addr: "10.0.0.2:6002"},
+		{Op: models.TopologyMountServer, GroupId: 1, Addr: "10.0.0.3:6001"},
+		{Op: models.TopologyMountServer, GroupId: 2, Addr: "10.0.0.2:6002"},
+		{Op: models.TopologyChangeRole, GroupId: 1, Addr: "10.0.0.2:6001"},
+		{Op: models.TopologyCreateProxy, Addr: "10.0.1.2:2110"},
+		{Op: models.TopologyCreatePconfig},
+		{Op: models.TopologyAssignSlots, GroupId: 2, Begin: 512, End: 599},
+		{Op: models.TopologyAssignSlots, GroupId: 2, Begin: 601, End: 1023},
+	}
+	if len(plan.Steps) != len(expect) {
+		t.Fatalf("unexpected steps %d, want %d", len(plan.Steps), len(expect))
+	}
+	for i, e := range expect {
+		s := plan.Steps[i]
+		if s.Op != e.Op || s.GroupId != e.GroupId || s.Addr != e.Addr || s.Begin != e.Begin || s.End != e.End {
+			t.Fatalf("step-[%d] = %+v, want %+v", i, s, e)
+		}
+	}
+	if plan.Steps[5].Role != models.ServerOberserNode || topologyMountModel(plan.Steps[5].Role) != 2 {
+		t.Fatalf("unexpected mount step %+v", plan.Steps[5])
+	}
+	if len(plan.Unmanaged) != 1 || plan.Unmanaged[0] != "group-[3]" {
+		t.Fatalf("unexpected unmanaged %v", plan.Unmanaged)
+	}
+	if plan.State != models.TopologyPlanned || plan.Next != 0 {
+		t.Fatalf("unexpected plan state %s next %d", plan.State, plan.Next)
+	}
+
+	for _, step := range plan.Steps {
+		if step.Op == models.TopologyAssignSlots && topologyStepSatisfied(ctx, step) {
+			t.Fatalf("step %+v should not be satisfied", step)
+		}
+	}
+	if !topologyStepSatisfied(ctx, &models.TopologyStep{Op: models.TopologyAssignSlots, GroupId: 1, Begin: 0, End: 511}) {
+		t.Fatal("slots [0,511] already in group-[1]")
+	}
+}
+
+func TestPlanTopologyInvalid(t *testing.T) {
+	for _, spec := range []*models.TopologySpec{
+		{Groups: []*models.GroupSpec{{Id: 0}}},
+		{Groups: []*models.GroupSpec{{Id: 2, Servers: []*models.ServerSpec{{Addr: "10.0.0.1:6001"}}}}},
+		{Groups: []*models.GroupSpec{{Id: 2, Servers: []*models.ServerSpec{{Addr: "a:1", Role: "leader"}}}}},
+		{Slots: []*models.SlotRangeSpec{{Begin: 0, End: 1024, GroupId: 1}}},
+		{Slots: []*models.SlotRangeSpec{{Begin: 0, End: 10, GroupId: 1}, {Begin: 10, End: 20, GroupId: 1}}},
+		{Slots: []*models.SlotRangeSpec{{Begin: 0, End: 10, GroupId: 5}}},
+		{Groups: []*models.GroupSpec{{Id: 2}}, Slots: []*models.SlotRangeSpec{{Begin: 0, End: 10, GroupId: 2}}},
+	} {
+		if _, err := planTopology(newTestTopologyContext(), spec); err == nil {
+			t.Fatalf("spec %+v should be invalid", spec)
+		}
+	}
+}
@@ -16,4 +16,8 @@ package dashcore
 
 import "errors"
 
-var ErrInitGroupID = errors.New("group id is zero")
+var (
+	ErrInitGroupID      = errors.New("group id is zero")
+	ErrSlowLogTimeout   = errors.New("slowlog request timeout")
+	ErrSlotStatsTimeout = errors.New("slotstats request timeout")
+)
@@ -59,6 +59,15 @@ func (c *ApiClient) StatsSimple() (*Stats, error) {
 	return stats, nil
 }
 
+func (c *ApiClient) SlowLog(num int) ([]*SlowLogEntry, error) {
+	url := c.encodeURL("/api/proxy/slowlog/%s/%d", c.xauth, num)
+	var entries []*SlowLogEntry
+	if err := rpc.ApiGetJson(url, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
 func (c *ApiClient) Start() error {
 	url := c.encodeURL("/api/proxy/start/%s", c.xauth)
 	return rpc.ApiPutJson(url, nil, nil)
@@ -69,6 +78,11 @@ func (c *ApiClient) Shutdown() error {
 	return rpc.ApiPutJson(url, nil, nil)
 }
 
+func (c *ApiClient) ReloadConfig() error {
+	url := c.encodeURL("/api/proxy/reload/%s", c.xauth)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
 func (c *ApiClient) ReadCrossCloud(flag string) error {
 	url := c.encodeURL("/api/proxy/readcrosscloud/%s/%s", c.xauth, flag)
 	return rpc.ApiPutJson(url, nil, nil)
@@ -132,3 +132,12 @@ type RuntimeStats struct {
 }
 
 type StatsFlags uint32
+
+type SlowLogEntry struct {
+	Id         int64    `json:"id"`
+	Time       int64    `json:"time"`
+	DurationUs int64    `json:"duration_us"`
+	Args       []string `json:"args"`
+	Addr       string   `json:"addr"`
+	Name       string   `json:"name"`
+}
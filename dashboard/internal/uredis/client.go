@@ -319,6 +319,15 @@ func (c *Client) RemoveRaftNode(nodeId int) error {
 	return nil
 }
 
+// TransferLeader asks the raft group of the server to hand its leadership to
+// the node nodeId.
+func (c *Client) TransferLeader(nodeId int) error {
+	if _, err := c.Do("transfer", nodeId); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
 func (c *Client) GetClusterMemberShip() (*MembershipV2, error) {
 	var data []byte
 	var err error
@@ -382,6 +391,41 @@ func (c *Client) MigrateSlots(slotid int, target string) error {
 	return nil
 }
 
+func (c *Client) MigratePause(slotid int) error {
+	if _, err := c.Do("MIGRATEPAUSE", slotid); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+func (c *Client) MigrateResume(slotid int) error {
+	if _, err := c.Do("MIGRATERESUME", slotid); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// MigrateCancel stops the migration of a slot, it reports whether the slot
+// was dropped whole because no key had been moved yet.
+func (c *Client) MigrateCancel(slotid int) (bool, error) {
+	n, err := redigo.Int(c.Do("MIGRATECANCEL", slotid))
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return n == 1, nil
+}
+
+// IsMigrateRunning reports whether a migrate command was refused because the
+// node already migrates as many slots as it may.
+func IsMigrateRunning(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "migrate running")
+}
+
+// IsMigrateNotExist reports whether the node has no migration of the slot.
+func IsMigrateNotExist(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "migrate not exist")
+}
+
 type MigrateSlotAsyncOption struct {
 	MaxBulks int
 	MaxBytes int
@@ -409,6 +453,84 @@ func (c *Client) SlotsInfo() (map[int]int, error) {
 	}
 }
 
+type SlotStats struct {
+	Keys     int64 `json:"keys"`
+	Bytes    int64 `json:"bytes"`
+	ReadQPS  int64 `json:"read_qps"`
+	WriteQPS int64 `json:"write_qps"`
+}
+
+// SlotStats returns the stats of the slots holding keys or serving traffic, absent slots are idle and empty.
+func (c *Client) SlotStats() (map[int]*SlotStats, error) {
+	infos, err := redigo.Values(c.Do("SLOTSTATS"))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	slots := make(map[int]*SlotStats, len(infos))
+	for i, info := range infos {
+		p, err := redigo.Values(info, nil)
+		if err != nil || len(p) != 2 {
+			return nil, errors.Errorf("invalid response[%d] = %v", i, info)
+		}
+		sid, err := redigo.Int(p[0], nil)
+		if err != nil {
+			return nil, errors.Errorf("invalid response[%d] = %v", i, info)
+		}
+		fields, err := redigo.Int64Map(p[1], nil)
+		if err != nil {
+			return nil, errors.Errorf("invalid response[%d] = %v", i, info)
+		}
+		slots[sid] = &SlotStats{
+			Keys:     fields["keys"],
+			Bytes:    fields["bytes"],
+			ReadQPS:  fields["read_qps"],
+			WriteQPS: fields["write_qps"],
+		}
+	}
+	return slots, nil
+}
+
+type SlowLogEntry struct {
+	Id            int64    `json:"id"`
+	Time          int64    `json:"time"`
+	DurationUs    int64    `json:"duration_us"`
+	Args          []string `json:"args"`
+	Addr          string   `json:"addr"`
+	Name          string   `json:"name"`
+	QueueWaitUs   int64    `json:"queue_wait_us"`
+	RaftProposeUs int64    `json:"raft_propose_us"`
+	ApplyUs       int64    `json:"apply_us"`
+}
+
+func (c *Client) SlowLogGet(num int) ([]*SlowLogEntry, error) {
+	infos, err := redigo.Values(c.Do("SLOWLOG", "GET", num))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	entries := make([]*SlowLogEntry, 0, len(infos))
+	for i, info := range infos {
+		fields, err := redigo.Values(info, nil)
+		if err != nil || len(fields) < 6 {
+			return nil, errors.Errorf("invalid response[%d] = %v", i, info)
+		}
+		e := &SlowLogEntry{}
+		e.Id, _ = redigo.Int64(fields[0], nil)
+		e.Time, _ = redigo.Int64(fields[1], nil)
+		e.DurationUs, _ = redigo.Int64(fields[2], nil)
+		e.Args, _ = redigo.Strings(fields[3], nil)
+		e.Addr, _ = redigo.String(fields[4], nil)
+		e.Name, _ = redigo.String(fields[5], nil)
+		if len(fields) > 6 {
+			phases, _ := redigo.Int64Map(fields[6], nil)
+			e.QueueWaitUs = phases["queue_wait_us"]
+			e.RaftProposeUs = phases["raft_propose_us"]
+			e.ApplyUs = phases["apply_us"]
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
 func (c *Client) Role() (string, error) {
 	if reply, err := c.Do("ROLE"); err != nil {
 		return "", err
@@ -14,6 +14,13 @@
 
 package models
 
+import (
+	"crypto/subtle"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
 const (
 	SUPERADMIN AdminRole = 1
 	OPADMIN    AdminRole = 2
@@ -32,6 +39,39 @@ func (a *Admin) Encode() []byte {
 	return jsonEncode(a)
 }
 
+// HashPassword returns the salted bcrypt hash of password, admins store the
+// hash and never the password.
+func HashPassword(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func IsPasswordHash(s string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckPassword reports whether password is the password of the admin. An
+// admin stored before passwords were hashed still has it in plain text, see
+// NeedRehash.
+func (a *Admin) CheckPassword(password string) bool {
+	if IsPasswordHash(a.Password) {
+		return bcrypt.CompareHashAndPassword([]byte(a.Password), []byte(password)) == nil
+	}
+	return len(a.Password) != 0 && subtle.ConstantTimeCompare([]byte(a.Password), []byte(password)) == 1
+}
+
+func (a *Admin) NeedRehash() bool {
+	return len(a.Password) != 0 && !IsPasswordHash(a.Password)
+}
+
 func (a *Admin) CheckAddRolePower() bool {
 	if a.Role == SUPERADMIN {
 		return true
@@ -0,0 +1,84 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdminPassword(t *testing.T) {
+	hash, err := HashPassword("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsPasswordHash(hash) || hash == "s3cret" {
+		t.Fatalf("HashPassword returns %s", hash)
+	}
+	if other, _ := HashPassword("s3cret"); other == hash {
+		t.Fatal("HashPassword is not salted")
+	}
+
+	a := &Admin{Username: "alice", Password: hash}
+	if !a.CheckPassword("s3cret") || a.CheckPassword("S3cret") || a.CheckPassword("") {
+		t.Fatal("CheckPassword of hashed password")
+	}
+	if a.NeedRehash() {
+		t.Fatal("NeedRehash of hashed password")
+	}
+
+	legacy := &Admin{Username: "bob", Password: "demo"}
+	if !legacy.CheckPassword("demo") || legacy.CheckPassword("dem") {
+		t.Fatal("CheckPassword of plain text password")
+	}
+	if !legacy.NeedRehash() {
+		t.Fatal("plain text password needs rehash")
+	}
+}
+
+func TestApiToken(t *testing.T) {
+	for _, c := range []struct {
+		scopes []string
+		role   AdminRole
+	}{
+		{[]string{TokenScopeRead}, READADMIN},
+		{[]string{TokenScopeRead, TokenScopeWrite}, OPADMIN},
+		{[]string{TokenScopeAdmin, TokenScopeRead}, SUPERADMIN},
+		{nil, READADMIN},
+	} {
+		if err := ValidateTokenScopes(c.scopes); err != nil && c.scopes != nil {
+			t.Fatal(err)
+		}
+		if role := (&ApiToken{Scopes: c.scopes}).Role(); role != c.role {
+			t.Fatalf("role of %v = %v, want %v", c.scopes, role, c.role)
+		}
+	}
+	for _, scopes := range [][]string{nil, {}, {"root"}, {TokenScopeRead, ""}} {
+		if err := ValidateTokenScopes(scopes); err == nil {
+			t.Fatalf("scopes %v should be invalid", scopes)
+		}
+	}
+
+	now := time.Now()
+	if (&ApiToken{}).Expired(now) {
+		t.Fatal("token without expiry expired")
+	}
+	if !(&ApiToken{ExpireAt: now.Unix()}).Expired(now) || (&ApiToken{ExpireAt: now.Unix() + 1}).Expired(now) {
+		t.Fatal("Expired of token with expiry")
+	}
+	if s := (&ApiToken{Id: "1", Hash: "h"}).Snapshot(); s.Hash != "" {
+		t.Fatal("Snapshot keeps the token hash")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"time"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+)
+
+const (
+	TokenScopeRead  = "read"
+	TokenScopeWrite = "write"
+	TokenScopeAdmin = "admin"
+)
+
+// ApiToken lets automation call the api without a login session. Only the
+// sha256 of the secret is stored, the secret is shown once on creation.
+type ApiToken struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Owner      string   `json:"owner"`
+	Scopes     []string `json:"scopes"`
+	Hash       string   `json:"hash,omitempty"`
+	CreateTime string   `json:"create_time"`
+	ExpireAt   int64    `json:"expire_at,omitempty"`
+}
+
+func (t *ApiToken) Encode() []byte {
+	return jsonEncode(t)
+}
+
+func (t *ApiToken) Snapshot() *ApiToken {
+	c := *t
+	c.Hash = ""
+	return &c
+}
+
+func (t *ApiToken) Expired(now time.Time) bool {
+	return t.ExpireAt != 0 && now.Unix() >= t.ExpireAt
+}
+
+// Role maps the widest scope of the token to the admin role with the same
+// power: admin to SUPERADMIN, write to OPADMIN and read to READADMIN. A
+// token without a known scope only reads.
+func (t *ApiToken) Role() AdminRole {
+	role := READADMIN
+	for _, scope := range t.Scopes {
+		var r AdminRole
+		switch scope {
+		case TokenScopeAdmin:
+			r = SUPERADMIN
+		case TokenScopeWrite:
+			r = OPADMIN
+		case TokenScopeRead:
+			r = READADMIN
+		default:
+			continue
+		}
+		if r < role {
+			role = r
+		}
+	}
+	return role
+}
+
+func ValidateTokenScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("missing token scopes")
+	}
+	for _, scope := range scopes {
+		switch scope {
+		case TokenScopeRead, TokenScopeWrite, TokenScopeAdmin:
+		default:
+			return errors.Errorf("invalid token scope %s", scope)
+		}
+	}
+	return nil
+}
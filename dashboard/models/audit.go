@@ -0,0 +1,43 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+const (
+	AuditResultOK    = "ok"
+	AuditResultError = "error"
+)
+
+// AuditRecord is a mutating api call, records are only created, never
+// updated. Secrets are redacted from Endpoint and Params before they are
+// stored.
+type AuditRecord struct {
+	Id         string    `json:"id"`
+	Unixtime   int64     `json:"unixtime"`
+	Time       string    `json:"time"`
+	User       string    `json:"user"`
+	Role       AdminRole `json:"role"`
+	SourceIP   string    `json:"source_ip"`
+	Method     string    `json:"method"`
+	Endpoint   string    `json:"endpoint"`
+	Params     string    `json:"params,omitempty"`
+	Result     string    `json:"result"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+func (r *AuditRecord) Encode() []byte {
+	return jsonEncode(r)
+}
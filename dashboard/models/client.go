@@ -15,9 +15,14 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/log"
 	mysqlclient "github.com/zuoyebang/bitalostored/dashboard/models/db"
 
 	"gorm.io/gorm"
@@ -52,14 +57,28 @@ func SqliteInit(db *gorm.DB) {
 	var res []*mysqlclient.TblDashboard
 	db = db.Where("product_name = ?", "admin").Find(&res)
 	if len(res) <= 0 {
+		// seed a superadmin with a random password instead of a well known one
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			log.PanicErrorf(err, "generate admin password failed")
+		}
+		password := hex.EncodeToString(b)
+		hash, err := HashPassword(password)
+		if err != nil {
+			log.PanicErrorf(err, "hash admin password failed")
+		}
+		admin := &Admin{Username: "demo", Password: hash, Role: SUPERADMIN}
 		dt := &mysqlclient.TblDashboard{
 			ClusterName: "admin",
-			SubPath:     "demo",
-			FullPath:    "/stored/admin/demo",
-			Value:       "{\"username\":\"demo\",\"password\":\"demo\",\"role\":1}",
+			SubPath:     admin.Username,
+			FullPath:    AdminPath(admin.Username),
+			Value:       string(admin.Encode()),
 			CreateTime:  time.Now().Unix(),
 			UpdateTime:  time.Now().Unix(),
 		}
 		db.Create(dt)
+		// the password goes to stderr once, never to the log file
+		fmt.Fprintf(os.Stderr, "sqlite: created admin %s with password %s, please change it\n", admin.Username, password)
+		log.Warnf("sqlite: created admin %s, its password is printed to stderr, please change it", admin.Username)
 	}
 }
@@ -16,6 +16,7 @@ package models
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 
 	"gorm.io/driver/sqlite"
@@ -25,15 +26,32 @@ import (
 var client Client
 
 func init() {
-	var err error
-	coordinator := "sqlite"
-	if client, err = NewClient(coordinator, nil); err != nil {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		fmt.Println("open sqlite err:", err.Error())
+		return
+	}
+	if client, err = NewClient("sqlite", db); err != nil {
 		fmt.Println("init Client err:", err.Error())
 	}
 }
 
+func TestSqliteInitAdmin(t *testing.T) {
+	b, err := client.Read(AdminPath("demo"))
+	if err != nil || b == nil {
+		t.Fatalf("seeded admin = %s, %v", b, err)
+	}
+	a := &Admin{}
+	if err := JsonDecode(a, b); err != nil {
+		t.Fatal(err)
+	}
+	if a.Role != SUPERADMIN || !IsPasswordHash(a.Password) {
+		t.Fatalf("seeded admin role = %v, password hashed = %v", a.Role, IsPasswordHash(a.Password))
+	}
+}
+
 func TestCreateTable(t *testing.T) {
-	db, err := gorm.Open(sqlite.Open("dh.db"), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "dh.db")), &gorm.Config{})
 	if err != nil {
 		t.Errorf("open sqlite err:%v", err)
 	}
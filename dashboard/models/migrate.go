@@ -15,9 +15,10 @@
 package models
 
 const (
-	MigratePrepred int = 0
-	MigrateRunning int = 1
-	MigrateFinshed int = 2
+	MigratePrepred    int = 0
+	MigrateRunning    int = 1
+	MigrateFinshed    int = 2
+	MigrateRolledBack int = 5
 )
 
 type Migrate struct {
@@ -39,6 +40,18 @@ type MigrateStatus struct {
 	Fails       int64  `json:"fails"`
 	SuccPercent string `json:"succ_percent"`
 	Status      int    `json:"status"`
+	Paused      bool   `json:"paused"`
+
+	Verified   int64                   `json:"verified"`
+	Mismatches int64                   `json:"mismatches"`
+	FailedKeys []*MigrateMismatchedKey `json:"failed_keys,omitempty"`
+}
+
+// MigrateMismatchedKey is a key whose copy on the target failed the
+// verification of the migration.
+type MigrateMismatchedKey struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
 }
 
 func (g *Migrate) Encode() []byte {
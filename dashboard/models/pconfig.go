@@ -14,11 +14,26 @@
 
 package models
 
-import "github.com/zuoyebang/bitalostored/butils/trie"
+import (
+	"strings"
+
+	"github.com/zuoyebang/bitalostored/butils/trie"
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+)
 
 const (
 	Local_Cache_Prefix = "Local_Cache_Prefix_PC-"
 	Black_Keys         = "Black_Keys"
+	Rate_Limit         = "Rate_Limit"
+	Prefix_Rules       = "Prefix_Rules"
+)
+
+const (
+	RateLimitByUser   = "user"
+	RateLimitByIP     = "ip"
+	RateLimitByPrefix = "prefix"
+
+	RateLimitMatchAll = "*"
 )
 
 var DefaultPconfigKeyList = map[string]*Pconfig{
@@ -48,6 +63,34 @@ var DefaultPconfigKeyList = map[string]*Pconfig{
 		},
 		OutOfSync: true,
 	},
+	Rate_Limit: {
+		Name:   Rate_Limit,
+		Remark: "Rate limit configuration: read and write qps per auth user, client ip or key prefix",
+		Content: &WhiteAndBlackList{
+			White:         []string{},
+			Black:         []string{},
+			WhitePrefixes: []string{},
+			BlackPrefixes: []string{},
+			WhiteTrie:     trie.NewCharTrie([]string{}),
+			BlackTrie:     trie.NewCharTrie([]string{}),
+			RateLimits:    []*RateLimitRule{},
+		},
+		OutOfSync: true,
+	},
+	Prefix_Rules: {
+		Name:   Prefix_Rules,
+		Remark: "Key prefix rules: read master, deny write, default ttl, disable or rename commands",
+		Content: &WhiteAndBlackList{
+			White:         []string{},
+			Black:         []string{},
+			WhitePrefixes: []string{},
+			BlackPrefixes: []string{},
+			WhiteTrie:     trie.NewCharTrie([]string{}),
+			BlackTrie:     trie.NewCharTrie([]string{}),
+			PrefixRules:   []*PrefixRule{},
+		},
+		OutOfSync: true,
+	},
 }
 
 type WhiteAndBlackList struct {
@@ -60,6 +103,66 @@ type WhiteAndBlackList struct {
 	BlackPrefixes []string  `json:"black_prefixes"`
 	WhiteTrie     trie.Trie `json:"-"`
 	BlackTrie     trie.Trie `json:"-"`
+
+	RateLimits  []*RateLimitRule `json:"rate_limits,omitempty"`
+	PrefixRules []*PrefixRule    `json:"prefix_rules,omitempty"`
+}
+
+type RateLimitRule struct {
+	Type     string `json:"type"`
+	Match    string `json:"match"`
+	ReadQPS  int64  `json:"read_qps"`
+	WriteQPS int64  `json:"write_qps"`
+	Burst    int64  `json:"burst,omitempty"`
+}
+
+func (r *RateLimitRule) Validate() error {
+	switch r.Type {
+	case RateLimitByUser, RateLimitByIP, RateLimitByPrefix:
+	default:
+		return errors.Errorf("invalid rate limit type: %s", r.Type)
+	}
+	if len(r.Match) == 0 {
+		return errors.Errorf("rate limit %s missing match", r.Type)
+	}
+	if r.Type == RateLimitByPrefix && r.Match == RateLimitMatchAll {
+		return errors.New("rate limit prefix does not support *")
+	}
+	if r.ReadQPS < 0 || r.WriteQPS < 0 || r.Burst < 0 {
+		return errors.Errorf("rate limit %s:%s has negative qps or burst", r.Type, r.Match)
+	}
+	return nil
+}
+
+type PrefixRule struct {
+	Prefix      string            `json:"prefix"`
+	ReadMaster  bool              `json:"read_master,omitempty"`
+	DenyWrite   bool              `json:"deny_write,omitempty"`
+	DefaultTTL  int64             `json:"default_ttl,omitempty"`
+	DisableCmds []string          `json:"disable_cmds,omitempty"`
+	RenameCmds  map[string]string `json:"rename_cmds,omitempty"`
+}
+
+func ValidatePrefixRules(rules []*PrefixRule) error {
+	for i, rule := range rules {
+		if len(strings.TrimSpace(rule.Prefix)) == 0 {
+			return errors.New("prefix rule missing prefix")
+		}
+		if rule.DefaultTTL < 0 {
+			return errors.Errorf("prefix rule %s has negative default_ttl", rule.Prefix)
+		}
+		for from, to := range rule.RenameCmds {
+			if len(from) == 0 || len(to) == 0 {
+				return errors.Errorf("prefix rule %s has empty rename command", rule.Prefix)
+			}
+		}
+		for _, other := range rules[:i] {
+			if strings.HasPrefix(rule.Prefix, other.Prefix) || strings.HasPrefix(other.Prefix, rule.Prefix) {
+				return errors.Errorf("prefix rule %s is nested with %s", rule.Prefix, other.Prefix)
+			}
+		}
+	}
+	return nil
 }
 
 func (pc *Pconfig) BuildTrie() {
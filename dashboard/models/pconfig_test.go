@@ -34,3 +34,17 @@ func TestPconfig_BuildTrie(t *testing.T) {
 	fmt.Println(p.Content.BlackTrie.HasPrefix("test"))
 	fmt.Println(p.Content.WhiteTrie.HasPrefix("test"))
 }
+
+func TestValidatePrefixRules(t *testing.T) {
+	rules := []*PrefixRule{
+		{Prefix: "order:", ReadMaster: true},
+		{Prefix: "feed:", DisableCmds: []string{"HGETALL"}},
+	}
+	if err := ValidatePrefixRules(rules); err != nil {
+		t.Fatal(err)
+	}
+	rules = append(rules, &PrefixRule{Prefix: "order:big:", DenyWrite: true})
+	if err := ValidatePrefixRules(rules); err == nil {
+		t.Fatal("nested prefix should be rejected")
+	}
+}
@@ -43,6 +43,7 @@ type SlotMapping struct {
 		Index          int    `json:"index,omitempty"`
 		State          string `json:"state,omitempty"`
 		TargetId       int    `json:"target_id,omitempty"`
+		Paused         bool   `json:"paused,omitempty"`
 	} `json:"action"`
 }
 
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"sort"
 
 	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
 	"github.com/zuoyebang/bitalostored/dashboard/internal/log"
@@ -71,6 +72,18 @@ func AdminDir() string {
 	return filepath.Join(StoredDir, "admin")
 }
 
+func AuditDir(product string) string {
+	return filepath.Join(StoredDir, product, "audit")
+}
+
+func ApiTokenDir(product string) string {
+	return filepath.Join(StoredDir, product, "apitoken")
+}
+
+func TopologyPath(product string) string {
+	return filepath.Join(StoredDir, product, "topology")
+}
+
 func CloudPath(product string) string {
 	return filepath.Join(StoredDir, product, "cloud")
 }
@@ -91,6 +104,14 @@ func PconfigPath(product string, name string) string {
 	return filepath.Join(StoredDir, product, "pconfig", fmt.Sprintf("%s", name))
 }
 
+func AuditPath(product string, id string) string {
+	return filepath.Join(StoredDir, product, "audit", id)
+}
+
+func ApiTokenPath(product string, id string) string {
+	return filepath.Join(StoredDir, product, "apitoken", id)
+}
+
 func AdminPath(name string) string {
 	return filepath.Join(StoredDir, "admin", fmt.Sprintf("%s", name))
 }
@@ -184,6 +205,26 @@ func (s *Store) AdminDir() string {
 	return AdminDir()
 }
 
+func (s *Store) AuditDir() string {
+	return AuditDir(s.product)
+}
+
+func (s *Store) AuditPath(id string) string {
+	return AuditPath(s.product, id)
+}
+
+func (s *Store) ApiTokenDir() string {
+	return ApiTokenDir(s.product)
+}
+
+func (s *Store) ApiTokenPath(id string) string {
+	return ApiTokenPath(s.product, id)
+}
+
+func (s *Store) TopologyPath() string {
+	return TopologyPath(s.product)
+}
+
 func (s *Store) GroupPath(gid int) string {
 	return GroupPath(s.product, gid)
 }
@@ -383,7 +424,8 @@ func (s *Store) ListAdmin() (map[string]*Admin, error) {
 	}
 	admins := make(map[string]*Admin)
 	for _, path := range paths {
-		b, err := s.client.Read(path)
+		// the db client lists admin names, not their paths
+		b, err := s.client.Read(s.AdminPath(filepath.Base(path)))
 		if err != nil {
 			return nil, err
 		}
@@ -484,6 +526,89 @@ func (s *Store) DeleteProxy(token string) error {
 	return s.client.Delete(s.ProxyPath(token))
 }
 
+func (s *Store) ListApiToken() (map[string]*ApiToken, error) {
+	paths, err := s.client.List(s.ApiTokenDir())
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]*ApiToken)
+	for _, path := range paths {
+		b, err := s.client.Read(path)
+		if err != nil {
+			return nil, err
+		}
+		t := &ApiToken{}
+		if err := JsonDecode(t, b); err != nil {
+			return nil, err
+		}
+		tokens[t.Id] = t
+	}
+	return tokens, nil
+}
+
+func (s *Store) LoadApiToken(id string) (*ApiToken, error) {
+	b, err := s.client.Read(s.ApiTokenPath(id))
+	if err != nil || b == nil {
+		return nil, err
+	}
+	t := &ApiToken{}
+	if err := JsonDecode(t, b); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *Store) UpdateApiToken(t *ApiToken) error {
+	return s.client.Update(s.ApiTokenPath(t.Id), t.Encode())
+}
+
+func (s *Store) DeleteApiToken(id string) error {
+	return s.client.Delete(s.ApiTokenPath(id))
+}
+
+func (s *Store) CreateAuditRecord(r *AuditRecord) error {
+	return s.client.Create(s.AuditPath(r.Id), r.Encode())
+}
+
+// ListAuditPaths returns the paths of the audit records, ids sort by time so
+// do the paths.
+func (s *Store) ListAuditPaths() ([]string, error) {
+	paths, err := s.client.List(s.AuditDir())
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (s *Store) LoadAuditRecord(path string) (*AuditRecord, error) {
+	b, err := s.client.Read(path)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	r := &AuditRecord{}
+	if err := JsonDecode(r, b); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *Store) LoadTopologyPlan() (*TopologyPlan, error) {
+	b, err := s.client.Read(s.TopologyPath())
+	if err != nil || b == nil {
+		return nil, err
+	}
+	p := &TopologyPlan{}
+	if err := JsonDecode(p, b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Store) UpdateTopologyPlan(p *TopologyPlan) error {
+	return s.client.Update(s.TopologyPath(), p.Encode())
+}
+
 func ValidateProduct(name string) error {
 	if regexp.MustCompile(`^\w[\w\.\-]*$`).MatchString(name) {
 		return nil
@@ -0,0 +1,134 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/zuoyebang/bitalostored/dashboard/internal/errors"
+)
+
+const (
+	TopologyCreateGroup   = "create-group"
+	TopologyAddServer     = "add-server"
+	TopologyMountServer   = "mount-server"
+	TopologyChangeRole    = "change-role"
+	TopologyCreateProxy   = "create-proxy"
+	TopologyCreatePconfig = "create-pconfig"
+	TopologyUpdatePconfig = "update-pconfig"
+	TopologyAssignSlots   = "assign-slots"
+)
+
+const (
+	TopologyPlanned  = "planned"
+	TopologyApplying = "applying"
+	TopologyFailed   = "failed"
+	TopologyApplied  = "applied"
+)
+
+// TopologySpec is the wanted layout of a product. Groups, servers, proxies
+// and pconfigs missing from the product are created, the ones the spec does
+// not mention are left alone.
+type TopologySpec struct {
+	Groups   []*GroupSpec     `json:"groups"`
+	Slots    []*SlotRangeSpec `json:"slots"`
+	Proxies  []string         `json:"proxies"`
+	Pconfigs []*Pconfig       `json:"pconfigs"`
+}
+
+type GroupSpec struct {
+	Id      int           `json:"id"`
+	Servers []*ServerSpec `json:"servers"`
+}
+
+// ServerSpec is a server of a group, a server with a raft_addr and a node_id
+// is mounted into the raft group once added unless it is the first one.
+type ServerSpec struct {
+	Addr      string `json:"addr"`
+	Role      string `json:"server_role,omitempty"`
+	CloudType string `json:"cloudtype,omitempty"`
+	RaftAddr  string `json:"raft_addr,omitempty"`
+	NodeId    int    `json:"node_id,omitempty"`
+}
+
+type SlotRangeSpec struct {
+	Begin          int  `json:"begin"`
+	End            int  `json:"end"`
+	GroupId        int  `json:"group_id"`
+	NotMigrateData bool `json:"not_migrate_data,omitempty"`
+}
+
+// ParseTopologySpec decodes a spec written in json or yaml, yaml keys are the
+// json ones.
+func ParseTopologySpec(b []byte) (*TopologySpec, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, errors.New("empty topology spec")
+	}
+	if b[0] != '{' {
+		var v interface{}
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, errors.Trace(err)
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		b = data
+	}
+	spec := &TopologySpec{}
+	if err := JsonDecode(spec, b); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// TopologyStep is a change of the plan, it applies through the same calls as
+// the matching api.
+type TopologyStep struct {
+	Op             string   `json:"op"`
+	GroupId        int      `json:"group_id,omitempty"`
+	Addr           string   `json:"addr,omitempty"`
+	Role           string   `json:"server_role,omitempty"`
+	CloudType      string   `json:"cloudtype,omitempty"`
+	RaftAddr       string   `json:"raft_addr,omitempty"`
+	NodeId         int      `json:"node_id,omitempty"`
+	Begin          int      `json:"begin,omitempty"`
+	End            int      `json:"end,omitempty"`
+	NotMigrateData bool     `json:"not_migrate_data,omitempty"`
+	Pconfig        *Pconfig `json:"pconfig,omitempty"`
+
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
+}
+
+// TopologyPlan is the ordered diff of a spec against the product, Next is the
+// first step not applied yet.
+type TopologyPlan struct {
+	Spec       *TopologySpec   `json:"spec"`
+	Steps      []*TopologyStep `json:"steps"`
+	Unmanaged  []string        `json:"unmanaged,omitempty"`
+	Next       int             `json:"next"`
+	State      string          `json:"state"`
+	CreateTime string          `json:"create_time"`
+	UpdateTime string          `json:"update_time"`
+}
+
+func (p *TopologyPlan) Encode() []byte {
+	return jsonEncode(p)
+}
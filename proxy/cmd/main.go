@@ -88,6 +88,17 @@ func main() {
 		go autoOnlineWithDashboard(p, *dashboardName, cfg.ProductName)
 	}
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Infof("receive SIGHUP, reload config:%s", *configPath)
+			if err := p.Reload(); err != nil {
+				log.Errorf("reload config failed err:%s", err.Error())
+			}
+		}
+	}()
+
 	go func() {
 		for !p.IsClosed() && !p.IsOnline() {
 			log.Warnf("proxy waiting online ...")
@@ -183,6 +194,8 @@ func initLogger(cfg *config.Config) {
 		SlowLogFile:   cfg.Log.SlowLogFile,
 		AccessLog:     cfg.Log.AccessLog,
 		AccessLogFile: cfg.Log.AccessLogFile,
+		AuditLog:      cfg.Log.AuditLog,
+		AuditLogFile:  cfg.Log.AuditLogFile,
 	}
 	log.NewLogger(opts)
 }
@@ -16,6 +16,7 @@ package anticc
 
 import (
 	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/zuoyebang/bitalostored/butils/timesize"
@@ -33,9 +34,15 @@ func LoadConfig(cfg *config.Config) error {
 		return errors.New("length of array client_ratio_threshold and deadline_threshold should be equal")
 	}
 
-	dd.aliveConnRatios = cfg.DynamicDeadline.ClientRatios[:]
-	dd.deadlineThreshold = cfg.DynamicDeadline.DeadlineThreshold[:]
-	dd.maxClients = cfg.ProxyMaxClients
+	if cfg.ProxyMaxClients <= 0 {
+		return errors.New("invalid proxy_max_clients")
+	}
+
+	dd.Store(&dynamicDeadline{
+		maxClients:        cfg.ProxyMaxClients,
+		aliveConnRatios:   append([]int(nil), cfg.DynamicDeadline.ClientRatios...),
+		deadlineThreshold: append([]timesize.Duration(nil), cfg.DynamicDeadline.DeadlineThreshold...),
+	})
 	return nil
 }
 
@@ -45,18 +52,20 @@ type dynamicDeadline struct {
 	deadlineThreshold []timesize.Duration
 }
 
-var dd dynamicDeadline
+// dd is replaced as a whole by LoadConfig, so a config reload never exposes a half updated deadline table.
+var dd atomic.Pointer[dynamicDeadline]
 
 func GetConfigDeadline() time.Time {
-	for index, connThreshold := range dd.aliveConnRatios {
-		if (dostats.ConnsAlive()*100)/int64(dd.maxClients) < int64(connThreshold) {
+	d := dd.Load()
+	for index, connThreshold := range d.aliveConnRatios {
+		if (dostats.ConnsAlive()*100)/int64(d.maxClients) < int64(connThreshold) {
 			if index == 0 {
-				log.Errorf("wrong config.dynamicDeadline:%+v.alive conn:%d", dd, dostats.ConnsAlive())
-				return time.Now().Add(dd.deadlineThreshold[0].Duration())
+				log.Errorf("wrong config.dynamicDeadline:%+v.alive conn:%d", *d, dostats.ConnsAlive())
+				return time.Now().Add(d.deadlineThreshold[0].Duration())
 			}
-			return time.Now().Add(dd.deadlineThreshold[index-1].Duration())
+			return time.Now().Add(d.deadlineThreshold[index-1].Duration())
 		}
 	}
-	t := dd.deadlineThreshold[len(dd.deadlineThreshold)-1].Duration()
+	t := d.deadlineThreshold[len(d.deadlineThreshold)-1].Duration()
 	return time.Now().Add(t)
 }
@@ -21,6 +21,7 @@ import (
 
 	"github.com/zuoyebang/bitalostored/butils/bytesize"
 	"github.com/zuoyebang/bitalostored/butils/timesize"
+	"github.com/zuoyebang/bitalostored/butils/tracing"
 	"github.com/zuoyebang/bitalostored/proxy/internal/log"
 	"github.com/zuoyebang/bitalostored/proxy/internal/models"
 	"github.com/zuoyebang/bitalostored/proxy/internal/switcher"
@@ -66,6 +67,9 @@ access_log_file = "/tmp/proxy.access.log"
 slow_log = true
 slow_log_cost = "30ms"
 slow_log_file = "/tmp/proxy.slow.log"
+slow_log_max_len = 128
+audit_log = false
+audit_log_file = "/tmp/proxy.audit.log"
 
 [redis_default_conf]
 max_idle = 50
@@ -78,6 +82,13 @@ conn_timeout = "50ms"
 read_timeout = "500ms"
 write_timeout = "500ms"
 
+[tracing]
+enable = false
+sample_ratio = 0.001
+exporter = "file"
+exporter_target = "/tmp/proxy.trace.json"
+propagate = true
+
 # client session deadline
 [dynamic_deadline]
 # the ratio of alive client to max client
@@ -131,14 +142,41 @@ type LogConfig struct {
 	SlowLog       bool              `toml:"slow_log" json:"slow_log"`
 	SlowLogFile   string            `toml:"slow_log_file" json:"slow_log_file"`
 	SlowLogCost   timesize.Duration `toml:"slow_log_cost" json:"slow_log_cost"`
+	SlowLogMaxLen int               `toml:"slow_log_max_len" json:"slow_log_max_len"`
 	AccessLog     bool              `toml:"access_log" json:"access_log"`
 	AccessLogFile string            `toml:"access_log_file" json:"access_log_file"`
+	AuditLog      bool              `toml:"audit_log" json:"audit_log"`
+	AuditLogFile  string            `toml:"audit_log_file" json:"audit_log_file"`
 }
 
 func (l LogConfig) Validate() error {
 	return nil
 }
 
+type TracingConfig struct {
+	Enable         bool    `toml:"enable" json:"enable"`
+	SampleRatio    float64 `toml:"sample_ratio" json:"sample_ratio"`
+	Exporter       string  `toml:"exporter" json:"exporter"`
+	ExporterTarget string  `toml:"exporter_target" json:"exporter_target"`
+	Propagate      bool    `toml:"propagate" json:"propagate"`
+}
+
+func (t TracingConfig) Validate() error {
+	if !t.Enable {
+		return nil
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return errors.New("tracing sample_ratio should be in [0,1]")
+	}
+	if t.Exporter != tracing.ExporterFile && t.Exporter != tracing.ExporterOTLP {
+		return errors.New("tracing exporter should be file or otlp")
+	}
+	if len(t.ExporterTarget) == 0 {
+		return errors.New("invalid tracing exporter_target")
+	}
+	return nil
+}
+
 type Config struct {
 	ProductName         string         `toml:"product_name" json:"product_name"`
 	ProductAuth         string         `toml:"product_auth" json:"-"`
@@ -151,6 +189,7 @@ type Config struct {
 	DashboardProtoType  string         `toml:"dashboard_proto_type" json:"dashboard_proto_type"`
 	DashboardUsername   string         `toml:"dashboard_username" json:"dashboard_username"`
 	DashboardPassword   string         `toml:"dashboard_password" json:"dashboard_password"`
+	ConfigFile          string         `toml:"-" json:"config_file"`
 	HostProxy           string         `toml:"-" json:"-"`
 	HostAdmin           string         `toml:"-" json:"-"`
 	ProxyMaxClients     int            `toml:"proxy_max_clients" json:"proxy_max_clients"`
@@ -177,6 +216,8 @@ type Config struct {
 
 	Log LogConfig `toml:"log" json:"log"`
 
+	Tracing TracingConfig `toml:"tracing" json:"tracing"`
+
 	RedisDefaultConf models.RedisConnConf `json:"redis_default_conf"`
 
 	DynamicDeadline DynamicDeadline `toml:"dynamic_deadline" json:"dynamic_deadline"`
@@ -197,6 +238,7 @@ func (c *Config) LoadFromFile(path string) error {
 	if _, err := toml.DecodeFile(path, c); err != nil {
 		return err
 	}
+	c.ConfigFile = path
 	return c.Validate()
 }
 
@@ -286,6 +328,9 @@ func (c *Config) Validate() error {
 	if c.Log.SlowLog && len(c.Log.SlowLogFile) < 0 {
 		return errors.New("invaild slow log conf")
 	}
+	if c.Log.AuditLog && len(c.Log.AuditLogFile) == 0 {
+		return errors.New("invaild audit log conf")
+	}
 	if c.Log.SlowLogCost < timesize.Duration(20*time.Millisecond) {
 		c.Log.SlowLogCost = timesize.Duration(20 * time.Millisecond)
 	}
@@ -309,6 +354,9 @@ func (c *Config) Validate() error {
 		c.BreakerStopTimeout = timesize.Duration(200 * time.Millisecond)
 	}
 
+	if err := c.Tracing.Validate(); err != nil {
+		return err
+	}
 	if err := c.DynamicDeadline.Validate(); err != nil {
 		return err
 	}
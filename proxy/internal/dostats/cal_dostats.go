@@ -46,7 +46,7 @@ func (s *CalDoStats) getOpStats(opstr string) *OpStats {
 	e := s.opmap[opstr]
 	s.mu.RUnlock()
 	if e == nil {
-		e = &OpStats{Opstr: opstr}
+		e = &OpStats{Opstr: opstr, hist: CmdHistogram(opstr)}
 		s.mu.Lock()
 		s.opmap[opstr] = e
 		s.mu.Unlock()
@@ -56,8 +56,12 @@ func (s *CalDoStats) getOpStats(opstr string) *OpStats {
 
 func (s *CalDoStats) IncrOpStats(opstr string, startUnixNano int64) {
 	e := s.getOpStats(opstr)
+	cost := time.Now().UnixNano() - startUnixNano
 	e.Calls.Add(1)
-	e.Nsecs.Add(time.Now().UnixNano() - startUnixNano)
+	e.Nsecs.Add(cost)
+	if e.hist != nil {
+		e.hist.RecordUsec(cost / 1e3)
+	}
 }
 
 func (s *CalDoStats) IncrOpFails(opstr string, err error) error {
@@ -113,6 +113,8 @@ func ResetStats() {
 		CmdStats[ct].fails.Store(0)
 		CmdStats[ct].periodfails.Store(0)
 	}
+	resetLimitStats()
+	ResetLatencyStats()
 }
 
 func PeriodResetStats() {
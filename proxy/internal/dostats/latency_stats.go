@@ -0,0 +1,99 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dostats
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils/histogram"
+)
+
+const maxCmdHistograms = 1024
+
+var latencyStats struct {
+	cmds   sync.Map
+	groups sync.Map
+	cmdNum atomic.Int32
+}
+
+func CmdHistogram(cmd string) *histogram.Histogram {
+	if h, ok := latencyStats.cmds.Load(cmd); ok {
+		return h.(*histogram.Histogram)
+	}
+	if latencyStats.cmdNum.Load() >= maxCmdHistograms {
+		return nil
+	}
+	h, loaded := latencyStats.cmds.LoadOrStore(cmd, histogram.New())
+	if !loaded {
+		latencyStats.cmdNum.Add(1)
+	}
+	return h.(*histogram.Histogram)
+}
+
+func GroupHistogram(gid int) *histogram.Histogram {
+	if h, ok := latencyStats.groups.Load(gid); ok {
+		return h.(*histogram.Histogram)
+	}
+	h, _ := latencyStats.groups.LoadOrStore(gid, histogram.New())
+	return h.(*histogram.Histogram)
+}
+
+func RecordGroupLatency(gid int, d time.Duration) {
+	GroupHistogram(gid).Record(d)
+}
+
+func RangeCmdHistograms(f func(cmd string, h *histogram.Histogram)) {
+	var cmds []string
+	latencyStats.cmds.Range(func(k, v interface{}) bool {
+		if v.(*histogram.Histogram).Count() > 0 {
+			cmds = append(cmds, k.(string))
+		}
+		return true
+	})
+	sort.Strings(cmds)
+	for _, cmd := range cmds {
+		if h, ok := latencyStats.cmds.Load(cmd); ok {
+			f(cmd, h.(*histogram.Histogram))
+		}
+	}
+}
+
+func RangeGroupHistograms(f func(gid int, h *histogram.Histogram)) {
+	var gids []int
+	latencyStats.groups.Range(func(k, v interface{}) bool {
+		if v.(*histogram.Histogram).Count() > 0 {
+			gids = append(gids, k.(int))
+		}
+		return true
+	})
+	sort.Ints(gids)
+	for _, gid := range gids {
+		if h, ok := latencyStats.groups.Load(gid); ok {
+			f(gid, h.(*histogram.Histogram))
+		}
+	}
+}
+
+func ResetLatencyStats() {
+	reset := func(_, v interface{}) bool {
+		v.(*histogram.Histogram).Reset()
+		return true
+	}
+	latencyStats.cmds.Range(reset)
+	latencyStats.groups.Range(reset)
+}
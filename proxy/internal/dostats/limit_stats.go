@@ -0,0 +1,96 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dostats
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var limitStats struct {
+	reads  atomic.Int64
+	writes atomic.Int64
+	rules  sync.Map
+}
+
+type limitRuleStats struct {
+	reads  atomic.Int64
+	writes atomic.Int64
+}
+
+type LimitRuleStats struct {
+	Rule   string `json:"rule"`
+	Reads  int64  `json:"reads"`
+	Writes int64  `json:"writes"`
+}
+
+type LimitStats struct {
+	Reads  int64             `json:"reads"`
+	Writes int64             `json:"writes"`
+	Rules  []*LimitRuleStats `json:"rules,omitempty"`
+}
+
+func IncrLimited(rule string, isWrite bool) {
+	v, ok := limitStats.rules.Load(rule)
+	if !ok {
+		v, _ = limitStats.rules.LoadOrStore(rule, &limitRuleStats{})
+	}
+	rs := v.(*limitRuleStats)
+	if isWrite {
+		limitStats.writes.Add(1)
+		rs.writes.Add(1)
+	} else {
+		limitStats.reads.Add(1)
+		rs.reads.Add(1)
+	}
+}
+
+func LimitedReads() int64 {
+	return limitStats.reads.Load()
+}
+
+func LimitedWrites() int64 {
+	return limitStats.writes.Load()
+}
+
+func GetLimitStats() *LimitStats {
+	ls := &LimitStats{
+		Reads:  limitStats.reads.Load(),
+		Writes: limitStats.writes.Load(),
+	}
+	limitStats.rules.Range(func(k, v any) bool {
+		rs := v.(*limitRuleStats)
+		ls.Rules = append(ls.Rules, &LimitRuleStats{
+			Rule:   k.(string),
+			Reads:  rs.reads.Load(),
+			Writes: rs.writes.Load(),
+		})
+		return true
+	})
+	sort.Slice(ls.Rules, func(i, j int) bool {
+		return ls.Rules[i].Rule < ls.Rules[j].Rule
+	})
+	return ls
+}
+
+func resetLimitStats() {
+	limitStats.reads.Store(0)
+	limitStats.writes.Store(0)
+	limitStats.rules.Range(func(k, _ any) bool {
+		limitStats.rules.Delete(k)
+		return true
+	})
+}
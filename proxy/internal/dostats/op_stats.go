@@ -16,6 +16,8 @@ package dostats
 
 import (
 	"sync/atomic"
+
+	"github.com/zuoyebang/bitalostored/butils/histogram"
 )
 
 type OpStats struct {
@@ -24,6 +26,8 @@ type OpStats struct {
 	Nsecs       atomic.Int64
 	Fails       atomic.Int64
 	PeriodFails atomic.Int64
+
+	hist *histogram.Histogram
 }
 
 func (s *OpStats) OpStats() *CalOpStats {
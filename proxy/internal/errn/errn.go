@@ -29,4 +29,5 @@ var (
 	ErrNotInitProxy         = errors.New("not init proxy client")
 	ErrInvalidSlotId        = errors.New("use of invalid slot id")
 	ErrReturnNil            = errors.New("err return nil")
+	ErrNoConfigFile         = errors.New("proxy is running without a config file")
 )
@@ -24,6 +24,7 @@ import (
 	"math/big"
 	insecurerand "math/rand"
 	"os"
+	"sync/atomic"
 	"time"
 )
 
@@ -37,6 +38,8 @@ type shardedCache struct {
 	m       uint32
 	cs      []*cache
 	janitor *shardedJanitor
+	hits    atomic.Uint64
+	misses  atomic.Uint64
 }
 
 func djb33(seed uint32, k string) uint32 {
@@ -108,7 +111,17 @@ func (sc *shardedCache) Replace(k string, x interface{}, d time.Duration) error
 }
 
 func (sc *shardedCache) Get(k string) (interface{}, bool) {
-	return sc.bucket(k).get(k)
+	x, found := sc.bucket(k).get(k)
+	if found {
+		sc.hits.Add(1)
+	} else {
+		sc.misses.Add(1)
+	}
+	return x, found
+}
+
+func (sc *shardedCache) HitStats() (hits, misses uint64) {
+	return sc.hits.Load(), sc.misses.Load()
 }
 
 func (sc *shardedCache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
@@ -26,7 +26,11 @@ var log = &Logger{
 }
 
 func IsDebug() bool {
-	return log.debug
+	return log.debug.Load()
+}
+
+func Reload(opts *Options) {
+	log.Reload(opts)
 }
 
 func CloseLog() {
@@ -51,7 +55,7 @@ func Fatal(arg ...interface{}) {
 }
 
 func Debug(arg ...interface{}) {
-	if log.debug {
+	if log.debug.Load() {
 		log.Debug(arg...)
 	}
 }
@@ -74,7 +78,7 @@ func Fatalf(format string, arg ...interface{}) {
 }
 
 func Debugf(format string, arg ...interface{}) {
-	if log.debug {
+	if log.debug.Load() {
 		log.outputf(TypeDebug, format, arg...)
 	}
 }
@@ -87,6 +91,14 @@ func Slow(remoteAddr string, usedTimeUs int64, request []byte, err error) {
 	log.Slow(remoteAddr, usedTimeUs, request, err)
 }
 
+func AuditEnabled() bool {
+	return log.AuditEnabled()
+}
+
+func Audit(entry []byte) {
+	log.Audit(entry)
+}
+
 func Stats(arg interface{}) {
 	log.Stats(arg)
 }
@@ -21,6 +21,8 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -42,15 +44,19 @@ const (
 )
 
 type Logger struct {
-	debug        bool
+	debug        atomic.Bool
+	reloadMu     sync.Mutex
+	opts         Options
 	outWriter    zapcore.WriteSyncer
 	statsWriter  zapcore.WriteSyncer
 	accessWriter zapcore.WriteSyncer
 	slowWriter   zapcore.WriteSyncer
+	auditWriter  zapcore.WriteSyncer
 	outLogger    *zap.Logger
 	statsLogger  *zap.Logger
 	accessLogger *zap.Logger
 	slowLogger   *zap.Logger
+	auditLogger  *zap.Logger
 }
 
 func (l *Logger) CloseSync() {
@@ -63,10 +69,13 @@ func (l *Logger) CloseSync() {
 	if l.slowLogger != nil {
 		l.slowLogger.Sync()
 	}
+	if l.auditLogger != nil {
+		l.auditLogger.Sync()
+	}
 }
 
 func (l *Logger) filter(level string) bool {
-	if l.debug {
+	if l.debug.Load() {
 		return false
 	}
 	if level == TypeDebug {
@@ -112,7 +121,7 @@ func (l *Logger) Fatal(arg ...interface{}) {
 }
 
 func (l *Logger) Debug(arg ...interface{}) {
-	if l.debug {
+	if l.debug.Load() {
 		l.output(TypeDebug, arg...)
 	}
 }
@@ -134,7 +143,7 @@ func (l *Logger) Fatalf(ft string, arg ...interface{}) {
 }
 
 func (l *Logger) Debugf(ft string, arg ...interface{}) {
-	if l.debug {
+	if l.debug.Load() {
 		l.outputf(TypeDebug, ft, arg...)
 	}
 }
@@ -179,6 +188,17 @@ func (l *Logger) Slow(remoteAddr string, cost int64, request []byte, err error)
 	l.slowLogger.Info(fmt.Sprint(l.formatHeader(TypeInfo), s))
 }
 
+func (l *Logger) AuditEnabled() bool {
+	return l.auditLogger != nil
+}
+
+func (l *Logger) Audit(entry []byte) {
+	if l.auditLogger == nil {
+		return
+	}
+	l.auditLogger.Info(string(entry))
+}
+
 type LevelEnable struct{}
 
 func (le *LevelEnable) Enabled(l zapcore.Level) bool {
@@ -194,12 +214,14 @@ type Options struct {
 	SlowLogFile   string
 	AccessLog     bool
 	AccessLogFile string
+	AuditLog      bool
+	AuditLogFile  string
 }
 
 func NewLogger(opts *Options) *Logger {
 	os.MkdirAll(path.Dir(opts.LogFile), 0777)
-	l := &Logger{}
-	l.debug = opts.IsDebug
+	l := &Logger{opts: *opts}
+	l.debug.Store(opts.IsDebug)
 	l.outWriter = getWriter(opts.LogFile, opts.RotationTime)
 	l.outLogger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "out"}), l.outWriter, &LevelEnable{}))
 	l.statsWriter = getWriter(opts.StatsLogFile, opts.RotationTime)
@@ -215,10 +237,37 @@ func NewLogger(opts *Options) *Logger {
 		l.slowLogger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "slow"}), l.slowWriter, &LevelEnable{}))
 	}
 
+	if opts.AuditLog {
+		l.auditWriter = getWriter(opts.AuditLogFile, opts.RotationTime)
+		l.auditLogger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "audit"}), l.auditWriter, &LevelEnable{}))
+	}
+
 	log = l
 	return l
 }
 
+// Reload applies the switches of opts to the running logger. Access, slow and audit
+// logs that were off are opened on first enable, file paths and rotation keep the
+// values the logger was created with.
+func (l *Logger) Reload(opts *Options) {
+	l.reloadMu.Lock()
+	defer l.reloadMu.Unlock()
+
+	l.debug.Store(opts.IsDebug)
+	if opts.AccessLog && l.accessLogger == nil {
+		l.accessWriter = getWriter(l.opts.AccessLogFile, l.opts.RotationTime)
+		l.accessLogger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "access"}), l.accessWriter, &LevelEnable{}))
+	}
+	if opts.SlowLog && l.slowLogger == nil {
+		l.slowWriter = getWriter(l.opts.SlowLogFile, l.opts.RotationTime)
+		l.slowLogger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "slow"}), l.slowWriter, &LevelEnable{}))
+	}
+	if opts.AuditLog && l.auditLogger == nil {
+		l.auditWriter = getWriter(l.opts.AuditLogFile, l.opts.RotationTime)
+		l.auditLogger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "audit"}), l.auditWriter, &LevelEnable{}))
+	}
+}
+
 func GetLogger() *Logger {
 	return log
 }
@@ -21,13 +21,52 @@ import (
 const (
 	LocalCachePrefix = "Local_Cache_Prefix_PC-"
 	BlackKeys        = "Black_Keys"
+	RateLimit        = "Rate_Limit"
+	PrefixRules      = "Prefix_Rules"
 )
 
 const (
 	LocalCacheIndex int = 0
 	BlackKeysIndex  int = 1
+	RateLimitIndex  int = 2
+	PrefixRuleIndex int = 3
+
+	PconfigNum = 4
+)
+
+const (
+	RateLimitByUser   = "user"
+	RateLimitByIP     = "ip"
+	RateLimitByPrefix = "prefix"
+
+	RateLimitMatchAll = "*"
 )
 
+// RateLimitRule limits the qps of one auth user, client ip or key prefix.
+// A zero qps means no limit, and Match "*" gives every user or ip its own budget.
+type RateLimitRule struct {
+	Type     string `json:"type"`
+	Match    string `json:"match"`
+	ReadQPS  int64  `json:"read_qps"`
+	WriteQPS int64  `json:"write_qps"`
+	Burst    int64  `json:"burst,omitempty"`
+}
+
+func (r *RateLimitRule) Name() string {
+	return r.Type + ":" + r.Match
+}
+
+// PrefixRule changes how commands on keys with Prefix are served.
+// DefaultTTL is in seconds and only applies to SET without EX or PX.
+type PrefixRule struct {
+	Prefix      string            `json:"prefix"`
+	ReadMaster  bool              `json:"read_master,omitempty"`
+	DenyWrite   bool              `json:"deny_write,omitempty"`
+	DefaultTTL  int64             `json:"default_ttl,omitempty"`
+	DisableCmds []string          `json:"disable_cmds,omitempty"`
+	RenameCmds  map[string]string `json:"rename_cmds,omitempty"`
+}
+
 type WhiteAndBlackList struct {
 	White         []string        `json:"whitelist"`
 	Black         []string        `json:"blacklist"`
@@ -37,6 +76,9 @@ type WhiteAndBlackList struct {
 	BlackPrefixes []string        `json:"black_prefixes"`
 	WhiteTrie     trie.Trie       `json:"-"`
 	BlackTrie     trie.Trie       `json:"-"`
+
+	RateLimits  []*RateLimitRule `json:"rate_limits,omitempty"`
+	PrefixRules []*PrefixRule    `json:"prefix_rules,omitempty"`
 }
 
 type Pconfig struct {
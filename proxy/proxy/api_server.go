@@ -28,6 +28,7 @@ import (
 	"github.com/zuoyebang/bitalostored/proxy/internal/models"
 	"github.com/zuoyebang/bitalostored/proxy/internal/rpc"
 	"github.com/zuoyebang/bitalostored/proxy/internal/switcher"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
 
 	"github.com/go-martini/martini"
 	"github.com/martini-contrib/binding"
@@ -72,6 +73,7 @@ func newApiServer(p *Proxy) http.Handler {
 	r.Any("/debug/**", func(w http.ResponseWriter, req *http.Request) {
 		http.DefaultServeMux.ServeHTTP(w, req)
 	})
+	r.Get("/metrics", api.Metrics)
 
 	r.Group("/proxy", func(r martini.Router) {
 		r.Get("", api.Overview)
@@ -86,9 +88,12 @@ func newApiServer(p *Proxy) http.Handler {
 		r.Get("/stats/:xauth/:flags", api.Stats)
 		r.Get("/slots/:xauth", api.Slots)
 		r.Get("/pconfig/:xauth", api.GetPconfigs)
+		r.Get("/slowlog/:xauth", api.SlowLog)
+		r.Get("/slowlog/:xauth/:num", api.SlowLog)
 		r.Put("/start/:xauth", api.Start)
 		r.Put("/stats/reset/:xauth", api.ResetStats)
 		r.Put("/forcegc/:xauth", api.ForceGC)
+		r.Put("/reload/:xauth", api.Reload)
 		r.Put("/shutdown/:xauth", api.Shutdown)
 		r.Put("/readcrosscloud/:xauth/:flag", api.SetReadCrossCloudFlag)
 		r.Put("/fillslots/:xauth", binding.Json([]*models.Slot{}), api.FillSlots)
@@ -182,6 +187,21 @@ func (s *apiServer) ResetStats(params martini.Params) (int, string) {
 	}
 }
 
+func (s *apiServer) SlowLog(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	num := -1
+	if v := params["num"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return rpc.ApiResponseError(errors.New("invalid param.num " + err.Error()))
+		}
+		num = n
+	}
+	return rpc.ApiResponseJson(resp.GetSlowLog(num))
+}
+
 func (s *apiServer) ForceGC(params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -191,6 +211,16 @@ func (s *apiServer) ForceGC(params martini.Params) (int, string) {
 	}
 }
 
+func (s *apiServer) Reload(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.proxy.Reload(); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
 func (s *apiServer) Shutdown(params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
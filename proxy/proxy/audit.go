@@ -0,0 +1,90 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/proxy/internal/log"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+	"github.com/zuoyebang/bitalostored/proxy/router"
+)
+
+const auditArgMaxLen = 128
+
+var auditAdminCmds = map[string]bool{
+	resp.AUTH:     false,
+	resp.SHUTDOWN: true,
+	resp.CLIENT:   true,
+	resp.MONITOR:  true,
+}
+
+type auditEntry struct {
+	Time   string   `json:"time"`
+	User   string   `json:"user"`
+	Addr   string   `json:"addr"`
+	Cmd    string   `json:"cmd"`
+	Key    string   `json:"key,omitempty"`
+	Args   []string `json:"args,omitempty"`
+	Admin  bool     `json:"admin,omitempty"`
+	Status string   `json:"status"`
+	CostUs int64    `json:"cost_us"`
+}
+
+// auditCommand records admin and write commands as JSON lines. Write commands only carry
+// the key, admin commands carry their arguments except for AUTH.
+func auditCommand(s *resp.Session, startUnixNano int64, err error) {
+	withArgs, isAdmin := auditAdminCmds[s.Cmd]
+	if !isAdmin && !router.IsWriteCmd(s.Cmd) {
+		return
+	}
+
+	now := time.Now()
+	entry := &auditEntry{
+		Time:   now.Format(time.RFC3339Nano),
+		User:   s.AuthUser(),
+		Addr:   s.RemoteAddr(),
+		Cmd:    s.Cmd,
+		Admin:  isAdmin,
+		Status: "OK",
+		CostUs: (now.UnixNano() - startUnixNano) / int64(time.Microsecond),
+	}
+	if err != nil {
+		entry.Status = err.Error()
+	}
+	if withArgs {
+		entry.Args = make([]string, 0, len(s.Args))
+		for _, arg := range s.Args {
+			if len(arg) > auditArgMaxLen {
+				arg = arg[:auditArgMaxLen]
+			}
+			entry.Args = append(entry.Args, string(arg))
+		}
+	} else if !isAdmin && len(s.Args) > 0 {
+		key := s.Args[0]
+		if len(key) > auditArgMaxLen {
+			key = key[:auditArgMaxLen]
+		}
+		entry.Key = string(key)
+	}
+
+	data, jerr := json.Marshal(entry)
+	if jerr != nil {
+		log.Warnf("marshal audit entry failed err:%v", jerr)
+		return
+	}
+	log.Audit(data)
+}
@@ -14,8 +14,329 @@
 
 package proxy
 
-var proxyInfo = []byte("status: true \n ")
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
-func SetProxyInfo(stats *Stats) {
-	proxyInfo = stats.getInfo()
+	"github.com/zuoyebang/bitalostored/butils/histogram"
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/proxy/internal/dostats"
+	"github.com/zuoyebang/bitalostored/proxy/internal/utils"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+	"github.com/zuoyebang/bitalostored/proxy/router"
+)
+
+const (
+	infoSectionServer       = "server"
+	infoSectionClients      = "clients"
+	infoSectionStats        = "stats"
+	infoSectionCommandStats = "commandstats"
+	infoSectionLatencyStats = "latencystats"
+	infoSectionKeyspace     = "keyspace"
+
+	infoSectionDefault    = "default"
+	infoSectionAll        = "all"
+	infoSectionEverything = "everything"
+
+	keyspaceInfoExpire = 5 * time.Second
+)
+
+var infoDefaultSections = []string{
+	infoSectionServer,
+	infoSectionClients,
+	infoSectionStats,
+	infoSectionKeyspace,
+}
+
+var infoAllSections = []string{
+	infoSectionServer,
+	infoSectionClients,
+	infoSectionStats,
+	infoSectionCommandStats,
+	infoSectionLatencyStats,
+	infoSectionKeyspace,
+}
+
+var infoProxy atomic.Pointer[Proxy]
+var infoStartTime = time.Now()
+
+type keyspaceSnapshot struct {
+	updateAt time.Time
+	info     []byte
+}
+
+// keyspaceInfo caches the keyspace section, it is refreshed in the background
+// so a slow group master does not hold up INFO of other clients.
+var keyspaceInfo struct {
+	cache      atomic.Pointer[keyspaceSnapshot]
+	refreshing atomic.Bool
+}
+
+func init() {
+	resp.Register(resp.INFO, InfoCommand)
+}
+
+func InfoCommand(s *resp.Session) error {
+	sections := infoDefaultSections
+	if len(s.Args) > 0 {
+		sections = make([]string, 0, len(s.Args))
+		for _, arg := range s.Args {
+			switch section := strings.ToLower(unsafe2.String(arg)); section {
+			case infoSectionDefault:
+				sections = append(sections, infoDefaultSections...)
+			case infoSectionAll, infoSectionEverything:
+				sections = append(sections, infoAllSections...)
+			default:
+				sections = append(sections, section)
+			}
+		}
+	}
+
+	s.RespWriter.WriteBulk(getInfo(sections))
+	return nil
+}
+
+func getInfo(sections []string) []byte {
+	buf := make([]byte, 0, 2048)
+	done := make(map[string]bool, len(sections))
+	for _, section := range sections {
+		if done[section] {
+			continue
+		}
+		done[section] = true
+
+		switch section {
+		case infoSectionServer:
+			buf = appendServerInfo(buf)
+		case infoSectionClients:
+			buf = appendClientsInfo(buf)
+		case infoSectionStats:
+			buf = appendStatsInfo(buf)
+		case infoSectionCommandStats:
+			buf = appendCommandStatsInfo(buf)
+		case infoSectionLatencyStats:
+			buf = appendLatencyStatsInfo(buf)
+		case infoSectionKeyspace:
+			buf = appendKeyspaceInfo(buf)
+		}
+	}
+	return buf
+}
+
+func appendServerInfo(buf []byte) []byte {
+	uptime := int64(time.Since(infoStartTime) / time.Second)
+	buf = append(buf, "# Server\n"...)
+	buf = appendInfoString(buf, "bitalos_version:", utils.GetVersionTag())
+	buf = appendInfoString(buf, "compile:", utils.Compile)
+	buf = appendInfoString(buf, "os:", runtime.GOOS+" "+runtime.GOARCH)
+	buf = appendInfoString(buf, "go_version:", runtime.Version())
+	buf = appendInfoInt(buf, "process_id:", int64(os.Getpid()))
+	if p := infoProxy.Load(); p != nil {
+		cfg := p.Config()
+		buf = appendInfoString(buf, "product_name:", cfg.ProductName)
+		buf = appendInfoString(buf, "cloud_type:", cfg.ProxyCloudType)
+		buf = appendInfoString(buf, "proto_type:", cfg.ProtoType)
+		buf = appendInfoString(buf, "proxy_addr:", cfg.ProxyAddr)
+		buf = appendInfoString(buf, "admin_addr:", cfg.AdminAddr)
+		buf = appendInfoString(buf, "hostname:", p.Model().Hostname)
+		buf = appendInfoString(buf, "online:", strconv.FormatBool(p.IsOnline()))
+	}
+	buf = appendInfoString(buf, "start_time:", infoStartTime.Format(time.RFC3339))
+	buf = appendInfoInt(buf, "uptime_in_seconds:", uptime)
+	buf = appendInfoInt(buf, "uptime_in_days:", uptime/86400)
+	return append(buf, '\n')
+}
+
+func appendClientsInfo(buf []byte) []byte {
+	buf = append(buf, "# Clients\n"...)
+	buf = appendInfoInt(buf, "connected_clients:", dostats.ConnsAlive())
+	buf = appendInfoInt(buf, "total_connections_received:", dostats.ConnsTotal())
+	if p := infoProxy.Load(); p != nil {
+		buf = appendInfoInt(buf, "maxclients:", int64(p.Config().ProxyMaxClients))
+	}
+	ps := dostats.GetPoolStat()
+	buf = appendInfoInt(buf, "pool_active_count:", int64(ps.ActiveCount))
+	buf = appendInfoInt(buf, "pool_idle_count:", int64(ps.IdleCount))
+	return append(buf, '\n')
+}
+
+func appendStatsInfo(buf []byte) []byte {
+	cost := getOpsCostFromCache()
+	buf = append(buf, "# Stats\n"...)
+	buf = appendInfoInt(buf, "total_commands_processed:", dostats.OpTotal(dostats.CmdServer))
+	buf = appendInfoInt(buf, "total_failed_commands:", dostats.OpFails(dostats.CmdServer))
+	buf = appendInfoInt(buf, "period_failed_commands:", dostats.OpPeriodFails(dostats.CmdServer))
+	buf = appendInfoInt(buf, "instantaneous_ops_per_sec:", dostats.OpQPS(dostats.CmdServer))
+	buf = appendInfoInt(buf, "cmd_cost_avg:", cost.AvgCost)
+	buf = appendInfoInt(buf, "cmd_cost_kv:", cost.KVCost)
+	buf = appendInfoInt(buf, "cmd_cost_list:", cost.ListCost)
+	buf = appendInfoInt(buf, "cmd_cost_hash:", cost.HashCost)
+	buf = appendInfoInt(buf, "cmd_cost_set:", cost.SetCost)
+	buf = appendInfoInt(buf, "cmd_cost_zset:", cost.ZsetCost)
+	buf = appendInfoInt(buf, "cmd_cost_write:", cost.WriteCost)
+	buf = appendInfoInt(buf, "cmd_cost_read:", cost.ReadCost)
+	buf = appendInfoInt(buf, "limited_reads:", dostats.LimitedReads())
+	buf = appendInfoInt(buf, "limited_writes:", dostats.LimitedWrites())
+	if u := dostats.GetSysUsage(); u != nil {
+		buf = appendInfoInt(buf, "rusage_mem:", u.MemTotal())
+		buf = appendInfoFloat(buf, "rusage_cpu:", u.CPU, 4)
+	}
+	if r := dostats.GetMemUsage(); r != nil {
+		buf = appendInfoInt(buf, "runtime_heap_alloc:", int64(r.HeapAlloc))
+		buf = appendInfoInt(buf, "runtime_gc_num:", int64(r.NumGC))
+		buf = appendInfoInt(buf, "runtime_gc_total_pausems:", int64(r.PauseTotalNs/uint64(time.Millisecond)))
+	}
+	buf = appendInfoInt(buf, "runtime_num_procs:", int64(runtime.GOMAXPROCS(0)))
+	buf = appendInfoInt(buf, "runtime_num_goroutines:", int64(runtime.NumGoroutine()))
+	return append(buf, '\n')
+}
+
+func appendCommandStatsInfo(buf []byte) []byte {
+	buf = append(buf, "# Commandstats\n"...)
+	opStats, _ := dostats.GetOpStatsAll(dostats.CmdServer)
+	for _, op := range opStats {
+		buf = append(buf, "cmdstat_"...)
+		buf = append(buf, strings.ToLower(op.OpStr)...)
+		buf = append(buf, ":calls="...)
+		buf = strconv.AppendInt(buf, op.Calls, 10)
+		buf = append(buf, ",usec="...)
+		buf = strconv.AppendInt(buf, op.Usecs, 10)
+		buf = append(buf, ",usec_per_call="...)
+		buf = strconv.AppendInt(buf, op.UsecsPercall, 10)
+		buf = append(buf, ",failed_calls="...)
+		buf = strconv.AppendInt(buf, op.Fails, 10)
+		buf = append(buf, '\n')
+	}
+	return append(buf, '\n')
+}
+
+var latencyPercentiles = []float64{50, 99, 99.9}
+
+func appendLatencyStatsInfo(buf []byte) []byte {
+	buf = append(buf, "# Latencystats\n"...)
+	dostats.RangeCmdHistograms(func(cmd string, h *histogram.Histogram) {
+		buf = appendLatencyPercentiles(buf, "latency_percentiles_usec_"+strings.ToLower(cmd), h)
+	})
+	dostats.RangeGroupHistograms(func(gid int, h *histogram.Histogram) {
+		buf = appendLatencyPercentiles(buf, "latency_percentiles_usec_group_"+strconv.Itoa(gid), h)
+	})
+	return append(buf, '\n')
+}
+
+func appendLatencyPercentiles(buf []byte, name string, h *histogram.Histogram) []byte {
+	buf = append(buf, name...)
+	buf = append(buf, ':')
+	for i, v := range h.Percentiles(latencyPercentiles...) {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, 'p')
+		buf = strconv.AppendFloat(buf, latencyPercentiles[i], 'f', -1, 64)
+		buf = append(buf, '=')
+		buf = strconv.AppendFloat(buf, float64(v), 'f', 3, 64)
+	}
+	buf = append(buf, ",max="...)
+	buf = strconv.AppendFloat(buf, float64(h.Max()), 'f', 3, 64)
+	return append(buf, '\n')
+}
+
+func appendKeyspaceInfo(buf []byte) []byte {
+	snap := keyspaceInfo.cache.Load()
+	if snap == nil {
+		snap = refreshKeyspaceInfo()
+	} else if time.Since(snap.updateAt) >= keyspaceInfoExpire && keyspaceInfo.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer keyspaceInfo.refreshing.Store(false)
+			refreshKeyspaceInfo()
+		}()
+	}
+	return append(buf, snap.info...)
+}
+
+func refreshKeyspaceInfo() *keyspaceSnapshot {
+	snap := &keyspaceSnapshot{info: buildKeyspaceInfo(nil)}
+	snap.updateAt = time.Now()
+	keyspaceInfo.cache.Store(snap)
+	return snap
+}
+
+func buildKeyspaceInfo(buf []byte) []byte {
+	buf = append(buf, "# Keyspace\n"...)
+	pc, err := router.GetProxyClient()
+	if err != nil {
+		return append(buf, '\n')
+	}
+
+	var totalOps, totalCmds, totalUsed, totalData, okGroups int64
+	masters := pc.GetMasterInfos()
+	for _, m := range masters {
+		buf = append(buf, "group_"...)
+		buf = strconv.AppendInt(buf, int64(m.GroupId), 10)
+		buf = append(buf, ":addr="...)
+		buf = append(buf, m.HostPort...)
+		if m.Err != nil {
+			buf = append(buf, ",status=error\n"...)
+			continue
+		}
+
+		fields := parseInfoFields(m.Info)
+		ops := infoFieldInt(fields, "instantaneous_ops_per_sec")
+		cmds := infoFieldInt(fields, "total_commands_processed")
+		used := infoFieldInt(fields, "disk_used_size")
+		data := infoFieldInt(fields, "disk_data_size")
+		okGroups++
+		totalOps += ops
+		totalCmds += cmds
+		totalUsed += used
+		totalData += data
+
+		buf = append(buf, ",status=ok,ops_per_sec="...)
+		buf = strconv.AppendInt(buf, ops, 10)
+		buf = append(buf, ",commands="...)
+		buf = strconv.AppendInt(buf, cmds, 10)
+		buf = append(buf, ",used_size="...)
+		buf = strconv.AppendInt(buf, used, 10)
+		buf = append(buf, ",data_size="...)
+		buf = strconv.AppendInt(buf, data, 10)
+		buf = append(buf, ",raft_log_index="...)
+		buf = append(buf, fields["raft_log_index"]...)
+		buf = append(buf, '\n')
+	}
+	buf = appendInfoInt(buf, "groups:", int64(len(masters)))
+	buf = appendInfoInt(buf, "groups_ok:", okGroups)
+	buf = appendInfoInt(buf, "total_ops_per_sec:", totalOps)
+	buf = appendInfoInt(buf, "total_commands_processed:", totalCmds)
+	buf = appendInfoInt(buf, "total_used_size:", totalUsed)
+	buf = appendInfoInt(buf, "total_data_size:", totalData)
+	return append(buf, '\n')
+}
+
+func parseInfoFields(info string) map[string]string {
+	fields := make(map[string]string, 64)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if i := strings.IndexByte(line, ':'); i > 0 {
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+	return fields
+}
+
+func infoFieldInt(fields map[string]string, key string) int64 {
+	v, _ := strconv.ParseInt(fields[key], 10, 64)
+	return v
+}
+
+func appendInfoString(buf []byte, key string, value string) []byte {
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	buf = append(buf, '\n')
+	return buf
 }
@@ -0,0 +1,68 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/proxy/internal/dostats"
+)
+
+func TestLatencyStatsInfo(t *testing.T) {
+	dostats.ResetLatencyStats()
+	h := dostats.CmdHistogram("GET")
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	dostats.RecordGroupLatency(3, 2*time.Millisecond)
+
+	info := string(getInfo([]string{infoSectionLatencyStats}))
+	for _, want := range []string{
+		"# Latencystats\n",
+		"latency_percentiles_usec_get:p50=51.000,p99=100.000,p99.9=100.000,max=100.000\n",
+		"latency_percentiles_usec_group_3:",
+	} {
+		if !strings.Contains(info, want) {
+			t.Fatalf("missing %q in:\n%s", want, info)
+		}
+	}
+
+	dostats.ResetLatencyStats()
+	if info = string(getInfo([]string{infoSectionLatencyStats})); strings.Contains(info, "latency_percentiles_usec_get") {
+		t.Fatalf("reset fail:\n%s", info)
+	}
+}
+
+func TestKeyspaceInfoRefresh(t *testing.T) {
+	stale := &keyspaceSnapshot{updateAt: time.Now().Add(-time.Minute), info: []byte("# Keyspace\nstale:1\n\n")}
+	keyspaceInfo.cache.Store(stale)
+	defer keyspaceInfo.cache.Store(nil)
+
+	if info := string(appendKeyspaceInfo(nil)); info != string(stale.info) {
+		t.Fatalf("a stale cache should be served while refreshing, got:\n%s", info)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for keyspaceInfo.cache.Load() == stale || keyspaceInfo.refreshing.Load() {
+		if time.Now().After(deadline) {
+			t.Fatalf("keyspace info not refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info := string(appendKeyspaceInfo(nil)); strings.Contains(info, "stale:1") || !strings.HasPrefix(info, "# Keyspace\n") {
+		t.Fatalf("refreshed keyspace info:\n%s", info)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net"
+	"sync"
+)
+
+// limitListener works like netutil.LimitListener, except that the limit can be
+// changed at runtime by a config reload. A limit <= 0 accepts without limit.
+type limitListener struct {
+	net.Listener
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+	closed bool
+}
+
+func newLimitListener(l net.Listener, limit int) *limitListener {
+	ll := &limitListener{Listener: l, limit: limit}
+	ll.cond = sync.NewCond(&ll.mu)
+	return ll
+}
+
+func (l *limitListener) SetLimit(limit int) {
+	l.mu.Lock()
+	l.limit = limit
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+func (l *limitListener) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *limitListener) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for !l.closed && l.limit > 0 && l.active >= l.limit {
+		l.cond.Wait()
+	}
+	if l.closed {
+		return false
+	}
+	l.active++
+	return true
+}
+
+func (l *limitListener) release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+	l.cond.Signal()
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if !l.acquire() {
+		return nil, net.ErrClosed
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		l.release()
+		return nil, err
+	}
+	return &limitListenerConn{Conn: c, release: l.release}, nil
+}
+
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	l.cond.Broadcast()
+	return err
+}
+
+type limitListenerConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (c *limitListenerConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
@@ -0,0 +1,121 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/zuoyebang/bitalostored/butils/histogram"
+	"github.com/zuoyebang/bitalostored/butils/promtext"
+	"github.com/zuoyebang/bitalostored/proxy/internal/dostats"
+)
+
+const metricsPrefix = "bitalosproxy_"
+
+func writeLatencyQuantiles(mw *promtext.Writer, labels string, h *histogram.Histogram) {
+	for i, v := range h.Percentiles(latencyPercentiles...) {
+		q := strconv.FormatFloat(latencyPercentiles[i]/100, 'f', -1, 64)
+		mw.Gauge("latency_seconds", labels+`,quantile="`+q+`"`, float64(v)/1e6)
+	}
+	mw.Gauge("latency_seconds", labels+`,quantile="1"`, float64(h.Max())/1e6)
+	mw.Gauge("latency_samples", labels, float64(h.Count()))
+}
+
+func (s *apiServer) Metrics(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.proxy.WritePrometheus(w)
+}
+
+// WritePrometheus writes the proxy metrics in Prometheus text format,
+// followed by the process metrics.
+func (p *Proxy) WritePrometheus(w io.Writer) {
+	mw := promtext.NewWriter(metricsPrefix, fmt.Sprintf(`product=%q,node=%q,role="proxy"`, p.model.ProductName, p.model.ProxyAddr))
+
+	mw.Gauge("up", "", promtext.BoolToFloat(!p.IsClosed()))
+	mw.Gauge("online", "", promtext.BoolToFloat(p.IsOnline()))
+	mw.Counter("commands_total", "", float64(dostats.OpTotal(dostats.CmdServer)))
+	mw.Counter("commands_failed_total", "", float64(dostats.OpFails(dostats.CmdServer)))
+	mw.Gauge("commands_period_failed", "", float64(dostats.OpPeriodFails(dostats.CmdServer)))
+	mw.Gauge("commands_qps", "", float64(dostats.OpQPS(dostats.CmdServer)))
+
+	opStats, _ := dostats.GetOpStatsAll(dostats.CmdServer)
+	for _, op := range opStats {
+		labels := fmt.Sprintf(`command=%q`, op.OpStr)
+		mw.Counter("command_calls_total", labels, float64(op.Calls))
+		mw.Counter("command_failed_total", labels, float64(op.Fails))
+		mw.Counter("command_duration_seconds_total", labels, float64(op.Usecs)/1e6)
+		mw.Gauge("command_duration_seconds_avg", labels, float64(op.UsecsPercall)/1e6)
+	}
+
+	dostats.RangeCmdHistograms(func(cmd string, h *histogram.Histogram) {
+		writeLatencyQuantiles(mw, fmt.Sprintf(`command=%q`, cmd), h)
+	})
+	dostats.RangeGroupHistograms(func(gid int, h *histogram.Histogram) {
+		writeLatencyQuantiles(mw, fmt.Sprintf(`group="%d"`, gid), h)
+	})
+
+	cost := getOpsCostFromCache()
+	for _, c := range []struct {
+		kind string
+		usec int64
+	}{
+		{"avg", cost.AvgCost},
+		{"kv", cost.KVCost},
+		{"list", cost.ListCost},
+		{"hash", cost.HashCost},
+		{"set", cost.SetCost},
+		{"zset", cost.ZsetCost},
+		{"write", cost.WriteCost},
+		{"read", cost.ReadCost},
+	} {
+		mw.Gauge("command_cost_seconds", fmt.Sprintf(`kind=%q`, c.kind), float64(c.usec)/1e6)
+	}
+
+	mw.Counter("sessions_total", "", float64(dostats.ConnsTotal()))
+	mw.Gauge("sessions_alive", "", float64(dostats.ConnsAlive()))
+
+	ps := dostats.GetPoolStat()
+	mw.Gauge("pool_active_conns", "", float64(ps.ActiveCount))
+	mw.Gauge("pool_idle_conns", "", float64(ps.IdleCount))
+
+	if ls := dostats.GetLimitStats(); ls != nil {
+		mw.Counter("limited_total", `op="read"`, float64(ls.Reads))
+		mw.Counter("limited_total", `op="write"`, float64(ls.Writes))
+	}
+
+	if p.proxyClient != nil {
+		hits, misses := p.proxyClient.LocalCacheStats()
+		var hitRate float64
+		if hits+misses > 0 {
+			hitRate = float64(hits) / float64(hits+misses)
+		}
+		mw.Counter("local_cache_hits_total", "", float64(hits))
+		mw.Counter("local_cache_misses_total", "", float64(misses))
+		mw.Gauge("local_cache_hit_rate", "", hitRate)
+		mw.Gauge("groups", "", float64(len(p.proxyClient.GetAllGroup())))
+	}
+
+	if u := dostats.GetSysUsage(); u != nil {
+		mw.Gauge("cpu_usage", "", u.CPU)
+		mw.Gauge("memory_bytes", "", float64(u.MemTotal()))
+	}
+
+	mw.WriteTo(w)
+	metrics.WritePrometheus(w, true)
+}
@@ -20,20 +20,21 @@ import (
 	"os/exec"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/zuoyebang/bitalostored/butils"
+	"github.com/zuoyebang/bitalostored/butils/tracing"
 	"github.com/zuoyebang/bitalostored/proxy/internal/config"
 	"github.com/zuoyebang/bitalostored/proxy/internal/errn"
 	"github.com/zuoyebang/bitalostored/proxy/internal/log"
 	"github.com/zuoyebang/bitalostored/proxy/internal/models"
 	"github.com/zuoyebang/bitalostored/proxy/internal/rpc"
 	"github.com/zuoyebang/bitalostored/proxy/internal/utils"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
 	_ "github.com/zuoyebang/bitalostored/proxy/respcmd"
 	"github.com/zuoyebang/bitalostored/proxy/router"
-
-	"golang.org/x/net/netutil"
 )
 
 type Proxy struct {
@@ -42,8 +43,10 @@ type Proxy struct {
 	closed      atomic.Bool
 	exitC       chan struct{}
 	model       *models.Proxy
-	config      *config.Config
+	config      atomic.Pointer[config.Config]
+	reloadMu    sync.Mutex
 	proxyClient *router.ProxyClient
+	limiter     *limitListener
 	lproxy      net.Listener
 	ladmin      net.Listener
 }
@@ -56,7 +59,7 @@ func New(cfg *config.Config) (*Proxy, error) {
 	p := &Proxy{}
 	p.closed.Store(false)
 	p.online.Store(false)
-	p.config = cfg
+	p.config.Store(cfg)
 	p.exitC = make(chan struct{})
 	pwd, _ := os.Getwd()
 	p.model = &models.Proxy{
@@ -79,8 +82,11 @@ func New(cfg *config.Config) (*Proxy, error) {
 	}
 
 	p.proxyClient = router.NewProxyClient(cfg)
+	infoProxy.Store(p)
+	resp.SetSlowLogMaxLen(cfg.Log.SlowLogMaxLen)
+	p.setupTracing(cfg)
 
-	go serveProxy(p, cfg)
+	go serveProxy(p)
 	go serveAdmin(p)
 
 	p.startProbeNode()
@@ -103,7 +109,8 @@ func (p *Proxy) setup(config *config.Config) error {
 	if err != nil {
 		return err
 	}
-	p.lproxy = netutil.LimitListener(l, config.ProxyMaxClients)
+	p.limiter = newLimitListener(l, config.ProxyMaxClients)
+	p.lproxy = p.limiter
 	proxyAddr, err := butils.ReplaceUnspecifiedIP(proto, p.ProxyAddress(), config.HostProxy)
 	if err != nil {
 		return err
@@ -159,6 +166,7 @@ func (p *Proxy) Close() error {
 	if p.ladmin != nil {
 		p.ladmin.Close()
 	}
+	tracing.SetDefault(nil)
 	return nil
 }
 
@@ -171,7 +179,7 @@ func (p *Proxy) Model() *models.Proxy {
 }
 
 func (p *Proxy) Config() *config.Config {
-	return p.config
+	return p.config.Load()
 }
 
 func (p *Proxy) IsOnline() bool {
@@ -0,0 +1,126 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/zuoyebang/bitalostored/proxy/internal/anticc"
+	"github.com/zuoyebang/bitalostored/proxy/internal/config"
+	"github.com/zuoyebang/bitalostored/proxy/internal/errn"
+	"github.com/zuoyebang/bitalostored/proxy/internal/log"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+)
+
+// restartOnlyConfigs are bound to listeners, pools, log files or the tracer at
+// startup. A reload keeps their running values and logs the ignored change.
+var restartOnlyConfigs = []string{
+	"ProductName",
+	"ProductAuth",
+	"ProtoType",
+	"ProxyAddr",
+	"AdminAddr",
+	"DashboardProtoType",
+	"DashboardUsername",
+	"DashboardPassword",
+	"HostProxy",
+	"HostAdmin",
+	"MaxProcs",
+	"ReadOnlyProxy",
+	"ProxyCloudType",
+	"OpenDistributedTx",
+	"PprofSwitch",
+	"PprofAddress",
+	"MetricsReportLogSwitch",
+	"MetricsReportLogPeriod",
+	"MetricsResetCycle",
+	"Tracing",
+	"RedisDefaultConf",
+	"Log.RotationTime",
+	"Log.LogFile",
+	"Log.StatsLogFile",
+	"Log.SlowLogFile",
+	"Log.AccessLogFile",
+	"Log.AuditLogFile",
+}
+
+// Reload reads the config file the proxy was started with and applies it.
+func (p *Proxy) Reload() error {
+	file := p.Config().ConfigFile
+	if file == "" {
+		return errn.ErrNoConfigFile
+	}
+
+	cfg := config.NewDefaultConfig()
+	if err := cfg.LoadFromFile(file); err != nil {
+		log.Warnf("reload config file:%s failed err:%s", file, err.Error())
+		return err
+	}
+	return p.LoadConfig(cfg)
+}
+
+// LoadConfig applies a validated config to the running proxy. Max clients,
+// breaker thresholds, dynamic deadline, read_master_chance, proxy auth, conn
+// buffers and the log switches take effect without dropping connections.
+func (p *Proxy) LoadConfig(cfg *config.Config) error {
+	if p.IsClosed() {
+		return errn.ErrClosedProxy
+	}
+
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	old := p.Config()
+	for _, name := range keepRestartOnlyConfigs(old, cfg) {
+		log.Warnf("reload config ignore %s, it needs a restart to take effect", name)
+	}
+	if err := anticc.LoadConfig(cfg); err != nil {
+		return err
+	}
+
+	p.proxyClient.LoadConfig(cfg)
+	p.limiter.SetLimit(cfg.ProxyMaxClients)
+	resp.SetSlowLogMaxLen(cfg.Log.SlowLogMaxLen)
+	log.Reload(&log.Options{
+		IsDebug:   cfg.Log.IsDebug,
+		SlowLog:   cfg.Log.SlowLog,
+		AccessLog: cfg.Log.AccessLog,
+		AuditLog:  cfg.Log.AuditLog,
+	})
+	p.config.Store(cfg)
+
+	log.Infof("reload config success\n%s", cfg)
+	return nil
+}
+
+func keepRestartOnlyConfigs(old, cfg *config.Config) []string {
+	var changed []string
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(cfg).Elem()
+	for _, name := range restartOnlyConfigs {
+		oldField, newField := oldValue, newValue
+		for _, n := range strings.Split(name, ".") {
+			oldField = oldField.FieldByName(n)
+			newField = newField.FieldByName(n)
+		}
+		if !reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			newField.Set(oldField)
+			changed = append(changed, name)
+		}
+	}
+	cfg.ConfigFile = old.ConfigFile
+	return changed
+}
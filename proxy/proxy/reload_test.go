@@ -0,0 +1,88 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/proxy/internal/config"
+)
+
+func TestKeepRestartOnlyConfigs(t *testing.T) {
+	old := config.NewDefaultConfig()
+	old.ConfigFile = "/tmp/proxy.toml"
+	cfg := config.NewDefaultConfig()
+	cfg.ProxyAddr = "0.0.0.0:9112"
+	cfg.Log.LogFile = "/tmp/other.log"
+	cfg.ProxyMaxClients = 2000
+	cfg.ReadMasterChance = 60
+
+	changed := keepRestartOnlyConfigs(old, cfg)
+	if len(changed) != 2 || changed[0] != "ProxyAddr" || changed[1] != "Log.LogFile" {
+		t.Fatalf("changed:%v", changed)
+	}
+	if cfg.ProxyAddr != old.ProxyAddr || cfg.Log.LogFile != old.Log.LogFile || cfg.ConfigFile != old.ConfigFile {
+		t.Fatalf("restart only config not kept: %s %s %s", cfg.ProxyAddr, cfg.Log.LogFile, cfg.ConfigFile)
+	}
+	if cfg.ProxyMaxClients != 2000 || cfg.ReadMasterChance != 60 {
+		t.Fatalf("reloadable config lost: %d %d", cfg.ProxyMaxClients, cfg.ReadMasterChance)
+	}
+}
+
+func TestLimitListenerSetLimit(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ll := newLimitListener(l, 1)
+	defer ll.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ll.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+
+	first := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("accept over limit")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ll.SetLimit(2)
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(time.Second):
+		t.Fatal("accept not resumed after raising limit")
+	}
+	first.Close()
+}
@@ -17,11 +17,10 @@ package proxy
 import (
 	"net/http"
 
-	"github.com/zuoyebang/bitalostored/proxy/internal/config"
 	"github.com/zuoyebang/bitalostored/proxy/internal/log"
 )
 
-func serveProxy(p *Proxy, config *config.Config) {
+func serveProxy(p *Proxy) {
 	if p.IsClosed() {
 		return
 	}
@@ -36,7 +35,7 @@ func serveProxy(p *Proxy, config *config.Config) {
 				log.Errorf("proxy accept on error %s", err.Error())
 				continue
 			}
-			newClientRESP(conn, p, config)
+			newClientRESP(conn, p, p.Config())
 		}
 	}()
 
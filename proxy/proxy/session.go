@@ -21,10 +21,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/zuoyebang/bitalostored/butils/tracing"
 	"github.com/zuoyebang/bitalostored/butils/unsafe2"
 	"github.com/zuoyebang/bitalostored/proxy/internal/config"
 	"github.com/zuoyebang/bitalostored/proxy/internal/log"
 	"github.com/zuoyebang/bitalostored/proxy/resp"
+	"github.com/zuoyebang/bitalostored/proxy/router"
 
 	"github.com/cockroachdb/errors"
 )
@@ -42,9 +44,6 @@ type requestClient struct {
 
 type sessionClient struct {
 	sproxy     *Proxy
-	accessLog  bool
-	slowLog    bool
-	slowCost   int64
 	remoteAddr string
 	session    *resp.Session
 	conn       net.Conn
@@ -73,9 +72,6 @@ func newClientRESP(conn net.Conn, p *Proxy, cfg *config.Config) {
 		cfg.OpenDistributedTx)
 	c.sproxy = p
 	c.remoteAddr = conn.RemoteAddr().String()
-	c.accessLog = cfg.Log.AccessLog
-	c.slowLog = cfg.Log.SlowLog
-	c.slowCost = cfg.Log.SlowLogCost.Int64()
 	c.session.SetAuth(cfg.ProxyAuthEnabled, cfg.ProxyAuthPassword, cfg.ProxyAuthAdmin)
 	c.session.SetLastQueryTime()
 	c.buf = bytes.Buffer{}
@@ -136,6 +132,11 @@ func (sc *sessionClient) run() {
 
 	for {
 		sc.session.SetReadDeadline()
+		// checked after the deadline is set, so a Kill racing with it
+		// either is seen here or expires the read below
+		if sc.session.Killed() {
+			return
+		}
 		sc.session.Cmd = ""
 		sc.session.Args = nil
 		sc.session.SetLastQueryTime()
@@ -154,7 +155,8 @@ func (sc *sessionClient) run() {
 			log.Warnf("handleRequest romoteAddr:%s cmd:%s args:%v err:%s", sc.remoteAddr, sc.session.Cmd, argsTmp, err.Error())
 		}
 
-		if sc.accessLog {
+		logConf := &sc.sproxy.Config().Log
+		if logConf.AccessLog {
 			duration := time.Since(start)
 			fullCmd := sc.catGenericCommand()
 			cost := duration.Nanoseconds() / 1000
@@ -165,17 +167,15 @@ func (sc *sessionClient) run() {
 			log.Access(sc.remoteAddr, cost, fullCmd[:truncateLen], err)
 		}
 
-		if sc.slowLog {
-			duration := time.Since(start)
-			cost := duration.Nanoseconds()
-			if cost >= sc.slowCost {
+		if duration := time.Since(start); duration.Nanoseconds() >= logConf.SlowLogCost.Int64() && len(sc.session.Cmd) > 0 {
+			sc.session.AddSlowLog(start, duration)
+			if logConf.SlowLog {
 				fullCmd := sc.catGenericCommand()
 				truncateLen := len(fullCmd)
 				if truncateLen > 256 {
 					truncateLen = 256
 				}
-				cost = cost / 1000
-				log.Slow(sc.remoteAddr, cost, fullCmd[:truncateLen], err)
+				log.Slow(sc.remoteAddr, duration.Microseconds(), fullCmd[:truncateLen], err)
 			}
 		}
 
@@ -197,6 +197,7 @@ func (sc *sessionClient) catGenericCommand() []byte {
 }
 
 func (sc *sessionClient) handleRequest(reqData [][]byte) error {
+	reqData, traceParent := tracing.SplitCommand(reqData)
 	if len(reqData) == 0 {
 		sc.session.Cmd = ""
 		sc.session.Args = reqData[0:0]
@@ -215,17 +216,22 @@ func (sc *sessionClient) handleRequest(reqData [][]byte) error {
 		}
 	}
 
-	if sc.session.Cmd == "INFO" {
-		sc.session.RespWriter.WriteBulk(proxyInfo)
-		return nil
-	}
-
 	if sc.session.Cmd == "QUIT" {
 		sc.session.RespWriter.WriteStatus(resp.ReplyOK)
 		return errClientQuit
 	}
 
+	if sc.session.Cmd != resp.CLIENT {
+		resp.WaitClientPause(router.IsWriteCmd(sc.session.Cmd))
+	}
+
 	startUninNano := time.Now().UnixNano()
 
-	return sc.session.Perform(startUninNano)
+	sc.session.StartTraceSpan(traceParent, startUninNano)
+	err := sc.session.Perform(startUninNano)
+	sc.session.EndTraceSpan(err)
+	if sc.sproxy.Config().Log.AuditLog {
+		auditCommand(sc.session, startUninNano, err)
+	}
+	return err
 }
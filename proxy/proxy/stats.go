@@ -118,6 +118,8 @@ type Stats struct {
 
 	Pool dostats.PoolStat `json:"pool"`
 
+	Limited *dostats.LimitStats `json:"limited,omitempty"`
+
 	Sessions struct {
 		Total int64 `json:"total"`
 		Alive int64 `json:"alive"`
@@ -131,9 +133,6 @@ type Stats struct {
 	} `json:"rusage"`
 
 	Runtime *RuntimeStats `json:"runtime,omitempty"`
-
-	infos  [2][]byte
-	rIndex int
 }
 
 var goc = GlobalOpsCost{}
@@ -161,45 +160,7 @@ type OpsCost struct {
 }
 
 func NewStats() *Stats {
-	s := &Stats{}
-	s.infos[0] = make([]byte, 0, 1024)
-	s.infos[1] = make([]byte, 0, 1024)
-	s.rIndex = 0
-	return s
-}
-
-func (stats *Stats) getInfo() []byte {
-	wIndex := (stats.rIndex + 1) % 2
-
-	stats.infos[wIndex] = stats.infos[wIndex][:0]
-	stats.infos[wIndex] = append(stats.infos[wIndex], []byte("# Status\nstatus: true \n")...)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cdm_ops_total:", stats.CmdOps.Total)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cdm_ops_fails:", stats.CmdOps.Fails)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cdm_ops_qps:", stats.CmdOps.QPS)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cmd_cost_avg:", stats.CmdOps.AvgCost)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cmd_cost_kv:", stats.CmdOps.KVCost)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cmd_cost_list:", stats.CmdOps.ListCost)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cmd_cost_hash:", stats.CmdOps.HashCost)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cmd_cost_set:", stats.CmdOps.SetCost)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cmd_cost_zset:", stats.CmdOps.ZsetCost)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cmd_cost_write:", stats.CmdOps.WriteCost)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "cmd_cost_read:", stats.CmdOps.ReadCost)
-
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "sessions_total:", stats.Sessions.Total)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "sessions_alive:", stats.Sessions.Alive)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "rusage_mem:", stats.Rusage.Mem)
-	stats.infos[wIndex] = appendInfoFloat(stats.infos[wIndex], "rusage_cpu:", stats.Rusage.CPU, 4)
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "runtime_gc_num:", int64(stats.Runtime.GC.Num))
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "runtime_gc_total_pausems:", int64(stats.Runtime.GC.TotalPauseMs))
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "runtime_num_procs:", int64(stats.Runtime.NumProcs))
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "runtime_num_goroutines:", int64(stats.Runtime.NumGoroutines))
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "runtime_num_cgo_call:", int64(stats.Runtime.NumCgoCall))
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "pool_active_count:", int64(stats.Pool.ActiveCount))
-	stats.infos[wIndex] = appendInfoInt(stats.infos[wIndex], "pool_idle_count:", int64(stats.Pool.IdleCount))
-	stats.infos[wIndex] = append(stats.infos[wIndex], '\n')
-
-	stats.rIndex = wIndex
-	return stats.infos[stats.rIndex]
+	return &Stats{}
 }
 
 func appendInfoInt(buf []byte, key string, value int64) []byte {
@@ -286,6 +247,8 @@ func GetStats(s *Proxy, update bool) *Stats {
 		stats.CmdOps.OpsCost = getOpsCostFromCache()
 	}
 
+	stats.Limited = dostats.GetLimitStats()
+
 	stats.Sessions.Total = dostats.ConnsTotal()
 	stats.Sessions.Alive = dostats.ConnsAlive()
 
@@ -319,7 +282,6 @@ func GetStats(s *Proxy, update bool) *Stats {
 	stats.Runtime.NumGoroutines = runtime.NumGoroutine()
 	stats.Runtime.NumCgoCall = runtime.NumCgoCall()
 
-	SetProxyInfo(stats)
 	stats.Copy(simpleStat)
 
 	return stats
@@ -344,6 +306,8 @@ func (stats *Stats) Copy(s *Stats) {
 	s.Pool.ActiveCount = stats.Pool.ActiveCount
 	s.Pool.IdleCount = stats.Pool.IdleCount
 
+	s.Limited = stats.Limited
+
 	s.Rusage = stats.Rusage
 	s.Runtime = stats.Runtime
 }
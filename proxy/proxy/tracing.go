@@ -0,0 +1,47 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proxy
+
+import (
+	"github.com/zuoyebang/bitalostored/butils"
+	"github.com/zuoyebang/bitalostored/butils/tracing"
+	"github.com/zuoyebang/bitalostored/proxy/internal/config"
+	"github.com/zuoyebang/bitalostored/proxy/internal/log"
+)
+
+const tracingServiceName = "bitalosproxy"
+
+func (p *Proxy) setupTracing(cfg *config.Config) {
+	if !cfg.Tracing.Enable {
+		return
+	}
+	exporter, err := tracing.NewExporter(cfg.Tracing.Exporter, cfg.Tracing.ExporterTarget)
+	if err != nil {
+		log.Warnf("tracing exporter init fail err:%v", err)
+		return
+	}
+	tracing.SetDefault(tracing.NewTracer(tracing.Config{
+		ServiceName: tracingServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		Exporter:    exporter,
+		Attributes: []tracing.Attribute{
+			{Key: "bitalos.product", Value: cfg.ProductName},
+			{Key: "host.name", Value: butils.Hostname},
+			{Key: "bitalos.proxy_addr", Value: p.model.ProxyAddr},
+		},
+	}))
+	log.Infof("tracing enabled exporter:%s target:%s sample_ratio:%v",
+		cfg.Tracing.Exporter, cfg.Tracing.ExporterTarget, cfg.Tracing.SampleRatio)
+}
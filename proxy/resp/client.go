@@ -0,0 +1,216 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resp
+
+import (
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ClientPauseNone int32 = iota
+	ClientPauseWrite
+	ClientPauseAll
+)
+
+const clientPauseCheckInterval = 10 * time.Millisecond
+
+var clientPause struct {
+	mode  atomic.Int32
+	until atomic.Int64
+}
+
+type ClientInfo struct {
+	ID        int64
+	Addr      string
+	LocalAddr string
+	Name      string
+	User      string
+	Age       int64
+	Idle      int64
+	Flags     string
+	Multi     int32
+	Watch     int
+	Qbuf      int32
+	Obuf      int32
+	LastCmd   string
+}
+
+func (ci *ClientInfo) String() string {
+	buf := make([]byte, 0, 256)
+	buf = append(buf, "id="...)
+	buf = strconv.AppendInt(buf, ci.ID, 10)
+	buf = append(buf, " addr="...)
+	buf = append(buf, ci.Addr...)
+	buf = append(buf, " laddr="...)
+	buf = append(buf, ci.LocalAddr...)
+	buf = append(buf, " name="...)
+	buf = append(buf, ci.Name...)
+	buf = append(buf, " age="...)
+	buf = strconv.AppendInt(buf, ci.Age, 10)
+	buf = append(buf, " idle="...)
+	buf = strconv.AppendInt(buf, ci.Idle, 10)
+	buf = append(buf, " flags="...)
+	buf = append(buf, ci.Flags...)
+	buf = append(buf, " db=0 multi="...)
+	buf = strconv.AppendInt(buf, int64(ci.Multi), 10)
+	buf = append(buf, " watch="...)
+	buf = strconv.AppendInt(buf, int64(ci.Watch), 10)
+	buf = append(buf, " qbuf="...)
+	buf = strconv.AppendInt(buf, int64(ci.Qbuf), 10)
+	buf = append(buf, " obl="...)
+	buf = strconv.AppendInt(buf, int64(ci.Obuf), 10)
+	buf = append(buf, " cmd="...)
+	buf = append(buf, ci.LastCmd...)
+	buf = append(buf, " user="...)
+	buf = append(buf, ci.User...)
+	return string(buf)
+}
+
+func (s *Session) ID() int64 {
+	return s.id
+}
+
+func (s *Session) RemoteAddr() string {
+	if addr := s.conn.RemoteAddr(); addr != nil {
+		return addr.String()
+	}
+	return ""
+}
+
+func (s *Session) LocalAddr() string {
+	if addr := s.conn.LocalAddr(); addr != nil {
+		return addr.String()
+	}
+	return ""
+}
+
+func (s *Session) ClientName() string {
+	if name := s.clientName.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+func (s *Session) SetClientName(name string) {
+	if len(name) == 0 {
+		s.clientName.Store(nil)
+		return
+	}
+	s.clientName.Store(&name)
+}
+
+func (s *Session) SetNoEvict(on bool) {
+	s.noEvict.Store(on)
+}
+
+func (s *Session) IsClosed() bool {
+	return s.activeQuit
+}
+
+func (s *Session) ClientInfo() *ClientInfo {
+	now := time.Now()
+	ci := &ClientInfo{
+		ID:        s.id,
+		Addr:      s.RemoteAddr(),
+		LocalAddr: s.LocalAddr(),
+		Name:      s.ClientName(),
+		User:      s.authUser,
+		Age:       int64(now.Sub(s.createTime) / time.Second),
+		Idle:      (now.UnixNano() - s.lastQueryTime.Load()) / int64(time.Second),
+		Multi:     s.multiNum.Load(),
+		Qbuf:      s.qbufSize.Load(),
+		Obuf:      s.obufSize.Load(),
+		LastCmd:   "NULL",
+	}
+	if ci.Idle < 0 || s.isDealingQuery.Load() {
+		ci.Idle = 0
+	}
+	if s.watching.Load() {
+		ci.Watch = 1
+	}
+	if cmd := s.lastCmd.Load(); cmd != nil {
+		ci.LastCmd = *cmd
+	}
+
+	flags := make([]byte, 0, 4)
+	if ci.Multi >= 0 {
+		flags = append(flags, 'x')
+	}
+	if s.noEvict.Load() {
+		flags = append(flags, 'e')
+	}
+	if len(flags) == 0 {
+		flags = append(flags, 'N')
+	}
+	ci.Flags = string(flags)
+	return ci
+}
+
+func (m *SessionManager) Sessions() []*Session {
+	sessions := make([]*Session, 0, 128)
+	m.sessions.Range(func(key, _ any) bool {
+		if s, ok := key.(*Session); ok && !s.activeQuit && !s.Killed() {
+			sessions = append(sessions, s)
+		}
+		return true
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].id < sessions[j].id
+	})
+	return sessions
+}
+
+func ClientSessions() []*Session {
+	return globalSessionManager.Sessions()
+}
+
+func PauseClients(mode int32, timeout time.Duration) {
+	clientPause.until.Store(time.Now().Add(timeout).UnixNano())
+	clientPause.mode.Store(mode)
+}
+
+func UnpauseClients() {
+	clientPause.mode.Store(ClientPauseNone)
+}
+
+func ClientPauseMode() int32 {
+	mode := clientPause.mode.Load()
+	if mode != ClientPauseNone && time.Now().UnixNano() >= clientPause.until.Load() {
+		clientPause.mode.CompareAndSwap(mode, ClientPauseNone)
+		return ClientPauseNone
+	}
+	return mode
+}
+
+// WaitClientPause blocks the caller until CLIENT PAUSE expires or is lifted by CLIENT UNPAUSE.
+// Reads are only held when all clients are paused.
+func WaitClientPause(isWrite bool) {
+	for {
+		mode := ClientPauseMode()
+		if mode == ClientPauseNone || (mode == ClientPauseWrite && !isWrite) {
+			return
+		}
+		wait := time.Duration(clientPause.until.Load() - time.Now().UnixNano())
+		if wait > clientPauseCheckInterval {
+			wait = clientPauseCheckInterval
+		}
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resp
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientInfo(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	s := NewSession(c1, 1024, 1024, false)
+	defer s.Close()
+
+	s.SetClientName("worker-1")
+	s.Cmd = PING
+	s.updateClientState()
+
+	line := s.ClientInfo().String()
+	for _, field := range []string{"name=worker-1", "flags=N", "multi=-1", "user=default"} {
+		if !strings.Contains(line, field) {
+			t.Fatalf("client info %q missing %s", line, field)
+		}
+	}
+
+	s.SetClientName("")
+	s.SetNoEvict(true)
+	if ci := s.ClientInfo(); ci.Name != "" || ci.Flags != "e" {
+		t.Fatalf("client info name:%s flags:%s", ci.Name, ci.Flags)
+	}
+}
+
+func TestClientPause(t *testing.T) {
+	PauseClients(ClientPauseWrite, 50*time.Millisecond)
+	start := time.Now()
+	WaitClientPause(false)
+	if time.Since(start) >= 50*time.Millisecond {
+		t.Fatal("read should not wait for write pause")
+	}
+	WaitClientPause(true)
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("write should wait for write pause")
+	}
+	if mode := ClientPauseMode(); mode != ClientPauseNone {
+		t.Fatalf("pause should expire, mode:%d", mode)
+	}
+
+	PauseClients(ClientPauseAll, time.Minute)
+	UnpauseClients()
+	start = time.Now()
+	WaitClientPause(false)
+	if time.Since(start) >= 10*time.Millisecond {
+		t.Fatal("unpause should release clients")
+	}
+}
+
+func TestClientKill(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	s := NewSession(c1, 1024, 1024, false)
+	defer s.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.RespReader.ParseRequest()
+		done <- err
+	}()
+	s.Kill()
+	select {
+	case err := <-done:
+		if err == nil || !s.Killed() {
+			t.Fatalf("killed session should stop reading, err:%v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("kill should wake up an idle session")
+	}
+	if s.IsClosed() {
+		t.Fatal("kill should leave closing the session to its owner")
+	}
+}
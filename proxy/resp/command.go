@@ -16,6 +16,7 @@ package resp
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -178,6 +179,11 @@ const (
 	GEOHASH           string = "GEOHASH"
 	GEORADIUS         string = "GEORADIUS"
 	GEORADIUSBYMEMBER string = "GEORADIUSBYMEMBER"
+
+	CLIENT  string = "CLIENT"
+	MONITOR string = "MONITOR"
+	LATENCY string = "LATENCY"
+	SLOWLOG string = "SLOWLOG"
 )
 
 type CommandFunc func(c *Session) error
@@ -188,10 +194,27 @@ type Cmd struct {
 }
 
 var regCmds = map[string]CommandFunc{}
+var regCmdNames = map[string]*string{}
 
 func Register(name string, f CommandFunc) {
 	if _, ok := regCmds[strings.ToLower(name)]; ok {
 		panic(fmt.Sprintf("%s has been registered", name))
 	}
 	regCmds[name] = f
+	lowerName := strings.ToLower(name)
+	regCmdNames[name] = &lowerName
+}
+
+func IsRegistered(name string) bool {
+	_, ok := regCmds[name]
+	return ok
+}
+
+func RegisteredCommands() []string {
+	names := make([]string, 0, len(regCmds))
+	for name := range regCmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
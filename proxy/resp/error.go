@@ -34,8 +34,24 @@ var (
 	HashTagErr                = errors.New("ERR hashtag mismatch or missing")
 	TxGroupChangedErr         = errors.New("ERR group changed in tx")
 	TxAbortErr                = errors.New("EXECABORT Transaction discarded because of previous errors.")
+	RateLimitedErr            = errors.New("LIMITED request rate exceeds the limit of proxy")
+	PrefixWriteDeniedErr      = errors.New("ERR write command is denied by key prefix rule")
 )
 
+// PrefixCmdDisabledError is returned for a command disabled on a key prefix.
+type PrefixCmdDisabledError struct {
+	Cmd    string
+	Prefix string
+}
+
+func (e *PrefixCmdDisabledError) Error() string {
+	return fmt.Sprintf("ERR command '%s' is disabled on key prefix '%s'", e.Cmd, e.Prefix)
+}
+
+func PrefixCmdDisabledErr(cmd, prefix string) error {
+	return &PrefixCmdDisabledError{Cmd: cmd, Prefix: prefix}
+}
+
 func CmdParamsErr(cmd string) error {
 	return fmt.Errorf("ERR wrong number of arguments for '%s' command", cmd)
 }
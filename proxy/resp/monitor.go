@@ -0,0 +1,208 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resp
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+)
+
+const (
+	monitorQueueSize  = 4096
+	monitorFlushBatch = 128
+	monitorRedacted   = "(redacted)"
+)
+
+var monitorHub struct {
+	mu       sync.Mutex
+	monitors atomic.Pointer[[]*Monitor]
+}
+
+type MonitorFilter struct {
+	Cmds      map[string]struct{}
+	KeyPrefix []byte
+	Addr      string
+}
+
+func (f *MonitorFilter) match(s *Session) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Cmds) > 0 {
+		if _, ok := f.Cmds[s.Cmd]; !ok {
+			return false
+		}
+	}
+	if len(f.KeyPrefix) > 0 && (len(s.Args) == 0 || !bytes.HasPrefix(s.Args[0], f.KeyPrefix)) {
+		return false
+	}
+	if len(f.Addr) > 0 && f.Addr != s.remoteIP && f.Addr != s.RemoteAddr() {
+		return false
+	}
+	return true
+}
+
+type Monitor struct {
+	filter  *MonitorFilter
+	events  chan []byte
+	dropped atomic.Int64
+}
+
+func AddMonitor(filter *MonitorFilter) *Monitor {
+	m := &Monitor{
+		filter: filter,
+		events: make(chan []byte, monitorQueueSize),
+	}
+
+	monitorHub.mu.Lock()
+	defer monitorHub.mu.Unlock()
+	var monitors []*Monitor
+	if p := monitorHub.monitors.Load(); p != nil {
+		monitors = append(monitors, *p...)
+	}
+	monitors = append(monitors, m)
+	monitorHub.monitors.Store(&monitors)
+	return m
+}
+
+func (m *Monitor) Close() {
+	monitorHub.mu.Lock()
+	defer monitorHub.mu.Unlock()
+	p := monitorHub.monitors.Load()
+	if p == nil {
+		return
+	}
+	monitors := make([]*Monitor, 0, len(*p))
+	for _, other := range *p {
+		if other != m {
+			monitors = append(monitors, other)
+		}
+	}
+	if len(monitors) == 0 {
+		monitorHub.monitors.Store(nil)
+	} else {
+		monitorHub.monitors.Store(&monitors)
+	}
+}
+
+func (m *Monitor) Dropped() int64 {
+	return m.dropped.Load()
+}
+
+func MonitorNum() int {
+	if p := monitorHub.monitors.Load(); p != nil {
+		return len(*p)
+	}
+	return 0
+}
+
+// feedMonitors never blocks the caller, events are dropped when a monitor falls behind.
+func (s *Session) feedMonitors(startUnixNano int64) {
+	p := monitorHub.monitors.Load()
+	if p == nil {
+		return
+	}
+
+	var event []byte
+	for _, m := range *p {
+		if !m.filter.match(s) {
+			continue
+		}
+		if event == nil {
+			event = s.formatMonitorEvent(startUnixNano)
+		}
+		select {
+		case m.events <- event:
+		default:
+			m.dropped.Add(1)
+		}
+	}
+}
+
+func (s *Session) formatMonitorEvent(startUnixNano int64) []byte {
+	size := 64 + len(s.Cmd)
+	for _, arg := range s.Args {
+		size += len(arg) + 3
+	}
+	buf := make([]byte, 0, size)
+	buf = strconv.AppendInt(buf, startUnixNano/int64(time.Second), 10)
+	buf = append(buf, '.')
+	usec := strconv.AppendInt(make([]byte, 0, 6), (startUnixNano%int64(time.Second))/int64(time.Microsecond), 10)
+	for i := len(usec); i < 6; i++ {
+		buf = append(buf, '0')
+	}
+	buf = append(buf, usec...)
+	buf = append(buf, " [0 "...)
+	buf = append(buf, s.RemoteAddr()...)
+	buf = append(buf, "] "...)
+	buf = strconv.AppendQuote(buf, s.Cmd)
+	// the arguments of AUTH are credentials, redact them like redis does
+	redact := s.Cmd == AUTH
+	for _, arg := range s.Args {
+		buf = append(buf, ' ')
+		if redact {
+			buf = strconv.AppendQuote(buf, monitorRedacted)
+		} else {
+			buf = strconv.AppendQuote(buf, string(arg))
+		}
+	}
+	return buf
+}
+
+// ServeMonitor streams monitor events to the client until it disconnects or sends QUIT or RESET,
+// then closes the session.
+func (s *Session) ServeMonitor(m *Monitor) {
+	s.conn.SetReadDeadline(time.Time{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			req, err := s.RespReader.ParseRequest()
+			if err != nil {
+				return
+			}
+			if len(req) > 0 {
+				switch string(UpperSlice(req[0])) {
+				case "QUIT", "RESET":
+					return
+				}
+			}
+		}
+	}()
+
+	for running := true; running; {
+		select {
+		case event := <-m.events:
+			s.RespWriter.WriteStatus(unsafe2.String(event))
+			for i := 0; i < monitorFlushBatch && len(m.events) > 0; i++ {
+				s.RespWriter.WriteStatus(unsafe2.String(<-m.events))
+			}
+			if err := s.RespWriter.buff.Flush(); err != nil {
+				running = false
+			}
+		case <-done:
+			running = false
+		}
+	}
+
+	s.Close()
+	<-done
+}
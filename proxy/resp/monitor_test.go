@@ -0,0 +1,81 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resp
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitorFeed(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	s := NewSession(c1, 1024, 1024, false)
+	defer s.Close()
+
+	all := AddMonitor(nil)
+	defer all.Close()
+	filtered := AddMonitor(&MonitorFilter{
+		Cmds:      map[string]struct{}{SET: {}},
+		KeyPrefix: []byte("user:"),
+	})
+	defer filtered.Close()
+	if n := MonitorNum(); n != 2 {
+		t.Fatalf("monitor num:%d", n)
+	}
+
+	start := time.Now().UnixNano()
+	s.Cmd = GET
+	s.Args = [][]byte{[]byte("user:1")}
+	s.feedMonitors(start)
+	s.Cmd = SET
+	s.Args = [][]byte{[]byte("order:1"), []byte("v")}
+	s.feedMonitors(start)
+	s.Args = [][]byte{[]byte("user:1"), []byte("v\n")}
+	s.feedMonitors(start)
+
+	if n := len(all.events); n != 3 {
+		t.Fatalf("all monitor events:%d", n)
+	}
+	if n := len(filtered.events); n != 1 {
+		t.Fatalf("filtered monitor events:%d", n)
+	}
+	event := string(<-filtered.events)
+	if !strings.HasSuffix(event, `"SET" "user:1" "v\n"`) || strings.Contains(event, "\n") {
+		t.Fatalf("bad monitor event %q", event)
+	}
+
+	filtered.Close()
+	all.Close()
+	if n := MonitorNum(); n != 0 {
+		t.Fatalf("monitor num after close:%d", n)
+	}
+}
+
+func TestMonitorRedactAuth(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	s := NewSession(c1, 1024, 1024, false)
+	defer s.Close()
+
+	s.Cmd = AUTH
+	s.Args = [][]byte{[]byte("user"), []byte("secret")}
+	event := string(s.formatMonitorEvent(time.Now().UnixNano()))
+	if !strings.HasSuffix(event, `"AUTH" "(redacted)" "(redacted)"`) || strings.Contains(event, "secret") {
+		t.Fatalf("bad monitor event %q", event)
+	}
+}
@@ -155,6 +155,10 @@ func (resp *RespReader) ParseBulkTo(w io.Writer) error {
 	}
 }
 
+func (resp *RespReader) Buffered() int {
+	return resp.br.Buffered()
+}
+
 func readLine(br *bufio.Reader) ([]byte, error) {
 	p, err := br.ReadSlice('\n')
 	if err == bufio.ErrBufferFull {
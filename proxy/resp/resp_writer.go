@@ -143,3 +143,7 @@ func (w *RespWriter) WriteBulkFrom(n int64, rb io.Reader) {
 func (w *RespWriter) Flush() {
 	w.buff.Flush()
 }
+
+func (w *RespWriter) Buffered() int {
+	return w.buff.Buffered()
+}
@@ -15,12 +15,14 @@
 package resp
 
 import (
+	"errors"
 	"net"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/zuoyebang/bitalostored/butils/math2"
+	"github.com/zuoyebang/bitalostored/butils/tracing"
 	"github.com/zuoyebang/bitalostored/proxy/internal/anticc"
 	"github.com/zuoyebang/bitalostored/proxy/internal/dostats"
 	"github.com/zuoyebang/bitalostored/proxy/internal/log"
@@ -45,26 +47,97 @@ const (
 	TxCommandNumLimit = 100
 )
 
+const (
+	AuthUserDefault = "default"
+	AuthUserAdmin   = "admin"
+)
+
+type CmdHookFunc func(s *Session) error
+
+// CmdKeysFunc returns the keys of cmd, args excludes the command name.
+type CmdKeysFunc func(cmd string, args [][]byte) [][]byte
+
+var (
+	cmdLimiter  atomic.Pointer[CmdHookFunc]
+	cmdRewriter atomic.Pointer[CmdHookFunc]
+	cmdKeys     atomic.Pointer[CmdKeysFunc]
+)
+
+func setCmdHook(hook *atomic.Pointer[CmdHookFunc], f CmdHookFunc) {
+	if f == nil {
+		hook.Store(nil)
+		return
+	}
+	hook.Store(&f)
+}
+
+func SetCmdLimiter(f CmdHookFunc) {
+	setCmdHook(&cmdLimiter, f)
+}
+
+// SetCmdRewriter installs f to check or rewrite s.Cmd and s.Args before the command runs.
+func SetCmdRewriter(f CmdHookFunc) {
+	setCmdHook(&cmdRewriter, f)
+}
+
+// SetCmdKeys installs f to find the key positions of commands, see Session.Keys.
+func SetCmdKeys(f CmdKeysFunc) {
+	if f == nil {
+		cmdKeys.Store(nil)
+		return
+	}
+	cmdKeys.Store(&f)
+}
+
+// Keys returns every key of the current command, it is empty for commands
+// without keys such as PING or INFO.
+func (s *Session) Keys() [][]byte {
+	if f := cmdKeys.Load(); f != nil {
+		return (*f)(s.Cmd, s.Args)
+	}
+	if len(s.Args) > 0 {
+		return s.Args[:1]
+	}
+	return nil
+}
+
+var sessionIdSeq atomic.Int64
+
 type Session struct {
-	conn net.Conn
-	Cmd  string
-	Args [][]byte
+	id         int64
+	conn       net.Conn
+	remoteIP   string
+	createTime time.Time
+	Cmd        string
+	Args       [][]byte
 
 	authEnabled   bool
 	userPassword  string
 	adminPassword string
 	isAuthed      bool
 	isAdmin       bool
+	authUser      string
 
 	isDealingQuery atomic.Bool
-	lastQueryTime  time.Time
+	lastQueryTime  atomic.Int64
+
+	clientName atomic.Pointer[string]
+	lastCmd    atomic.Pointer[string]
+	noEvict    atomic.Bool
+	multiNum   atomic.Int32
+	watching   atomic.Bool
+	qbufSize   atomic.Int32
+	obufSize   atomic.Int32
 
 	RespWriter *RespWriter
 	RespReader *RespReader
 
 	Stats *dostats.CalDoStats
 
+	traceSpan *tracing.Span
+
 	activeQuit bool
+	killed     atomic.Bool
 
 	OpenDistributedTx bool
 	TxState           int
@@ -131,10 +204,14 @@ func NewSession(conn net.Conn, connReaderBufferSize int, connWriteBufferSize int
 	}
 
 	s := &Session{
+		id:                sessionIdSeq.Add(1),
 		conn:              conn,
+		createTime:        time.Now(),
 		Cmd:               "",
 		Args:              nil,
+		remoteIP:          remoteIP(conn),
 		isAuthed:          false,
+		authUser:          AuthUserDefault,
 		RespReader:        NewRespReader(conn, connReaderBufferSize),
 		RespWriter:        NewRespWriter(conn, connWriteBufferSize),
 		Stats:             dostats.NewCalDoStats(),
@@ -144,6 +221,7 @@ func NewSession(conn net.Conn, connReaderBufferSize int, connWriteBufferSize int
 	if openDistributedTx {
 		s.Recorder = &TxRecorder{}
 	}
+	s.multiNum.Store(-1)
 
 	dostats.IncrConns()
 	globalSessionManager.AddSession(s)
@@ -151,12 +229,27 @@ func NewSession(conn net.Conn, connReaderBufferSize int, connWriteBufferSize int
 	return s
 }
 
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+func (s *Session) RemoteIP() string {
+	return s.remoteIP
+}
+
 func (s *Session) SetReadDeadline() {
 	s.conn.SetReadDeadline(anticc.GetConfigDeadline())
 }
 
 func (s *Session) SetLastQueryTime() {
-	s.lastQueryTime = time.Now()
+	s.lastQueryTime.Store(time.Now().UnixNano())
 }
 
 func (s *Session) SetQueryProperty(v bool) {
@@ -169,7 +262,7 @@ func (s *Session) closeSpareConn() bool {
 	if s.isDealingQuery.Load() {
 		return false
 	}
-	if 2*math2.Abs(currTime, currDeadline) < math2.Abs(currTime, s.lastQueryTime.Unix()) {
+	if 2*math2.Abs(currTime, currDeadline) < math2.Abs(currTime, s.lastQueryTime.Load()/int64(time.Second)) {
 		if !s.isDealingQuery.Load() {
 			s.Close()
 			return true
@@ -181,6 +274,7 @@ func (s *Session) closeSpareConn() bool {
 func (s *Session) SetAuth(authEnabled bool, userPassword, adminPassword string) {
 	s.isAuthed = false
 	s.isAdmin = false
+	s.authUser = AuthUserDefault
 	s.authEnabled = authEnabled
 	s.userPassword = userPassword
 	s.adminPassword = adminPassword
@@ -193,11 +287,13 @@ func (s *Session) DoAuth() error {
 	if s.adminPassword == string(s.Args[0]) {
 		s.isAuthed = true
 		s.isAdmin = true
+		s.authUser = AuthUserAdmin
 		return nil
 	}
 	if s.userPassword == string(s.Args[0]) {
 		s.isAuthed = true
 		s.isAdmin = false
+		s.authUser = AuthUserDefault
 		return nil
 	}
 	return AuthenticationFailureErr
@@ -207,6 +303,14 @@ func (s *Session) IsAdmin() bool {
 	return s.isAdmin
 }
 
+func (s *Session) HasAdminPerm() bool {
+	return !s.authEnabled || s.isAdmin
+}
+
+func (s *Session) AuthUser() string {
+	return s.authUser
+}
+
 func (s *Session) ReleaseTxClients() {
 	if !s.OpenDistributedTx {
 		return
@@ -216,6 +320,18 @@ func (s *Session) ReleaseTxClients() {
 	}
 }
 
+// Kill asks the goroutine serving the session to close it. The owner checks
+// Killed before reading the next request, an idle owner blocked in the read
+// is woken up by an expired read deadline.
+func (s *Session) Kill() {
+	s.killed.Store(true)
+	s.conn.SetReadDeadline(time.Now())
+}
+
+func (s *Session) Killed() bool {
+	return s.killed.Load()
+}
+
 func (s *Session) Close() {
 	s.ReleaseTxClients()
 	s.activeQuit = true
@@ -249,7 +365,16 @@ func (s *Session) Perform(startUnixNano int64) error {
 		}
 	} else if s.authEnabled && !s.isAuthed && s.Cmd != AUTH {
 		err = NotAuthenticatedErr
+	} else if exeCmd, err = s.rewriteCmd(exeCmd); err != nil {
+		if s.OpenDistributedTx {
+			s.SetTxCancel(err)
+		}
+	} else if err = s.checkCmdLimit(); err != nil {
+		if s.OpenDistributedTx {
+			s.SetTxCancel(err)
+		}
 	} else {
+		s.feedMonitors(startUnixNano)
 		err = exeCmd(s)
 		if s.OpenDistributedTx {
 			s.SetTxCancel(err)
@@ -266,9 +391,50 @@ func (s *Session) Perform(startUnixNano int64) error {
 		}
 	}
 	s.Stats.IncrOpStats(s.Cmd, startUnixNano)
+	s.updateClientState()
 	return err
 }
 
+func (s *Session) updateClientState() {
+	if name, ok := regCmdNames[s.Cmd]; ok {
+		s.lastCmd.Store(name)
+	}
+	if s.OpenDistributedTx && s.TxCommandQueued {
+		s.multiNum.Store(int32(s.Recorder.CmdNum))
+	} else {
+		s.multiNum.Store(-1)
+	}
+	s.watching.Store(s.TxState&TxStateWatch != 0)
+	s.qbufSize.Store(int32(s.RespReader.Buffered()))
+	s.obufSize.Store(int32(s.RespWriter.Buffered()))
+}
+
+func (s *Session) checkCmdLimit() error {
+	f := cmdLimiter.Load()
+	if f == nil || s.Cmd == AUTH {
+		return nil
+	}
+	return (*f)(s)
+}
+
+func (s *Session) rewriteCmd(exeCmd CommandFunc) (CommandFunc, error) {
+	f := cmdRewriter.Load()
+	if f == nil || len(s.Args) == 0 {
+		return exeCmd, nil
+	}
+	cmd := s.Cmd
+	if err := (*f)(s); err != nil {
+		return nil, err
+	}
+	if s.Cmd == cmd {
+		return exeCmd, nil
+	}
+	if exeCmd, ok := regCmds[s.Cmd]; ok {
+		return exeCmd, nil
+	}
+	return nil, NotFoundErr
+}
+
 func (s *Session) checkTxCommandNum() bool {
 	if !s.TxCommandQueued {
 		return true
@@ -276,7 +442,7 @@ func (s *Session) checkTxCommandNum() bool {
 	switch s.Cmd {
 	case WATCH, UNWATCH, MULTI, EXEC, DISCARD:
 		return true
-	case INFO, "shutdown", PING, PONG, ECHO, AUTH, SHUTDOWN:
+	case INFO, "shutdown", PING, PONG, ECHO, AUTH, SHUTDOWN, CLIENT, LATENCY, SLOWLOG:
 		return true
 	}
 	return s.Recorder.CmdNum < TxCommandNumLimit
@@ -286,7 +452,8 @@ func (s *Session) SetTxCancel(err error) {
 	if err == nil || !s.TxCommandQueued || s.TxState&TxStateCancel != 0 {
 		return
 	}
-	if err == NotFoundErr || strings.Contains(err.Error(), "ERR wrong number of arguments") || err == TxGroupChangedErr {
+	if err == NotFoundErr || strings.Contains(err.Error(), "ERR wrong number of arguments") || err == TxGroupChangedErr ||
+		err == RateLimitedErr || err == PrefixWriteDeniedErr || errors.As(err, new(*PrefixCmdDisabledError)) {
 		s.TxState |= TxStateCancel
 	}
 }
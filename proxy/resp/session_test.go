@@ -18,6 +18,9 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"io"
+	"net"
+	"strings"
 	"testing"
 )
 
@@ -85,3 +88,78 @@ func TestRespWriter(t *testing.T) {
 	}
 
 }
+
+const txTestCmd = "txtestcmd"
+
+func init() {
+	Register(txTestCmd, func(s *Session) error {
+		return s.SendTxQueued(nil)
+	})
+}
+
+// newTxTestSession returns a session inside MULTI whose replies are dropped.
+func newTxTestSession(t *testing.T) *Session {
+	c1, c2 := net.Pipe()
+	go io.Copy(io.Discard, c2)
+	s := NewSession(c1, 1024, 1024, true)
+	s.TxCommandQueued = true
+	t.Cleanup(func() {
+		s.Close()
+		c2.Close()
+	})
+	return s
+}
+
+func performTx(s *Session, args ...string) error {
+	s.Cmd = args[0]
+	s.Args = s.Args[:0]
+	for _, arg := range args[1:] {
+		s.Args = append(s.Args, []byte(arg))
+	}
+	return s.Perform(0)
+}
+
+func TestTxCancelRateLimited(t *testing.T) {
+	SetCmdLimiter(func(s *Session) error {
+		if string(s.Args[0]) == "limited" {
+			return RateLimitedErr
+		}
+		return nil
+	})
+	defer SetCmdLimiter(nil)
+
+	s := newTxTestSession(t)
+	if err := performTx(s, txTestCmd, "k1"); err != nil || s.TxState&TxStateCancel != 0 {
+		t.Fatalf("queued command err:%v state:%x", err, s.TxState)
+	}
+	if err := performTx(s, txTestCmd, "limited"); err != RateLimitedErr {
+		t.Fatalf("limited command err:%v", err)
+	}
+	if s.TxState&TxStateCancel == 0 {
+		t.Fatal("rate limited command does not abort the transaction")
+	}
+}
+
+func TestTxCancelPrefixRule(t *testing.T) {
+	defer SetCmdRewriter(nil)
+
+	for _, ruleErr := range []error{PrefixWriteDeniedErr, PrefixCmdDisabledErr(txTestCmd, "deny:")} {
+		SetCmdRewriter(func(s *Session) error {
+			if strings.HasPrefix(string(s.Args[0]), "deny:") {
+				return ruleErr
+			}
+			return nil
+		})
+
+		s := newTxTestSession(t)
+		if err := performTx(s, txTestCmd, "k1"); err != nil || s.TxState&TxStateCancel != 0 {
+			t.Fatalf("queued command err:%v state:%x", err, s.TxState)
+		}
+		if err := performTx(s, txTestCmd, "deny:1"); err == nil || err.Error() != ruleErr.Error() {
+			t.Fatalf("denied command err:%v, want %v", err, ruleErr)
+		}
+		if s.TxState&TxStateCancel == 0 {
+			t.Fatalf("%v does not abort the transaction", ruleErr)
+		}
+	}
+}
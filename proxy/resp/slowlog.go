@@ -0,0 +1,142 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resp
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSlowLogMaxLen = 128
+
+	slowLogMaxArgc   = 32
+	slowLogMaxArgLen = 128
+)
+
+type SlowLogEntry struct {
+	Id         int64    `json:"id"`
+	Time       int64    `json:"time"`
+	DurationUs int64    `json:"duration_us"`
+	Args       []string `json:"args"`
+	Addr       string   `json:"addr"`
+	Name       string   `json:"name"`
+}
+
+var slowLog = struct {
+	mu      sync.Mutex
+	nextId  int64
+	head    int
+	size    int
+	entries []*SlowLogEntry
+}{
+	entries: make([]*SlowLogEntry, DefaultSlowLogMaxLen),
+}
+
+// SetSlowLogMaxLen resizes the slow log ring, the newest entries are kept.
+func SetSlowLogMaxLen(maxLen int) {
+	if maxLen <= 0 {
+		maxLen = DefaultSlowLogMaxLen
+	}
+
+	slowLog.mu.Lock()
+	defer slowLog.mu.Unlock()
+	kept := getSlowLogLocked(maxLen)
+	slowLog.entries = make([]*SlowLogEntry, maxLen)
+	slowLog.size = len(kept)
+	for i := range kept {
+		slowLog.entries[len(kept)-1-i] = kept[i]
+	}
+	slowLog.head = slowLog.size % maxLen
+}
+
+// AddSlowLog records the current command of the session into the slow log ring.
+func (s *Session) AddSlowLog(startTime time.Time, duration time.Duration) {
+	e := &SlowLogEntry{
+		Time:       startTime.Unix(),
+		DurationUs: duration.Microseconds(),
+		Args:       slowLogArgs(s.Cmd, s.Args),
+		Addr:       s.RemoteAddr(),
+		Name:       s.ClientName(),
+	}
+
+	slowLog.mu.Lock()
+	e.Id = slowLog.nextId
+	slowLog.nextId++
+	slowLog.entries[slowLog.head] = e
+	slowLog.head = (slowLog.head + 1) % len(slowLog.entries)
+	if slowLog.size < len(slowLog.entries) {
+		slowLog.size++
+	}
+	slowLog.mu.Unlock()
+}
+
+// GetSlowLog returns at most n entries, newest first. A negative n returns all entries.
+func GetSlowLog(n int) []*SlowLogEntry {
+	slowLog.mu.Lock()
+	defer slowLog.mu.Unlock()
+	return getSlowLogLocked(n)
+}
+
+func getSlowLogLocked(n int) []*SlowLogEntry {
+	if n < 0 || n > slowLog.size {
+		n = slowLog.size
+	}
+	entries := make([]*SlowLogEntry, 0, n)
+	pos := slowLog.head
+	for i := 0; i < n; i++ {
+		pos = (pos - 1 + len(slowLog.entries)) % len(slowLog.entries)
+		entries = append(entries, slowLog.entries[pos])
+	}
+	return entries
+}
+
+func SlowLogLen() int {
+	slowLog.mu.Lock()
+	defer slowLog.mu.Unlock()
+	return slowLog.size
+}
+
+func ResetSlowLog() {
+	slowLog.mu.Lock()
+	defer slowLog.mu.Unlock()
+	for i := range slowLog.entries {
+		slowLog.entries[i] = nil
+	}
+	slowLog.head = 0
+	slowLog.size = 0
+}
+
+func slowLogArgs(cmd string, args [][]byte) []string {
+	argc := len(args) + 1
+	if argc > slowLogMaxArgc {
+		argc = slowLogMaxArgc
+	}
+	res := make([]string, 0, argc)
+	res = append(res, cmd)
+	for i, arg := range args {
+		if len(res) == slowLogMaxArgc-1 && i < len(args)-1 {
+			res = append(res, "... ("+strconv.Itoa(len(args)-i)+" more arguments)")
+			break
+		}
+		if len(arg) > slowLogMaxArgLen {
+			res = append(res, string(arg[:slowLogMaxArgLen])+"... ("+strconv.Itoa(len(arg)-slowLogMaxArgLen)+" more bytes)")
+		} else {
+			res = append(res, string(arg))
+		}
+	}
+	return res
+}
@@ -0,0 +1,77 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resp
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowLogRing(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	s := NewSession(c1, 1024, 1024, false)
+	defer s.Close()
+	s.SetClientName("worker")
+	defer SetSlowLogMaxLen(DefaultSlowLogMaxLen)
+
+	SetSlowLogMaxLen(3)
+	ResetSlowLog()
+	s.Cmd = SET
+	for i := 0; i < 5; i++ {
+		s.Args = [][]byte{[]byte("k"), []byte(strings.Repeat("v", i))}
+		s.AddSlowLog(time.Now(), time.Duration(i)*time.Millisecond)
+	}
+	if n := SlowLogLen(); n != 3 {
+		t.Fatalf("slowlog len:%d", n)
+	}
+	entries := GetSlowLog(-1)
+	if len(entries) != 3 || entries[0].DurationUs != 4000 || entries[2].DurationUs != 2000 {
+		t.Fatalf("slowlog entries:%+v", entries)
+	}
+	if entries[0].Id <= entries[1].Id || entries[0].Name != "worker" || entries[0].Args[0] != SET {
+		t.Fatalf("slowlog entry:%+v", entries[0])
+	}
+
+	SetSlowLogMaxLen(2)
+	if entries = GetSlowLog(10); len(entries) != 2 || entries[0].DurationUs != 4000 {
+		t.Fatalf("slowlog resized entries:%+v", entries)
+	}
+
+	ResetSlowLog()
+	if n := SlowLogLen(); n != 0 {
+		t.Fatalf("slowlog len after reset:%d", n)
+	}
+}
+
+func TestSlowLogArgsTruncate(t *testing.T) {
+	args := make([][]byte, 40)
+	for i := range args {
+		args[i] = []byte("a")
+	}
+	args[0] = []byte(strings.Repeat("x", slowLogMaxArgLen+10))
+	res := slowLogArgs(MSET, args)
+	if len(res) != slowLogMaxArgc {
+		t.Fatalf("truncated argc:%d", len(res))
+	}
+	if res[len(res)-1] != "... (10 more arguments)" {
+		t.Fatalf("truncated last arg:%s", res[len(res)-1])
+	}
+	if !strings.HasSuffix(res[1], "... (10 more bytes)") {
+		t.Fatalf("truncated arg:%s", res[1])
+	}
+}
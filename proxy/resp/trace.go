@@ -0,0 +1,63 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resp
+
+import (
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils/tracing"
+)
+
+const traceKeyMaxLen = 128
+
+// StartTraceSpan opens the server span of the current command, parent is the
+// context sent by the client with the TRACE prefix, if any.
+func (s *Session) StartTraceSpan(parent tracing.SpanContext, startUnixNano int64) {
+	span := tracing.StartAt(s.Cmd, tracing.SpanKindServer, parent, time.Unix(0, startUnixNano))
+	if span != nil {
+		span.SetAttr("db.system", "bitalos")
+		span.SetAttr("db.operation", s.Cmd)
+		if len(s.Args) > 0 {
+			key := s.Args[0]
+			if len(key) > traceKeyMaxLen {
+				key = key[:traceKeyMaxLen]
+			}
+			span.SetAttr("db.key", string(key))
+		}
+		span.SetAttr("net.peer.name", s.RemoteAddr())
+		if name := s.ClientName(); len(name) > 0 {
+			span.SetAttr("db.client.name", name)
+		}
+	}
+	s.traceSpan = span
+}
+
+func (s *Session) EndTraceSpan(err error) {
+	if s.traceSpan == nil {
+		return
+	}
+	s.traceSpan.SetError(err)
+	s.traceSpan.End()
+	s.traceSpan = nil
+}
+
+// TraceSpan returns the span of the command being performed, nil when the
+// command is not sampled.
+func (s *Session) TraceSpan() *tracing.Span {
+	if s == nil {
+		return nil
+	}
+	return s.traceSpan
+}
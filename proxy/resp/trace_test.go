@@ -0,0 +1,50 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils/tracing"
+)
+
+func TestSessionTraceSpan(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	s := NewSession(c1, 1024, 1024, false)
+	defer s.Close()
+
+	s.Cmd = GET
+	s.Args = [][]byte{[]byte("k")}
+	s.StartTraceSpan(tracing.SpanContext{}, time.Now().UnixNano())
+	if s.TraceSpan() != nil {
+		t.Fatal("span without tracer")
+	}
+
+	tracing.SetDefault(tracing.NewTracer(tracing.Config{SampleRatio: 1}))
+	defer tracing.SetDefault(nil)
+	parent, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	s.StartTraceSpan(parent, time.Now().UnixNano())
+	span := s.TraceSpan()
+	if span == nil || span.Name() != GET || span.Context().TraceID != parent.TraceID {
+		t.Fatalf("session span:%+v", span)
+	}
+	s.EndTraceSpan(nil)
+	if s.TraceSpan() != nil {
+		t.Fatal("span not cleared")
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respcmd
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+)
+
+var (
+	errClientNoSuchClient = errors.New("ERR No such client")
+	errInvalidClientId    = errors.New("ERR Invalid client ID")
+	errClientNameSpaces   = errors.New("ERR Client names cannot contain spaces, newlines or special characters.")
+	errClientTimeout      = errors.New("ERR timeout is not an integer or out of range")
+	errNoAdminPerm        = errors.New("NOPERM this command requires admin authentication")
+)
+
+func init() {
+	resp.Register(resp.CLIENT, ClientCommand)
+}
+
+func ClientCommand(s *resp.Session) error {
+	if len(s.Args) == 0 {
+		return resp.CmdParamsErr(resp.CLIENT)
+	}
+
+	args := s.Args[1:]
+	switch strings.ToUpper(unsafe2.String(s.Args[0])) {
+	case "ID":
+		if len(args) != 0 {
+			return resp.CmdParamsErr("client|id")
+		}
+		s.RespWriter.WriteInteger(s.ID())
+	case "GETNAME":
+		if len(args) != 0 {
+			return resp.CmdParamsErr("client|getname")
+		}
+		if name := s.ClientName(); len(name) > 0 {
+			s.RespWriter.WriteBulk([]byte(name))
+		} else {
+			s.RespWriter.WriteBulk(nil)
+		}
+	case "SETNAME":
+		if len(args) != 1 {
+			return resp.CmdParamsErr("client|setname")
+		}
+		for _, c := range args[0] {
+			if c <= ' ' || c > '~' {
+				return errClientNameSpaces
+			}
+		}
+		s.SetClientName(string(args[0]))
+		s.RespWriter.WriteStatus(resp.ReplyOK)
+	case "INFO":
+		if len(args) != 0 {
+			return resp.CmdParamsErr("client|info")
+		}
+		s.RespWriter.WriteBulk([]byte(s.ClientInfo().String() + "\n"))
+	case "LIST":
+		return clientList(s, args)
+	case "KILL":
+		return clientKill(s, args)
+	case "PAUSE":
+		return clientPause(s, args)
+	case "UNPAUSE":
+		if len(args) != 0 {
+			return resp.CmdParamsErr("client|unpause")
+		}
+		if !s.HasAdminPerm() {
+			return errNoAdminPerm
+		}
+		resp.UnpauseClients()
+		s.RespWriter.WriteStatus(resp.ReplyOK)
+	case "NO-EVICT":
+		if len(args) != 1 {
+			return resp.CmdParamsErr("client|no-evict")
+		}
+		switch strings.ToUpper(unsafe2.String(args[0])) {
+		case "ON":
+			s.SetNoEvict(true)
+		case "OFF":
+			s.SetNoEvict(false)
+		default:
+			return resp.SyntaxErr
+		}
+		s.RespWriter.WriteStatus(resp.ReplyOK)
+	default:
+		return resp.SyntaxErr
+	}
+	return nil
+}
+
+func clientList(s *resp.Session, args [][]byte) error {
+	var ids map[int64]struct{}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(unsafe2.String(args[i])) {
+		case "TYPE":
+			if i+1 >= len(args) {
+				return resp.SyntaxErr
+			}
+			i++
+			if t := strings.ToLower(unsafe2.String(args[i])); t != "normal" {
+				s.RespWriter.WriteBulk([]byte{})
+				return nil
+			}
+		case "ID":
+			if i+1 >= len(args) {
+				return resp.SyntaxErr
+			}
+			ids = make(map[int64]struct{}, len(args)-i-1)
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseInt(unsafe2.String(args[i]), 10, 64)
+				if err != nil || id <= 0 {
+					return errInvalidClientId
+				}
+				ids[id] = struct{}{}
+			}
+		default:
+			return resp.SyntaxErr
+		}
+	}
+
+	buf := make([]byte, 0, 4096)
+	for _, cs := range resp.ClientSessions() {
+		if ids != nil {
+			if _, ok := ids[cs.ID()]; !ok {
+				continue
+			}
+		}
+		buf = append(buf, cs.ClientInfo().String()...)
+		buf = append(buf, '\n')
+	}
+	s.RespWriter.WriteBulk(buf)
+	return nil
+}
+
+type clientKillFilter struct {
+	id     int64
+	addr   string
+	laddr  string
+	user   string
+	skipMe bool
+}
+
+func (f *clientKillFilter) match(s, self *resp.Session) bool {
+	if f.skipMe && s == self {
+		return false
+	}
+	if f.id > 0 && s.ID() != f.id {
+		return false
+	}
+	if len(f.addr) > 0 && s.RemoteAddr() != f.addr {
+		return false
+	}
+	if len(f.laddr) > 0 && s.LocalAddr() != f.laddr {
+		return false
+	}
+	if len(f.user) > 0 && s.AuthUser() != f.user {
+		return false
+	}
+	return true
+}
+
+func clientKill(s *resp.Session, args [][]byte) error {
+	if len(args) == 0 {
+		return resp.CmdParamsErr("client|kill")
+	}
+	if !s.HasAdminPerm() {
+		return errNoAdminPerm
+	}
+
+	filter := &clientKillFilter{skipMe: true}
+	oldStyle := len(args) == 1
+	if oldStyle {
+		filter.addr = string(args[0])
+		filter.skipMe = false
+	} else {
+		if len(args)%2 != 0 {
+			return resp.SyntaxErr
+		}
+		for i := 0; i < len(args); i += 2 {
+			value := unsafe2.String(args[i+1])
+			switch strings.ToUpper(unsafe2.String(args[i])) {
+			case "ID":
+				id, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || id <= 0 {
+					return errInvalidClientId
+				}
+				filter.id = id
+			case "ADDR":
+				filter.addr = string(args[i+1])
+			case "LADDR":
+				filter.laddr = string(args[i+1])
+			case "USER":
+				filter.user = string(args[i+1])
+			case "SKIPME":
+				switch strings.ToLower(value) {
+				case "yes":
+					filter.skipMe = true
+				case "no":
+					filter.skipMe = false
+				default:
+					return resp.SyntaxErr
+				}
+			case "TYPE":
+				if strings.ToLower(value) != "normal" {
+					s.RespWriter.WriteInteger(0)
+					return nil
+				}
+			default:
+				return resp.SyntaxErr
+			}
+		}
+	}
+
+	var killed int64
+	for _, cs := range resp.ClientSessions() {
+		if !filter.match(cs, s) {
+			continue
+		}
+		killed++
+		cs.Kill()
+	}
+
+	if oldStyle {
+		if killed == 0 {
+			return errClientNoSuchClient
+		}
+		s.RespWriter.WriteStatus(resp.ReplyOK)
+	} else {
+		s.RespWriter.WriteInteger(killed)
+	}
+	return nil
+}
+
+// clientPause blocks the commands of every client until the timeout, like
+// redis. Stored rejects them with TRYAGAIN instead, as a blocked command there
+// would block all connections of its event loop.
+func clientPause(s *resp.Session, args [][]byte) error {
+	if len(args) != 1 && len(args) != 2 {
+		return resp.CmdParamsErr("client|pause")
+	}
+	if !s.HasAdminPerm() {
+		return errNoAdminPerm
+	}
+
+	timeout, err := strconv.ParseInt(unsafe2.String(args[0]), 10, 64)
+	if err != nil || timeout < 0 {
+		return errClientTimeout
+	}
+	mode := resp.ClientPauseAll
+	if len(args) == 2 {
+		switch strings.ToUpper(unsafe2.String(args[1])) {
+		case "WRITE":
+			mode = resp.ClientPauseWrite
+		case "ALL":
+		default:
+			return resp.SyntaxErr
+		}
+	}
+
+	resp.PauseClients(mode, time.Duration(timeout)*time.Millisecond)
+	s.RespWriter.WriteStatus(resp.ReplyOK)
+	return nil
+}
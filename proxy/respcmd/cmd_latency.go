@@ -0,0 +1,98 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respcmd
+
+import (
+	"strings"
+
+	"github.com/zuoyebang/bitalostored/butils/histogram"
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/proxy/internal/dostats"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+)
+
+func init() {
+	resp.Register(resp.LATENCY, LatencyCommand)
+}
+
+var latencyHelp = []string{
+	"LATENCY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"HISTOGRAM [COMMAND ...]",
+	"    Return a cumulative distribution of latencies in the format of a histogram for the specified command names.",
+	"    If no commands are specified then all histograms are replied.",
+	"RESET",
+	"    Reset the latency histograms of all commands and backend groups.",
+	"HELP",
+	"    Print this help.",
+}
+
+// LatencyCommand serves the latency histograms recorded by the proxy.
+// Usage: LATENCY HISTOGRAM [command ...] | RESET | HELP
+func LatencyCommand(s *resp.Session) error {
+	if len(s.Args) == 0 {
+		return resp.CmdParamsErr(resp.LATENCY)
+	}
+
+	switch strings.ToUpper(unsafe2.String(s.Args[0])) {
+	case "HISTOGRAM":
+		s.RespWriter.WriteArray(latencyHistogramReply(s.Args[1:]))
+	case "RESET":
+		if !s.HasAdminPerm() {
+			return errNoAdminPerm
+		}
+		dostats.ResetLatencyStats()
+		s.RespWriter.WriteStatus(resp.ReplyOK)
+	case "HELP":
+		reply := make([]interface{}, len(latencyHelp))
+		for i := range latencyHelp {
+			reply[i] = latencyHelp[i]
+		}
+		s.RespWriter.WriteArray(reply)
+	default:
+		return resp.CmdParamsErr(resp.LATENCY)
+	}
+	return nil
+}
+
+func latencyHistogramReply(args [][]byte) []interface{} {
+	var filter map[string]bool
+	if len(args) > 0 {
+		filter = make(map[string]bool, len(args))
+		for _, arg := range args {
+			filter[strings.ToUpper(string(arg))] = true
+		}
+	}
+
+	reply := make([]interface{}, 0, 16)
+	dostats.RangeCmdHistograms(func(cmd string, h *histogram.Histogram) {
+		if filter != nil && !filter[strings.ToUpper(cmd)] {
+			return
+		}
+		reply = append(reply, []byte(strings.ToLower(cmd)), histogramReply(h))
+	})
+	return reply
+}
+
+func histogramReply(h *histogram.Histogram) []interface{} {
+	bounds, cumulative := h.PowerOfTwoBuckets()
+	buckets := make([]interface{}, 0, 2*len(bounds))
+	for i := range bounds {
+		buckets = append(buckets, bounds[i], cumulative[i])
+	}
+	return []interface{}{
+		[]byte("calls"), h.Count(),
+		[]byte("histogram_usec"), buckets,
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respcmd
+
+import (
+	"strings"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+)
+
+func init() {
+	resp.Register(resp.MONITOR, MonitorCommand)
+}
+
+// MonitorCommand streams the commands served by this proxy.
+// Usage: MONITOR [CMD name[,name...]] [PREFIX keyprefix] [ADDR ip|ip:port]
+func MonitorCommand(s *resp.Session) error {
+	if !s.HasAdminPerm() {
+		return errNoAdminPerm
+	}
+	filter, err := parseMonitorFilter(s.Args)
+	if err != nil {
+		return err
+	}
+
+	m := resp.AddMonitor(filter)
+	defer m.Close()
+
+	s.RespWriter.WriteStatus(resp.ReplyOK)
+	s.RespWriter.Flush()
+	s.ServeMonitor(m)
+	return nil
+}
+
+func parseMonitorFilter(args [][]byte) (*resp.MonitorFilter, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if len(args)%2 != 0 {
+		return nil, resp.SyntaxErr
+	}
+
+	filter := &resp.MonitorFilter{}
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToUpper(unsafe2.String(args[i])) {
+		case "CMD":
+			filter.Cmds = make(map[string]struct{}, 4)
+			for _, cmd := range strings.Split(value, ",") {
+				if cmd = strings.TrimSpace(cmd); len(cmd) > 0 {
+					filter.Cmds[strings.ToUpper(cmd)] = struct{}{}
+				}
+			}
+		case "PREFIX":
+			filter.KeyPrefix = []byte(value)
+		case "ADDR":
+			filter.Addr = value
+		default:
+			return nil, resp.SyntaxErr
+		}
+	}
+	return filter, nil
+}
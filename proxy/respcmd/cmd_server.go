@@ -15,14 +15,22 @@
 package respcmd
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"syscall"
 
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
 	"github.com/zuoyebang/bitalostored/proxy/resp"
 )
 
+var (
+	errInvalidCommand     = errors.New("ERR Invalid command specified")
+	errInvalidCommandArgs = errors.New("ERR Invalid number of arguments specified for command")
+	errCommandNoKeys      = errors.New("ERR The command has no key arguments")
+)
+
 func init() {
-	resp.Register(resp.INFO, InfoCommand)
 	resp.Register(resp.COMMAND, CommandCommand)
 	resp.Register(resp.PING, PingCommand)
 	resp.Register(resp.ECHO, EchoCommand)
@@ -30,12 +38,6 @@ func init() {
 	resp.Register(resp.AUTH, AuthCommand)
 }
 
-func InfoCommand(s *resp.Session) error {
-	status := "status: true"
-	s.RespWriter.WriteStatus(status)
-	return nil
-}
-
 func PingCommand(s *resp.Session) error {
 	if len(s.Args) > 1 {
 		return resp.CmdParamsErr(resp.PING)
@@ -58,7 +60,72 @@ func EchoCommand(s *resp.Session) error {
 }
 
 func CommandCommand(s *resp.Session) error {
-	s.RespWriter.WriteStatus(resp.ReplyOK)
+	if len(s.Args) == 0 {
+		names := resp.RegisteredCommands()
+		infos := make([]interface{}, 0, len(names))
+		for _, name := range names {
+			infos = append(infos, commandInfo(name))
+		}
+		s.RespWriter.WriteArray(infos)
+		return nil
+	}
+
+	switch strings.ToUpper(unsafe2.String(s.Args[0])) {
+	case "COUNT":
+		if len(s.Args) != 1 {
+			return resp.CmdParamsErr("command|count")
+		}
+		s.RespWriter.WriteInteger(int64(len(resp.RegisteredCommands())))
+	case "LIST":
+		if len(s.Args) != 1 {
+			return resp.CmdParamsErr("command|list")
+		}
+		names := resp.RegisteredCommands()
+		list := make([][]byte, 0, len(names))
+		for _, name := range names {
+			list = append(list, []byte(strings.ToLower(name)))
+		}
+		s.RespWriter.WriteSliceArray(list)
+	case "INFO":
+		names := s.Args[1:]
+		if len(names) == 0 {
+			for _, name := range resp.RegisteredCommands() {
+				names = append(names, []byte(name))
+			}
+		}
+		infos := make([]interface{}, 0, len(names))
+		for _, name := range names {
+			upper := strings.ToUpper(unsafe2.String(name))
+			if resp.IsRegistered(upper) {
+				infos = append(infos, commandInfo(upper))
+			} else {
+				infos = append(infos, nil)
+			}
+		}
+		s.RespWriter.WriteArray(infos)
+	case "GETKEYS":
+		if len(s.Args) < 2 {
+			return resp.CmdParamsErr("command|getkeys")
+		}
+		name := strings.ToUpper(unsafe2.String(s.Args[1]))
+		if !resp.IsRegistered(name) {
+			return errInvalidCommand
+		}
+		spec := getCommandSpec(name)
+		args := s.Args[1:]
+		if !spec.checkArity(len(args)) {
+			return errInvalidCommandArgs
+		}
+		keys := spec.getKeys(args)
+		if len(keys) == 0 {
+			return errCommandNoKeys
+		}
+		s.RespWriter.WriteSliceArray(keys)
+	case "DOCS":
+		s.RespWriter.WriteArray([]interface{}{})
+	default:
+		return resp.SyntaxErr
+	}
 	return nil
 }
 
@@ -45,3 +45,37 @@ func TestServerCommandErrorParams(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, resp.CmdParamsErr("ECHO").Error(), err.Error())
 }
+
+func TestCommandSpecKeys(t *testing.T) {
+	args := [][]byte{[]byte("mset"), []byte("k1"), []byte("v1"), []byte("k2"), []byte("v2")}
+	spec := getCommandSpec(resp.MSET)
+	assert.True(t, spec.checkArity(len(args)))
+	assert.False(t, spec.checkArity(2))
+	assert.Equal(t, [][]byte{[]byte("k1"), []byte("k2")}, spec.getKeys(args))
+
+	spec = getCommandSpec(resp.GET)
+	assert.True(t, spec.checkArity(2))
+	assert.False(t, spec.checkArity(3))
+	assert.Equal(t, [][]byte{[]byte("k1")}, spec.getKeys([][]byte{[]byte("get"), []byte("k1")}))
+
+	spec = getCommandSpec(resp.PING)
+	assert.Equal(t, 0, len(spec.getKeys([][]byte{[]byte("ping")})))
+}
+
+func TestCommandKeys(t *testing.T) {
+	b := func(args ...string) [][]byte {
+		res := make([][]byte, len(args))
+		for i, a := range args {
+			res[i] = []byte(a)
+		}
+		return res
+	}
+	assert.Equal(t, b("k1", "k2"), commandKeys(resp.MSET, b("k1", "v1", "k2", "v2")))
+	assert.Equal(t, b("a", "b", "c"), commandKeys(resp.DEL, b("a", "b", "c")))
+	assert.Equal(t, b("k1"), commandKeys(resp.HSET, b("k1", "f", "v")))
+	assert.Equal(t, b("k1", "k2"), commandKeys(resp.EVAL, b("return 1", "2", "k1", "k2", "a1")))
+	assert.Equal(t, 0, len(commandKeys(resp.EVAL, b("return 1", "3", "k1"))))
+	assert.Equal(t, 0, len(commandKeys(resp.PING, nil)))
+	assert.Equal(t, 0, len(commandKeys(resp.INFO, b("keyspace"))))
+	assert.Equal(t, 0, len(commandKeys(resp.GET, nil)))
+}
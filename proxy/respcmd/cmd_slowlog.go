@@ -0,0 +1,105 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respcmd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+)
+
+const defaultSlowLogGetNum = 10
+
+func init() {
+	resp.Register(resp.SLOWLOG, SlowLogCommand)
+}
+
+var slowLogHelp = []string{
+	"SLOWLOG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"GET [<count>]",
+	"    Return top <count> entries from the slowlog (default: 10, -1 mean all).",
+	"    Entries are made of:",
+	"    id, timestamp, time in microseconds, arguments array, client IP and port,",
+	"    client name",
+	"LEN",
+	"    Return the length of the slowlog.",
+	"RESET",
+	"    Reset the slowlog.",
+	"HELP",
+	"    Print this help.",
+}
+
+// SlowLogCommand serves the in-memory slow log ring of the proxy.
+// Usage: SLOWLOG GET [count] | LEN | RESET | HELP
+func SlowLogCommand(s *resp.Session) error {
+	if len(s.Args) == 0 {
+		return resp.CmdParamsErr(resp.SLOWLOG)
+	}
+
+	switch strings.ToUpper(unsafe2.String(s.Args[0])) {
+	case "GET":
+		if len(s.Args) > 2 {
+			return resp.CmdParamsErr(resp.SLOWLOG)
+		}
+		n := defaultSlowLogGetNum
+		if len(s.Args) == 2 {
+			v, err := strconv.Atoi(unsafe2.String(s.Args[1]))
+			if err != nil || v < -1 {
+				return resp.ValueErr
+			}
+			n = v
+		}
+		entries := resp.GetSlowLog(n)
+		reply := make([]interface{}, 0, len(entries))
+		for _, e := range entries {
+			reply = append(reply, slowLogEntryReply(e))
+		}
+		s.RespWriter.WriteArray(reply)
+	case "LEN":
+		s.RespWriter.WriteInteger(int64(resp.SlowLogLen()))
+	case "RESET":
+		if !s.HasAdminPerm() {
+			return errNoAdminPerm
+		}
+		resp.ResetSlowLog()
+		s.RespWriter.WriteStatus(resp.ReplyOK)
+	case "HELP":
+		reply := make([]interface{}, len(slowLogHelp))
+		for i := range slowLogHelp {
+			reply[i] = slowLogHelp[i]
+		}
+		s.RespWriter.WriteArray(reply)
+	default:
+		return resp.CmdParamsErr(resp.SLOWLOG)
+	}
+	return nil
+}
+
+func slowLogEntryReply(e *resp.SlowLogEntry) []interface{} {
+	args := make([]interface{}, len(e.Args))
+	for i := range e.Args {
+		args[i] = []byte(e.Args[i])
+	}
+	return []interface{}{
+		e.Id,
+		e.Time,
+		e.DurationUs,
+		args,
+		[]byte(e.Addr),
+		[]byte(e.Name),
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respcmd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+	"github.com/zuoyebang/bitalostored/proxy/router"
+)
+
+const (
+	groupConnection  = "connection"
+	groupServer      = "server"
+	groupGeneric     = "generic"
+	groupString      = "string"
+	groupBitmap      = "bitmap"
+	groupHash        = "hash"
+	groupList        = "list"
+	groupSet         = "set"
+	groupSortedSet   = "sortedset"
+	groupGeo         = "geo"
+	groupScripting   = "scripting"
+	groupTransaction = "transaction"
+)
+
+const (
+	flagFast        = "fast"
+	flagAdmin       = "admin"
+	flagNoScript    = "noscript"
+	flagLoading     = "loading"
+	flagStale       = "stale"
+	flagDenyOOM     = "denyoom"
+	flagMovableKeys = "movablekeys"
+)
+
+type commandSpec struct {
+	arity    int64
+	firstKey int64
+	lastKey  int64
+	keyStep  int64
+	group    string
+	flags    []string
+}
+
+func noKeySpec(arity int64, group string, flags ...string) *commandSpec {
+	return &commandSpec{arity: arity, group: group, flags: flags}
+}
+
+func oneKeySpec(arity int64, group string, flags ...string) *commandSpec {
+	return &commandSpec{arity: arity, firstKey: 1, lastKey: 1, keyStep: 1, group: group, flags: flags}
+}
+
+func allKeysSpec(arity int64, keyStep int64, group string, flags ...string) *commandSpec {
+	return &commandSpec{arity: arity, firstKey: 1, lastKey: -1, keyStep: keyStep, group: group, flags: flags}
+}
+
+func init() {
+	resp.SetCmdKeys(commandKeys)
+}
+
+var commandSpecs = map[string]*commandSpec{
+	resp.PING:     noKeySpec(-1, groupConnection, flagFast, flagStale),
+	resp.ECHO:     noKeySpec(2, groupConnection, flagFast),
+	resp.AUTH:     noKeySpec(2, groupConnection, flagFast, flagNoScript, flagLoading, flagStale),
+	resp.SELECT:   noKeySpec(2, groupConnection, flagFast, flagLoading, flagStale),
+	resp.INFO:     noKeySpec(-1, groupServer, flagLoading, flagStale),
+	resp.COMMAND:  noKeySpec(-1, groupServer, flagLoading, flagStale),
+	resp.SHUTDOWN: noKeySpec(-1, groupServer, flagAdmin, flagNoScript, flagLoading, flagStale),
+	resp.CLIENT:   noKeySpec(-2, groupConnection, flagNoScript, flagLoading, flagStale),
+	resp.MONITOR:  noKeySpec(-1, groupServer, flagAdmin, flagNoScript, flagLoading, flagStale),
+	resp.LATENCY:  noKeySpec(-2, groupServer, flagNoScript, flagLoading, flagStale),
+	resp.SLOWLOG:  noKeySpec(-2, groupServer, flagNoScript, flagLoading, flagStale),
+
+	resp.TYPE:      oneKeySpec(2, groupGeneric, flagFast),
+	resp.EXISTS:    oneKeySpec(2, groupGeneric, flagFast),
+	resp.DEL:       allKeysSpec(-2, 1, groupGeneric),
+	resp.UNLINK:    allKeysSpec(-2, 1, groupGeneric, flagFast),
+	resp.EXPIRE:    oneKeySpec(3, groupGeneric, flagFast),
+	resp.EXPIREAT:  oneKeySpec(3, groupGeneric, flagFast),
+	resp.PEXPIRE:   oneKeySpec(3, groupGeneric, flagFast),
+	resp.PEXPIREAT: oneKeySpec(3, groupGeneric, flagFast),
+	resp.TTL:       oneKeySpec(2, groupGeneric, flagFast),
+	resp.PTTL:      oneKeySpec(2, groupGeneric, flagFast),
+	resp.PERSIST:   oneKeySpec(2, groupGeneric, flagFast),
+	resp.KDEL:      allKeysSpec(-2, 1, groupGeneric),
+	resp.KEXISTS:   oneKeySpec(2, groupGeneric, flagFast),
+	resp.KEXPIRE:   oneKeySpec(3, groupGeneric, flagFast),
+	resp.KEXPIREAT: oneKeySpec(3, groupGeneric, flagFast),
+	resp.KTTL:      oneKeySpec(2, groupGeneric, flagFast),
+	resp.KPERSIST:  oneKeySpec(2, groupGeneric, flagFast),
+
+	resp.SET:         oneKeySpec(-3, groupString, flagDenyOOM),
+	resp.SETEX:       oneKeySpec(4, groupString, flagDenyOOM),
+	resp.PSETEX:      oneKeySpec(4, groupString, flagDenyOOM),
+	resp.SETNX:       oneKeySpec(3, groupString, flagDenyOOM, flagFast),
+	resp.PKSETEXAT:   oneKeySpec(4, groupString, flagDenyOOM),
+	resp.GET:         oneKeySpec(2, groupString, flagFast),
+	resp.GETSET:      oneKeySpec(3, groupString, flagDenyOOM, flagFast),
+	resp.MSET:        allKeysSpec(-3, 2, groupString, flagDenyOOM),
+	resp.MGET:        allKeysSpec(-2, 1, groupString, flagFast),
+	resp.INCR:        oneKeySpec(2, groupString, flagDenyOOM, flagFast),
+	resp.INCRBY:      oneKeySpec(3, groupString, flagDenyOOM, flagFast),
+	resp.INCRBYFLOAT: oneKeySpec(3, groupString, flagDenyOOM, flagFast),
+	resp.DECR:        oneKeySpec(2, groupString, flagDenyOOM, flagFast),
+	resp.DECRBY:      oneKeySpec(3, groupString, flagDenyOOM, flagFast),
+	resp.APPEND:      oneKeySpec(3, groupString, flagDenyOOM, flagFast),
+	resp.GETRANGE:    oneKeySpec(4, groupString),
+	resp.SETRANGE:    oneKeySpec(4, groupString, flagDenyOOM),
+	resp.STRLEN:      oneKeySpec(2, groupString, flagFast),
+
+	resp.BITCOUNT: oneKeySpec(-2, groupBitmap),
+	resp.BITPOS:   oneKeySpec(-3, groupBitmap),
+	resp.GETBIT:   oneKeySpec(3, groupBitmap, flagFast),
+	resp.SETBIT:   oneKeySpec(4, groupBitmap, flagDenyOOM),
+
+	resp.HSET:       oneKeySpec(-4, groupHash, flagDenyOOM, flagFast),
+	resp.HMSET:      oneKeySpec(-4, groupHash, flagDenyOOM, flagFast),
+	resp.HGET:       oneKeySpec(3, groupHash, flagFast),
+	resp.HMGET:      oneKeySpec(-3, groupHash, flagFast),
+	resp.HEXISTS:    oneKeySpec(3, groupHash, flagFast),
+	resp.HLEN:       oneKeySpec(2, groupHash, flagFast),
+	resp.HKEYS:      oneKeySpec(2, groupHash),
+	resp.HVALS:      oneKeySpec(2, groupHash),
+	resp.HDEL:       oneKeySpec(-3, groupHash, flagFast),
+	resp.HINCRBY:    oneKeySpec(4, groupHash, flagDenyOOM, flagFast),
+	resp.HGETALL:    oneKeySpec(2, groupHash),
+	resp.HSCAN:      oneKeySpec(-3, groupHash),
+	resp.HCLEAR:     allKeysSpec(-2, 1, groupHash),
+	resp.HEXPIRE:    oneKeySpec(3, groupHash, flagFast),
+	resp.HEXPIREAT:  oneKeySpec(3, groupHash, flagFast),
+	resp.HTTL:       oneKeySpec(2, groupHash, flagFast),
+	resp.HPERSIST:   oneKeySpec(2, groupHash, flagFast),
+	resp.HKEYEXISTS: oneKeySpec(2, groupHash, flagFast),
+
+	resp.LPUSH:      oneKeySpec(-3, groupList, flagDenyOOM, flagFast),
+	resp.RPUSH:      oneKeySpec(-3, groupList, flagDenyOOM, flagFast),
+	resp.LPUSHX:     oneKeySpec(-3, groupList, flagDenyOOM, flagFast),
+	resp.RPUSHX:     oneKeySpec(-3, groupList, flagDenyOOM, flagFast),
+	resp.LPOP:       oneKeySpec(-2, groupList, flagFast),
+	resp.RPOP:       oneKeySpec(-2, groupList, flagFast),
+	resp.LLEN:       oneKeySpec(2, groupList, flagFast),
+	resp.LINDEX:     oneKeySpec(3, groupList),
+	resp.LRANGE:     oneKeySpec(4, groupList),
+	resp.LREM:       oneKeySpec(4, groupList),
+	resp.LINSERT:    oneKeySpec(5, groupList, flagDenyOOM),
+	resp.LSET:       oneKeySpec(4, groupList, flagDenyOOM),
+	resp.LTRIM:      oneKeySpec(4, groupList),
+	resp.LTRIMBACK:  oneKeySpec(3, groupList),
+	resp.LTRIMFRONT: oneKeySpec(3, groupList),
+	resp.LCLEAR:     allKeysSpec(-2, 1, groupList),
+	resp.LEXPIRE:    oneKeySpec(3, groupList, flagFast),
+	resp.LEXPIREAT:  oneKeySpec(3, groupList, flagFast),
+	resp.LTTL:       oneKeySpec(2, groupList, flagFast),
+	resp.LPERSIST:   oneKeySpec(2, groupList, flagFast),
+	resp.LKEYEXISTS: oneKeySpec(2, groupList, flagFast),
+
+	resp.SADD:        oneKeySpec(-3, groupSet, flagDenyOOM, flagFast),
+	resp.SREM:        oneKeySpec(-3, groupSet, flagFast),
+	resp.SPOP:        oneKeySpec(-2, groupSet, flagFast),
+	resp.SCARD:       oneKeySpec(2, groupSet, flagFast),
+	resp.SISMEMBER:   oneKeySpec(3, groupSet, flagFast),
+	resp.SMEMBERS:    oneKeySpec(2, groupSet),
+	resp.SSCAN:       oneKeySpec(-3, groupSet),
+	resp.SRANDMEMBER: oneKeySpec(-2, groupSet),
+	resp.SCLEAR:      allKeysSpec(-2, 1, groupSet),
+	resp.SEXPIRE:     oneKeySpec(3, groupSet, flagFast),
+	resp.SEXPIREAT:   oneKeySpec(3, groupSet, flagFast),
+	resp.STTL:        oneKeySpec(2, groupSet, flagFast),
+	resp.SPERSIST:    oneKeySpec(2, groupSet, flagFast),
+	resp.SKEYEXISTS:  oneKeySpec(2, groupSet, flagFast),
+
+	resp.ZADD:             oneKeySpec(-4, groupSortedSet, flagDenyOOM, flagFast),
+	resp.ZSCORE:           oneKeySpec(3, groupSortedSet, flagFast),
+	resp.ZCARD:            oneKeySpec(2, groupSortedSet, flagFast),
+	resp.ZCOUNT:           oneKeySpec(4, groupSortedSet, flagFast),
+	resp.ZINCRBY:          oneKeySpec(4, groupSortedSet, flagDenyOOM, flagFast),
+	resp.ZRANGE:           oneKeySpec(-4, groupSortedSet),
+	resp.ZRANGEBYSCORE:    oneKeySpec(-4, groupSortedSet),
+	resp.ZREVRANGEBYSCORE: oneKeySpec(-4, groupSortedSet),
+	resp.ZRANGEBYLEX:      oneKeySpec(-4, groupSortedSet),
+	resp.ZRANK:            oneKeySpec(3, groupSortedSet, flagFast),
+	resp.ZREVRANK:         oneKeySpec(3, groupSortedSet, flagFast),
+	resp.ZREM:             oneKeySpec(-3, groupSortedSet, flagFast),
+	resp.ZREMRANGEBYRANK:  oneKeySpec(4, groupSortedSet),
+	resp.ZREMRANGEBYSCORE: oneKeySpec(4, groupSortedSet),
+	resp.ZREMRANGEBYLEX:   oneKeySpec(4, groupSortedSet),
+	resp.ZREVRANGE:        oneKeySpec(-4, groupSortedSet),
+	resp.ZLEXCOUNT:        oneKeySpec(4, groupSortedSet, flagFast),
+	resp.ZSCAN:            oneKeySpec(-3, groupSortedSet),
+	resp.ZCLEAR:           allKeysSpec(-2, 1, groupSortedSet),
+	resp.ZEXPIRE:          oneKeySpec(3, groupSortedSet, flagFast),
+	resp.ZEXPIREAT:        oneKeySpec(3, groupSortedSet, flagFast),
+	resp.ZTTL:             oneKeySpec(2, groupSortedSet, flagFast),
+	resp.ZPERSIST:         oneKeySpec(2, groupSortedSet, flagFast),
+	resp.ZKEYEXISTS:       oneKeySpec(2, groupSortedSet, flagFast),
+
+	resp.GEOADD:            oneKeySpec(-5, groupGeo, flagDenyOOM),
+	resp.GEODIST:           oneKeySpec(-4, groupGeo),
+	resp.GEOPOS:            oneKeySpec(-2, groupGeo),
+	resp.GEOHASH:           oneKeySpec(-2, groupGeo),
+	resp.GEORADIUS:         oneKeySpec(-6, groupGeo),
+	resp.GEORADIUSBYMEMBER: oneKeySpec(-5, groupGeo),
+
+	resp.EVAL:    {arity: -3, group: groupScripting, flags: []string{flagNoScript, flagMovableKeys}},
+	resp.EVALSHA: {arity: -3, group: groupScripting, flags: []string{flagNoScript, flagMovableKeys}},
+	resp.SCRIPT:  noKeySpec(-2, groupScripting, flagNoScript),
+
+	resp.WATCH:   allKeysSpec(-2, 1, groupTransaction, flagNoScript, flagLoading, flagStale, flagFast),
+	resp.UNWATCH: noKeySpec(1, groupTransaction, flagNoScript, flagLoading, flagStale, flagFast),
+	resp.MULTI:   noKeySpec(1, groupTransaction, flagNoScript, flagLoading, flagStale, flagFast),
+	resp.EXEC:    noKeySpec(1, groupTransaction, flagNoScript, flagLoading, flagStale),
+	resp.DISCARD: noKeySpec(1, groupTransaction, flagNoScript, flagLoading, flagStale, flagFast),
+}
+
+func getCommandSpec(name string) *commandSpec {
+	if spec, ok := commandSpecs[name]; ok {
+		return spec
+	}
+	return noKeySpec(-1, groupGeneric)
+}
+
+func (cs *commandSpec) checkArity(argc int) bool {
+	if cs.arity >= 0 {
+		return int64(argc) == cs.arity
+	}
+	return int64(argc) >= -cs.arity
+}
+
+// getKeys returns the keys of args, args[0] is the command name.
+func (cs *commandSpec) getKeys(args [][]byte) [][]byte {
+	if cs.firstKey <= 0 {
+		return nil
+	}
+	last := cs.lastKey
+	if last < 0 {
+		last = int64(len(args)) + last
+	}
+	keys := make([][]byte, 0, 1)
+	for i := cs.firstKey; i <= last && i < int64(len(args)); i += cs.keyStep {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// commandKeys returns the keys of a session command, args excludes the
+// command name. The keys of EVAL and EVALSHA follow their numkeys argument.
+func commandKeys(cmd string, args [][]byte) [][]byte {
+	switch cmd {
+	case resp.EVAL, resp.EVALSHA:
+		if len(args) < 2 {
+			return nil
+		}
+		n, err := strconv.Atoi(unsafe2.String(args[1]))
+		if err != nil || n <= 0 || n > len(args)-2 {
+			return nil
+		}
+		return args[2 : 2+n]
+	}
+	spec, ok := commandSpecs[cmd]
+	if !ok || spec.firstKey <= 0 || len(args) == 0 {
+		return nil
+	}
+	if spec.lastKey == spec.firstKey {
+		return args[spec.firstKey-1 : spec.firstKey]
+	}
+	last := spec.lastKey
+	if last < 0 {
+		last = int64(len(args)) + 1 + last
+	}
+	keys := make([][]byte, 0, int64(len(args))/spec.keyStep+1)
+	for i := spec.firstKey; i <= last && i <= int64(len(args)); i += spec.keyStep {
+		keys = append(keys, args[i-1])
+	}
+	return keys
+}
+
+func commandInfo(name string) []interface{} {
+	spec := getCommandSpec(name)
+	isWrite := router.IsWriteCmd(name)
+
+	flags := make([]interface{}, 0, len(spec.flags)+1)
+	if isWrite {
+		flags = append(flags, "write")
+	} else {
+		flags = append(flags, "readonly")
+	}
+	for _, f := range spec.flags {
+		if f == flagDenyOOM && !isWrite {
+			continue
+		}
+		flags = append(flags, f)
+	}
+
+	aclCategories := []interface{}{"@" + spec.group}
+	if isWrite {
+		aclCategories = append(aclCategories, "@write")
+	} else {
+		aclCategories = append(aclCategories, "@read")
+	}
+	for _, f := range spec.flags {
+		switch f {
+		case flagFast:
+			aclCategories = append(aclCategories, "@fast")
+		case flagAdmin:
+			aclCategories = append(aclCategories, "@admin", "@dangerous")
+		}
+	}
+
+	keySpecs := make([]interface{}, 0, 1)
+	if spec.firstKey > 0 {
+		lastKey := spec.lastKey
+		if lastKey > 0 {
+			lastKey -= spec.firstKey
+		}
+		access := "RO"
+		if isWrite {
+			access = "RW"
+		}
+		keySpecs = append(keySpecs, []interface{}{
+			[]byte("flags"), []interface{}{access},
+			[]byte("begin_search"), []interface{}{
+				[]byte("type"), []byte("index"),
+				[]byte("spec"), []interface{}{[]byte("index"), spec.firstKey},
+			},
+			[]byte("find_keys"), []interface{}{
+				[]byte("type"), []byte("range"),
+				[]byte("spec"), []interface{}{
+					[]byte("lastkey"), lastKey,
+					[]byte("keystep"), spec.keyStep,
+					[]byte("limit"), int64(0),
+				},
+			},
+		})
+	}
+
+	return []interface{}{
+		[]byte(strings.ToLower(name)),
+		spec.arity,
+		flags,
+		spec.firstKey,
+		spec.lastKey,
+		spec.keyStep,
+		aclCategories,
+		[]interface{}{},
+		keySpecs,
+		[]interface{}{},
+	}
+}
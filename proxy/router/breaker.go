@@ -34,17 +34,38 @@ type GroupBreaker struct {
 }
 
 func NewGroupBreaker(conf *config.Config) *GroupBreaker {
+	gb := &GroupBreaker{
+		mu:    sync.RWMutex{},
+		gbmap: make(map[int]*Breaker),
+		opt:   newBreakerOption(conf),
+	}
+	return gb
+}
+
+func newBreakerOption(conf *config.Config) *BreakerOption {
 	opt := &BreakerOption{}
 	opt.BreakerOpenFailRate = conf.BreakerOpenFailRate
 	opt.BreakerRestoreRequest = conf.BreakerRestoreRequest
 	opt.BreakerStopTimeout = conf.BreakerStopTimeout.Duration()
+	return opt
+}
 
-	gb := &GroupBreaker{
-		mu:    sync.RWMutex{},
-		gbmap: make(map[int]*Breaker),
-		opt:   opt,
+// LoadConfig applies the breaker thresholds of conf, the breakers of all groups
+// are rebuilt and start from the closed state when the thresholds changed.
+func (gb *GroupBreaker) LoadConfig(conf *config.Config) {
+	opt := newBreakerOption(conf)
+
+	gb.mu.Lock()
+	defer gb.mu.Unlock()
+
+	if *opt == *gb.opt {
+		return
+	}
+	gb.opt = opt
+	for gid, b := range gb.gbmap {
+		num := b.resetOption(opt)
+		log.Infof("reset breaker gid:%d num:%d opt:%+v", gid, num, *opt)
 	}
-	return gb
 }
 
 func (gb *GroupBreaker) GetCircuitBreakerByGid(gid int) (*Breaker, error) {
@@ -117,28 +138,24 @@ func NewCircuitBreaker(opt *BreakerOption) *Breaker {
 	return cgb
 }
 
-func (b *Breaker) AddBreakerByAddrs(addrs ...string) int {
-	if len(addrs) <= 0 {
-		return 0
-	}
-
-	opts := gobreaker.Settings{
+func newCircuitBreakerSettings(opt *BreakerOption) gobreaker.Settings {
+	return gobreaker.Settings{
 		Name:        "DEFAULT",
-		Timeout:     b.opt.BreakerStopTimeout,
-		MaxRequests: uint32(b.opt.BreakerRestoreRequest),
+		Timeout:     opt.BreakerStopTimeout,
+		MaxRequests: uint32(opt.BreakerRestoreRequest),
 		Interval:    time.Second,
 		ReadyToTrip: func(counts gobreaker.Counts) bool {
 			if counts.Requests <= MinBreakerOpenRequest {
 				return false
 			}
 			failureRate := float64(counts.TotalFailures) / float64(counts.Requests)
-			ok := failureRate > b.opt.BreakerOpenFailRate
+			ok := failureRate > opt.BreakerOpenFailRate
 			if ok {
 				log.Infof("braker open total requests:%d totalfailures:%d failrate:%f>%f",
 					counts.Requests,
 					counts.TotalFailures,
 					failureRate,
-					b.opt.BreakerOpenFailRate)
+					opt.BreakerOpenFailRate)
 			}
 			return ok
 		},
@@ -146,9 +163,17 @@ func (b *Breaker) AddBreakerByAddrs(addrs ...string) int {
 			log.Infof("name:%s gobreaker State from %v to %v", name, from.String(), to.String())
 		},
 	}
+}
+
+func (b *Breaker) AddBreakerByAddrs(addrs ...string) int {
+	if len(addrs) <= 0 {
+		return 0
+	}
+
 	num := 0
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	opts := newCircuitBreakerSettings(b.opt)
 	for _, addr := range addrs {
 		opts.Name = addr
 		if _, ok := b.bmap[addr]; !ok {
@@ -159,6 +184,18 @@ func (b *Breaker) AddBreakerByAddrs(addrs ...string) int {
 	return num
 }
 
+func (b *Breaker) resetOption(opt *BreakerOption) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.opt = opt
+	opts := newCircuitBreakerSettings(opt)
+	for addr := range b.bmap {
+		opts.Name = addr
+		b.bmap[addr] = gobreaker.NewCircuitBreaker(opts)
+	}
+	return len(b.bmap)
+}
+
 func (b *Breaker) RemoveCircuitBreakerByAddr(addrs ...string) int {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -19,7 +19,10 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/zuoyebang/bitalostored/butils/tracing"
+	"github.com/zuoyebang/bitalostored/proxy/internal/dostats"
 	"github.com/zuoyebang/bitalostored/proxy/internal/errn"
 	"github.com/zuoyebang/bitalostored/proxy/internal/log"
 	"github.com/zuoyebang/bitalostored/proxy/resp"
@@ -98,6 +101,7 @@ func (pc *ProxyClient) do(commandName string, s *resp.Session, args ...interface
 		return pc.doWithClients(commandName, s, args...)
 	}
 
+	span := s.TraceSpan()
 	switch strings.ToUpper(commandName) {
 	case resp.MGET:
 		return execStoredMGet(pc, commandName, args...)
@@ -112,7 +116,7 @@ func (pc *ProxyClient) do(commandName string, s *resp.Session, args ...interface
 		} else {
 			slotId = pc.router.HashForLua(args[2].(string))
 		}
-		res, err, _ = goStoredDo(pc, slotId, commandName, nil, args...)
+		res, err, _ = goStoredDoSpan(pc, span, slotId, commandName, nil, args...)
 	case resp.SCRIPT:
 		var slotId int
 		switch strings.ToUpper(args[0].(string)) {
@@ -132,40 +136,46 @@ func (pc *ProxyClient) do(commandName string, s *resp.Session, args ...interface
 			} else {
 				slotId = pc.router.Hash(args[1].(string))
 			}
-			res, err, _ = goStoredDo(pc, slotId, commandName, nil, args...)
+			res, err, _ = goStoredDoSpan(pc, span, slotId, commandName, nil, args...)
 		case "LEN":
 			if len(args) == 1 {
 				slotId = pc.router.Hash("")
 			} else {
 				slotId = pc.router.Hash(args[1].(string))
 			}
-			res, err, _ = goStoredDo(pc, slotId, commandName, nil, args...)
+			res, err, _ = goStoredDoSpan(pc, span, slotId, commandName, nil, args...)
 		default:
 			return nil, resp.CmdParamsErr(resp.SCRIPT)
 		}
 	case resp.LRANGE:
 		slotId := pc.router.Hash(args[0])
-		res, err, _ = goStoredDo(pc, slotId, commandName, nil, args...)
+		res, err, _ = goStoredDoSpan(pc, span, slotId, commandName, nil, args...)
 	case resp.HKEYS, resp.HGETALL:
 		slotId := pc.router.Hash(args[0])
-		res, err, _ = goStoredDo(pc, slotId, commandName, nil, args...)
+		res, err, _ = goStoredDoSpan(pc, span, slotId, commandName, nil, args...)
 	case resp.SMEMBERS:
 		slotId := pc.router.Hash(args[0])
-		res, err, _ = goStoredDo(pc, slotId, commandName, nil, args...)
+		res, err, _ = goStoredDoSpan(pc, span, slotId, commandName, nil, args...)
 	case resp.ZRANGE, resp.ZREVRANGE:
 		slotId := pc.router.Hash(args[0])
-		res, err, _ = goStoredDo(pc, slotId, commandName, nil, args...)
+		res, err, _ = goStoredDoSpan(pc, span, slotId, commandName, nil, args...)
 	case resp.ZRANGEBYSCORE, resp.ZREVRANGEBYSCORE, resp.ZRANK, resp.ZREVRANK:
 		slotId := pc.router.Hash(args[0])
-		res, err, _ = goStoredDo(pc, slotId, commandName, nil, args...)
+		res, err, _ = goStoredDoSpan(pc, span, slotId, commandName, nil, args...)
 	default:
 		slotId := pc.router.Hash(args[0])
-		res, err, _ = goStoredDo(pc, slotId, commandName, nil, args...)
+		res, err, _ = goStoredDoSpan(pc, span, slotId, commandName, nil, args...)
 	}
 	return res, err
 }
 
 func goStoredDo(r *ProxyClient, slotId int, commandName string, prevGetConn func() (*InternalPool, bool, uint64, string, error), args ...interface{}) (res interface{}, err error, addrs string) {
+	return goStoredDoSpan(r, nil, slotId, commandName, prevGetConn, args...)
+}
+
+// goStoredDoSpan records a client span of the backend call under span, the
+// trace context is passed on to stored with the TRACE prefix when propagation is on.
+func goStoredDoSpan(r *ProxyClient, span *tracing.Span, slotId int, commandName string, prevGetConn func() (*InternalPool, bool, uint64, string, error), args ...interface{}) (res interface{}, err error, addrs string) {
 	isWrite := IsWriteCmd(commandName)
 	if r.readOnly && isWrite {
 		return nil, resp.WriteErrorOnReadOnlyProxy, ""
@@ -176,6 +186,8 @@ func goStoredDo(r *ProxyClient, slotId int, commandName string, prevGetConn func
 	var cloudType string
 	if prevGetConn != nil {
 		storedAddrPool, needCircuit, curindex, cloudType, err = prevGetConn()
+	} else if !isWrite && len(args) > 0 && isReadMasterKey(args[0]) {
+		storedAddrPool, err = r.router.GetMasterConn(slotId)
 	} else {
 		storedAddrPool, needCircuit, curindex, cloudType, err = r.router.GetConn(slotId, commandName)
 	}
@@ -184,9 +196,26 @@ func goStoredDo(r *ProxyClient, slotId int, commandName string, prevGetConn func
 		return nil, err, ""
 	}
 	hystrixName := storedAddrPool.GetHostPort()
+	groupId, _ := r.router.GetGroupId(slotId)
 	doCmdFunc := func() (interface{}, error) {
 		conn := storedAddrPool.GetConn()
-		res, err := conn.Do(commandName, args...)
+		start := time.Now()
+		child := span.StartChildAt("stored "+commandName, tracing.SpanKindClient, start)
+		var res interface{}
+		var err error
+		if child != nil && r.tracePropagate {
+			traceCmd, traceArgs := tracing.WrapCommand(child.Context(), commandName, args)
+			res, err = conn.Do(traceCmd, traceArgs...)
+		} else {
+			res, err = conn.Do(commandName, args...)
+		}
+		dostats.RecordGroupLatency(groupId, time.Since(start))
+		if child != nil {
+			child.SetAttr("net.peer.name", hystrixName)
+			child.SetAttr("bitalos.group_id", groupId)
+			child.SetError(err)
+			child.End()
+		}
 		defer conn.Close()
 		if err != nil {
 			log.Warnf("do redis cmd fail addr:%s slotId:%d commandName:%s args:%s err:%v", hystrixName, slotId, commandName, args, err)
@@ -201,7 +230,6 @@ func goStoredDo(r *ProxyClient, slotId int, commandName string, prevGetConn func
 	}
 
 	var cgb *Breaker
-	groupId, _ := r.router.GetGroupId(slotId)
 	cgb, err = r.router.GroupBreaker.GetCircuitBreakerByGid(groupId)
 	if cgb == nil || err != nil {
 		log.Warnf("get group circuit breaker fail err:%v", err)
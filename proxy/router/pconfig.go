@@ -29,14 +29,14 @@ type PclientConfig struct {
 func newPclientConfig() *PclientConfig {
 	return &PclientConfig{
 		mu:     sync.RWMutex{},
-		wblist: make([]*models.WhiteAndBlackList, 2),
+		wblist: make([]*models.WhiteAndBlackList, models.PconfigNum),
 	}
 }
 
 func (pcc *PclientConfig) pconfigs() []*models.Pconfig {
 	pcc.mu.RLock()
 	defer pcc.mu.RUnlock()
-	res := make([]*models.Pconfig, 0, 2)
+	res := make([]*models.Pconfig, 0, models.PconfigNum)
 	localCachePconfig := &models.Pconfig{
 		Name:      models.LocalCachePrefix,
 		Content:   pcc.wblist[models.LocalCacheIndex],
@@ -47,7 +47,17 @@ func (pcc *PclientConfig) pconfigs() []*models.Pconfig {
 		Content:   pcc.wblist[models.BlackKeysIndex],
 		OutOfSync: false,
 	}
-	res = append(res, localCachePconfig, blackPconfig)
+	rateLimitPconfig := &models.Pconfig{
+		Name:      models.RateLimit,
+		Content:   pcc.wblist[models.RateLimitIndex],
+		OutOfSync: false,
+	}
+	prefixRulePconfig := &models.Pconfig{
+		Name:      models.PrefixRules,
+		Content:   pcc.wblist[models.PrefixRuleIndex],
+		OutOfSync: false,
+	}
+	res = append(res, localCachePconfig, blackPconfig, rateLimitPconfig, prefixRulePconfig)
 	return res
 }
 
@@ -60,6 +70,12 @@ func (pcc *PclientConfig) fillPconfig(pconfig *models.Pconfig) error {
 		pcc.wblist[models.LocalCacheIndex] = pconfig.Content
 	} else if pconfig.Name == models.BlackKeys {
 		pcc.wblist[models.BlackKeysIndex] = pconfig.Content
+	} else if pconfig.Name == models.RateLimit {
+		pcc.wblist[models.RateLimitIndex] = pconfig.Content
+		updateRateLimiter(pconfig.Content.RateLimits)
+	} else if pconfig.Name == models.PrefixRules {
+		pcc.wblist[models.PrefixRuleIndex] = pconfig.Content
+		updatePrefixRules(pconfig.Content.PrefixRules)
 	} else {
 		return errors.New("not exists pconfig name")
 	}
@@ -0,0 +1,191 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/zuoyebang/bitalostored/butils/trie"
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/proxy/internal/log"
+	"github.com/zuoyebang/bitalostored/proxy/internal/models"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+)
+
+var globalPrefixRules atomic.Pointer[prefixRuleSet]
+
+func init() {
+	resp.SetCmdRewriter(rewriteCmdByPrefixRule)
+}
+
+type prefixRule struct {
+	prefix      string
+	readMaster  bool
+	denyWrite   bool
+	ttl         []byte
+	disableCmds map[string]bool
+	renameCmds  map[string]string
+}
+
+type prefixRuleSet struct {
+	rules   map[string]*prefixRule
+	lengths []int
+	trie    trie.Trie
+}
+
+func newPrefixRuleSet(rules []*models.PrefixRule) *prefixRuleSet {
+	rs := &prefixRuleSet{
+		rules: make(map[string]*prefixRule, len(rules)),
+	}
+	prefixes := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if rule == nil || len(rule.Prefix) == 0 {
+			continue
+		}
+		if nested := rs.nestedPrefix(rule.Prefix); nested != "" {
+			log.Warnf("ignore prefix rule %s nested with %s", rule.Prefix, nested)
+			continue
+		}
+		pr := &prefixRule{
+			prefix:      rule.Prefix,
+			readMaster:  rule.ReadMaster,
+			denyWrite:   rule.DenyWrite,
+			disableCmds: make(map[string]bool, len(rule.DisableCmds)),
+			renameCmds:  make(map[string]string, len(rule.RenameCmds)),
+		}
+		if rule.DefaultTTL > 0 {
+			pr.ttl = strconv.AppendInt(nil, rule.DefaultTTL, 10)
+		}
+		for _, cmd := range rule.DisableCmds {
+			pr.disableCmds[strings.ToUpper(cmd)] = true
+		}
+		for from, to := range rule.RenameCmds {
+			pr.renameCmds[strings.ToUpper(from)] = strings.ToUpper(to)
+		}
+		rs.rules[rule.Prefix] = pr
+		prefixes = append(prefixes, rule.Prefix)
+	}
+
+	lengths := make(map[int]struct{}, len(rs.rules))
+	for prefix := range rs.rules {
+		if _, ok := lengths[len(prefix)]; !ok {
+			lengths[len(prefix)] = struct{}{}
+			rs.lengths = append(rs.lengths, len(prefix))
+		}
+	}
+	sort.Ints(rs.lengths)
+	rs.trie = trie.NewCharTrie(prefixes)
+	return rs
+}
+
+func (rs *prefixRuleSet) nestedPrefix(prefix string) string {
+	for p := range rs.rules {
+		if strings.HasPrefix(prefix, p) || strings.HasPrefix(p, prefix) {
+			return p
+		}
+	}
+	return ""
+}
+
+func (rs *prefixRuleSet) match(key string) *prefixRule {
+	if !rs.trie.HasPrefix(key) {
+		return nil
+	}
+	for _, l := range rs.lengths {
+		if l > len(key) {
+			break
+		}
+		if pr, ok := rs.rules[key[:l]]; ok {
+			return pr
+		}
+	}
+	return nil
+}
+
+func updatePrefixRules(rules []*models.PrefixRule) {
+	rs := newPrefixRuleSet(rules)
+	if len(rs.rules) == 0 {
+		globalPrefixRules.Store(nil)
+	} else {
+		globalPrefixRules.Store(rs)
+	}
+}
+
+func matchPrefixRule(key string) *prefixRule {
+	rs := globalPrefixRules.Load()
+	if rs == nil {
+		return nil
+	}
+	return rs.match(key)
+}
+
+func isReadMasterKey(key interface{}) bool {
+	if globalPrefixRules.Load() == nil {
+		return false
+	}
+	var pr *prefixRule
+	switch k := key.(type) {
+	case string:
+		pr = matchPrefixRule(k)
+	case []byte:
+		pr = matchPrefixRule(unsafe2.String(k))
+	}
+	return pr != nil && pr.readMaster
+}
+
+// rewriteCmdByPrefixRule checks the command against the rules of all its
+// keys, so a multi-key command like MSET or DEL can not pass a denied key
+// behind an allowed one. The command is renamed and given a default ttl by
+// the rule of its first key.
+func rewriteCmdByPrefixRule(s *resp.Session) error {
+	rs := globalPrefixRules.Load()
+	if rs == nil {
+		return nil
+	}
+	keys := s.Keys()
+	if len(keys) == 0 {
+		return nil
+	}
+	first := rs.match(unsafe2.String(keys[0]))
+	cmd := s.Cmd
+	if first != nil {
+		if to, ok := first.renameCmds[cmd]; ok {
+			cmd = to
+		}
+	}
+	isWrite := IsWriteCmd(cmd)
+	for _, key := range keys {
+		pr := rs.match(unsafe2.String(key))
+		if pr == nil {
+			continue
+		}
+		if pr.disableCmds[s.Cmd] || pr.disableCmds[cmd] {
+			return resp.PrefixCmdDisabledErr(s.Cmd, pr.prefix)
+		}
+		if pr.denyWrite && isWrite {
+			return resp.PrefixWriteDeniedErr
+		}
+	}
+	s.Cmd = cmd
+	if first != nil && first.ttl != nil && s.Cmd == resp.SET && len(s.Args) >= 2 {
+		if e, _, _, err := resp.ParseSetArgs(s.Args[2:]); err == nil && e == resp.NoType {
+			s.Args = append(s.Args, []byte(resp.EX), first.ttl)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net"
+	"testing"
+
+	"github.com/zuoyebang/bitalostored/proxy/internal/models"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+)
+
+func TestPrefixRuleSet(t *testing.T) {
+	rs := newPrefixRuleSet([]*models.PrefixRule{
+		{Prefix: "order:", ReadMaster: true},
+		{Prefix: "order:big:", DenyWrite: true},
+		{Prefix: "feed:", DisableCmds: []string{"hgetall"}},
+	})
+	if len(rs.rules) != 2 {
+		t.Fatalf("nested prefix should be ignored, rules:%d", len(rs.rules))
+	}
+	if pr := rs.match("order:1"); pr == nil || !pr.readMaster {
+		t.Fatalf("order:1 should match order:")
+	}
+	if pr := rs.match("feed:1"); pr == nil || !pr.disableCmds[resp.HGETALL] {
+		t.Fatalf("feed:1 should match feed:")
+	}
+	if pr := rs.match("user:1"); pr != nil {
+		t.Fatalf("user:1 should not match %s", pr.prefix)
+	}
+	if pr := rs.match("feed"); pr != nil {
+		t.Fatalf("feed should not match %s", pr.prefix)
+	}
+}
+
+func TestRewriteCmdByPrefixRule(t *testing.T) {
+	updatePrefixRules([]*models.PrefixRule{
+		{Prefix: "tmp:", DefaultTTL: 60, RenameCmds: map[string]string{"del": "unlink"}},
+		{Prefix: "ro:", DenyWrite: true, DisableCmds: []string{resp.HGETALL}},
+	})
+	defer updatePrefixRules(nil)
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	s := resp.NewSession(c1, 1024, 1024, false)
+	defer s.Close()
+
+	s.Cmd = resp.SET
+	s.Args = [][]byte{[]byte("tmp:1"), []byte("v")}
+	if err := rewriteCmdByPrefixRule(s); err != nil || len(s.Args) != 4 || string(s.Args[3]) != "60" {
+		t.Fatalf("set should get default ttl, args:%q err:%v", s.Args, err)
+	}
+
+	s.Args = [][]byte{[]byte("tmp:1"), []byte("v"), []byte("px"), []byte("100")}
+	if err := rewriteCmdByPrefixRule(s); err != nil || len(s.Args) != 4 {
+		t.Fatalf("set with ttl should not change, args:%q err:%v", s.Args, err)
+	}
+
+	s.Cmd = resp.DEL
+	s.Args = [][]byte{[]byte("tmp:1")}
+	if err := rewriteCmdByPrefixRule(s); err != nil || s.Cmd != resp.UNLINK {
+		t.Fatalf("del should be renamed to unlink, cmd:%s err:%v", s.Cmd, err)
+	}
+
+	s.Cmd = resp.SET
+	s.Args = [][]byte{[]byte("ro:1"), []byte("v")}
+	if err := rewriteCmdByPrefixRule(s); err != resp.PrefixWriteDeniedErr {
+		t.Fatalf("write on ro: should be denied err:%v", err)
+	}
+	s.Cmd = resp.HGETALL
+	if err := rewriteCmdByPrefixRule(s); err == nil {
+		t.Fatalf("hgetall on ro: should be disabled")
+	}
+	s.Cmd = resp.GET
+	if err := rewriteCmdByPrefixRule(s); err != nil {
+		t.Fatalf("get on ro: err:%v", err)
+	}
+}
+
+func TestRewriteCmdByPrefixRuleMultiKey(t *testing.T) {
+	updatePrefixRules([]*models.PrefixRule{
+		{Prefix: "ro:", DenyWrite: true},
+		{Prefix: "feed:", DisableCmds: []string{resp.DEL}},
+	})
+	defer updatePrefixRules(nil)
+	// the key spec lives in respcmd, which imports router
+	resp.SetCmdKeys(func(cmd string, args [][]byte) [][]byte {
+		if cmd != resp.MSET {
+			return args
+		}
+		var keys [][]byte
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	})
+	defer resp.SetCmdKeys(nil)
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	s := resp.NewSession(c1, 1024, 1024, false)
+	defer s.Close()
+
+	s.Cmd = resp.MSET
+	s.Args = [][]byte{[]byte("ok:1"), []byte("v"), []byte("ro:1"), []byte("v")}
+	if err := rewriteCmdByPrefixRule(s); err != resp.PrefixWriteDeniedErr {
+		t.Fatalf("mset with a ro: key should be denied err:%v", err)
+	}
+	s.Args = [][]byte{[]byte("ok:1"), []byte("ro:1"), []byte("ok:2"), []byte("v")}
+	if err := rewriteCmdByPrefixRule(s); err != nil {
+		t.Fatalf("mset with a ro: value should pass err:%v", err)
+	}
+
+	s.Cmd = resp.DEL
+	s.Args = [][]byte{[]byte("a"), []byte("feed:b")}
+	if err := rewriteCmdByPrefixRule(s); err == nil {
+		t.Fatalf("del with a feed: key should be disabled")
+	}
+	s.Args = [][]byte{[]byte("a"), []byte("b")}
+	if err := rewriteCmdByPrefixRule(s); err != nil {
+		t.Fatalf("del err:%v", err)
+	}
+}
+
+func TestIsReadMasterKey(t *testing.T) {
+	updatePrefixRules([]*models.PrefixRule{{Prefix: "order:", ReadMaster: true}})
+	defer updatePrefixRules(nil)
+
+	if !isReadMasterKey("order:1") || !isReadMasterKey([]byte("order:1")) {
+		t.Fatalf("string and []byte keys should read master")
+	}
+	if isReadMasterKey([]byte("user:1")) || isReadMasterKey(1) {
+		t.Fatalf("user:1 should not read master")
+	}
+}
@@ -89,7 +89,7 @@ func (p *probeTask) checkSlotNodeNormal(id int) {
 		localAddrs := make([]string, 0, 3)
 		backupAddrs := make([]string, 0, 3)
 
-		cloudType := p.r.config.ProxyCloudType
+		cloudType := p.r.Config().ProxyCloudType
 		for addr, alive := range rgsi.flagNodeMap {
 			if addrCloud, ok := m.GroupServersCloudMap[addr]; ok {
 				if alive {
@@ -15,6 +15,7 @@
 package router
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/zuoyebang/bitalostored/proxy/internal/config"
@@ -22,29 +23,37 @@ import (
 	"github.com/zuoyebang/bitalostored/proxy/internal/log"
 	"github.com/zuoyebang/bitalostored/proxy/internal/models"
 	"github.com/zuoyebang/bitalostored/proxy/resp"
+
+	"github.com/gomodule/redigo/redis"
 )
 
 var doOnce = sync.Once{}
 var globalProxyClient *ProxyClient = nil
 
 type ProxyClient struct {
-	mu       sync.Mutex
-	readOnly bool
-	router   *Router
-	pconfig  *PclientConfig
+	mu             sync.Mutex
+	readOnly       bool
+	tracePropagate bool
+	router         *Router
+	pconfig        *PclientConfig
 }
 
 func NewProxyClient(cfg *config.Config) *ProxyClient {
 	doOnce.Do(func() {
 		globalProxyClient = &ProxyClient{
-			router:   NewRouter(cfg),
-			pconfig:  newPclientConfig(),
-			readOnly: cfg.ReadOnlyProxy,
+			router:         NewRouter(cfg),
+			pconfig:        newPclientConfig(),
+			readOnly:       cfg.ReadOnlyProxy,
+			tracePropagate: cfg.Tracing.Propagate,
 		}
 	})
 	return globalProxyClient
 }
 
+func (pc *ProxyClient) LoadConfig(cfg *config.Config) {
+	pc.router.LoadConfig(cfg)
+}
+
 func GetProxyClient() (*ProxyClient, error) {
 	if globalProxyClient == nil {
 		return nil, errn.ErrNotInitProxy
@@ -81,6 +90,43 @@ func (pc *ProxyClient) GetMasterClients() (map[int]*resp.InternalServerConn, err
 	return clients, nil
 }
 
+type GroupMasterInfo struct {
+	GroupId  int
+	HostPort string
+	Info     string
+	Err      error
+}
+
+func (pc *ProxyClient) GetMasterInfos() []*GroupMasterInfo {
+	groups := pc.GetAllGroup()
+	infos := make([]*GroupMasterInfo, 0, len(groups))
+	var wg sync.WaitGroup
+	for gid, s := range groups {
+		if gid <= 0 {
+			continue
+		}
+		info := &GroupMasterInfo{GroupId: gid}
+		infos = append(infos, info)
+		pool, err := pc.router.GetMasterConn(s)
+		if err != nil {
+			info.Err = err
+			continue
+		}
+		info.HostPort = pool.GetHostPort()
+		wg.Add(1)
+		go func(info *GroupMasterInfo, conn redis.Conn) {
+			defer wg.Done()
+			defer conn.Close()
+			info.Info, info.Err = redis.String(conn.Do("INFO"))
+		}(info, pool.GetConn())
+	}
+	wg.Wait()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].GroupId < infos[j].GroupId
+	})
+	return infos
+}
+
 func (pc *ProxyClient) Slots() []*models.Slot {
 	pc.mu.Lock()
 	defer pc.mu.Unlock()
@@ -143,6 +189,10 @@ func (pc *ProxyClient) DoProbeNode() {
 	pc.router.probe.doCheck()
 }
 
+func (pc *ProxyClient) LocalCacheStats() (hits, misses uint64) {
+	return pc.router.localCache.HitStats()
+}
+
 func (pc *ProxyClient) checkKeyIsProxyCache(key string) bool {
 	if pc.pconfig.checkIsBlackCache(key) {
 		return false
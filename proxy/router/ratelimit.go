@@ -0,0 +1,299 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"container/list"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/proxy/internal/dostats"
+	"github.com/zuoyebang/bitalostored/proxy/internal/log"
+	"github.com/zuoyebang/bitalostored/proxy/internal/models"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+
+	"github.com/juju/ratelimit"
+)
+
+const maxLimitBucketsPerRule = 65536
+
+var globalRateLimiter atomic.Pointer[rateLimiter]
+
+func init() {
+	resp.SetCmdLimiter(checkCmdRateLimit)
+}
+
+type limitBuckets struct {
+	read  *ratelimit.Bucket
+	write *ratelimit.Bucket
+}
+
+func newLimitBuckets(rule *models.RateLimitRule) *limitBuckets {
+	lb := &limitBuckets{}
+	if rule.ReadQPS > 0 {
+		lb.read = ratelimit.NewBucketWithRate(float64(rule.ReadQPS), limitCapacity(rule.ReadQPS, rule.Burst))
+	}
+	if rule.WriteQPS > 0 {
+		lb.write = ratelimit.NewBucketWithRate(float64(rule.WriteQPS), limitCapacity(rule.WriteQPS, rule.Burst))
+	}
+	return lb
+}
+
+func limitCapacity(qps, burst int64) int64 {
+	if burst > 0 {
+		return burst
+	}
+	return qps
+}
+
+func (lb *limitBuckets) get(isWrite bool) *ratelimit.Bucket {
+	if isWrite {
+		return lb.write
+	}
+	return lb.read
+}
+
+// limitBucket is a bucket a command takes a token from, with the rule it
+// belongs to.
+type limitBucket struct {
+	lr *limitRule
+	b  *ratelimit.Bucket
+}
+
+// limitEntry is the buckets of one user or ip of a wildcard rule.
+type limitEntry struct {
+	value string
+	lb    *limitBuckets
+}
+
+// limitRule keeps the buckets of a rule. A wildcard rule has buckets of each
+// user or ip, at most maxLimitBucketsPerRule of them, the least recently used
+// one is dropped for a new one so clients cycling through many users or ips
+// can not reset the buckets of the others.
+type limitRule struct {
+	name     string
+	rule     *models.RateLimitRule
+	shared   *limitBuckets
+	mu       sync.Mutex
+	eachOne  map[string]*list.Element
+	lru      *list.List
+	wildcard bool
+}
+
+func newLimitRule(rule *models.RateLimitRule) *limitRule {
+	lr := &limitRule{
+		name:     rule.Name(),
+		rule:     rule,
+		wildcard: rule.Match == models.RateLimitMatchAll && rule.Type != models.RateLimitByPrefix,
+	}
+	if lr.wildcard {
+		lr.eachOne = make(map[string]*list.Element, 64)
+		lr.lru = list.New()
+	} else {
+		lr.shared = newLimitBuckets(rule)
+	}
+	return lr
+}
+
+// bucket returns the bucket of value, nil if the rule does not limit this kind
+// of command. A wildcard rule keeps value, so it must not be an unsafe string.
+func (lr *limitRule) bucket(value string, isWrite bool) *ratelimit.Bucket {
+	if !lr.wildcard {
+		return lr.shared.get(isWrite)
+	}
+
+	lr.mu.Lock()
+	var lb *limitBuckets
+	if e, ok := lr.eachOne[value]; ok {
+		lr.lru.MoveToFront(e)
+		lb = e.Value.(*limitEntry).lb
+	} else {
+		if lr.lru.Len() >= maxLimitBucketsPerRule {
+			oldest := lr.lru.Back()
+			delete(lr.eachOne, oldest.Value.(*limitEntry).value)
+			lr.lru.Remove(oldest)
+		}
+		lb = newLimitBuckets(lr.rule)
+		lr.eachOne[value] = lr.lru.PushFront(&limitEntry{value: value, lb: lb})
+	}
+	lr.mu.Unlock()
+	return lb.get(isWrite)
+}
+
+func (lr *limitRule) appendBucket(buckets []limitBucket, value string, isWrite bool) []limitBucket {
+	for _, lb := range buckets {
+		if lb.lr == lr {
+			return buckets
+		}
+	}
+	if b := lr.bucket(value, isWrite); b != nil {
+		buckets = append(buckets, limitBucket{lr: lr, b: b})
+	}
+	return buckets
+}
+
+type rateLimiter struct {
+	users    map[string]*limitRule
+	ips      map[string]*limitRule
+	anyUser  *limitRule
+	anyIP    *limitRule
+	prefixes []*limitRule
+}
+
+// newRateLimiter builds the limiter of rules. A rule unchanged since prev
+// keeps its buckets, so a pconfig push does not refill the budget of clients.
+func newRateLimiter(rules []*models.RateLimitRule, prev *rateLimiter) *rateLimiter {
+	rl := &rateLimiter{
+		users: make(map[string]*limitRule, 2),
+		ips:   make(map[string]*limitRule, len(rules)),
+	}
+	prevRules := prev.rules()
+	for _, rule := range rules {
+		if rule == nil || len(rule.Match) == 0 || (rule.ReadQPS <= 0 && rule.WriteQPS <= 0) {
+			continue
+		}
+		lr := prevRules[rule.Name()]
+		if lr == nil || *lr.rule != *rule {
+			lr = newLimitRule(rule)
+		}
+		switch rule.Type {
+		case models.RateLimitByUser:
+			if lr.wildcard {
+				rl.anyUser = lr
+			} else {
+				rl.users[rule.Match] = lr
+			}
+		case models.RateLimitByIP:
+			if lr.wildcard {
+				rl.anyIP = lr
+			} else {
+				rl.ips[rule.Match] = lr
+			}
+		case models.RateLimitByPrefix:
+			rl.prefixes = append(rl.prefixes, lr)
+		default:
+			log.Warnf("ignore rate limit rule with unknown type:%s", rule.Type)
+		}
+	}
+	sort.Slice(rl.prefixes, func(i, j int) bool {
+		return len(rl.prefixes[i].rule.Match) > len(rl.prefixes[j].rule.Match)
+	})
+	return rl
+}
+
+// rules returns the rules of rl by name.
+func (rl *rateLimiter) rules() map[string]*limitRule {
+	m := make(map[string]*limitRule)
+	if rl == nil {
+		return m
+	}
+	for _, lr := range rl.users {
+		m[lr.name] = lr
+	}
+	for _, lr := range rl.ips {
+		m[lr.name] = lr
+	}
+	for _, lr := range rl.prefixes {
+		m[lr.name] = lr
+	}
+	for _, lr := range []*limitRule{rl.anyUser, rl.anyIP} {
+		if lr != nil {
+			m[lr.name] = lr
+		}
+	}
+	return m
+}
+
+func (rl *rateLimiter) empty() bool {
+	return len(rl.users) == 0 && len(rl.ips) == 0 && rl.anyUser == nil && rl.anyIP == nil && len(rl.prefixes) == 0
+}
+
+func (rl *rateLimiter) matchPrefix(key string) *limitRule {
+	for _, lr := range rl.prefixes {
+		if strings.HasPrefix(key, lr.rule.Match) {
+			return lr
+		}
+	}
+	return nil
+}
+
+// allow returns the rule limiting the command, nil if the command may run.
+// Tokens are only taken when every bucket of the command has one, so a
+// command rejected by one rule does not use up the budget of the others. A
+// command takes one token of a prefix rule however many of its keys match.
+func (rl *rateLimiter) allow(user, ip string, keys [][]byte, isWrite bool) *limitRule {
+	buckets := make([]limitBucket, 0, 4)
+	if lr := rl.users[user]; lr != nil {
+		buckets = lr.appendBucket(buckets, user, isWrite)
+	} else if rl.anyUser != nil {
+		buckets = rl.anyUser.appendBucket(buckets, user, isWrite)
+	}
+	if lr := rl.ips[ip]; lr != nil {
+		buckets = lr.appendBucket(buckets, ip, isWrite)
+	} else if rl.anyIP != nil {
+		buckets = rl.anyIP.appendBucket(buckets, ip, isWrite)
+	}
+	if len(rl.prefixes) > 0 {
+		for _, key := range keys {
+			if lr := rl.matchPrefix(unsafe2.String(key)); lr != nil {
+				buckets = lr.appendBucket(buckets, "", isWrite)
+			}
+		}
+	}
+
+	for _, lb := range buckets {
+		if lb.b.Available() < 1 {
+			return lb.lr
+		}
+	}
+	// a concurrent command may take the last token between the check and
+	// here, the command is then rejected like it would have been a moment later
+	for _, lb := range buckets {
+		if lb.b.TakeAvailable(1) != 1 {
+			return lb.lr
+		}
+	}
+	return nil
+}
+
+func updateRateLimiter(rules []*models.RateLimitRule) {
+	rl := newRateLimiter(rules, globalRateLimiter.Load())
+	if rl.empty() {
+		globalRateLimiter.Store(nil)
+	} else {
+		globalRateLimiter.Store(rl)
+	}
+}
+
+func checkCmdRateLimit(s *resp.Session) error {
+	rl := globalRateLimiter.Load()
+	if rl == nil {
+		return nil
+	}
+
+	var keys [][]byte
+	if len(rl.prefixes) > 0 {
+		keys = s.Keys()
+	}
+	isWrite := IsWriteCmd(s.Cmd)
+	if lr := rl.allow(s.AuthUser(), s.RemoteIP(), keys, isWrite); lr != nil {
+		dostats.IncrLimited(lr.name, isWrite)
+		return resp.RateLimitedErr
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/zuoyebang/bitalostored/proxy/internal/models"
+	"github.com/zuoyebang/bitalostored/proxy/resp"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter([]*models.RateLimitRule{
+		{Type: models.RateLimitByPrefix, Match: "user:", WriteQPS: 2},
+		{Type: models.RateLimitByPrefix, Match: "user:vip:", ReadQPS: 1},
+		{Type: models.RateLimitByIP, Match: models.RateLimitMatchAll, ReadQPS: 3},
+		{Type: models.RateLimitByUser, Match: "nobody"},
+	}, nil)
+	if len(rl.users) != 0 {
+		t.Fatalf("rule without qps should be ignored")
+	}
+
+	for i := 0; i < 2; i++ {
+		if lr := rl.allow(resp.AuthUserDefault, "10.0.0.1", keys("user:1"), true); lr != nil {
+			t.Fatalf("write %d limited by %s", i, lr.name)
+		}
+	}
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.1", keys("user:1"), true); lr == nil || lr.name != "prefix:user:" {
+		t.Fatalf("write should be limited by prefix:user:")
+	}
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.1", keys("other"), true); lr != nil {
+		t.Fatalf("write on other prefix limited by %s", lr.name)
+	}
+
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.2", keys("user:vip:1"), false); lr != nil {
+		t.Fatalf("read limited by %s", lr.name)
+	}
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.2", keys("user:vip:1"), false); lr == nil || lr.name != "prefix:user:vip:" {
+		t.Fatalf("read should be limited by the longest prefix")
+	}
+
+	for i := 0; i < 2; i++ {
+		rl.allow(resp.AuthUserDefault, "10.0.0.3", nil, false)
+	}
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.3", nil, false); lr != nil {
+		t.Fatalf("ip read limited too early by %s", lr.name)
+	}
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.3", nil, false); lr == nil || lr.name != "ip:*" {
+		t.Fatalf("read should be limited by ip:*")
+	}
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.4", nil, false); lr != nil {
+		t.Fatalf("every ip should have its own budget")
+	}
+}
+
+func keys(ks ...string) [][]byte {
+	res := make([][]byte, len(ks))
+	for i, k := range ks {
+		res[i] = []byte(k)
+	}
+	return res
+}
+
+func TestRateLimiterAllOrNothing(t *testing.T) {
+	rl := newRateLimiter([]*models.RateLimitRule{
+		{Type: models.RateLimitByUser, Match: resp.AuthUserDefault, WriteQPS: 2},
+		{Type: models.RateLimitByPrefix, Match: "hot:", WriteQPS: 1},
+	}, nil)
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.1", keys("hot:1"), true); lr != nil {
+		t.Fatalf("first write limited by %s", lr.name)
+	}
+	for i := 0; i < 3; i++ {
+		if lr := rl.allow(resp.AuthUserDefault, "10.0.0.1", keys("hot:1"), true); lr == nil || lr.name != "prefix:hot:" {
+			t.Fatalf("write %d should be limited by prefix:hot:", i)
+		}
+	}
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.1", keys("cold:1"), true); lr != nil {
+		t.Fatalf("rejected writes used up the user budget, limited by %s", lr.name)
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	rl := newRateLimiter([]*models.RateLimitRule{
+		{Type: models.RateLimitByPrefix, Match: "hot:", WriteQPS: 1},
+	}, nil)
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.1", keys("a", "hot:1", "hot:2"), true); lr != nil {
+		t.Fatalf("multi-key write limited by %s", lr.name)
+	}
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.1", keys("b", "hot:3"), true); lr == nil {
+		t.Fatalf("a later key of a multi-key write should be limited")
+	}
+	for i := 0; i < 3; i++ {
+		if lr := rl.allow(resp.AuthUserDefault, "10.0.0.1", nil, true); lr != nil {
+			t.Fatalf("command without keys limited by %s", lr.name)
+		}
+	}
+}
+
+func TestRateLimiterEvict(t *testing.T) {
+	rl := newRateLimiter([]*models.RateLimitRule{
+		{Type: models.RateLimitByIP, Match: models.RateLimitMatchAll, WriteQPS: 1},
+	}, nil)
+	if lr := rl.allow(resp.AuthUserDefault, "hot", nil, true); lr != nil {
+		t.Fatalf("first write limited by %s", lr.name)
+	}
+	for i := 0; i < maxLimitBucketsPerRule+10; i++ {
+		rl.allow(resp.AuthUserDefault, "hot", nil, true)
+		rl.allow(resp.AuthUserDefault, strconv.Itoa(i), nil, true)
+	}
+	if n := rl.anyIP.lru.Len(); n != maxLimitBucketsPerRule || len(rl.anyIP.eachOne) != n {
+		t.Fatalf("buckets %d, want %d", n, maxLimitBucketsPerRule)
+	}
+	if lr := rl.allow(resp.AuthUserDefault, "hot", nil, true); lr == nil {
+		t.Fatalf("recently used ip should keep its budget")
+	}
+	if _, ok := rl.anyIP.eachOne["0"]; ok {
+		t.Fatalf("least recently used ip should be evicted")
+	}
+}
+
+func TestRateLimiterUpdate(t *testing.T) {
+	prev := newRateLimiter([]*models.RateLimitRule{
+		{Type: models.RateLimitByUser, Match: resp.AuthUserDefault, WriteQPS: 1},
+		{Type: models.RateLimitByPrefix, Match: "hot:", WriteQPS: 1},
+	}, nil)
+	if lr := prev.allow(resp.AuthUserDefault, "10.0.0.1", keys("hot:1"), true); lr != nil {
+		t.Fatalf("first write limited by %s", lr.name)
+	}
+
+	rl := newRateLimiter([]*models.RateLimitRule{
+		{Type: models.RateLimitByUser, Match: resp.AuthUserDefault, WriteQPS: 1},
+		{Type: models.RateLimitByPrefix, Match: "hot:", WriteQPS: 2},
+	}, prev)
+	if rl.users[resp.AuthUserDefault] != prev.users[resp.AuthUserDefault] {
+		t.Fatalf("unchanged rule should keep its buckets")
+	}
+	if rl.prefixes[0] == prev.prefixes[0] {
+		t.Fatalf("changed rule should get new buckets")
+	}
+	if lr := rl.allow(resp.AuthUserDefault, "10.0.0.1", nil, true); lr == nil || lr.name != "user:"+resp.AuthUserDefault {
+		t.Fatalf("update should not refill the budget of an unchanged rule")
+	}
+}
@@ -67,7 +67,7 @@ type Router struct {
 	antsPools     sync.Map
 	GroupBreaker  *GroupBreaker
 	localCache    *gcache.BucketCache
-	config        *config.Config
+	config        atomic.Pointer[config.Config]
 	online        bool
 	closed        bool
 	curPoolActive int
@@ -76,7 +76,6 @@ type Router struct {
 
 func NewRouter(config *config.Config) *Router {
 	r := &Router{
-		config:        config,
 		slots:         make([]*models.Slot, MaxSlotNum),
 		groupPools:    sync.Map{},
 		antsPools:     sync.Map{},
@@ -85,6 +84,7 @@ func NewRouter(config *config.Config) *Router {
 		closed:        false,
 		curPoolActive: config.RedisDefaultConf.MaxActive,
 	}
+	r.config.Store(config)
 	dostats.SetPoolActive(r.curPoolActive)
 	for i := range r.slots {
 		r.slots[i] = &models.Slot{Id: i}
@@ -95,6 +95,17 @@ func NewRouter(config *config.Config) *Router {
 	return r
 }
 
+func (r *Router) Config() *config.Config {
+	return r.config.Load()
+}
+
+// LoadConfig switches the router to a reloaded config, settings read per request
+// like read_master_chance and the breaker thresholds take effect at once.
+func (r *Router) LoadConfig(cfg *config.Config) {
+	r.config.Store(cfg)
+	r.GroupBreaker.LoadConfig(cfg)
+}
+
 func (r *Router) Close() {
 	r.closed = true
 	r.online = false
@@ -125,7 +136,7 @@ func (r *Router) GetConn(
 		} else {
 			index := slot.RoundRobinNum % uint64(localNum)
 			if slot.LocalCloudServers[index] == slot.MasterAddr {
-				if !math2.ChanceControl(r.config.ReadMasterChance) {
+				if !math2.ChanceControl(r.Config().ReadMasterChance) {
 					indexIncr := atomic.AddUint64(&slot.RoundRobinNum, math2.ChanceDelta(localNum-1))
 					index = indexIncr % uint64(localNum)
 				}
@@ -146,7 +157,7 @@ func (r *Router) GetConn(
 			indexIncr := atomic.AddUint64(&slot.RoundRobinNum, 1)
 			index := indexIncr % uint64(backupNum)
 			if slot.BackupCloudServers[index] == slot.MasterAddr {
-				if !math2.ChanceControl(r.config.ReadMasterChance) {
+				if !math2.ChanceControl(r.Config().ReadMasterChance) {
 					indexIncr = atomic.AddUint64(&slot.RoundRobinNum, math2.ChanceDelta(backupNum-1))
 					index = indexIncr % uint64(backupNum)
 				}
@@ -347,7 +358,7 @@ func (r *Router) newGroupPool(groupId int, addrs []string, poolMaxActive int) {
 		if _, ok := r.groupPools.Load(addr); !ok {
 			r.registerGroupBreaker(groupId, addr)
 
-			poolConf := r.config.RedisDefaultConf
+			poolConf := r.Config().RedisDefaultConf
 			poolConf.HostPort = addr
 			poolConf.MaxActive = poolMaxActive
 			poolConf.MaxIdle = poolMaxActive
@@ -1107,6 +1107,7 @@ func (r *raft) toFollowerState(term uint64, leaderID uint64,
 	r.state = follower
 	r.reset(term, resetElectionTimeout)
 	r.setLeaderID(leaderID)
+	order.G_NodeSates.SetRemoteLag(r.clusterID, 0)
 	plog.Infof("%s became follower", r.describe())
 }
 
@@ -1931,9 +1932,45 @@ func (r *raft) handleRestoreRemote(m *pb.Message) error {
 func (r *raft) handleLeaderHeartbeat(m *pb.Message) error {
 	r.broadcastHeartbeatMessage()
 	order.G_NodeSates.SetStates(r.clusterID, r.log.committed, r.log.lastIndex(), m.Term, time.Now().UnixNano(), r.isLeader(), r.isWitness())
+	order.G_NodeSates.SetRemoteLag(r.clusterID, r.remoteMaxLag())
 	return nil
 }
 
+// remoteMaxLag returns how many entries the quorum-th highest match index of
+// the voting members is behind the leader's last index, that is how far a
+// write is from being committed. A follower that is down does not count as
+// long as a quorum keeps up, witnesses hold no data and count as matched like
+// in tryCommit.
+func (r *raft) remoteMaxLag() uint64 {
+	if r.numVotingMembers() != len(r.matched) {
+		r.resetMatchValueArray()
+	}
+	lastIndex := r.log.lastIndex()
+	var maxMatch uint64
+	index := 0
+	for nid, rp := range r.remotes {
+		match := rp.match
+		if nid == r.nodeID {
+			match = lastIndex
+		}
+		r.matched[index] = match
+		index++
+		if match > maxMatch {
+			maxMatch = match
+		}
+	}
+	for range r.witnesses {
+		r.matched[index] = maxMatch
+		index++
+	}
+	r.sortMatchValues()
+	q := r.matched[r.numVotingMembers()-r.quorum()]
+	if q >= lastIndex {
+		return 0
+	}
+	return lastIndex - q
+}
+
 // p69 of the raft thesis
 func (r *raft) handleLeaderCheckQuorum(m *pb.Message) error {
 	r.mustBeLeader()
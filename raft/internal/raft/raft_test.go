@@ -147,6 +147,27 @@ func TestTryCommitResetsMatchArray(t *testing.T) {
 	}
 }
 
+func TestRemoteMaxLagIgnoresMinority(t *testing.T) {
+	p := newTestRaft(1, []uint64{1, 2, 3}, 10, 1, NewTestLogDB())
+	p.becomeCandidate()
+	ne(p.becomeLeader(), t)
+	for i := 0; i < 10; i++ {
+		ne(p.appendEntries([]pb.Entry{{Cmd: []byte("v")}}), t)
+	}
+	lastIndex := p.log.lastIndex()
+
+	// node 3 is down, node 2 keeps up with the leader
+	p.remotes[2].match = lastIndex
+	p.remotes[3].match = 0
+	if lag := p.remoteMaxLag(); lag != 0 {
+		t.Errorf("lag %d, want 0", lag)
+	}
+	p.remotes[2].match = lastIndex - 5
+	if lag := p.remoteMaxLag(); lag != 5 {
+		t.Errorf("lag %d, want 5", lag)
+	}
+}
+
 func TestOneNodeWithHigherTermAndOneNodeWithMostRecentLogCanCompleteElection(t *testing.T) {
 	a := newTestRaft(1, []uint64{1, 2, 3}, 10, 1, NewTestLogDB())
 	b := newTestRaft(2, []uint64{1, 2, 3}, 10, 1, NewTestLogDB())
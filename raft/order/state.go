@@ -34,6 +34,7 @@ type NodeState struct {
 	nIsWitness  int32
 	nRecover    int
 	nOk         int32
+	nRemoteLag  uint64 // 主上最慢从节点落后的日志条数
 }
 
 type NodeStateInfo struct {
@@ -44,6 +45,7 @@ type NodeStateInfo struct {
 	IsWitness  int32  `json:"is_witness"`
 	Recover    int    `json:"recover"`
 	Diff       int64  `json:"diff"`
+	RemoteLag  uint64 `json:"remote_lag"`
 }
 
 func (p *NodeState) Ok(nNow, hbPeriod int64) int32 {
@@ -152,9 +154,26 @@ func (p *NodeStates) StatInfo(nClusterId uint64) NodeStateInfo {
 		IsWitness:  atomic.LoadInt32(&pNS.nIsWitness),
 		Recover:    pNS.nRecover,
 		Diff:       int64(atomic.LoadUint64(&pNS.nLastIndex)) - int64(atomic.LoadUint64(&pNS.nCommit)),
+		RemoteLag:  atomic.LoadUint64(&pNS.nRemoteLag),
 	}
 }
 
+func (p *NodeStates) SetRemoteLag(nClusterId, nLag uint64) {
+	pNS := p.getNodeState(nClusterId)
+	if nil == pNS {
+		return
+	}
+	atomic.StoreUint64(&pNS.nRemoteLag, nLag)
+}
+
+func (p *NodeStates) GetRemoteLag(nClusterId uint64) uint64 {
+	v, ok := p.mapRuningStat[nClusterId]
+	if !ok {
+		return 0
+	}
+	return atomic.LoadUint64(&v.nRemoteLag)
+}
+
 func (p *NodeStates) GetUpdateInterval() int64 {
 	return p.nUpdateIntervel
 }
@@ -21,6 +21,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/zuoyebang/bitalostored/butils/tracing"
 	"github.com/zuoyebang/bitalostored/stored/internal/config"
 	"github.com/zuoyebang/bitalostored/stored/internal/raft"
 	"github.com/zuoyebang/bitalostored/stored/internal/tclock"
@@ -46,6 +47,7 @@ func main() {
 		IsDebug:      config.GlobalConfig.Log.IsDebug,
 		RotationTime: config.GlobalConfig.Log.RotationTime,
 		LogPath:      config.GetBitalosLogPath(),
+		AuditLog:     config.GlobalConfig.Log.AuditLog,
 	})
 
 	tclock.InitTimeClock()
@@ -60,6 +62,9 @@ func main() {
 		os.Exit(1)
 	}
 
+	startMetrics(s)
+	server.SetupTracing(s)
+
 	log.Info("server is working ...")
 
 	server.InitLuaPool(s)
@@ -76,6 +81,11 @@ func main() {
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
 
+	if err = s.ListenInternal(); err != nil {
+		log.Errorf("server internal listen fail err:%s", err.Error())
+		s.Close()
+		os.Exit(1)
+	}
 	go s.ListenAndServe()
 
 	<-sc
@@ -84,6 +94,7 @@ func main() {
 
 	log.Info("server is closing ...")
 	s.Close()
+	tracing.SetDefault(nil)
 	log.Info("server is closed ...")
 }
 
@@ -99,3 +110,14 @@ func startPprof() {
 		}
 	}()
 }
+
+func startMetrics(s *server.Server) {
+	if !config.GlobalConfig.Plugin.OpenPprof {
+		return
+	}
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		s.WritePrometheus(w)
+	})
+}
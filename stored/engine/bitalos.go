@@ -18,8 +18,12 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 
 	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb/base"
 	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
 	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/dbconfig"
 	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/dbmeta"
@@ -28,8 +32,12 @@ import (
 )
 
 type Bitalos struct {
-	Meta    *dbmeta.Meta
-	Migrate *Migrate
+	Meta *dbmeta.Meta
+
+	migrateMu  sync.RWMutex
+	migrates   map[uint32]*Migrate
+	migrating  atomic.Int32
+	migrateDir string
 
 	bitsdb *bitsdb.BitsDB
 }
@@ -54,11 +62,17 @@ func NewBitalos(dir string) (*Bitalos, error) {
 	}
 
 	b := &Bitalos{
-		bitsdb: bdb,
-		Meta:   meta,
+		bitsdb:     bdb,
+		Meta:       meta,
+		migrates:   make(map[uint32]*Migrate),
+		migrateDir: filepath.Join(dbPath, migrateStateDir),
+	}
+	if err = os.MkdirAll(b.migrateDir, 0755); err != nil {
+		return nil, err
 	}
 
 	b.tryClean()
+	b.loadMigrates()
 
 	log.Infof("new bitalos success dumpDbConfig[%s]", b.dumpDbConfig(cfg))
 
@@ -71,7 +85,7 @@ func (b *Bitalos) dumpDbConfig(cfg *dbconfig.Config) string {
 	fmt.Fprintf(&buf, "DBPath:%s ", cfg.DBPath)
 	fmt.Fprintf(&buf, "MaxFieldSize:%d ", btools.MaxFieldSize)
 	fmt.Fprintf(&buf, "MaxValueSize:%d ", btools.MaxValueSize)
-	fmt.Fprintf(&buf, "MaxIOWriteLoadQPS:%d ", btools.MaxIOWriteLoadQPS)
+	fmt.Fprintf(&buf, "MaxIOWriteLoadQPS:%d ", btools.MaxIOWriteLoadQPS.Load())
 	fmt.Fprintf(&buf, "DisableWAL:%v ", cfg.DisableWAL)
 	fmt.Fprintf(&buf, "EnableRaftlogRestore:%v ", cfg.EnableRaftlogRestore)
 	fmt.Fprintf(&buf, "BithashCompressionType:%d ", cfg.BithashCompressionType)
@@ -155,6 +169,7 @@ func newBitalosMeta(dir string) (*dbmeta.Meta, error) {
 }
 
 func (b *Bitalos) Close() {
+	b.closeMigrates()
 	if b.bitsdb != nil {
 		b.bitsdb.Close()
 		b.bitsdb = nil
@@ -264,6 +279,62 @@ func (b *Bitalos) CacheInfo() []byte {
 	return b.bitsdb.CacheInfo()
 }
 
+func (b *Bitalos) CacheStats() base.CacheStats {
+	if b.bitsdb == nil {
+		return base.CacheStats{}
+	}
+
+	return b.bitsdb.CacheStats()
+}
+
+func (b *Bitalos) BitmapMemStats() base.BitmapMemStats {
+	if b.bitsdb == nil {
+		return base.BitmapMemStats{}
+	}
+
+	return b.bitsdb.BitmapMemStats()
+}
+
+func (b *Bitalos) KVStoreNum() int {
+	if b.bitsdb == nil {
+		return 0
+	}
+
+	return len(b.bitsdb.GetAllDB())
+}
+
+func (b *Bitalos) SampleMetaKeys(slotId uint32, seek []byte, count int, volatile bool) []bitsdb.EvictCandidate {
+	if b.bitsdb == nil {
+		return nil
+	}
+
+	return b.bitsdb.SampleMetaKeys(slotId, seek, count, volatile)
+}
+
+func (b *Bitalos) SlotKeyStats(slotId uint32) (int64, int64) {
+	if b.bitsdb == nil {
+		return 0, 0
+	}
+
+	return b.bitsdb.SlotKeyStats(slotId)
+}
+
+func (b *Bitalos) SetSlotKeyCounter(fn func(slotId uint16, delta int64)) {
+	if b.bitsdb == nil {
+		return
+	}
+
+	b.bitsdb.SetKeyCounter(fn)
+}
+
+func (b *Bitalos) SampleExpireKeys(count int) []bitsdb.EvictCandidate {
+	if b.bitsdb == nil {
+		return nil
+	}
+
+	return b.bitsdb.SampleExpireKeys(count)
+}
+
 func (b *Bitalos) GetIsDelExpire() int {
 	if b.bitsdb == nil {
 		return 0
@@ -43,14 +43,15 @@ func (bo *BaseObject) Del(khash uint32, keys ...[]byte) (n int64, err error) {
 			unlockKey := bo.LockKey(khash)
 			defer unlockKey()
 
+			mk, mkCloser := EncodeMetaKey(key, khash)
+			defer mkCloser()
 			bitmapExist, _ := bo.BaseDb.ClearBitmap(key, true)
 			if bitmapExist {
+				bo.BaseDb.CountKey(mk, -1)
 				n++
 				return
 			}
 
-			mk, mkCloser := EncodeMetaKey(key, khash)
-			defer mkCloser()
 			mkv, err := bo.BaseDb.BaseGetMetaWithoutValue(mk)
 			if err != nil {
 				return
@@ -64,6 +65,7 @@ func (bo *BaseObject) Del(khash uint32, keys ...[]byte) (n int64, err error) {
 				if err := bo.BaseDb.DeleteMetaKey(mk); err != nil {
 					return
 				}
+				bo.BaseDb.CountKey(mk, -1)
 			} else {
 				oldExpireKey, oekCloser := EncodeExpireKey(key, mkv)
 				mkv.Del()
@@ -15,6 +15,7 @@
 package base
 
 import (
+	"encoding/binary"
 	"fmt"
 	"sync/atomic"
 	"time"
@@ -45,8 +46,14 @@ type BaseDB struct {
 	Ready           atomic.Bool
 	KeyLocker       *locker.ScopeLocker
 	BitmapMem       *BitmapMem
+	keyCounter      atomic.Pointer[KeyCounter]
 }
 
+// KeyCounter receives the change of the alive key count of a slot. Writes
+// report a key when it turns alive or is deleted, keys that expire are not
+// reported and are left to the periodic slot scans.
+type KeyCounter func(slotId uint16, delta int64)
+
 func NewBaseDB(cfg *dbconfig.Config) (*BaseDB, error) {
 	db, err := bitskv.NewBaseDB(cfg)
 	if err != nil {
@@ -183,6 +190,8 @@ func (b *BaseDB) getMetaWithValue(ek []byte, dt btools.DataType) (mkv *MetaData,
 		return nil, nil, err
 	}
 
+	mkv.alive = mkv.IsAlive()
+
 	if mkv.IsWrongType(dt) {
 		log.Errorf("getMetaWithValue dataType notmatch ek:%s exp:%d act:%d mkv:%v", string(ek), dt, mkv.dt, mkv)
 		PutMkvToPool(mkv)
@@ -211,6 +220,54 @@ func (b *BaseDB) getMetaWithoutValue(ek []byte, dt btools.DataType) (*MetaData,
 	return mkv, nil
 }
 
+func (b *BaseDB) SetKeyCounter(fn KeyCounter) {
+	if fn == nil {
+		b.keyCounter.Store(nil)
+		return
+	}
+	b.keyCounter.Store(&fn)
+}
+
+func (b *BaseDB) HasKeyCounter() bool {
+	return b.keyCounter.Load() != nil
+}
+
+// CountKey reports delta alive keys for the slot of the meta key ek.
+func (b *BaseDB) CountKey(ek []byte, delta int64) {
+	fn := b.keyCounter.Load()
+	if fn == nil || len(ek) < keySlotIdLength {
+		return
+	}
+	(*fn)(binary.LittleEndian.Uint16(ek[:keySlotIdLength]), delta)
+}
+
+// CountKeyChange reports mkv to the slot key counts if the write of mkv to ek
+// created or deleted the key.
+func (b *BaseDB) CountKeyChange(ek []byte, mkv *MetaData) {
+	alive := mkv.IsAlive()
+	if alive == mkv.alive {
+		return
+	}
+	mkv.alive = alive
+	if alive {
+		b.CountKey(ek, 1)
+	} else {
+		b.CountKey(ek, -1)
+	}
+}
+
+// IsKeyAlive reports whether ek holds an alive key of any type. Blind string
+// writes use it to find out whether they create the key, a failed read
+// reports true so that it never adds a key.
+func (b *BaseDB) IsKeyAlive(ek []byte) bool {
+	mkv, err := b.getMetaWithoutValue(ek, btools.NoneType)
+	if err != nil {
+		return true
+	}
+	defer PutMkvToPool(mkv)
+	return mkv.alive
+}
+
 func (b *BaseDB) DeleteMetaKey(key []byte) error {
 	wb := b.DB.GetMetaWriteBatchFromPool()
 	defer b.DB.PutWriteBatchToPool(wb)
@@ -251,6 +308,27 @@ func (b *BaseDB) GetAllDB() []kv.IKVStore {
 	return b.DB.GetAllDB()
 }
 
+type CacheStats struct {
+	MaxMem     uint64
+	UsedMem    uint64
+	Items      int
+	QueryCount uint64
+	MissCount  uint64
+}
+
+func (b *BaseDB) CacheStats() CacheStats {
+	if b.MetaCache == nil {
+		return CacheStats{}
+	}
+	return CacheStats{
+		MaxMem:     uint64(b.MetaCache.MaxMem()),
+		UsedMem:    uint64(b.MetaCache.UsedMem()),
+		Items:      b.MetaCache.Count(),
+		QueryCount: b.MetaCache.QueryCount(),
+		MissCount:  b.MetaCache.MissCount(),
+	}
+}
+
 func (b *BaseDB) CacheInfo() string {
 	if b.MetaCache == nil {
 		return ""
@@ -61,6 +61,9 @@ type MetaData struct {
 	leftindex  uint32
 	rightindex uint32
 	value      []byte
+	// alive is whether the meta record was alive when it was read, the slot
+	// key counts compare it with the state that is written back.
+	alive bool
 }
 
 func NewMetaData() *MetaData {
@@ -207,6 +210,7 @@ func (mkv *MetaData) Clear() {
 	mkv.leftindex = InitalLeftIndex
 	mkv.rightindex = InitalRightIndex
 	mkv.value = nil
+	mkv.alive = false
 }
 
 func (mkv *MetaData) checkAndResetLeftRightIndex() {
@@ -83,6 +83,10 @@ func EncodeMetaKey(key []byte, khash uint32) ([]byte, func()) {
 	return pool[:size], closer
 }
 
+func EncodeMetaKeySize(key []byte) int {
+	return keySlotIdLength + len(key)
+}
+
 func EncodeMetaKeyForLua(key []byte) ([]byte, func()) {
 	size := keySlotIdLength + len(key)
 	pool, closer := bytepools.BytePools.GetBytePool(size)
@@ -130,6 +134,16 @@ func EncodeMetaDbValueForList(buf []byte, mkv *MetaData) {
 	binary.BigEndian.PutUint32(buf[pos:], mkv.rightindex)
 }
 
+// SetMetaValueVersion rewrites the key version of an encoded list or mix
+// meta value in place.
+func SetMetaValueVersion(val []byte, version uint64) error {
+	if len(val) < MetaMixValueLen || btools.DataType(val[0]) == btools.STRING {
+		return errMetaDataKeyLen
+	}
+	binary.BigEndian.PutUint64(val[keyDataTypeLength+keySizeLength:], version)
+	return nil
+}
+
 func DecodeMetaValue(mkv *MetaData, val []byte) error {
 	if len(val) < MetaStringValueLen {
 		return errMetaDataKeyLen
@@ -103,22 +103,26 @@ func (bo *BaseObject) GetMetaDataCheckAlive(key []byte, khash uint32) (*MetaData
 	return mkv, nil
 }
 
-func (bo *BaseObject) SetMetaData(ek []byte, mkv *MetaData) error {
+func (bo *BaseObject) SetMetaData(ek []byte, mkv *MetaData) (err error) {
 	switch mkv.dt {
 	case btools.STRING:
 		var meta [MetaStringValueLen]byte
 		EncodeMetaDbValueForString(meta[:], mkv.timestamp)
 		vlen := MetaStringValueLen + len(mkv.value)
-		return bo.SetMetaDataByValues(ek, vlen, meta[:], mkv.value)
+		err = bo.SetMetaDataByValues(ek, vlen, meta[:], mkv.value)
 	case btools.LIST:
 		var meta [MetaListValueLen]byte
 		EncodeMetaDbValueForList(meta[:], mkv)
-		return bo.SetMetaDataByValue(ek, meta[:])
+		err = bo.SetMetaDataByValue(ek, meta[:])
 	default:
 		var meta [MetaMixValueLen]byte
 		EncodeMetaDbValueForMix(meta[:], mkv)
-		return bo.SetMetaDataByValue(ek, meta[:])
+		err = bo.SetMetaDataByValue(ek, meta[:])
 	}
+	if err == nil {
+		bo.BaseDb.CountKeyChange(ek, mkv)
+	}
+	return err
 }
 
 func (bo *BaseObject) SetMetaDataSize(ek []byte, khash uint32, delta int64) error {
@@ -153,14 +157,18 @@ func (bo *BaseObject) SetMetaDataSize(ek []byte, khash uint32, delta int64) erro
 	case btools.ZSET, btools.ZSETOLD, btools.SET, btools.HASH:
 		var meta [MetaMixValueLen]byte
 		EncodeMetaDbValueForMix(meta[:], mkv)
-		return bo.SetMetaDataByValue(ek, meta[:])
+		err = bo.SetMetaDataByValue(ek, meta[:])
 	case btools.LIST:
 		var meta [MetaListValueLen]byte
 		EncodeMetaDbValueForList(meta[:], mkv)
-		return bo.SetMetaDataByValue(ek, meta[:])
+		err = bo.SetMetaDataByValue(ek, meta[:])
 	default:
 		return nil
 	}
+	if err == nil {
+		bo.BaseDb.CountKeyChange(ek, mkv)
+	}
+	return err
 }
 
 func (bo *BaseObject) SetMetaDataByValue(ek []byte, value []byte) error {
@@ -39,8 +39,8 @@ type BitmapMem struct {
 		count int
 	}
 
-	migrating    atomic.Bool
-	migrateSlot  atomic.Uint32
+	migrating    atomic.Int32
+	migrateSlots [utils.TotalSlot]atomic.Bool
 	maxItemCount int
 	baseDB       *BaseDB
 	flushing     atomic.Bool
@@ -157,7 +157,7 @@ func (bm *BitmapMem) AddItem(key []byte, khash uint32, newBi func(k []byte) *Bit
 		return false, nil
 	}
 
-	if bm.migrating.Load() && khash%utils.TotalSlot == bm.migrateSlot.Load() {
+	if bm.migrating.Load() > 0 && bm.migrateSlots[khash%utils.TotalSlot].Load() {
 		return false, nil
 	}
 
@@ -214,13 +214,16 @@ func (bm *BitmapMem) Close() {
 }
 
 func (bm *BitmapMem) StartMigrate(slotId uint32) {
-	bm.migrateSlot.Store(slotId)
-	bm.migrating.Store(true)
+	if !bm.migrateSlots[slotId].Swap(true) {
+		bm.migrating.Add(1)
+	}
 	bm.flushSlot(slotId)
 }
 
-func (bm *BitmapMem) ClearMigrate() {
-	bm.migrating.Store(false)
+func (bm *BitmapMem) ClearMigrate(slotId uint32) {
+	if bm.migrateSlots[slotId].Swap(false) {
+		bm.migrating.Add(-1)
+	}
 }
 
 func (bm *BitmapMem) RunFlushWorker() {
@@ -339,6 +342,45 @@ func (bm *BitmapMem) Flush(fast bool) {
 	log.Infof("bitmap item flush. cost:%d(s) total:%d expireNum:%d nullNum:%d flushNum:%d flushBytes:%d", tclock.GetTimestampSecond()-now, total, expireNum, nullNum, flushNum, flushBytes)
 }
 
+type BitmapMemStats struct {
+	Enable   bool
+	Items    int
+	MaxItems int
+	Bytes    uint64
+}
+
+func (bi *BitmapItem) SizeInBytes() uint64 {
+	bi.mu.RLock()
+	defer bi.mu.RUnlock()
+	if bi.mu.rb == nil {
+		return 0
+	}
+	return bi.mu.rb.GetSizeInBytes()
+}
+
+func (bm *BitmapMem) Stats() BitmapMemStats {
+	stats := BitmapMemStats{
+		Enable:   bm.enable,
+		MaxItems: bm.maxItemCount,
+	}
+	if !bm.enable {
+		return stats
+	}
+
+	bm.mu.RLock()
+	items := make([]*BitmapItem, 0, len(bm.mu.items))
+	for _, it := range bm.mu.items {
+		items = append(items, it)
+	}
+	stats.Items = bm.mu.count
+	bm.mu.RUnlock()
+
+	for _, it := range items {
+		stats.Bytes += uint64(len(it.key)) + it.SizeInBytes()
+	}
+	return stats
+}
+
 func (bm *BitmapMem) IsFull() bool {
 	return bm.mu.count >= bm.maxItemCount
 }
@@ -224,6 +224,14 @@ func (bdb *BitsDB) CacheInfo() []byte {
 	return buf.Bytes()
 }
 
+func (bdb *BitsDB) CacheStats() base.CacheStats {
+	return bdb.baseDb.CacheStats()
+}
+
+func (bdb *BitsDB) BitmapMemStats() base.BitmapMemStats {
+	return bdb.baseDb.BitmapMem.Stats()
+}
+
 func (bdb *BitsDB) CheckpointPrepareForBitalosdb(v bool) {
 	dbs := []*bitskv.DB{
 		bdb.baseDb.DB,
@@ -368,5 +376,5 @@ func (bdb *BitsDB) SetQPS(qps uint64) {
 
 func (bdb *BitsDB) CheckIOWriteLoadThreshold() bool {
 	qps := bdb.statQPS.Load()
-	return qps < btools.MaxIOWriteLoadQPS
+	return qps < btools.MaxIOWriteLoadQPS.Load()
 }
@@ -19,6 +19,7 @@ import (
 
 	"github.com/zuoyebang/bitalostored/butils"
 	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitskv"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
 	"github.com/zuoyebang/bitalostored/stored/internal/bytepools"
 	"github.com/zuoyebang/bitalostored/stored/internal/utils"
 )
@@ -105,6 +106,17 @@ func (bu *BitsUsage) AppendTo(target []byte, pos int) int {
 	return copy(target[pos:], bu.cache)
 }
 
+func (bu *BitsUsage) Range(f func(dataType string, u BitsDBUsage)) {
+	bu.mutex.RLock()
+	defer bu.mutex.RUnlock()
+
+	f(btools.StringName, *bu.metaUsage)
+	f(btools.HashName, *bu.hashUsage)
+	f(btools.ListName, *bu.listUsage)
+	f(btools.SetName, *bu.setUsage)
+	f(btools.ZSetName, *bu.zsetUsage)
+}
+
 func (bu *BitsUsage) UpdateCache() {
 	bu.mutex.Lock()
 	defer bu.mutex.Unlock()
@@ -0,0 +1,101 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitsdb
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/zuoyebang/bitalostored/butils/hash"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb/base"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitskv"
+	"github.com/zuoyebang/bitalostored/stored/internal/tclock"
+	"github.com/zuoyebang/bitalostored/stored/internal/utils"
+)
+
+type EvictCandidate struct {
+	Key      []byte
+	KeyHash  uint32
+	ExpireMs uint64
+}
+
+// SampleMetaKeys returns up to count alive keys of slotId starting at a
+// random position seek inside the slot and wrapping around to the start of
+// the slot. If volatile is true only keys with a ttl are returned.
+func (bdb *BitsDB) SampleMetaKeys(slotId uint32, seek []byte, count int, volatile bool) []EvictCandidate {
+	var slotIdPrefix [2]byte
+	binary.LittleEndian.PutUint16(slotIdPrefix[:], uint16(slotId))
+	seekKey := make([]byte, 0, len(slotIdPrefix)+len(seek))
+	seekKey = append(append(seekKey, slotIdPrefix[:]...), seek...)
+
+	mkv := base.GetMkvFromPool()
+	defer base.PutMkvToPool(mkv)
+
+	it := bdb.baseDb.DB.NewIteratorMeta(&bitskv.IterOptions{SlotId: slotId})
+	defer it.Close()
+
+	candidates := make([]EvictCandidate, 0, count)
+	collect := func(stop []byte) {
+		for ; it.Valid() && it.ValidForPrefix(slotIdPrefix[:]) && len(candidates) < count; it.Next() {
+			if stop != nil && bytes.Compare(it.RawKey(), stop) >= 0 {
+				return
+			}
+			mkv.Reset(0)
+			if err := base.DecodeMetaValue(mkv, it.RawValue()); err != nil || !mkv.IsAlive() {
+				continue
+			}
+			if volatile && mkv.Timestamp() == 0 {
+				continue
+			}
+			key, err := base.DecodeMetaKey(it.Key())
+			if err != nil {
+				continue
+			}
+			khash := hash.Fnv32(key)
+			if uint32(utils.GetSlotId(khash)) != slotId {
+				khash = utils.GetHashTagFnv(key)
+			}
+			candidates = append(candidates, EvictCandidate{Key: key, KeyHash: khash, ExpireMs: mkv.Timestamp()})
+		}
+	}
+
+	it.Seek(seekKey)
+	collect(nil)
+	if len(candidates) < count && len(seek) > 0 {
+		it.Seek(slotIdPrefix[:])
+		collect(seekKey)
+	}
+	return candidates
+}
+
+// SampleExpireKeys returns up to count alive keys with the nearest expire
+// time from the expire db. Only non-string keys are recorded there.
+func (bdb *BitsDB) SampleExpireKeys(count int) []EvictCandidate {
+	var nowTimeBuf [8]byte
+	binary.BigEndian.PutUint64(nowTimeBuf[:], uint64(tclock.GetTimestampMilli())+1)
+
+	it := bdb.baseDb.DB.NewIteratorExpire(&bitskv.IterOptions{IsAll: true})
+	defer it.Close()
+
+	candidates := make([]EvictCandidate, 0, count)
+	for it.Seek(nowTimeBuf[:]); it.Valid() && len(candidates) < count; it.Next() {
+		timestamp, _, _, _, key, err := base.DecodeExpireKey(it.Key())
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, EvictCandidate{Key: key, KeyHash: hash.Fnv32(key), ExpireMs: timestamp})
+	}
+	return candidates
+}
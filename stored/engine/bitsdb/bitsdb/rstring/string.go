@@ -66,7 +66,7 @@ func (so *StringObject) incr(key []byte, khash uint32, delta int64) (int64, erro
 	}
 
 	n += delta
-	return n, so.setValueForString(ek, extend.FormatInt64ToSlice(n), timestamp)
+	return n, so.setValueCountForString(ek, extend.FormatInt64ToSlice(n), timestamp, val == nil)
 }
 
 func (so *StringObject) incrFloat(key []byte, khash uint32, delta float64) (float64, error) {
@@ -92,7 +92,7 @@ func (so *StringObject) incrFloat(key []byte, khash uint32, delta float64) (floa
 	}
 
 	f, _ := decimal.NewFromFloat(n).Add(decimal.NewFromFloat(delta)).Float64()
-	return f, so.setValueForString(ek, []byte(strconv.FormatFloat(f, 'f', -1, 64)), timestamp)
+	return f, so.setValueCountForString(ek, []byte(strconv.FormatFloat(f, 'f', -1, 64)), timestamp, val == nil)
 }
 
 func (so *StringObject) getValueForString(key []byte) ([]byte, uint64, func(), error) {
@@ -133,6 +133,18 @@ func (so *StringObject) setValueForString(ek, value []byte, timestamp uint64) (e
 	return so.SetMetaDataByValues(ek, vlen, metaValue[:], value)
 }
 
+// setValueCountForString writes value and adds ek to the slot key counts if
+// the write created the key.
+func (so *StringObject) setValueCountForString(ek, value []byte, timestamp uint64, created bool) error {
+	if err := so.setValueForString(ek, value, timestamp); err != nil {
+		return err
+	}
+	if created {
+		so.BaseDb.CountKey(ek, 1)
+	}
+	return nil
+}
+
 func (so *StringObject) setMultiValueForString(ek, oldValue, value []byte, timestamp uint64) (err error) {
 	var metaValue [base.MetaStringValueLen]byte
 	base.EncodeMetaDbValueForString(metaValue[:], timestamp)
@@ -93,6 +93,7 @@ func (so *StringObject) SetBit(key []byte, khash uint32, offset int, on int) (in
 		}
 	}()
 
+	created := rb.GetCardinality() == 0
 	ret, changed := existFunc(rb)
 	if changed {
 		ek, ekCloser := base.EncodeMetaKey(key, khash)
@@ -101,13 +102,14 @@ func (so *StringObject) SetBit(key []byte, khash uint32, offset int, on int) (in
 			if err = so.BaseDb.DeleteMetaKey(ek); err != nil {
 				return 0, err
 			}
+			so.BaseDb.CountKey(ek, -1)
 		} else {
 			value, err := rb.MarshalBinary()
 			if err != nil {
 				return 0, errn.ErrBitMarshal
 			}
 
-			if err = so.setValueForString(ek, value, timestamp); err != nil {
+			if err = so.setValueCountForString(ek, value, timestamp, created); err != nil {
 				return 0, err
 			}
 		}
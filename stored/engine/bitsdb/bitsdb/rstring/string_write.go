@@ -61,7 +61,7 @@ func (so *StringObject) GetSet(key []byte, khash uint32, value []byte) ([]byte,
 		return nil, nil, err
 	}
 
-	return oldValue, getCloser, so.setValueForString(ek, value, 0)
+	return oldValue, getCloser, so.setValueCountForString(ek, value, 0, oldValue == nil)
 }
 
 func (so *StringObject) MSet(khash uint32, args ...btools.KVPair) (err error) {
@@ -102,7 +102,8 @@ func (so *StringObject) Set(key []byte, khash uint32, value []byte) error {
 	ek, ekcloser := base.EncodeMetaKey(key, khash)
 	defer ekcloser()
 
-	return so.setValueForString(ek, value, 0)
+	created := so.BaseDb.HasKeyCounter() && !so.BaseDb.IsKeyAlive(ek)
+	return so.setValueCountForString(ek, value, 0, created)
 }
 
 func (so *StringObject) SetNX(key []byte, khash uint32, value []byte) (int64, error) {
@@ -127,7 +128,7 @@ func (so *StringObject) SetNX(key []byte, khash uint32, value []byte) (int64, er
 		return 0, err
 	}
 
-	return 1, so.setValueForString(ek, value, 0)
+	return 1, so.setValueCountForString(ek, value, 0, true)
 }
 
 func (so *StringObject) SetEX(key []byte, khash uint32, duration int64, value []byte, p bool) error {
@@ -152,7 +153,8 @@ func (so *StringObject) SetEX(key []byte, khash uint32, duration int64, value []
 		timestamp = uint64(tclock.SetExpireAtMilli(duration))
 	}
 
-	if err := so.setValueForString(ek, value, timestamp); err != nil {
+	created := so.BaseDb.HasKeyCounter() && !so.BaseDb.IsKeyAlive(ek)
+	if err := so.setValueCountForString(ek, value, timestamp, created); err != nil {
 		return err
 	}
 
@@ -190,7 +192,7 @@ func (so *StringObject) SetNXEX(key []byte, khash uint32, duration int64, value
 		newTtl = uint64(tclock.SetExpireAtMilli(duration))
 	}
 
-	if err = so.setValueForString(ek, value, newTtl); err != nil {
+	if err = so.setValueCountForString(ek, value, newTtl, true); err != nil {
 		return 0, err
 	}
 
@@ -223,13 +225,14 @@ func (so *StringObject) SetRange(key []byte, khash uint32, offset int, value []b
 		return 0, err
 	}
 
+	created := oldValue == nil
 	extra := offset + len(value) - len(oldValue)
 	if extra > 0 {
 		oldValue = append(oldValue, make([]byte, extra)...)
 	}
 	copy(oldValue[offset:], value)
 
-	if err = so.setValueForString(ek, oldValue, timestamp); err != nil {
+	if err = so.setValueCountForString(ek, oldValue, timestamp, created); err != nil {
 		return 0, err
 	}
 
@@ -267,6 +270,9 @@ func (so *StringObject) Append(key []byte, khash uint32, value []byte) (int64, e
 	if err = so.setMultiValueForString(ek, oldValue, value, timestamp); err != nil {
 		return 0, nil
 	}
+	if oldValue == nil {
+		so.BaseDb.CountKey(ek, 1)
+	}
 
 	return int64(valueLen), nil
 }
@@ -0,0 +1,311 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitsdb
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/zuoyebang/bitalostored/butils/hash"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb/base"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitskv"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
+	"github.com/zuoyebang/bitalostored/stored/internal/utils"
+)
+
+// A slot dump carries the raw records of a slot between nodes. Every key is
+// encoded as
+//
+//	key | meta value | (tag | record suffix | record value)... | slotDumpTagEnd
+//
+// with uvarint length prefixes. Data and index records drop the slot id and
+// version header, the loader rebuilds it with a version of its own so that
+// loaded keys can not collide with keys already written on the target.
+const (
+	slotDumpTagEnd byte = iota
+	slotDumpTagData
+	slotDumpTagIndex
+)
+
+// SlotDumpMaxKeySize is the largest collection dumped raw, bigger keys are
+// left to the caller to replay.
+const SlotDumpMaxKeySize = 10000
+
+var errSlotDumpCorrupt = errors.New("slot dump corrupt")
+
+func (bdb *BitsDB) slotDumpObject(dt btools.DataType) *base.BaseObject {
+	switch dt {
+	case btools.HASH:
+		return &bdb.HashObj.BaseObject
+	case btools.SET:
+		return &bdb.SetObj.BaseObject
+	case btools.LIST:
+		return &bdb.ListObj.BaseObject
+	case btools.ZSET:
+		return &bdb.ZsetObj.BaseObject
+	default:
+		return nil
+	}
+}
+
+func slotKeyHash(key []byte, slotId uint32) uint32 {
+	khash := hash.Fnv32(key)
+	if uint32(utils.GetSlotId(khash)) != slotId {
+		khash = utils.GetHashTagFnv(key)
+	}
+	return khash
+}
+
+func appendSlotDumpBytes(dump []byte, b []byte) []byte {
+	dump = binary.AppendUvarint(dump, uint64(len(b)))
+	return append(dump, b...)
+}
+
+func readSlotDumpBytes(dump []byte) ([]byte, []byte, error) {
+	n, l := binary.Uvarint(dump)
+	if l <= 0 || uint64(len(dump)-l) < n {
+		return nil, nil, errSlotDumpCorrupt
+	}
+	return dump[l : l+int(n)], dump[l+int(n):], nil
+}
+
+func appendSlotDumpRecords(dump []byte, tag byte, db *bitskv.DB, slotId uint32, version uint64, index bool) []byte {
+	var header [base.DataKeyHeaderLength]byte
+	base.PutDataKeyHeader(header[:], version, slotId)
+
+	iterOpts := &bitskv.IterOptions{SlotId: slotId}
+	var it *bitskv.Iterator
+	if index {
+		it = db.NewIteratorIndex(iterOpts)
+	} else {
+		it = db.NewIterator(iterOpts)
+	}
+	defer it.Close()
+
+	for it.Seek(header[:]); it.Valid() && it.ValidForPrefix(header[:]); it.Next() {
+		dump = append(dump, tag)
+		dump = appendSlotDumpBytes(dump, it.RawKey()[base.DataKeyHeaderLength:])
+		dump = appendSlotDumpBytes(dump, it.RawValue())
+	}
+	return dump
+}
+
+// DumpSlot encodes the alive keys of slotId starting at the meta key cursor
+// until the dump grows past maxBytes. It returns the cursor of the next call,
+// nil once the slot is exhausted. Keys that can not be dumped raw, old format
+// zsets and collections above SlotDumpMaxKeySize, are returned in skipped.
+func (bdb *BitsDB) DumpSlot(
+	slotId uint32, cursor []byte, maxBytes int,
+) (dump []byte, keys int, next []byte, skipped [][]byte, err error) {
+	var slotIdPrefix [2]byte
+	binary.LittleEndian.PutUint16(slotIdPrefix[:], uint16(slotId))
+	if len(cursor) == 0 {
+		cursor = slotIdPrefix[:]
+	}
+
+	mkv := base.GetMkvFromPool()
+	defer base.PutMkvToPool(mkv)
+
+	it := bdb.baseDb.DB.NewIteratorMeta(&bitskv.IterOptions{SlotId: slotId})
+	defer it.Close()
+
+	for it.Seek(cursor); it.Valid() && it.ValidForPrefix(slotIdPrefix[:]); it.Next() {
+		if len(dump) >= maxBytes {
+			return dump, keys, it.Key(), skipped, nil
+		}
+
+		mkv.Reset(0)
+		if err = base.DecodeMetaValue(mkv, it.RawValue()); err != nil {
+			return nil, 0, nil, nil, err
+		}
+		if !mkv.IsAlive() {
+			continue
+		}
+		var key []byte
+		if key, err = base.DecodeMetaKey(it.Key()); err != nil {
+			return nil, 0, nil, nil, err
+		}
+
+		dt := mkv.GetDataType()
+		obj := bdb.slotDumpObject(dt)
+		if dt != btools.STRING && (obj == nil || mkv.Size() > SlotDumpMaxKeySize) {
+			skipped = append(skipped, key)
+			continue
+		}
+
+		dump = appendSlotDumpBytes(dump, key)
+		dump = appendSlotDumpBytes(dump, it.RawValue())
+		if obj != nil {
+			dump = appendSlotDumpRecords(dump, slotDumpTagData, obj.DataDb, slotId, mkv.Version(), false)
+			if dt == btools.ZSET {
+				dump = appendSlotDumpRecords(dump, slotDumpTagIndex, obj.DataDb, slotId, mkv.Version(), true)
+			}
+		}
+		dump = append(dump, slotDumpTagEnd)
+		keys++
+	}
+
+	return dump, keys, nil, skipped, nil
+}
+
+// LoadSlotDump writes the keys of a dump produced by DumpSlot into slotId.
+// Keys that are alive locally are newer than the dump and are kept.
+func (bdb *BitsDB) LoadSlotDump(slotId uint32, dump []byte) (loaded int, err error) {
+	for len(dump) > 0 {
+		var key, meta []byte
+		if key, dump, err = readSlotDumpBytes(dump); err != nil {
+			return loaded, err
+		}
+		if meta, dump, err = readSlotDumpBytes(dump); err != nil {
+			return loaded, err
+		}
+
+		var records []byte
+		records, dump, err = splitSlotDumpRecords(dump)
+		if err != nil {
+			return loaded, err
+		}
+
+		ok, err := bdb.loadSlotDumpKey(slotId, key, meta, records)
+		if err != nil {
+			return loaded, err
+		}
+		if ok {
+			loaded++
+		}
+	}
+	return loaded, nil
+}
+
+func splitSlotDumpRecords(dump []byte) ([]byte, []byte, error) {
+	rest := dump
+	for {
+		if len(rest) == 0 {
+			return nil, nil, errSlotDumpCorrupt
+		}
+		tag := rest[0]
+		rest = rest[1:]
+		if tag == slotDumpTagEnd {
+			return dump[:len(dump)-len(rest)-1], rest, nil
+		}
+		var err error
+		for i := 0; i < 2; i++ {
+			if _, rest, err = readSlotDumpBytes(rest); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+}
+
+func (bdb *BitsDB) loadSlotDumpKey(slotId uint32, key, meta, records []byte) (bool, error) {
+	khash := slotKeyHash(key, slotId)
+	unlockKey := bdb.StringObj.LockKey(khash)
+	defer unlockKey()
+
+	mk, mkCloser := base.EncodeMetaKey(key, khash)
+	defer mkCloser()
+	mkv, err := bdb.baseDb.BaseGetMetaWithoutValue(mk)
+	if err != nil {
+		return false, err
+	}
+	defer base.PutMkvToPool(mkv)
+	if mkv.IsAlive() {
+		return false, nil
+	}
+
+	mkv.Reset(0)
+	if err = base.DecodeMetaValue(mkv, meta); err != nil {
+		return false, err
+	}
+	if !mkv.IsAlive() {
+		return false, nil
+	}
+
+	dt := mkv.GetDataType()
+	if dt == btools.STRING {
+		if err = bdb.baseDb.SetMetaDataByValues(mk, len(meta), meta); err != nil {
+			return false, err
+		}
+		bdb.baseDb.CountKey(mk, 1)
+		return true, nil
+	}
+
+	obj := bdb.slotDumpObject(dt)
+	if obj == nil {
+		return false, errSlotDumpCorrupt
+	}
+	_, kind := base.DecodeKeyVersion(mkv.Version())
+	version := base.EncodeKeyVersion(obj.GetNextKeyId(), kind)
+	meta = append([]byte(nil), meta...)
+	if err = base.SetMetaValueVersion(meta, version); err != nil {
+		return false, err
+	}
+
+	dataWb := obj.GetDataWriteBatchFromPool()
+	defer obj.PutWriteBatchToPool(dataWb)
+	var indexWb *bitskv.WriteBatch
+	if dt == btools.ZSET {
+		indexWb = obj.GetIndexWriteBatchFromPool()
+		defer obj.PutWriteBatchToPool(indexWb)
+	}
+
+	var suffix, value []byte
+	for len(records) > 0 {
+		tag := records[0]
+		if suffix, records, err = readSlotDumpBytes(records[1:]); err != nil {
+			return false, err
+		}
+		if value, records, err = readSlotDumpBytes(records); err != nil {
+			return false, err
+		}
+		ek := make([]byte, base.DataKeyHeaderLength+len(suffix))
+		base.PutDataKeyHeader(ek, version, khash)
+		copy(ek[base.DataKeyHeaderLength:], suffix)
+		switch {
+		case tag == slotDumpTagData:
+			_ = dataWb.Put(ek, value)
+		case tag == slotDumpTagIndex && indexWb != nil:
+			_ = indexWb.Put(ek, value)
+		default:
+			return false, errSlotDumpCorrupt
+		}
+	}
+	if err = dataWb.Commit(); err != nil {
+		return false, err
+	}
+	if indexWb != nil {
+		if err = indexWb.Commit(); err != nil {
+			return false, err
+		}
+	}
+
+	if mkv.Timestamp() > 0 {
+		if err = base.DecodeMetaValue(mkv, meta); err != nil {
+			return false, err
+		}
+		ek, ekCloser := base.EncodeExpireKey(key, mkv)
+		err = obj.UpdateExpire(nil, ek)
+		ekCloser()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err = bdb.baseDb.SetMetaDataByValues(mk, len(meta), meta); err != nil {
+		return false, err
+	}
+	bdb.baseDb.CountKey(mk, 1)
+	return true, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitsdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
+	"github.com/zuoyebang/bitalostored/stored/internal/utils"
+)
+
+func TestSlotDumpLoad(t *testing.T) {
+	cores := testTwoBitsCores()
+	defer closeCores(cores)
+	src, dst := cores[0].db, cores[1].db
+
+	keyHash := func(key string) uint32 { return utils.GetHashTagFnv([]byte(key)) }
+	strKey, hashKey, setKey := []byte("{slotdump}str"), []byte("{slotdump}hash"), []byte("{slotdump}set")
+	listKey, zsetKey, keepKey := []byte("{slotdump}list"), []byte("{slotdump}zset"), []byte("{slotdump}keep")
+	slotId := uint32(utils.GetSlotId(keyHash(string(strKey))))
+
+	require.NoError(t, src.StringObj.Set(strKey, keyHash(string(strKey)), []byte("v")))
+	require.NoError(t, src.StringObj.Set(keepKey, keyHash(string(keepKey)), []byte("old")))
+	require.NoError(t, src.HashObj.HMset(hashKey, keyHash(string(hashKey)),
+		btools.FVPair{Field: []byte("f1"), Value: []byte("v1")},
+		btools.FVPair{Field: []byte("f2"), Value: []byte("v2")}))
+	_, err := src.SetObj.SAdd(setKey, keyHash(string(setKey)), []byte("m1"), []byte("m2"))
+	require.NoError(t, err)
+	_, err = src.ListObj.RPush(listKey, keyHash(string(listKey)), []byte("a"), []byte("b"), []byte("c"))
+	require.NoError(t, err)
+	_, err = src.ZsetObj.ZAdd(zsetKey, keyHash(string(zsetKey)), false,
+		btools.ScorePair{Score: 1, Member: []byte("z1")}, btools.ScorePair{Score: 2, Member: []byte("z2")})
+	require.NoError(t, err)
+	_, err = src.StringObj.Expire(hashKey, keyHash(string(hashKey)), 100)
+	require.NoError(t, err)
+
+	require.NoError(t, dst.StringObj.Set(keepKey, keyHash(string(keepKey)), []byte("new")))
+	require.NoError(t, dst.HashObj.HMset([]byte("{slotdump}other"), keyHash("{slotdump}other"),
+		btools.FVPair{Field: []byte("x"), Value: []byte("y")}))
+
+	var cursor []byte
+	var dumped, loaded int
+	for {
+		dump, keys, next, skipped, err := src.DumpSlot(slotId, cursor, 64)
+		require.NoError(t, err)
+		require.Equal(t, 0, len(skipped))
+		n, err := dst.LoadSlotDump(slotId, dump)
+		require.NoError(t, err)
+		dumped += keys
+		loaded += n
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	require.Equal(t, 6, dumped)
+	require.Equal(t, 5, loaded)
+
+	val, closer, err := dst.StringObj.Get(strKey, keyHash(string(strKey)))
+	require.NoError(t, err)
+	require.Equal(t, []byte("v"), val)
+	closer()
+	val, closer, err = dst.StringObj.Get(keepKey, keyHash(string(keepKey)))
+	require.NoError(t, err)
+	require.Equal(t, []byte("new"), val)
+	closer()
+
+	val, closer, err = dst.HashObj.HGet(hashKey, keyHash(string(hashKey)), []byte("f2"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("v2"), val)
+	closer()
+	ttl, err := dst.StringObj.PTTL(hashKey, keyHash(string(hashKey)))
+	require.NoError(t, err)
+	require.True(t, ttl > 0 && ttl <= 100000)
+	val, closer, err = dst.HashObj.HGet([]byte("{slotdump}other"), keyHash("{slotdump}other"), []byte("x"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("y"), val)
+	closer()
+
+	members, err := dst.SetObj.SMembers(setKey, keyHash(string(setKey)))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(members))
+	items, err := dst.ListObj.LRange(listKey, keyHash(string(listKey)), 0, -1)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, items)
+	pairs, err := dst.ZsetObj.ZRange(zsetKey, keyHash(string(zsetKey)), 0, -1)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(pairs))
+	require.Equal(t, []byte("z2"), pairs[1].Member)
+	score, err := dst.ZsetObj.ZScore(zsetKey, keyHash(string(zsetKey)), []byte("z1"))
+	require.NoError(t, err)
+	require.Equal(t, float64(1), score)
+}
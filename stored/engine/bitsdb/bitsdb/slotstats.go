@@ -0,0 +1,60 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitsdb
+
+import (
+	"encoding/binary"
+
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb/base"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitskv"
+)
+
+// slotStatsItemPayload is the assumed payload of a collection element, the
+// scan reads meta records only and does not sample element sizes.
+const slotStatsItemPayload = 32
+
+// SlotKeyStats counts the alive keys of slotId and estimates their size from
+// the meta records. Strings are stored in the meta record, collections add
+// their element count multiplied by an assumed element size.
+func (bdb *BitsDB) SlotKeyStats(slotId uint32) (keys int64, size int64) {
+	var slotIdPrefix [2]byte
+	binary.LittleEndian.PutUint16(slotIdPrefix[:], uint16(slotId))
+
+	mkv := base.GetMkvFromPool()
+	defer base.PutMkvToPool(mkv)
+
+	it := bdb.baseDb.DB.NewIteratorMeta(&bitskv.IterOptions{SlotId: slotId})
+	defer it.Close()
+
+	for it.Seek(slotIdPrefix[:]); it.Valid() && it.ValidForPrefix(slotIdPrefix[:]); it.Next() {
+		mkv.Reset(0)
+		value := it.RawValue()
+		if err := base.DecodeMetaValue(mkv, value); err != nil || !mkv.IsAlive() {
+			continue
+		}
+		keys++
+		size += int64(len(it.RawKey()) + len(value))
+		if n := mkv.Size(); n > 0 {
+			size += n * int64(base.DataKeyHeaderLength+slotStatsItemPayload)
+		}
+	}
+	return keys, size
+}
+
+// SetKeyCounter installs fn to receive the keys created and deleted by writes
+// per slot, see base.KeyCounter.
+func (bdb *BitsDB) SetKeyCounter(fn func(slotId uint16, delta int64)) {
+	bdb.baseDb.SetKeyCounter(fn)
+}
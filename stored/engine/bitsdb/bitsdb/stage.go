@@ -0,0 +1,112 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitsdb
+
+import (
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb/base"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
+)
+
+// SwitchStageKey replaces key with the collection built under stage by a
+// chunked migration. Both names share khash, so the data records written
+// under the staged version belong to key as soon as its meta points at them.
+// It returns false if stage does not hold a live collection of size members,
+// a negative size skips that check.
+func (bdb *BitsDB) SwitchStageKey(stage, key []byte, khash uint32, size int64) (bool, error) {
+	unlockKey := bdb.StringObj.LockKey(khash)
+	defer unlockKey()
+
+	smk, smkCloser := base.EncodeMetaKey(stage, khash)
+	defer smkCloser()
+	val, valCloser, err := bdb.baseDb.GetMeta(smk)
+	if err != nil || len(val) == 0 {
+		return false, err
+	}
+	meta := append([]byte(nil), val...)
+	if valCloser != nil {
+		valCloser()
+	}
+
+	smkv := base.GetMkvFromPool()
+	defer base.PutMkvToPool(smkv)
+	if err = base.DecodeMetaValue(smkv, meta); err != nil {
+		return false, err
+	}
+	if !smkv.IsAlive() || smkv.GetDataType() == btools.STRING || (size >= 0 && smkv.Size() != size) {
+		return false, nil
+	}
+
+	mk, mkCloser := base.EncodeMetaKey(key, khash)
+	defer mkCloser()
+	mkv, err := bdb.baseDb.BaseGetMetaWithoutValue(mk)
+	if err != nil {
+		return false, err
+	}
+	defer base.PutMkvToPool(mkv)
+	replaced := mkv.IsAlive()
+	if replaced {
+		if mkv.GetDataType() == btools.STRING {
+			_, _ = bdb.baseDb.ClearBitmap(key, true)
+		} else {
+			oldEk, oekCloser := base.EncodeExpireKey(key, mkv)
+			mkv.Del()
+			newEk, nekCloser := base.EncodeExpireKey(key, mkv)
+			err = bdb.StringObj.UpdateExpire(oldEk, newEk)
+			oekCloser()
+			nekCloser()
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if smkv.Timestamp() > 0 {
+		sek, sekCloser := base.EncodeExpireKey(stage, smkv)
+		ek, ekCloser := base.EncodeExpireKey(key, smkv)
+		err = bdb.StringObj.UpdateExpire(sek, ek)
+		sekCloser()
+		ekCloser()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	wb := bdb.baseDb.DB.GetMetaWriteBatchFromPool()
+	defer bdb.baseDb.DB.PutWriteBatchToPool(wb)
+	_ = wb.Put(mk, meta)
+	_ = wb.Delete(smk)
+	if err = wb.Commit(); err != nil {
+		return false, err
+	}
+	if bdb.baseDb.MetaCache != nil {
+		bdb.baseDb.MetaCache.RePut(mk, meta)
+		bdb.baseDb.MetaCache.Delete(smk)
+	}
+	if replaced {
+		bdb.baseDb.CountKey(mk, -1)
+	}
+	return true, nil
+}
+
+// KeyVersion returns the version and size of a live key, zero if it does not
+// exist.
+func (bdb *BitsDB) KeyVersion(key []byte, khash uint32) (uint64, int64, error) {
+	mkv, err := bdb.baseDb.BaseGetMetaDataCheckAlive(key, khash)
+	if mkv == nil {
+		return 0, 0, err
+	}
+	defer base.PutMkvToPool(mkv)
+	return mkv.Version(), mkv.Size(), nil
+}
@@ -234,6 +234,7 @@ func (zo *ZSetObject) ZIncrBy(key []byte, khash uint32, isOld bool, delta float6
 	} else if updateCache != nil {
 		updateCache()
 	}
+	zo.BaseDb.CountKeyChange(mk, mkv)
 
 	return newScore, nil
 }
@@ -16,6 +16,7 @@ package btools
 
 import (
 	"math"
+	"sync/atomic"
 
 	"github.com/zuoyebang/bitalostored/butils/numeric"
 	"github.com/zuoyebang/bitalostored/stored/internal/config"
@@ -25,15 +26,19 @@ const (
 	DefaultScanCount   int    = 10
 	LuaScriptSlot      uint16 = 2048
 	ConfigMaxFieldSize int    = 60 << 10
+
+	DefaultMaxIOWriteLoadQPS uint64 = 20000
 )
 
 var (
-	MaxKeySize               = 512
-	MaxFieldSize             = 10 << 10
-	MaxValueSize             = 6 << 20
-	MaxIOWriteLoadQPS uint64 = 20000
-	MaxScoreByte             = numeric.Float64ToByteSort(math.MaxFloat64, nil)
-	ScanEndCurosr            = []byte("0")
+	MaxKeySize    = 512
+	MaxFieldSize  = 10 << 10
+	MaxValueSize  = 6 << 20
+	MaxScoreByte  = numeric.Float64ToByteSort(math.MaxFloat64, nil)
+	ScanEndCurosr = []byte("0")
+
+	// MaxIOWriteLoadQPS is changed by CONFIG SET while writes read it.
+	MaxIOWriteLoadQPS atomic.Uint64
 )
 
 func SetDefineVarFromCfg() {
@@ -50,6 +55,10 @@ func SetDefineVarFromCfg() {
 	}
 
 	if config.GlobalConfig.Bitalos.IOWriteLoadQpsThreshold > 0 {
-		MaxIOWriteLoadQPS = config.GlobalConfig.Bitalos.IOWriteLoadQpsThreshold
+		MaxIOWriteLoadQPS.Store(config.GlobalConfig.Bitalos.IOWriteLoadQpsThreshold)
 	}
 }
+
+func init() {
+	MaxIOWriteLoadQPS.Store(DefaultMaxIOWriteLoadQPS)
+}
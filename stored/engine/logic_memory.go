@@ -0,0 +1,196 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb/base"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
+)
+
+const memoryUsageScanCount = 100
+
+// MemoryUsage estimates the bytes key occupies on disk and in the bitmap
+// cache: the encoded meta record plus the element count multiplied by the
+// average encoded size of up to samples elements (all elements if samples
+// is 0). It returns -1 if the key does not exist.
+func (b *Bitalos) MemoryUsage(key []byte, khash uint32, samples int) (int64, error) {
+	if err := btools.CheckKeySize(key); err != nil {
+		return 0, err
+	}
+
+	metaKeySize := int64(base.EncodeMetaKeySize(key))
+
+	var bitmapSize int64
+	if bi, ok := b.bitsdb.StringObj.BaseDb.BitmapMem.Get(key); ok && !bi.Expired() {
+		bitmapSize = int64(bi.SizeInBytes())
+	}
+
+	dt, err := b.Type(key, khash)
+	if err != nil {
+		return 0, err
+	}
+
+	switch dt {
+	case btools.StringName:
+		n, err := b.StrLen(key, khash)
+		if err != nil {
+			return 0, err
+		}
+		return metaKeySize + int64(base.MetaStringValueLen) + n + bitmapSize, nil
+	case btools.HashName:
+		n, err := b.HLen(key, khash)
+		if err != nil {
+			return 0, err
+		}
+		sampled, size, err := b.sampleHash(key, khash, samples)
+		if err != nil {
+			return 0, err
+		}
+		return metaKeySize + int64(base.MetaMixValueLen) + extrapolate(n, sampled, size, base.DataKeyHeaderLength), nil
+	case btools.SetName:
+		n, err := b.SCard(key, khash)
+		if err != nil {
+			return 0, err
+		}
+		sampled, size, err := b.sampleSet(key, khash, samples)
+		if err != nil {
+			return 0, err
+		}
+		return metaKeySize + int64(base.MetaMixValueLen) + extrapolate(n, sampled, size, base.DataKeyHeaderLength+len(base.NilDataVal)), nil
+	case btools.ZSetName:
+		n, err := b.ZCard(key, khash)
+		if err != nil {
+			return 0, err
+		}
+		sampled, size, err := b.sampleZSet(key, khash, samples)
+		if err != nil {
+			return 0, err
+		}
+		// every member is stored twice: md5(member) -> score+member and score+member -> nil
+		perItem := base.DataKeyZsetLength + base.ScoreLength + base.IndexKeyScoreLength + len(base.NilDataVal)
+		return metaKeySize + int64(base.MetaMixValueLen) + extrapolate(n, sampled, 2*size, perItem), nil
+	case btools.ListName:
+		n, err := b.LLen(key, khash)
+		if err != nil {
+			return 0, err
+		}
+		sampled, size, err := b.sampleList(key, khash, n, samples)
+		if err != nil {
+			return 0, err
+		}
+		return metaKeySize + int64(base.MetaListValueLen) + extrapolate(n, sampled, size, base.DataKeyListIndex), nil
+	default:
+		if bitmapSize > 0 {
+			return metaKeySize + int64(base.MetaStringValueLen) + bitmapSize, nil
+		}
+		return -1, nil
+	}
+}
+
+// extrapolate scales the sampled payload size to count elements and adds
+// the fixed encoding overhead of every element.
+func extrapolate(count, sampled, size int64, perItem int) int64 {
+	if count <= 0 {
+		return 0
+	}
+	total := count * int64(perItem)
+	if sampled > 0 {
+		total += size * count / sampled
+	}
+	return total
+}
+
+func sampleLimit(samples int) int {
+	if samples <= 0 || samples > memoryUsageScanCount {
+		return memoryUsageScanCount
+	}
+	return samples
+}
+
+func (b *Bitalos) sampleHash(key []byte, khash uint32, samples int) (sampled, size int64, err error) {
+	var cursor []byte
+	for {
+		var items []btools.FVPair
+		cursor, items, err = b.HScan(key, khash, cursor, sampleLimit(samples-int(sampled)), "")
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, it := range items {
+			size += int64(len(it.Field) + len(it.Value))
+		}
+		sampled += int64(len(items))
+		if len(items) == 0 || bytes.Equal(cursor, btools.ScanEndCurosr) || (samples > 0 && sampled >= int64(samples)) {
+			return sampled, size, nil
+		}
+	}
+}
+
+func (b *Bitalos) sampleSet(key []byte, khash uint32, samples int) (sampled, size int64, err error) {
+	var cursor []byte
+	for {
+		var members [][]byte
+		cursor, members, err = b.SScan(key, khash, cursor, sampleLimit(samples-int(sampled)), "")
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, m := range members {
+			size += int64(len(m))
+		}
+		sampled += int64(len(members))
+		if len(members) == 0 || bytes.Equal(cursor, btools.ScanEndCurosr) || (samples > 0 && sampled >= int64(samples)) {
+			return sampled, size, nil
+		}
+	}
+}
+
+func (b *Bitalos) sampleZSet(key []byte, khash uint32, samples int) (sampled, size int64, err error) {
+	var cursor []byte
+	for {
+		var pairs []btools.ScorePair
+		cursor, pairs, err = b.ZScan(key, khash, cursor, sampleLimit(samples-int(sampled)), "")
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, p := range pairs {
+			size += int64(len(p.Member))
+		}
+		sampled += int64(len(pairs))
+		if len(pairs) == 0 || bytes.Equal(cursor, btools.ScanEndCurosr) || (samples > 0 && sampled >= int64(samples)) {
+			return sampled, size, nil
+		}
+	}
+}
+
+func (b *Bitalos) sampleList(key []byte, khash uint32, n int64, samples int) (sampled, size int64, err error) {
+	for start := int64(0); start < n; {
+		stop := start + int64(sampleLimit(samples-int(sampled))) - 1
+		var values [][]byte
+		values, err = b.LRange(key, khash, start, stop)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, v := range values {
+			size += int64(len(v))
+		}
+		sampled += int64(len(values))
+		if len(values) == 0 || (samples > 0 && sampled >= int64(samples)) {
+			break
+		}
+		start = stop + 1
+	}
+	return sampled, size, nil
+}
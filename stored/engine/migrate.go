@@ -16,8 +16,10 @@ package engine
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"runtime/debug"
 	"sync"
 	"sync/atomic"
@@ -29,6 +31,7 @@ import (
 	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb"
 	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb/locker"
 	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
 	"github.com/zuoyebang/bitalostored/stored/internal/errn"
 	"github.com/zuoyebang/bitalostored/stored/internal/log"
 	"github.com/zuoyebang/bitalostored/stored/internal/resp"
@@ -39,10 +42,12 @@ import (
 var MigrateLuaScript = "redis.call(KEYS)"
 
 const (
-	MigrateStatusPrepare = 0
-	MigrateStatusProcess = 1
-	MigrateStatusFinish  = 2
-	MigrateStatusError   = 3
+	MigrateStatusPrepare  = 0
+	MigrateStatusProcess  = 1
+	MigrateStatusFinish   = 2
+	MigrateStatusError    = 3
+	MigrateStatusCancel   = 4
+	MigrateStatusRollback = 5
 )
 
 type Migrate struct {
@@ -60,6 +65,33 @@ type Migrate struct {
 	fails             int64
 	beginTime         time.Time
 	endTime           time.Time
+
+	bulk    bool
+	retry   bool
+	copied  int64
+	dirtyMu sync.Mutex
+	dirty   map[string]struct{}
+	journal *os.File
+
+	paused   atomic.Bool
+	canceled atomic.Bool
+	runWg    sync.WaitGroup
+
+	stageMu sync.RWMutex
+	stages  map[string]*migrateStage
+
+	verifyMu   sync.Mutex
+	verified   int64
+	mismatches int64
+	failedKeys []migrateMismatch
+	repairKeys [][]byte
+
+	stateDir string
+	stateMu  sync.Mutex
+	over     atomic.Bool
+	phase    int
+	round    int
+	cursor   []byte
 }
 
 func (m *Migrate) migrateDirectTTL(key []byte, ttl int64, conn redis.Conn, isHashTag bool) error {
@@ -103,6 +135,14 @@ func (m *Migrate) getKeyHash(key []byte) (uint32, bool) {
 	return khash, isHashTag
 }
 
+// migrateKeyHash returns the hash a key of the slot is stored under.
+func migrateKeyHash(slotId uint32, key []byte) uint32 {
+	if khash := hash.Fnv32(key); khash%utils.TotalSlot == slotId {
+		return khash
+	}
+	return utils.GetHashTagFnv(key)
+}
+
 func (m *Migrate) migrateString(key []byte, conn redis.Conn) error {
 	if m.slotId == uint32(btools.LuaScriptSlot) {
 		val, closer := m.db.StringObj.GetLuaScript(key)
@@ -508,6 +548,22 @@ func (m *Migrate) migrateSet(key []byte, conn redis.Conn) error {
 	return nil
 }
 
+func (m *Migrate) migrateKey(key []byte, dataType btools.DataType, conn redis.Conn) error {
+	switch dataType {
+	case btools.STRING:
+		return m.migrateString(key, conn)
+	case btools.HASH:
+		return m.migrateHash(key, conn)
+	case btools.SET:
+		return m.migrateSet(key, conn)
+	case btools.LIST:
+		return m.migrateList(key, conn)
+	case btools.ZSET, btools.ZSETOLD:
+		return m.migrateZSet(key, conn)
+	}
+	return nil
+}
+
 func (m *Migrate) migrateRunTask(isMaster func() bool) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -518,7 +574,7 @@ func (m *Migrate) migrateRunTask(isMaster func() bool) (err error) {
 
 	var goros = 10
 	var limit = goros * 1000
-	var begin []byte
+	var begin = m.resumeCursor()
 	var list []btools.ScanPair
 	var wg sync.WaitGroup
 
@@ -538,29 +594,35 @@ func (m *Migrate) migrateRunTask(isMaster func() bool) (err error) {
 					err = errors.New("migrate error: server is not master")
 					return
 				}
-				conn := m.Conn.Get()
+				conn := m.getConn()
 				defer conn.Close()
 				for right := j + 1000; j < len(list) && j < right; j++ {
+					if e := m.waitRunnable(); e != nil {
+						err = e
+						return
+					}
+					migrateThrottleKeys(1)
+
 					key := list[j].Key
 					dataType := list[j].Dt
 					khash, _ := m.getKeyHash(key)
 
+					atomic.AddInt64(&m.total, 1)
+					if m.migrateChunked(key, dataType) {
+						if e := m.migrateChunkKey(key, dataType, conn); e != nil {
+							atomic.AddInt64(&m.fails, 1)
+						}
+						continue
+					}
+
 					func() {
 						defer m.keyLocker.LockKey(khash, resp.SET)()
 
 						var e error
-						atomic.AddInt64(&m.total, 1)
-						switch dataType {
-						case btools.STRING:
-							e = m.migrateString(key, conn)
-						case btools.HASH:
-							e = m.migrateHash(key, conn)
-						case btools.SET:
-							e = m.migrateSet(key, conn)
-						case btools.LIST:
-							e = m.migrateList(key, conn)
-						case btools.ZSET, btools.ZSETOLD:
-							e = m.migrateZSet(key, conn)
+						if m.bulk {
+							e = m.migrateBulkKey(key, dataType, conn)
+						} else {
+							e = m.migrateKey(key, dataType, conn)
 						}
 						if e != nil {
 							atomic.AddInt64(&m.fails, 1)
@@ -576,6 +638,7 @@ func (m *Migrate) migrateRunTask(isMaster func() bool) (err error) {
 		if len(list) < limit || bytes.Equal(begin, btools.ScanEndCurosr) {
 			break
 		}
+		m.checkpoint(migratePhaseScan, m.round, begin)
 	}
 	return nil
 }
@@ -609,9 +672,15 @@ func (m *Migrate) migrateRetryRunTask(isMaster func() bool) (err error) {
 					err = errors.New("migrateretry error: server is not master")
 					return
 				}
-				conn := m.Conn.Get()
+				conn := m.getConn()
 				defer conn.Close()
 				for right := j + 1000; j < len(list) && j < right; j++ {
+					if e := m.waitRunnable(); e != nil {
+						err = e
+						return
+					}
+					migrateThrottleKeys(1)
+
 					key := list[j].Key
 					dataType := list[j].Dt
 					khash, _ := m.getKeyHash(key)
@@ -654,6 +723,35 @@ func (m *Migrate) migrateRetryRunTask(isMaster func() bool) (err error) {
 	return nil
 }
 
+type MigrateStats struct {
+	SlotId uint32
+	Status int64
+	Paused bool
+	Bulk   bool
+	Copied int64
+	Total  int64
+	Fails  int64
+	Costs  time.Duration
+}
+
+func (m *Migrate) Stats() MigrateStats {
+	stats := MigrateStats{
+		SlotId: m.slotId,
+		Status: m.status,
+		Paused: m.paused.Load(),
+		Bulk:   m.bulk,
+		Copied: atomic.LoadInt64(&m.copied),
+		Total:  atomic.LoadInt64(&m.total),
+		Fails:  atomic.LoadInt64(&m.fails),
+	}
+	if stats.Status == MigrateStatusProcess {
+		stats.Costs = time.Since(m.beginTime)
+	} else {
+		stats.Costs = m.endTime.Sub(m.beginTime)
+	}
+	return stats
+}
+
 func (m *Migrate) Info() string {
 	buf := bytes.NewBuffer(make([]byte, 0, 1024))
 	fmt.Fprintf(buf, `{`)
@@ -663,43 +761,74 @@ func (m *Migrate) Info() string {
 	fmt.Fprintf(buf, `"to": "%s",`, m.toHost)
 	fmt.Fprintf(buf, `"slot_id": %d,`, m.slotId)
 	fmt.Fprintf(buf, `"status": %d,`, m.status)
-	fmt.Fprintf(buf, `"total": %d,`, m.total)
-	fmt.Fprintf(buf, `"fails": %d,`, m.fails)
+	fmt.Fprintf(buf, `"paused": %v,`, m.paused.Load())
+	fmt.Fprintf(buf, `"bulk": %v,`, m.bulk)
+	fmt.Fprintf(buf, `"copied": %d,`, atomic.LoadInt64(&m.copied))
+	fmt.Fprintf(buf, `"total": %d,`, atomic.LoadInt64(&m.total))
+	fmt.Fprintf(buf, `"fails": %d,`, atomic.LoadInt64(&m.fails))
+	verified, mismatches, failedKeys := m.migrateVerifyInfo()
+	fmt.Fprintf(buf, `"verified": %d,`, verified)
+	fmt.Fprintf(buf, `"mismatches": %d,`, mismatches)
+	if len(failedKeys) > 0 {
+		failed, _ := json.Marshal(failedKeys)
+		fmt.Fprintf(buf, `"failed_keys": %s,`, failed)
+	}
 	fmt.Fprintf(buf, `"nonce":""`)
 	fmt.Fprintf(buf, `}`)
 	return buf.String()
 }
 
-func (b *Bitalos) CheckRedirectAndLockFunc(cmd string, key []byte, khash uint32) (bool, func()) {
-	if len(key) == 0 || b.Migrate == nil || b.Meta.GetMigrateStatus() == 0 {
+func (b *Bitalos) CheckRedirectAndLockFunc(cmd string, key []byte, khash uint32, args [][]byte) (bool, func()) {
+	if len(key) == 0 {
 		return false, nil
 	}
-	if s := khash % utils.TotalSlot; s != b.Migrate.slotId {
+	mg := b.GetMigrate(khash % utils.TotalSlot)
+	if mg == nil {
 		return false, nil
 	}
 
 	switch cmd {
-	case resp.MGET, resp.MSET, resp.INFO, "migrateslots", "migratestatus", "migrateend", "migrateslotsretry", "migrateretryend":
+	case resp.MGET, resp.MSET, resp.INFO, "migrateslots", "migratestatus", "migrateend", "migrateslotsretry", "migrateretryend",
+		"migratepause", "migrateresume", "migratecancel", MigrateLoadCmd, MigrateSwitchCmd, MigrateAuthCmd, MigrateWriteCmd,
+		MigrateDigestCmd:
 		return false, nil
 	}
 
-	lockFunc := b.Migrate.keyLocker.LockKey(khash, cmd)
+	lockFunc := mg.keyLocker.LockKey(khash, cmd)
 
 	if n, _ := b.bitsdb.StringObj.Exists(key, khash); n == 1 {
+		if resp.IsWriteCmd(cmd) {
+			mg.markDirty(key)
+			if st := mg.getStage(key); st != nil {
+				return false, mg.trackStageWrite(st, cmd, args, lockFunc)
+			}
+		}
+		return false, lockFunc
+	} else if mg.isDirty(key) {
+		return false, lockFunc
+	} else if mg.holdsSlot() {
+		if resp.IsWriteCmd(cmd) {
+			mg.markDirty(key)
+		}
 		return false, lockFunc
 	} else {
 		return true, lockFunc
 	}
 }
 
-func (b *Bitalos) Redirect(cmd string, key []byte, reqData [][]byte, rw *resp.Writer) error {
+func (b *Bitalos) Redirect(cmd string, key []byte, khash uint32, reqData [][]byte, rw *resp.Writer) error {
 	log.Info("redirect cmd: ", cmd, " key: ", string(key))
+	mg := b.GetMigrate(khash % utils.TotalSlot)
+	if mg == nil {
+		return errn.ErrMigrateNotExist
+	}
+
 	var arg []interface{}
 	for _, v := range reqData[1:] {
 		arg = append(arg, v)
 	}
 
-	conn := b.Migrate.Conn.Get()
+	conn := mg.Conn.Get()
 	defer conn.Close()
 
 	res, err := conn.Do(cmd, arg...)
@@ -733,10 +862,11 @@ func (b *Bitalos) NewMigrate(slot uint32, tohost string, fromhost string) *Migra
 		beginTime: time.Now(),
 		endTime:   time.Now(),
 		keyLocker: locker.NewScopeLocker(false),
+		stateDir:  b.migrateDir,
 		Conn: &redis.Pool{
 			MaxIdle: 10,
 			Dial: func() (redis.Conn, error) {
-				return redis.Dial("tcp", tohost)
+				return dialMigrate(tohost)
 			},
 		},
 	}
@@ -746,136 +876,135 @@ func (b *Bitalos) NewMigrate(slot uint32, tohost string, fromhost string) *Migra
 func (b *Bitalos) MigrateStart(
 	from string, host string, slot uint32, isMaster func() bool, migrateDelToSlave func(uint32, [][]byte) error,
 ) (*Migrate, error) {
-	if b.Migrate == nil {
-		if b.Meta.GetMigrateStatus() != MigrateStatusPrepare {
-			if b.Meta.GetMigrateSlotid() != uint64(slot) {
-				return nil, errn.ErrMigrateRunning
-			}
-		}
-	} else {
-		if slot != b.Migrate.slotId {
-			if b.Migrate.status == MigrateStatusProcess {
-				return nil, errn.ErrMigrateRunning
-			}
-		}
-		if b.Migrate.status == MigrateStatusProcess {
-			return b.Migrate, nil
-		}
-	}
-
-	mg := b.NewMigrate(slot, host, from)
-	mg.migrateDelToSlave = migrateDelToSlave
-	mg.db = b.bitsdb
-	b.Migrate = mg
-	b.Migrate.IsMigrate.Store(1)
+	return b.migrateStart(from, host, slot, isMaster, migrateDelToSlave, false)
+}
 
-	isSlotMaster := isMaster != nil && isMaster()
+func (b *Bitalos) MigrateStartRetry(
+	from string, host string, slot uint32, isMaster func() bool, migrateDelToSlave func(uint32, [][]byte) error,
+) (*Migrate, error) {
+	return b.migrateStart(from, host, slot, isMaster, migrateDelToSlave, true)
+}
 
-	log.Infof("migrate start toHost:%s slotId:%d isMasterSlot:%v", host, slot, isSlotMaster)
-	if isSlotMaster {
-		mg.status = MigrateStatusProcess
+// migrateStart runs the migration of a slot next to the ones of other slots.
+// A migration interrupted by an error, a cancel or a restart resumes from its
+// persisted cursor, a finished one or one to another host starts over.
+func (b *Bitalos) migrateStart(
+	from string, host string, slot uint32, isMaster func() bool, migrateDelToSlave func(uint32, [][]byte) error, retry bool,
+) (*Migrate, error) {
+	name := "migrate"
+	if retry {
+		name = "migrateretry"
+	}
 
-		task.Run(slot, func(task *task.Task) error {
-			defer func() {
-				mg.endTime = time.Now()
-				b.Migrate.IsMigrate.Store(0)
-			}()
+	b.migrateMu.Lock()
+	defer b.migrateMu.Unlock()
 
-			if e := mg.migrateRunTask(isMaster); e != nil {
-				log.Errorf("migrate Run err:%s", e.Error())
-				mg.status = MigrateStatusError
-				return e
-			}
-			mg.status = MigrateStatusFinish
-			return nil
-		})
+	prev := b.migrates[slot]
+	if prev != nil && prev.status == MigrateStatusProcess {
+		return prev, nil
+	}
+	if b.runningMigrates(slot) >= config.Runtime().Migrate.MaxConcurrentSlots {
+		return nil, errn.ErrMigrateRunning
 	}
-	b.bitsdb.StringObj.BaseDb.BitmapMem.StartMigrate(slot)
-	b.Meta.SetMigrateStatus(MigrateStatusProcess)
-	b.Meta.SetMigrateSlotid(uint64(slot))
-	log.Infof("migrate end toHost:%s slotId:%d", host, slot)
-	return b.Migrate, nil
-}
 
-func (b *Bitalos) MigrateStartRetry(
-	from string, host string, slot uint32, isMaster func() bool, migrateDelToSlave func(uint32, [][]byte) error,
-) (*Migrate, error) {
-	if b.Migrate == nil {
-		if b.Meta.GetMigrateStatus() != MigrateStatusPrepare {
-			if b.Meta.GetMigrateSlotid() != uint64(slot) {
-				return nil, errn.ErrMigrateRunning
-			}
+	mg := prev
+	if mg == nil || mg.status == MigrateStatusFinish || mg.status == MigrateStatusRollback || mg.toHost != host || mg.retry != retry {
+		mg = b.NewMigrate(slot, host, from)
+		mg.retry = retry
+		cfg := &config.Runtime().Migrate
+		mg.bulk = !retry && (cfg.BulkMode || cfg.Verify) && slot != uint32(btools.LuaScriptSlot)
+		mg.inheritDirty(prev)
+		if mg.bulk {
+			mg.phase = migratePhaseCopy
 		}
-	} else {
-		if slot != b.Migrate.slotId {
-			if b.Migrate.status == MigrateStatusProcess {
-				return nil, errn.ErrMigrateRunning
-			}
-		}
-		if b.Migrate.status == MigrateStatusProcess {
-			return b.Migrate, nil
+		if prev != nil {
+			prev.removeState()
 		}
+	} else {
+		log.Infof("%s resume toHost:%s slotId:%d phase:%d round:%d cursor:%s", name, host, slot, mg.phase, mg.round, string(mg.resumeCursor()))
 	}
-
-	mg := b.NewMigrate(slot, host, from)
 	mg.migrateDelToSlave = migrateDelToSlave
 	mg.db = b.bitsdb
-	b.Migrate = mg
-	b.Migrate.IsMigrate.Store(1)
+	b.addMigrate(mg)
+	mg.IsMigrate.Store(1)
 
 	isSlotMaster := isMaster != nil && isMaster()
 
-	log.Infof("migrateretry start toHost:%s slotId:%d isMasterSlot:%v", host, slot, isSlotMaster)
+	log.Infof("%s start toHost:%s slotId:%d isMasterSlot:%v bulk:%v", name, host, slot, isSlotMaster, mg.bulk)
 	if isSlotMaster {
 		mg.status = MigrateStatusProcess
-
+	}
+	mg.saveState()
+	if isSlotMaster {
+		mg.runWg.Add(1)
 		task.Run(slot, func(task *task.Task) error {
 			defer func() {
 				mg.endTime = time.Now()
-				b.Migrate.IsMigrate.Store(0)
+				mg.IsMigrate.Store(0)
+				mg.saveState()
+				mg.runWg.Done()
 			}()
 
-			if e := mg.migrateRetryRunTask(isMaster); e != nil {
-				log.Errorf("migrateretry Run err:%s", e.Error())
-				mg.status = MigrateStatusError
+			runTask := mg.migrateRunTask
+			if mg.bulk {
+				runTask = mg.migrateBulkRunTask
+			} else if mg.retry {
+				runTask = mg.migrateRetryRunTask
+			}
+			if e := runTask(isMaster); e != nil {
+				log.Errorf("%s Run slotId:%d err:%s", name, slot, e.Error())
+				mg.status = migrateErrStatus(e)
 				return e
 			}
 			mg.status = MigrateStatusFinish
 			return nil
 		})
 	}
-	b.bitsdb.StringObj.BaseDb.BitmapMem.StartMigrate(slot)
 	b.Meta.SetMigrateStatus(MigrateStatusProcess)
 	b.Meta.SetMigrateSlotid(uint64(slot))
-	log.Infof("migrateretry end toHost:%s slotId:%d", host, slot)
-	return b.Migrate, nil
+	log.Infof("%s end toHost:%s slotId:%d", name, host, slot)
+	return mg, nil
 }
 
-func (b *Bitalos) MigrateOver(slotId uint64) error {
-	if b.Migrate != nil && uint64(b.Migrate.slotId) != slotId {
-		return errn.ErrSlotIdNotMatch
-	}
-	if b.Migrate != nil {
-		log.Infof("migrate over toHost:%s slotId:%d", b.Migrate.toHost, slotId)
-	} else {
-		log.Infof("migrate over slotId:%d", slotId)
+// migrateErrStatus is the status a migration ends with after the error e.
+func migrateErrStatus(e error) int64 {
+	if errors.Is(e, errn.ErrMigrateCanceled) {
+		return MigrateStatusCancel
+	} else if errors.Is(e, errn.ErrMigrateVerify) {
+		return MigrateStatusRollback
 	}
-	b.bitsdb.StringObj.BaseDb.BitmapMem.ClearMigrate()
-	b.Meta.SetMigrateStatus(MigrateStatusPrepare)
-	return nil
+	return MigrateStatusError
+}
+
+func (b *Bitalos) MigrateOver(slotId uint64) error {
+	return b.migrateOver(slotId, "migrate")
 }
 
 func (b *Bitalos) MigrateRetryOver(slotId uint64) error {
-	if b.Migrate != nil && uint64(b.Migrate.slotId) != slotId {
+	return b.migrateOver(slotId, "migrateretryend")
+}
+
+func (b *Bitalos) migrateOver(slotId uint64, name string) error {
+	if slotId >= uint64(utils.TotalSlot) {
 		return errn.ErrSlotIdNotMatch
 	}
-	if b.Migrate != nil {
-		log.Infof("migrateretryend over toHost:%s slotId:%d", b.Migrate.toHost, slotId)
-	} else {
-		log.Infof("migrateretryend over slotId:%d", slotId)
+
+	b.migrateMu.Lock()
+	mg := b.removeMigrate(uint32(slotId))
+	if len(b.migrates) == 0 {
+		b.Meta.SetMigrateStatus(MigrateStatusPrepare)
+	}
+	b.migrateMu.Unlock()
+
+	if mg == nil {
+		log.Infof("%s over slotId:%d", name, slotId)
+		return nil
 	}
-	b.bitsdb.StringObj.BaseDb.BitmapMem.ClearMigrate()
-	b.Meta.SetMigrateStatus(MigrateStatusPrepare)
-	b.Migrate = nil
+	// wait for the task to stop, it must not write the state or the dirty
+	// journal while they are removed.
+	mg.canceled.Store(true)
+	mg.runWg.Wait()
+	mg.removeState()
+	log.Infof("%s over toHost:%s slotId:%d", name, mg.toHost, slotId)
 	return nil
 }
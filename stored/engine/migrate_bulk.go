@@ -0,0 +1,285 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
+)
+
+// MigrateLoadCmd ingests a raw record batch of a slot on the target.
+const MigrateLoadCmd = "migrateload"
+
+const migrateBulkCatchUpRounds = 10
+
+// Bulk migration copies the slot as raw record batches while the source keeps
+// serving it. Keys written during the copy are marked dirty, they are never
+// redirected while dirty and are replayed key by key in the catch-up phase,
+// clean keys only have to be deleted locally once the copy is done. Until the
+// catch-up starts no key has left the source, keys it misses are not
+// redirected either.
+
+func (m *Migrate) inheritDirty(prev *Migrate) {
+	if prev == nil || prev.slotId != m.slotId {
+		return
+	}
+	prev.dirtyMu.Lock()
+	defer prev.dirtyMu.Unlock()
+	if prev.dirty != nil {
+		m.dirty = prev.dirty
+		m.bulk = true
+	}
+}
+
+func (m *Migrate) markDirty(key []byte) {
+	m.dirtyMu.Lock()
+	if m.dirty != nil {
+		if _, ok := m.dirty[unsafe2.String(key)]; !ok {
+			m.dirty[string(key)] = struct{}{}
+			m.appendDirty(migrateDirtyAdd, key)
+		}
+	}
+	m.dirtyMu.Unlock()
+}
+
+func (m *Migrate) isDirty(key []byte) bool {
+	m.dirtyMu.Lock()
+	defer m.dirtyMu.Unlock()
+	_, ok := m.dirty[unsafe2.String(key)]
+	return ok
+}
+
+func (m *Migrate) takeDirty(key []byte) bool {
+	m.dirtyMu.Lock()
+	defer m.dirtyMu.Unlock()
+	if _, ok := m.dirty[unsafe2.String(key)]; ok {
+		delete(m.dirty, unsafe2.String(key))
+		m.appendDirty(migrateDirtyDel, key)
+		return true
+	}
+	return false
+}
+
+func (m *Migrate) initDirty() {
+	m.dirtyMu.Lock()
+	defer m.dirtyMu.Unlock()
+	if m.dirty == nil {
+		m.dirty = make(map[string]struct{})
+	}
+	m.openDirtyJournal()
+}
+
+func (m *Migrate) clearDirty() {
+	m.dirtyMu.Lock()
+	defer m.dirtyMu.Unlock()
+	m.dirty = nil
+	if m.journal != nil {
+		m.journal.Close()
+		m.journal = nil
+		if err := os.Remove(m.dirtyFile()); err != nil && !os.IsNotExist(err) {
+			log.Warnf("migrate remove dirty journal slotId:%d err:%s", m.slotId, err)
+		}
+	}
+}
+
+func (m *Migrate) dirtyKeys() [][]byte {
+	m.dirtyMu.Lock()
+	defer m.dirtyMu.Unlock()
+	keys := make([][]byte, 0, len(m.dirty))
+	for key := range m.dirty {
+		keys = append(keys, []byte(key))
+	}
+	return keys
+}
+
+func (m *Migrate) migrateBulkDelTarget(key []byte, conn redis.Conn) (err error) {
+	if _, isHashTag := m.getKeyHash(key); isHashTag {
+		_, err = conn.Do(resp.EVAL, MigrateLuaScript, 2, resp.DEL, key)
+	} else {
+		_, err = conn.Do(resp.DEL, key)
+	}
+	if err != nil {
+		log.Errorf("migrate bulk del target key:%s err:%s", string(key), err)
+	}
+	return err
+}
+
+func (m *Migrate) migrateBulkDelLocal(key []byte, dataType btools.DataType) error {
+	var cmd string
+	switch dataType {
+	case btools.STRING:
+		cmd = resp.KDEL
+	case btools.HASH:
+		cmd = resp.HCLEAR
+	case btools.SET:
+		cmd = resp.SCLEAR
+	case btools.LIST:
+		cmd = resp.LCLEAR
+	case btools.ZSET, btools.ZSETOLD:
+		cmd = resp.ZCLEAR
+	default:
+		return nil
+	}
+
+	khash, _ := m.getKeyHash(key)
+	if err := m.migrateDelToSlave(khash, [][]byte{[]byte(cmd), key}); err != nil {
+		log.Errorf("migrate bulk sync slaves key:%s err:%s", string(key), err)
+		return err
+	}
+	if _, err := m.db.StringObj.Del(khash, key); err != nil {
+		log.Warnf("migrate bulk del key:%s err:%s", string(key), err)
+	}
+	return nil
+}
+
+// migrateBulkKey finishes a key of the catch-up scan, it runs under the key lock.
+func (m *Migrate) migrateBulkKey(key []byte, dataType btools.DataType, conn redis.Conn) error {
+	if !m.takeDirty(key) {
+		return m.migrateBulkDelLocal(key, dataType)
+	}
+
+	err := m.migrateBulkDelTarget(key, conn)
+	if err == nil {
+		err = m.migrateKey(key, dataType, conn)
+	}
+	if err != nil {
+		m.markDirty(key)
+	}
+	return err
+}
+
+// migrateBulkDropKey resolves a dirty key the catch-up scan did not meet
+// because it was deleted locally, the stale copy on the target is removed.
+func (m *Migrate) migrateBulkDropKey(key []byte, conn redis.Conn) error {
+	khash, _ := m.getKeyHash(key)
+	defer m.keyLocker.LockKey(khash, resp.SET)()
+
+	if !m.takeDirty(key) {
+		return nil
+	}
+	if n, _ := m.db.StringObj.Exists(key, khash); n == 1 {
+		m.markDirty(key)
+		return nil
+	}
+	if err := m.migrateBulkDelTarget(key, conn); err != nil {
+		m.markDirty(key)
+		return err
+	}
+	return nil
+}
+
+func (m *Migrate) migrateBulkCopy(isMaster func() bool) error {
+	conn := m.getConn()
+	defer conn.Close()
+
+	cursor := m.resumeCursor()
+	for {
+		if isMaster == nil || !isMaster() {
+			return errors.New("migrate error: server is not master")
+		}
+		if err := m.waitRunnable(); err != nil {
+			return err
+		}
+
+		dump, keys, next, skipped, err := m.db.DumpSlot(m.slotId, cursor, config.Runtime().Migrate.BulkBatchSize.AsInt())
+		if err != nil {
+			log.Warnf("migrate bulk dump slotId:%d err:%s", m.slotId, err)
+			return err
+		}
+		for _, key := range skipped {
+			m.markDirty(key)
+		}
+		if keys > 0 {
+			migrateThrottleKeys(int64(keys))
+			if _, err = conn.Do(MigrateLoadCmd, m.slotId, dump); err != nil {
+				log.Errorf("migrate bulk load slotId:%d keys:%d err:%s", m.slotId, keys, err)
+				return err
+			}
+			atomic.AddInt64(&m.copied, int64(keys))
+		}
+		if next == nil {
+			return nil
+		}
+		cursor = next
+		m.checkpoint(migratePhaseCopy, 0, cursor)
+	}
+}
+
+func (m *Migrate) migrateBulkRunTask(isMaster func() bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("migrateBulkTaskRun panic recover err:%v stack:%s", r, string(debug.Stack()))
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	m.initDirty()
+
+	if m.phase == migratePhaseCopy {
+		if err = m.migrateBulkCopy(isMaster); err != nil {
+			return err
+		}
+		log.Infof("migrate bulk copy finish slotId:%d copied:%d dirty:%d", m.slotId, atomic.LoadInt64(&m.copied), len(m.dirtyKeys()))
+		if config.Runtime().Migrate.Verify {
+			m.checkpoint(migratePhaseVerify, 0, nil)
+		} else {
+			m.checkpoint(migratePhaseScan, 0, nil)
+		}
+	}
+	if m.phase == migratePhaseVerify {
+		if err = m.migrateVerify(isMaster); err != nil {
+			return err
+		}
+		m.checkpoint(migratePhaseScan, 0, nil)
+	}
+
+	conn := m.getConn()
+	defer conn.Close()
+	for round := m.round; round < migrateBulkCatchUpRounds; round++ {
+		if err = m.migrateRunTask(isMaster); err != nil {
+			return err
+		}
+		keys := m.dirtyKeys()
+		if len(keys) == 0 {
+			m.clearDirty()
+			return nil
+		}
+		for _, key := range keys {
+			if err = m.waitRunnable(); err != nil {
+				return err
+			}
+			if err = m.migrateBulkDropKey(key, conn); err != nil {
+				return err
+			}
+		}
+		m.checkpoint(migratePhaseScan, round+1, nil)
+	}
+	m.checkpoint(migratePhaseScan, 0, nil)
+	return fmt.Errorf("migrate bulk catch-up slotId:%d not converged after %d rounds", m.slotId, migrateBulkCatchUpRounds)
+}
+
+func (b *Bitalos) MigrateLoad(slotId uint32, dump []byte) (int, error) {
+	return b.bitsdb.LoadSlotDump(slotId, dump)
+}
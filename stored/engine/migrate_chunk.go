@@ -0,0 +1,972 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
+	"github.com/zuoyebang/bitalostored/stored/internal/utils"
+)
+
+// MigrateSwitchCmd replaces a key on the target by its staging key.
+const MigrateSwitchCmd = "migrateswitch"
+
+const (
+	migrateStageSuffix   = "\x00migrate-stage"
+	migrateChunkAttempts = 3
+	// migrateStageQueueMax bounds the writes waiting to be sent to a staging
+	// key, a target that falls further behind aborts the copy.
+	migrateStageQueueMax = 1 << 16
+	// migrateStageQueueLow is the backlog below which the copy reads its next
+	// chunk.
+	migrateStageQueueLow = 64
+)
+
+// Chunked migration copies a big collection without holding its key lock over
+// a round trip to the target. Members are shipped chunk by chunk into a
+// staging key on the target, which carries the hash tag of the key so both
+// names share one khash. Chunks are read and writes to the key are recorded
+// under the key lock into the queue of the stage, so the queue follows the
+// order in which they were applied, and a forwarder sends the queue to the
+// target. Member writes resend the members they touched with their current
+// value, writes that remove members by rank or pop them record the members
+// beforehand. Lists are copied from the head and writes are translated to the
+// leading members the staging key already holds. Writes that replace or
+// delete the key abort the copy, which starts over. The key lock is held over
+// a round trip only to switch the staging key in place of the key on the
+// target and drop the local copy.
+
+// migrateStageWrites lists the writes mirrored into a staging key with the
+// type they apply to.
+var migrateStageWrites = map[string]btools.DataType{
+	resp.HSET:             btools.HASH,
+	resp.HMSET:            btools.HASH,
+	resp.HINCRBY:          btools.HASH,
+	resp.HDEL:             btools.HASH,
+	resp.SADD:             btools.SET,
+	resp.SREM:             btools.SET,
+	resp.SPOP:             btools.SET,
+	resp.ZADD:             btools.ZSET,
+	resp.ZINCRBY:          btools.ZSET,
+	resp.ZREM:             btools.ZSET,
+	resp.ZREMRANGEBYSCORE: btools.ZSET,
+	resp.ZREMRANGEBYLEX:   btools.ZSET,
+	resp.ZREMRANGEBYRANK:  btools.ZSET,
+	resp.LPUSH:            btools.LIST,
+	resp.LPUSHX:           btools.LIST,
+	resp.RPUSH:            btools.LIST,
+	resp.RPUSHX:           btools.LIST,
+	resp.LPOP:             btools.LIST,
+	resp.RPOP:             btools.LIST,
+	resp.LTRIMFRONT:       btools.LIST,
+	resp.LTRIMBACK:        btools.LIST,
+	resp.LTRIM:            btools.LIST,
+	resp.LSET:             btools.LIST,
+	resp.LREM:             btools.LIST,
+	resp.LINSERT:          btools.LIST,
+}
+
+// migrateStageKeeps lists the writes a staging key ignores, the ttl is copied
+// at the switch.
+var migrateStageKeeps = map[string]struct{}{
+	resp.EXPIRE: {}, resp.EXPIREAT: {}, resp.PEXPIRE: {}, resp.PEXPIREAT: {}, resp.PERSIST: {},
+	resp.HEXPIRE: {}, resp.HEXPIREAT: {}, resp.HPERSIST: {},
+	resp.SEXPIRE: {}, resp.SEXPIREAT: {}, resp.SPERSIST: {},
+	resp.ZEXPIRE: {}, resp.ZEXPIREAT: {}, resp.ZPERSIST: {},
+	resp.LEXPIRE: {}, resp.LEXPIREAT: {}, resp.LPERSIST: {},
+}
+
+// migrateStageOp is a write to a staging key, either a command sent as is or
+// members resent with their current value.
+type migrateStageOp struct {
+	epoch    uint64
+	throttle bool
+	cmd      string
+	args     []interface{}
+	members  [][]byte
+}
+
+type migrateStage struct {
+	key       []byte
+	stage     []byte
+	khash     uint32
+	isHashTag bool
+	dt        btools.DataType
+
+	// listCopied is the number of leading list members the staging key
+	// holds, it is only accessed under the key lock.
+	listCopied int64
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []migrateStageOp
+	busy    bool
+	epoch   uint64
+	aborted bool
+	closed  bool
+}
+
+// push queues op, it runs under the key lock.
+func (st *migrateStage) push(op migrateStageOp) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.aborted || st.closed {
+		return
+	}
+	if len(st.queue) >= migrateStageQueueMax {
+		log.Warnf("migrate stage key:%s queue full, abort copy", string(st.key))
+		st.abortLocked()
+		return
+	}
+	op.epoch = st.epoch
+	st.queue = append(st.queue, op)
+	st.cond.Broadcast()
+}
+
+func (st *migrateStage) abortLocked() {
+	st.aborted = true
+	st.queue = nil
+	st.cond.Broadcast()
+}
+
+func (st *migrateStage) abort() {
+	st.mu.Lock()
+	st.abortLocked()
+	st.mu.Unlock()
+}
+
+func (st *migrateStage) isAborted() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.aborted
+}
+
+// restart drops the queue of an aborted copy and queues the delete of the
+// staging key ahead of the writes of the next one, it runs under the key lock.
+func (st *migrateStage) restart() {
+	st.listCopied = 0
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.epoch++
+	st.aborted = false
+	st.queue = append(st.queue[:0], migrateStageOp{epoch: st.epoch, cmd: resp.DEL})
+	st.cond.Broadcast()
+}
+
+// next waits for the next queued op, it returns false once the stage is
+// closed.
+func (st *migrateStage) next() (migrateStageOp, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for len(st.queue) == 0 && !st.closed {
+		st.cond.Wait()
+	}
+	if st.closed {
+		return migrateStageOp{}, false
+	}
+	op := st.queue[0]
+	st.queue[0] = migrateStageOp{}
+	st.queue = st.queue[1:]
+	st.busy = true
+	return op, true
+}
+
+// done reports the op taken by next as sent, a failed op aborts the copy it
+// belongs to.
+func (st *migrateStage) done(op migrateStageOp, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.busy = false
+	if err != nil && op.epoch == st.epoch {
+		st.abortLocked()
+	}
+	st.cond.Broadcast()
+}
+
+// wait blocks until at most n ops are queued, wait(0) also waits for the op
+// being sent. It returns false if the copy was aborted.
+func (st *migrateStage) wait(n int) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for !st.aborted && !st.closed && (len(st.queue) > n || (n == 0 && st.busy)) {
+		st.cond.Wait()
+	}
+	return !st.aborted && !st.closed
+}
+
+func (st *migrateStage) close() {
+	st.mu.Lock()
+	st.closed = true
+	st.queue = nil
+	st.cond.Broadcast()
+	st.mu.Unlock()
+}
+
+// migrateStageName returns the staging name of key, nil if key can not be
+// given a name of the same khash.
+func (m *Migrate) migrateStageName(key []byte) []byte {
+	tag := key
+	if _, isHashTag := m.getKeyHash(key); isHashTag {
+		tag = utils.ExtractHashTag(key)
+	} else if bytes.IndexByte(key, '}') >= 0 {
+		return nil
+	}
+	stage := make([]byte, 0, len(tag)+len(migrateStageSuffix)+2)
+	stage = append(stage, '{')
+	stage = append(stage, tag...)
+	stage = append(stage, '}')
+	return append(stage, migrateStageSuffix...)
+}
+
+// migrateChunked reports whether key is big enough to be copied in chunks.
+func (m *Migrate) migrateChunked(key []byte, dataType btools.DataType) bool {
+	threshold := config.Runtime().Migrate.ChunkThreshold
+	if threshold <= 0 {
+		return false
+	}
+	switch dataType {
+	case btools.HASH, btools.SET, btools.LIST, btools.ZSET, btools.ZSETOLD:
+	default:
+		return false
+	}
+	if m.bulk && !m.isDirty(key) {
+		return false
+	}
+	khash, _ := m.getKeyHash(key)
+	if _, size, err := m.db.KeyVersion(key, khash); err != nil || size <= threshold {
+		return false
+	}
+	return m.migrateStageName(key) != nil
+}
+
+func (m *Migrate) getStage(key []byte) *migrateStage {
+	m.stageMu.RLock()
+	defer m.stageMu.RUnlock()
+	return m.stages[unsafe2.String(key)]
+}
+
+// addStage starts mirroring the writes of key, the key lock is taken once so
+// that no write in flight misses the stage.
+func (m *Migrate) addStage(key []byte, dataType btools.DataType) *migrateStage {
+	khash, isHashTag := m.getKeyHash(key)
+	if dataType == btools.ZSETOLD {
+		dataType = btools.ZSET
+	}
+	st := &migrateStage{
+		key:       key,
+		stage:     m.migrateStageName(key),
+		khash:     khash,
+		isHashTag: isHashTag,
+		dt:        dataType,
+	}
+	st.cond = sync.NewCond(&st.mu)
+	go m.runStageForwarder(st)
+
+	unlockKey := m.keyLocker.LockKey(khash, resp.SET)
+	m.stageMu.Lock()
+	if m.stages == nil {
+		m.stages = make(map[string]*migrateStage)
+	}
+	m.stages[string(key)] = st
+	m.stageMu.Unlock()
+	unlockKey()
+	return st
+}
+
+// removeStage stops mirroring the writes of key and stops its forwarder, ops
+// still queued are dropped.
+func (m *Migrate) removeStage(key []byte) {
+	m.stageMu.Lock()
+	st := m.stages[unsafe2.String(key)]
+	delete(m.stages, unsafe2.String(key))
+	m.stageMu.Unlock()
+	if st != nil {
+		st.close()
+	}
+}
+
+// runStageForwarder sends the queued ops of st to the target in order.
+func (m *Migrate) runStageForwarder(st *migrateStage) {
+	var conn redis.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		op, ok := st.next()
+		if !ok {
+			return
+		}
+		if conn == nil {
+			conn = m.Conn.Get()
+		}
+		mc := migrateConn{Conn: conn, throttle: op.throttle}
+		var err error
+		if op.members != nil {
+			err = m.migrateStageSync(st, mc, op.members)
+		} else {
+			err = m.migrateStageDo(st, mc, op.cmd, op.args...)
+		}
+		if err != nil {
+			log.Warnf("migrate stage forward key:%s cmd:%s err:%s", string(st.key), op.cmd, err)
+			conn.Close()
+			conn = nil
+		}
+		st.done(op, err)
+	}
+}
+
+// trackStageWrite runs under the key lock before a write to a staged key is
+// applied, the returned func queues its mirror once applied and releases the
+// lock. Both only read the local key.
+func (m *Migrate) trackStageWrite(st *migrateStage, cmd string, args [][]byte, unlockKey func()) func() {
+	if _, ok := migrateStageKeeps[cmd]; ok {
+		return unlockKey
+	}
+	dt, ok := migrateStageWrites[cmd]
+	if !ok {
+		st.abort()
+		return unlockKey
+	}
+	if dt != st.dt || len(args) == 0 || st.isAborted() {
+		return unlockKey
+	}
+
+	var mirror func()
+	if dt == btools.LIST {
+		mirror = m.trackStageListWrite(st, cmd, args)
+	} else {
+		mirror = m.trackStageMemberWrite(st, cmd, args)
+	}
+	if mirror == nil {
+		return unlockKey
+	}
+	return func() {
+		mirror()
+		unlockKey()
+	}
+}
+
+func (m *Migrate) trackStageMemberWrite(st *migrateStage, cmd string, args [][]byte) func() {
+	var members [][]byte
+	switch cmd {
+	case resp.ZREMRANGEBYSCORE, resp.ZREMRANGEBYLEX:
+		op := migrateStageOp{cmd: cmd, args: migrateStageArgs(args[1:])}
+		return func() {
+			st.push(op)
+		}
+	case resp.ZREMRANGEBYRANK, resp.SPOP:
+		var err error
+		if members, err = m.migrateStageRemoved(st, cmd, args); err != nil {
+			st.abort()
+			return nil
+		}
+	default:
+		members = migrateStageMembers(cmd, args)
+		for i := range members {
+			members[i] = append([]byte(nil), members[i]...)
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return func() {
+		st.push(migrateStageOp{cmd: cmd, members: members})
+	}
+}
+
+// migrateStageMembers returns the members a mirrored write touched.
+func migrateStageMembers(cmd string, args [][]byte) [][]byte {
+	var members [][]byte
+	switch cmd {
+	case resp.HSET, resp.HMSET:
+		for i := 1; i < len(args); i += 2 {
+			members = append(members, args[i])
+		}
+	case resp.ZADD:
+		for i := 2; i < len(args); i += 2 {
+			members = append(members, args[i])
+		}
+	case resp.HINCRBY:
+		if len(args) > 1 {
+			members = args[1:2]
+		}
+	case resp.ZINCRBY:
+		if len(args) > 2 {
+			members = args[2:3]
+		}
+	default:
+		if len(args) > 1 {
+			members = args[1:]
+		}
+	}
+	return members
+}
+
+// migrateStageRemoved reads the members a write removing by rank or popping is
+// about to remove, SPOP pops the members in scan order.
+func (m *Migrate) migrateStageRemoved(st *migrateStage, cmd string, args [][]byte) ([][]byte, error) {
+	var members [][]byte
+	switch cmd {
+	case resp.ZREMRANGEBYRANK:
+		if len(args) != 3 {
+			return nil, nil
+		}
+		start, err := utils.ByteToInt64(args[1])
+		if err != nil {
+			return nil, nil
+		}
+		stop, err := utils.ByteToInt64(args[2])
+		if err != nil {
+			return nil, nil
+		}
+		pairs, err := m.db.ZsetObj.ZRange(st.key, st.khash, start, stop)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range pairs {
+			members = append(members, append([]byte(nil), pair.Member...))
+		}
+	case resp.SPOP:
+		count := int64(1)
+		if len(args) > 1 {
+			var err error
+			if count, err = utils.ByteToInt64(args[1]); err != nil || count <= 0 {
+				return nil, nil
+			}
+		}
+		_, popped, err := m.db.SetObj.SScan(st.key, st.khash, nil, int(count), "")
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range popped {
+			members = append(members, append([]byte(nil), member...))
+		}
+	}
+	return members, nil
+}
+
+// trackStageListWrite translates a list write to the leading members the
+// staging key holds, the length of the list before the write is compared
+// with the length after it.
+func (m *Migrate) trackStageListWrite(st *migrateStage, cmd string, args [][]byte) func() {
+	before, err := m.db.ListObj.LLen(st.key, st.khash)
+	if err != nil {
+		st.abort()
+		return nil
+	}
+	copied := st.listCopied
+
+	var removed int64
+	var pivotCopied bool
+	switch cmd {
+	case resp.LREM:
+		if len(args) != 3 {
+			return nil
+		}
+		count, e := utils.ByteToInt64(args[1])
+		if e != nil {
+			return nil
+		}
+		if removed, err = m.migrateStageListRemoved(st, count, args[2], copied, before); err != nil {
+			st.abort()
+			return nil
+		}
+	case resp.LINSERT:
+		if len(args) != 4 {
+			return nil
+		}
+		var first int64
+		if _, first, err = m.migrateStageListCount(st, args[2], 0, copied); err != nil {
+			st.abort()
+			return nil
+		}
+		pivotCopied = first >= 0
+	}
+
+	return func() {
+		after, err := m.db.ListObj.LLen(st.key, st.khash)
+		if err != nil {
+			st.abort()
+			return
+		}
+
+		switch cmd {
+		case resp.LPUSH, resp.LPUSHX:
+			if after > before {
+				st.listCopied += after - before
+				st.push(migrateStageOp{cmd: resp.LPUSH, args: migrateStageArgs(args[1:])})
+			}
+		case resp.RPUSH, resp.RPUSHX:
+			if after > before && copied == before {
+				st.listCopied = after
+				st.push(migrateStageOp{cmd: resp.RPUSH, args: migrateStageArgs(args[1:])})
+			}
+		case resp.LPOP, resp.LTRIMFRONT:
+			n := before - after
+			if n > copied {
+				n = copied
+			}
+			if n > 0 {
+				st.listCopied -= n
+				st.push(migrateStageOp{cmd: resp.LTRIMFRONT, args: []interface{}{n}})
+			}
+		case resp.RPOP, resp.LTRIMBACK:
+			if copied > after {
+				st.listCopied = after
+				st.push(migrateStageOp{cmd: resp.LTRIMBACK, args: []interface{}{copied - after}})
+			}
+		case resp.LTRIM:
+			if len(args) != 3 {
+				return
+			}
+			start, e1 := utils.ByteToInt64(args[1])
+			stop, e2 := utils.ByteToInt64(args[2])
+			if e1 != nil || e2 != nil {
+				return
+			}
+			start, end := migrateStageListRange(start, stop, before)
+			front := start
+			if front > copied {
+				front = copied
+			}
+			keep := end
+			if keep > copied {
+				keep = copied
+			}
+			if keep < front {
+				keep = front
+			}
+			back := copied - keep
+			st.listCopied = keep - front
+			if front > 0 {
+				st.push(migrateStageOp{cmd: resp.LTRIMFRONT, args: []interface{}{front}})
+			}
+			if back > 0 {
+				st.push(migrateStageOp{cmd: resp.LTRIMBACK, args: []interface{}{back}})
+			}
+		case resp.LSET:
+			if len(args) != 3 {
+				return
+			}
+			index, e := utils.ByteToInt64(args[1])
+			if e != nil {
+				return
+			}
+			if index < 0 {
+				index += before
+			}
+			if index >= 0 && index < copied {
+				st.push(migrateStageOp{cmd: resp.LSET, args: []interface{}{index, append([]byte(nil), args[2]...)}})
+			}
+		case resp.LREM:
+			if removed == 0 || before-after < removed {
+				return
+			}
+			count := removed
+			if n, _ := utils.ByteToInt64(args[1]); n < 0 {
+				count = -removed
+			}
+			st.listCopied -= removed
+			st.push(migrateStageOp{cmd: resp.LREM, args: []interface{}{count, append([]byte(nil), args[2]...)}})
+		case resp.LINSERT:
+			if pivotCopied && after > before {
+				st.listCopied++
+				st.push(migrateStageOp{cmd: resp.LINSERT, args: migrateStageArgs(args[1:])})
+			}
+		}
+	}
+}
+
+// migrateStageListRange returns the members [start, end) that LTRIM start
+// stop keeps of a list of size members.
+func migrateStageListRange(start, stop, size int64) (int64, int64) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop + 1
+}
+
+// migrateStageListRemoved returns how many of the leading copied members LREM
+// count value removes from a list of size members.
+func (m *Migrate) migrateStageListRemoved(st *migrateStage, count int64, value []byte, copied, size int64) (int64, error) {
+	inCopied, _, err := m.migrateStageListCount(st, value, 0, copied)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case count == 0:
+		return inCopied, nil
+	case count > 0:
+		if count < inCopied {
+			return count, nil
+		}
+		return inCopied, nil
+	}
+
+	inRest, _, err := m.migrateStageListCount(st, value, copied, size)
+	if err != nil {
+		return 0, err
+	}
+	removed := -count - inRest
+	if removed < 0 {
+		return 0, nil
+	} else if removed > inCopied {
+		return inCopied, nil
+	}
+	return removed, nil
+}
+
+// migrateStageListCount counts value in the list members [start, stop) and
+// returns the position of the first one, -1 if there is none.
+func (m *Migrate) migrateStageListCount(st *migrateStage, value []byte, start, stop int64) (n int64, first int64, err error) {
+	first = -1
+	count := int64(config.Runtime().Migrate.ChunkSize)
+	for pos := start; pos < stop; pos += count {
+		end := pos + count
+		if end > stop {
+			end = stop
+		}
+		list, err := m.db.ListObj.LRange(st.key, st.khash, pos, end-1)
+		if err != nil {
+			return 0, -1, err
+		}
+		for i, item := range list {
+			if bytes.Equal(item, value) {
+				if first < 0 {
+					first = pos + int64(i)
+				}
+				n++
+			}
+		}
+		if int64(len(list)) < end-pos {
+			break
+		}
+	}
+	return n, first, nil
+}
+
+// migrateStageArgs copies args, the queued op outlives the buffers of the
+// client.
+func migrateStageArgs(args [][]byte) []interface{} {
+	out := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		out = append(out, append([]byte(nil), arg...))
+	}
+	return out
+}
+
+func (m *Migrate) migrateStageDo(st *migrateStage, conn redis.Conn, cmd string, args ...interface{}) error {
+	cmdArgs := make([]interface{}, 0, len(args)+4)
+	cmdArgs = append(cmdArgs, MigrateLuaScript, len(args)+2, cmd, st.stage)
+	cmdArgs = append(cmdArgs, args...)
+	_, err := conn.Do(resp.EVAL, cmdArgs...)
+	return err
+}
+
+func (m *Migrate) migrateStageDel(st *migrateStage, conn redis.Conn) error {
+	if err := m.migrateStageDo(st, conn, resp.DEL); err != nil {
+		log.Errorf("migrate stage del key:%s err:%s", string(st.key), err)
+		return err
+	}
+	return nil
+}
+
+// migrateStageSync sends members with their current local value to the
+// staging key, members gone locally are removed from it.
+func (m *Migrate) migrateStageSync(st *migrateStage, conn redis.Conn, members [][]byte) error {
+	if len(members) == 0 {
+		return nil
+	}
+
+	var setCmd, delCmd string
+	var sets, dels []interface{}
+	switch st.dt {
+	case btools.HASH:
+		setCmd, delCmd = resp.HMSET, resp.HDEL
+		for _, field := range members {
+			val, closer, err := m.db.HashObj.HGet(st.key, st.khash, field)
+			if val == nil {
+				dels = append(dels, field)
+			} else {
+				sets = append(sets, field, append([]byte(nil), val...))
+			}
+			if closer != nil {
+				closer()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case btools.SET:
+		setCmd, delCmd = resp.SADD, resp.SREM
+		for _, member := range members {
+			n, err := m.db.SetObj.SIsMember(st.key, st.khash, member)
+			if err != nil {
+				return err
+			} else if n == 1 {
+				sets = append(sets, member)
+			} else {
+				dels = append(dels, member)
+			}
+		}
+	case btools.ZSET:
+		setCmd, delCmd = resp.ZADD, resp.ZREM
+		for _, member := range members {
+			score, err := m.db.ZsetObj.ZScore(st.key, st.khash, member)
+			if err == errn.ErrZsetMemberNil {
+				dels = append(dels, member)
+			} else if err != nil {
+				return err
+			} else {
+				sets = append(sets, score, member)
+			}
+		}
+	default:
+		return nil
+	}
+
+	if len(sets) > 0 {
+		if err := m.migrateStageDo(st, conn, setCmd, sets...); err != nil {
+			return err
+		}
+	}
+	if len(dels) > 0 {
+		if err := m.migrateStageDo(st, conn, delCmd, dels...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateStageChunk reads the members from cursor on under the key lock and
+// queues them for the staging key.
+func (m *Migrate) migrateStageChunk(st *migrateStage, cursor []byte, count int) (next []byte, n int, err error) {
+	defer m.keyLocker.LockKey(st.khash, resp.SET)()
+
+	var cmd string
+	var args []interface{}
+	switch st.dt {
+	case btools.HASH:
+		var pairs []btools.FVPair
+		if next, pairs, err = m.db.HashObj.HScan(st.key, st.khash, cursor, count, ""); err != nil {
+			return nil, 0, err
+		}
+		cmd, n = resp.HMSET, len(pairs)
+		for _, pair := range pairs {
+			args = append(args, append([]byte(nil), pair.Field...), append([]byte(nil), pair.Value...))
+		}
+	case btools.SET:
+		var members [][]byte
+		if next, members, err = m.db.SetObj.SScan(st.key, st.khash, cursor, count, ""); err != nil {
+			return nil, 0, err
+		}
+		cmd, n = resp.SADD, len(members)
+		args = migrateStageArgs(members)
+	case btools.ZSET:
+		var pairs []btools.ScorePair
+		if next, pairs, err = m.db.ZsetObj.ZScan(st.key, st.khash, cursor, count, ""); err != nil {
+			return nil, 0, err
+		}
+		cmd, n = resp.ZADD, len(pairs)
+		for _, pair := range pairs {
+			args = append(args, pair.Score, append([]byte(nil), pair.Member...))
+		}
+	}
+
+	if len(args) > 0 {
+		st.push(migrateStageOp{throttle: true, cmd: cmd, args: args})
+	}
+	return next, n, nil
+}
+
+// migrateStageListChunk reads the list members following the copied ones
+// under the key lock and queues them for the staging key, it reports whether
+// the whole list is queued.
+func (m *Migrate) migrateStageListChunk(st *migrateStage, count int) (bool, error) {
+	defer m.keyLocker.LockKey(st.khash, resp.SET)()
+
+	start := st.listCopied
+	list, err := m.db.ListObj.LRange(st.key, st.khash, start, start+int64(count)-1)
+	if err != nil {
+		return false, err
+	}
+	size, err := m.db.ListObj.LLen(st.key, st.khash)
+	if err != nil {
+		return false, err
+	}
+	if len(list) > 0 {
+		st.listCopied += int64(len(list))
+		st.push(migrateStageOp{throttle: true, cmd: resp.RPUSH, args: migrateStageArgs(list)})
+	}
+	return st.listCopied >= size, nil
+}
+
+// migrateStageCopy fills the staging key, it returns false if a write aborted
+// the copy.
+func (m *Migrate) migrateStageCopy(st *migrateStage) (bool, error) {
+	count := config.Runtime().Migrate.ChunkSize
+	var cursor []byte
+	for {
+		if err := m.waitRunnable(); err != nil {
+			return false, err
+		}
+		if !st.wait(migrateStageQueueLow) {
+			return false, nil
+		}
+
+		if st.dt == btools.LIST {
+			done, err := m.migrateStageListChunk(st, count)
+			if err != nil {
+				return false, err
+			} else if done {
+				return !st.isAborted(), nil
+			}
+			continue
+		}
+
+		next, n, err := m.migrateStageChunk(st, cursor, count)
+		if err != nil {
+			return false, err
+		}
+		if st.isAborted() {
+			return false, nil
+		}
+		end := bytes.Equal(next, btools.ScanEndCurosr)
+		if n < count || (end && bytes.Equal(cursor, next)) {
+			return true, nil
+		}
+		cursor = next
+	}
+}
+
+// migrateStageSwitch replaces the key on the target by the staging key and
+// drops it locally, it returns false if the copy has to start over.
+func (m *Migrate) migrateStageSwitch(st *migrateStage, version uint64, conn redis.Conn) (bool, error) {
+	defer m.keyLocker.LockKey(st.khash, resp.SET)()
+
+	if !st.wait(0) {
+		return false, nil
+	}
+	curVersion, size, err := m.db.KeyVersion(st.key, st.khash)
+	if err != nil {
+		return false, err
+	}
+	if size == 0 {
+		if m.bulk {
+			m.takeDirty(st.key)
+		}
+		return true, m.migrateStageDel(st, conn)
+	}
+	if curVersion != version {
+		return false, nil
+	}
+
+	ok, err := redis.Bool(conn.Do(MigrateSwitchCmd, st.stage, st.key, size))
+	if err != nil {
+		log.Errorf("migrate stage switch key:%s err:%s", string(st.key), err)
+		return false, err
+	} else if !ok {
+		log.Warnf("migrate stage switch key:%s size:%d mismatch", string(st.key), size)
+		return false, nil
+	}
+	if err = m.migrateTTL(st.key, st.khash, conn, st.isHashTag); err != nil {
+		return false, err
+	}
+	if m.bulk {
+		m.takeDirty(st.key)
+	}
+	m.removeStage(st.key)
+	return true, m.migrateBulkDelLocal(st.key, st.dt)
+}
+
+// migrateChunkKey copies a big collection in chunks, after migrateChunkAttempts
+// aborted copies it falls back to a copy under the key lock.
+func (m *Migrate) migrateChunkKey(key []byte, dataType btools.DataType, conn redis.Conn) (err error) {
+	if m.bulk {
+		m.takeDirty(key)
+		defer func() {
+			if err != nil {
+				m.markDirty(key)
+			}
+		}()
+	}
+
+	st := m.addStage(key, dataType)
+	defer m.removeStage(key)
+
+	for attempt := 0; attempt < migrateChunkAttempts; attempt++ {
+		unlockKey := m.keyLocker.LockKey(st.khash, resp.SET)
+		st.restart()
+		version, _, e := m.db.KeyVersion(key, st.khash)
+		unlockKey()
+		if e != nil {
+			return e
+		}
+		var done bool
+		if done, err = m.migrateStageCopy(st); err == nil && done {
+			done, err = m.migrateStageSwitch(st, version, conn)
+		}
+		if err != nil {
+			m.removeStage(key)
+			_ = m.migrateStageDel(st, conn)
+			return err
+		}
+		if done {
+			log.Infof("migrate chunked key:%s attempts:%d", string(key), attempt+1)
+			return nil
+		}
+	}
+
+	log.Warnf("migrate chunked key:%s aborted %d times, copy under lock", string(key), migrateChunkAttempts)
+	m.removeStage(key)
+	if err = m.migrateStageDel(st, conn); err != nil {
+		return err
+	}
+	defer m.keyLocker.LockKey(st.khash, resp.SET)()
+	if m.bulk {
+		m.takeDirty(key)
+		if err = m.migrateBulkDelTarget(key, conn); err != nil {
+			return err
+		}
+	}
+	return m.migrateKey(key, dataType, conn)
+}
+
+func (b *Bitalos) MigrateSwitch(stage, key []byte, size int64) (bool, error) {
+	return b.bitsdb.SwitchStageKey(stage, key, utils.GetHashTagFnv(stage), size)
+}
@@ -0,0 +1,105 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
+)
+
+const (
+	// MigrateAuthCmd authenticates an internal connection with the migrate token.
+	MigrateAuthCmd = "migrateauth"
+	// MigrateWriteCmd runs a command sent by a migration on the target, it
+	// takes whether the key is hashed by its hash tag, the command and its args.
+	MigrateWriteCmd = "migratewrite"
+)
+
+// dialMigrate connects to the target of a migration. It goes through the
+// internal tls listener of the target if migrate.tls_port_offset is set, and
+// authenticates when there is a migrate token.
+func dialMigrate(tohost string) (redis.Conn, error) {
+	addr := tohost
+	var options []redis.DialOption
+	if offset := config.GlobalConfig.Migrate.TLSPortOffset; offset > 0 {
+		host, port, err := net.SplitHostPort(tohost)
+		if err != nil {
+			return nil, err
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig, err := config.GlobalConfig.MigrateTLSConfig(false)
+		if err != nil {
+			return nil, err
+		}
+		addr = net.JoinHostPort(host, strconv.Itoa(p+offset))
+		options = append(options, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
+	}
+
+	conn, err := redis.Dial("tcp", addr, options...)
+	if err != nil {
+		return nil, err
+	}
+	if token := config.GlobalConfig.MigrateToken(); token != "" {
+		if _, err = conn.Do(MigrateAuthCmd, token); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// migrateConn sends the writes of a migration in the internal namespace of
+// the target: a plain command or one wrapped in MigrateLuaScript to be hashed
+// by its hash tag becomes a MigrateWriteCmd. Connections of the copy also
+// throttle the bytes they send.
+type migrateConn struct {
+	redis.Conn
+	throttle bool
+}
+
+func (c migrateConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if c.throttle {
+		var n int64
+		for _, arg := range args {
+			switch v := arg.(type) {
+			case []byte:
+				n += int64(len(v))
+			case string:
+				n += int64(len(v))
+			}
+		}
+		migrateBytesLimiter.wait(n, config.Runtime().Migrate.MaxBytesPerSecond.Int64())
+	}
+
+	switch {
+	case cmd == MigrateLoadCmd || cmd == MigrateSwitchCmd || cmd == MigrateDigestCmd:
+		return c.Conn.Do(cmd, args...)
+	case cmd == resp.EVAL && len(args) > 2 && args[0] == MigrateLuaScript:
+		return c.Conn.Do(MigrateWriteCmd, append([]interface{}{1}, args[2:]...)...)
+	default:
+		return c.Conn.Do(MigrateWriteCmd, append([]interface{}{0, cmd}, args...)...)
+	}
+}
+
+func (m *Migrate) getConn() redis.Conn {
+	return migrateConn{Conn: m.Conn.Get(), throttle: true}
+}
@@ -0,0 +1,205 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+)
+
+const migratePauseInterval = 100 * time.Millisecond
+
+var (
+	migrateKeysLimiter  migrateLimiter
+	migrateBytesLimiter migrateLimiter
+)
+
+// migrateLimiter spreads the work of every migrating slot of the node evenly
+// over time so that together they stay under one rate.
+type migrateLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until n more units fit in rate units per second, a rate of 0 is
+// unlimited.
+func (l *migrateLimiter) wait(n, rate int64) {
+	if rate <= 0 || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	l.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+func migrateThrottleKeys(n int64) {
+	migrateKeysLimiter.wait(n, config.Runtime().Migrate.MaxKeysPerSecond)
+}
+
+// waitRunnable parks the migration while it is paused and fails it once it
+// is canceled.
+func (m *Migrate) waitRunnable() error {
+	for m.paused.Load() && !m.canceled.Load() {
+		time.Sleep(migratePauseInterval)
+	}
+	if m.canceled.Load() {
+		return errn.ErrMigrateCanceled
+	}
+	return nil
+}
+
+func (m *Migrate) isRunning() bool {
+	return m.status == MigrateStatusProcess && !m.paused.Load()
+}
+
+func (b *Bitalos) addMigrate(mg *Migrate) {
+	if prev, ok := b.migrates[mg.slotId]; !ok || prev == nil {
+		b.migrating.Add(1)
+	}
+	b.migrates[mg.slotId] = mg
+	b.bitsdb.StringObj.BaseDb.BitmapMem.StartMigrate(mg.slotId)
+}
+
+func (b *Bitalos) removeMigrate(slotId uint32) *Migrate {
+	mg, ok := b.migrates[slotId]
+	if !ok {
+		return nil
+	}
+	delete(b.migrates, slotId)
+	b.migrating.Add(-1)
+	b.bitsdb.StringObj.BaseDb.BitmapMem.ClearMigrate(slotId)
+	return mg
+}
+
+func (b *Bitalos) GetMigrate(slotId uint32) *Migrate {
+	if b.migrating.Load() == 0 {
+		return nil
+	}
+	b.migrateMu.RLock()
+	defer b.migrateMu.RUnlock()
+	return b.migrates[slotId]
+}
+
+// Migrates returns the registered migrations ordered by slot.
+func (b *Bitalos) Migrates() []*Migrate {
+	b.migrateMu.RLock()
+	list := make([]*Migrate, 0, len(b.migrates))
+	for _, mg := range b.migrates {
+		list = append(list, mg)
+	}
+	b.migrateMu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].slotId < list[j].slotId
+	})
+	return list
+}
+
+// IsMigrating reports whether a migration task of the node is copying data.
+func (b *Bitalos) IsMigrating() bool {
+	for _, mg := range b.Migrates() {
+		if mg.IsMigrate.Load() == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Bitalos) runningMigrates(except uint32) int {
+	n := 0
+	for slotId, mg := range b.migrates {
+		if slotId != except && mg.isRunning() {
+			n++
+		}
+	}
+	return n
+}
+
+// MigratePause parks the migration task of a slot, its moved keys are still
+// redirected.
+func (b *Bitalos) MigratePause(slotId uint32) error {
+	mg := b.GetMigrate(slotId)
+	if mg == nil {
+		return errn.ErrMigrateNotExist
+	}
+	mg.paused.Store(true)
+	mg.saveState()
+	log.Infof("migrate pause toHost:%s slotId:%d", mg.toHost, slotId)
+	return nil
+}
+
+func (b *Bitalos) MigrateResume(slotId uint32) error {
+	b.migrateMu.Lock()
+	defer b.migrateMu.Unlock()
+	mg := b.migrates[slotId]
+	if mg == nil {
+		return errn.ErrMigrateNotExist
+	}
+	if !mg.paused.Load() {
+		return nil
+	}
+	if mg.status == MigrateStatusProcess && b.runningMigrates(slotId) >= config.Runtime().Migrate.MaxConcurrentSlots {
+		return errn.ErrMigrateRunning
+	}
+	mg.paused.Store(false)
+	mg.saveState()
+	log.Infof("migrate resume toHost:%s slotId:%d", mg.toHost, slotId)
+	return nil
+}
+
+// MigrateCancel stops the migration task of a slot. A migration that did not
+// send anything to the target yet or that was rolled back by its verification
+// is dropped and the slot is whole again on this node, it returns true. Otherwise the moved keys keep being redirected
+// and the slot resumes from its cursor on the next migrateslots.
+func (b *Bitalos) MigrateCancel(slotId uint32) (bool, error) {
+	mg := b.GetMigrate(slotId)
+	if mg == nil {
+		return false, errn.ErrMigrateNotExist
+	}
+
+	mg.canceled.Store(true)
+	mg.runWg.Wait()
+	mg.canceled.Store(false)
+	mg.paused.Store(false)
+
+	stats := mg.Stats()
+	if (stats.Total == 0 && stats.Copied == 0) || stats.Status == MigrateStatusRollback {
+		b.migrateMu.Lock()
+		if b.migrates[slotId] == mg {
+			b.removeMigrate(slotId)
+		}
+		b.migrateMu.Unlock()
+		mg.removeState()
+		log.Infof("migrate cancel drop toHost:%s slotId:%d", mg.toHost, slotId)
+		return true, nil
+	}
+	mg.saveState()
+	log.Infof("migrate cancel toHost:%s slotId:%d total:%d copied:%d", mg.toHost, slotId, stats.Total, stats.Copied)
+	return false, nil
+}
@@ -0,0 +1,312 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+)
+
+const migrateStateDir = "migrate"
+
+const (
+	migratePhaseScan   = 0
+	migratePhaseCopy   = 1
+	migratePhaseVerify = 2
+)
+
+const (
+	migrateDirtyAdd byte = 1
+	migrateDirtyDel byte = 2
+)
+
+// migrateState is the progress of a slot migration persisted under the db
+// path. It survives a restart so the node keeps redirecting the keys already
+// moved and resumes the slot from Cursor instead of starting it over.
+type migrateState struct {
+	SlotId    uint32 `json:"slot_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Status    int64  `json:"status"`
+	Bulk      bool   `json:"bulk"`
+	Retry     bool   `json:"retry"`
+	Paused    bool   `json:"paused"`
+	Phase     int    `json:"phase"`
+	Round     int    `json:"round"`
+	Cursor    []byte `json:"cursor"`
+	Copied    int64  `json:"copied"`
+	Total     int64  `json:"total"`
+	Fails     int64  `json:"fails"`
+	BeginTime int64  `json:"begin_time"`
+
+	Verified   int64             `json:"verified,omitempty"`
+	Mismatches int64             `json:"mismatches,omitempty"`
+	FailedKeys []migrateMismatch `json:"failed_keys,omitempty"`
+}
+
+func (m *Migrate) stateFile() string {
+	return filepath.Join(m.stateDir, fmt.Sprintf("%d.json", m.slotId))
+}
+
+func (m *Migrate) dirtyFile() string {
+	return filepath.Join(m.stateDir, fmt.Sprintf("%d.dirty", m.slotId))
+}
+
+// checkpoint records the position the migration resumes from.
+func (m *Migrate) checkpoint(phase, round int, cursor []byte) {
+	m.stateMu.Lock()
+	m.phase = phase
+	m.round = round
+	m.cursor = append(m.cursor[:0], cursor...)
+	m.stateMu.Unlock()
+	m.saveState()
+}
+
+func (m *Migrate) resumeCursor() []byte {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if len(m.cursor) == 0 {
+		return nil
+	}
+	return append([]byte(nil), m.cursor...)
+}
+
+func (m *Migrate) saveState() {
+	if m.stateDir == "" {
+		return
+	}
+
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	if m.over.Load() {
+		return
+	}
+	st := migrateState{
+		SlotId:    m.slotId,
+		From:      m.fromHost,
+		To:        m.toHost,
+		Status:    m.status,
+		Bulk:      m.bulk,
+		Retry:     m.retry,
+		Paused:    m.paused.Load(),
+		Phase:     m.phase,
+		Round:     m.round,
+		Cursor:    m.cursor,
+		Copied:    atomic.LoadInt64(&m.copied),
+		Total:     atomic.LoadInt64(&m.total),
+		Fails:     atomic.LoadInt64(&m.fails),
+		BeginTime: m.beginTime.Unix(),
+	}
+	st.Verified, st.Mismatches, st.FailedKeys = m.migrateVerifyInfo()
+	data, err := json.Marshal(&st)
+	if err == nil {
+		err = writeMigrateFile(m.stateFile(), data)
+	}
+	if err != nil {
+		log.Warnf("migrate save state slotId:%d err:%s", m.slotId, err)
+	}
+}
+
+// removeState drops the persisted progress, the migration is not saved again.
+func (m *Migrate) removeState() {
+	if m.stateDir == "" {
+		return
+	}
+
+	m.stateMu.Lock()
+	m.over.Store(true)
+	m.stateMu.Unlock()
+
+	m.dirtyMu.Lock()
+	if m.journal != nil {
+		m.journal.Close()
+		m.journal = nil
+	}
+	m.dirtyMu.Unlock()
+	for _, file := range []string{m.stateFile(), m.dirtyFile()} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Warnf("migrate remove state file:%s err:%s", file, err)
+		}
+	}
+}
+
+func writeMigrateFile(file string, data []byte) error {
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// openDirtyJournal rewrites the dirty key journal from the dirty set, later
+// changes of the set are appended to it. The caller holds dirtyMu.
+func (m *Migrate) openDirtyJournal() {
+	if m.stateDir == "" {
+		return
+	}
+	if m.journal != nil {
+		m.journal.Close()
+		m.journal = nil
+	}
+
+	buf := make([]byte, 0, 4096)
+	for key := range m.dirty {
+		buf = appendDirtyRecord(buf, migrateDirtyAdd, []byte(key))
+	}
+	if err := writeMigrateFile(m.dirtyFile(), buf); err != nil {
+		log.Warnf("migrate write dirty journal slotId:%d err:%s", m.slotId, err)
+		return
+	}
+	f, err := os.OpenFile(m.dirtyFile(), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Warnf("migrate open dirty journal slotId:%d err:%s", m.slotId, err)
+		return
+	}
+	m.journal = f
+}
+
+// appendDirty journals a change of the dirty set, the caller holds dirtyMu.
+func (m *Migrate) appendDirty(op byte, key []byte) {
+	if m.journal == nil {
+		return
+	}
+	if _, err := m.journal.Write(appendDirtyRecord(nil, op, key)); err != nil {
+		log.Warnf("migrate append dirty journal slotId:%d err:%s", m.slotId, err)
+	}
+}
+
+func appendDirtyRecord(buf []byte, op byte, key []byte) []byte {
+	buf = append(buf, op)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	return append(buf, key...)
+}
+
+func loadDirtyJournal(file string) (map[string]struct{}, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	dirty := make(map[string]struct{})
+	r := bufio.NewReader(f)
+	for {
+		op, err := r.ReadByte()
+		if err == io.EOF {
+			return dirty, nil
+		} else if err != nil {
+			return nil, err
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return dirty, nil
+		}
+		key := make([]byte, n)
+		if _, err = io.ReadFull(r, key); err != nil {
+			return dirty, nil
+		}
+		if op == migrateDirtyAdd {
+			dirty[string(key)] = struct{}{}
+		} else {
+			delete(dirty, string(key))
+		}
+	}
+}
+
+func (b *Bitalos) closeMigrates() {
+	for _, mg := range b.Migrates() {
+		mg.canceled.Store(true)
+		mg.runWg.Wait()
+		mg.dirtyMu.Lock()
+		if mg.journal != nil {
+			mg.journal.Close()
+			mg.journal = nil
+		}
+		mg.dirtyMu.Unlock()
+	}
+}
+
+// loadMigrates registers the migrations left unfinished by the last run, they
+// redirect the moved keys right away and resume once migrateslots is sent
+// again for their slot.
+func (b *Bitalos) loadMigrates() {
+	entries, err := os.ReadDir(b.migrateDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("migrate read state dir:%s err:%s", b.migrateDir, err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(b.migrateDir, entry.Name()))
+		if err != nil {
+			log.Warnf("migrate read state file:%s err:%s", entry.Name(), err)
+			continue
+		}
+		var st migrateState
+		if err = json.Unmarshal(data, &st); err != nil {
+			log.Warnf("migrate decode state file:%s err:%s", entry.Name(), err)
+			continue
+		}
+
+		mg := b.NewMigrate(st.SlotId, st.To, st.From)
+		mg.db = b.bitsdb
+		mg.bulk = st.Bulk
+		mg.retry = st.Retry
+		mg.phase = st.Phase
+		mg.round = st.Round
+		mg.cursor = st.Cursor
+		mg.copied = st.Copied
+		mg.total = st.Total
+		mg.fails = st.Fails
+		mg.beginTime = time.Unix(st.BeginTime, 0)
+		mg.paused.Store(st.Paused)
+		mg.verified, mg.mismatches, mg.failedKeys = st.Verified, st.Mismatches, st.FailedKeys
+		if st.Status == MigrateStatusFinish || st.Status == MigrateStatusRollback {
+			mg.status = st.Status
+		}
+		if mg.bulk {
+			if mg.dirty, err = loadDirtyJournal(mg.dirtyFile()); err != nil {
+				log.Warnf("migrate load dirty journal slotId:%d err:%s", st.SlotId, err)
+			}
+			if mg.dirty == nil && mg.status != MigrateStatusFinish && mg.status != MigrateStatusRollback {
+				log.Warnf("migrate dirty journal lost slotId:%d", st.SlotId)
+				mg.dirty = make(map[string]struct{})
+			}
+			if mg.dirty != nil {
+				mg.openDirtyJournal()
+			}
+		}
+		b.addMigrate(mg)
+		log.Infof("migrate restore slotId:%d toHost:%s status:%d phase:%d round:%d cursor:%s", st.SlotId, st.To, st.Status, st.Phase, st.Round, string(st.Cursor))
+	}
+}
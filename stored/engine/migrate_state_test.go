@@ -0,0 +1,86 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+)
+
+func TestMigrateStateRestore(t *testing.T) {
+	config.GlobalConfig.Plugin.OpenRaft = false
+	const testDir = "testmigrate"
+	os.RemoveAll(testDir)
+	defer func() {
+		os.RemoveAll(testDir)
+		config.GlobalConfig.Plugin.OpenRaft = true
+	}()
+
+	db, err := NewBitalos(testDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mg := db.NewMigrate(7, "127.0.0.1:8191", "127.0.0.1:8291")
+	mg.db = db.bitsdb
+	mg.bulk = true
+	mg.status = MigrateStatusProcess
+	db.migrateMu.Lock()
+	db.addMigrate(mg)
+	db.migrateMu.Unlock()
+	mg.initDirty()
+	mg.markDirty([]byte("k1"))
+	mg.markDirty([]byte("k2"))
+	mg.takeDirty([]byte("k1"))
+	mg.checkpoint(migratePhaseScan, 1, []byte("k9"))
+	db.Close()
+
+	db, err = NewBitalos(testDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mg = db.GetMigrate(7)
+	if mg == nil {
+		t.Fatal("migrate not restored")
+	}
+	if mg.status != MigrateStatusPrepare || !mg.bulk || mg.toHost != "127.0.0.1:8191" {
+		t.Fatalf("restored status:%d bulk:%v toHost:%s", mg.status, mg.bulk, mg.toHost)
+	}
+	if mg.phase != migratePhaseScan || mg.round != 1 || !bytes.Equal(mg.resumeCursor(), []byte("k9")) {
+		t.Fatalf("restored phase:%d round:%d cursor:%s", mg.phase, mg.round, mg.resumeCursor())
+	}
+	if mg.isDirty([]byte("k1")) || !mg.isDirty([]byte("k2")) {
+		t.Fatal("restored dirty keys mismatch")
+	}
+	if db.GetMigrate(8) != nil {
+		t.Fatal("unexpected migrate of slot 8")
+	}
+
+	dropped, err := db.MigrateCancel(7)
+	if err != nil {
+		t.Fatal(err)
+	} else if !dropped {
+		t.Fatal("migrate without moved keys not dropped")
+	}
+	if db.GetMigrate(7) != nil {
+		t.Fatal("canceled migrate still registered")
+	}
+	if _, err = os.Stat(mg.stateFile()); !os.IsNotExist(err) {
+		t.Fatalf("state file not removed err:%v", err)
+	}
+}
@@ -0,0 +1,390 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+)
+
+// MigrateDigestCmd returns the digests of keys of a slot on the target.
+const MigrateDigestCmd = "migratedigest"
+
+const (
+	migrateVerifyBatch      = 100
+	migrateVerifyFailedKeys = 100
+	migrateVerifyTTLSlack   = int64(time.Second / time.Millisecond)
+	migrateDigestScanCount  = 500
+)
+
+// A verified migration holds the slot on the source until the copy matches:
+// during the bulk copy and the verify phase nothing is deleted locally, so
+// keys missing on the source are not redirected and the source stays the
+// only owner of the slot. The verify phase compares the digest of every clean
+// key with the one of the target, dirty keys are replayed by the catch-up
+// anyway. Mismatching keys within verify_max_mismatch are marked dirty, the
+// catch-up copies them again instead of deleting them as clean. Too many
+// mismatches delete the copy on the target and end the migration with
+// MigrateStatusRollback, the dashboard then keeps the slot.
+
+// migrateMismatch is a key whose copy differs from the source.
+type migrateMismatch struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// keyDigest sums up a key: its type, expire deadline in milliseconds or -1,
+// number of members and a hash of its content.
+type keyDigest struct {
+	dt       string
+	deadline int64
+	size     int64
+	sum      uint64
+}
+
+func (d *keyDigest) String() string {
+	return fmt.Sprintf("%s %d %d %x", d.dt, d.deadline, d.size, d.sum)
+}
+
+func parseKeyDigest(s string) (*keyDigest, error) {
+	d := &keyDigest{}
+	if _, err := fmt.Sscanf(s, "%s %d %d %x", &d.dt, &d.deadline, &d.size, &d.sum); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// diff returns why the target digest remote differs, remote is empty if the
+// target does not have the key.
+func (d *keyDigest) diff(remote string) string {
+	if remote == "" {
+		if d.deadline >= 0 && d.deadline <= time.Now().UnixMilli()+migrateVerifyTTLSlack {
+			return ""
+		}
+		return "missing"
+	}
+	r, err := parseKeyDigest(remote)
+	if err != nil {
+		return "invalid digest"
+	}
+	switch {
+	case d.dt != r.dt:
+		return "type"
+	case d.size != r.size:
+		return "size"
+	case d.sum != r.sum:
+		return "content"
+	case (d.deadline < 0) != (r.deadline < 0):
+		return "ttl"
+	case d.deadline >= 0 && (d.deadline-r.deadline > migrateVerifyTTLSlack || r.deadline-d.deadline > migrateVerifyTTLSlack):
+		return "ttl"
+	}
+	return ""
+}
+
+// migrateItemSum hashes a member of a collection, members are summed up so
+// the digest does not depend on the scan order.
+func migrateItemSum(parts ...[]byte) uint64 {
+	h := fnv.New64a()
+	var n [binary.MaxVarintLen64]byte
+	for _, part := range parts {
+		h.Write(n[:binary.PutUvarint(n[:], uint64(len(part)))])
+		h.Write(part)
+	}
+	return h.Sum64()
+}
+
+// migrateKeyDigest computes the digest of a key, it returns nil if the key
+// does not exist.
+func migrateKeyDigest(db *bitsdb.BitsDB, key []byte, khash uint32) (*keyDigest, error) {
+	t, err := db.StringObj.Type(key, khash)
+	if err != nil {
+		return nil, err
+	}
+	dt := btools.StringToDataType(t)
+	if t == btools.ZSetOldName {
+		dt = btools.ZSET
+	}
+	if dt == btools.NoneType {
+		return nil, nil
+	}
+
+	ttl, err := db.StringObj.PTTL(key, khash)
+	if err != nil {
+		return nil, err
+	} else if ttl < -1 {
+		return nil, nil
+	}
+	d := &keyDigest{dt: dt.String(), deadline: -1}
+	if ttl >= 0 {
+		d.deadline = time.Now().UnixMilli() + ttl
+	}
+
+	var cursor []byte
+	switch dt {
+	case btools.STRING:
+		val, closer, err := db.StringObj.Get(key, khash)
+		if closer != nil {
+			defer closer()
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.size = int64(len(val))
+		d.sum = migrateItemSum(val)
+	case btools.HASH:
+		for {
+			next, pairs, err := db.HashObj.HScan(key, khash, cursor, migrateDigestScanCount, "")
+			if err != nil {
+				return nil, err
+			}
+			for _, pair := range pairs {
+				d.size++
+				d.sum += migrateItemSum(pair.Field, pair.Value)
+			}
+			if bytes.Equal(next, btools.ScanEndCurosr) {
+				break
+			}
+			cursor = next
+		}
+	case btools.SET:
+		for {
+			next, members, err := db.SetObj.SScan(key, khash, cursor, migrateDigestScanCount, "")
+			if err != nil {
+				return nil, err
+			}
+			for _, member := range members {
+				d.size++
+				d.sum += migrateItemSum(member)
+			}
+			if bytes.Equal(next, btools.ScanEndCurosr) {
+				break
+			}
+			cursor = next
+		}
+	case btools.ZSET:
+		var score [8]byte
+		for {
+			next, pairs, err := db.ZsetObj.ZScan(key, khash, cursor, migrateDigestScanCount, "")
+			if err != nil {
+				return nil, err
+			}
+			for _, pair := range pairs {
+				binary.BigEndian.PutUint64(score[:], math.Float64bits(pair.Score))
+				d.size++
+				d.sum += migrateItemSum(pair.Member, score[:])
+			}
+			if bytes.Equal(next, btools.ScanEndCurosr) {
+				break
+			}
+			cursor = next
+		}
+	case btools.LIST:
+		h := fnv.New64a()
+		for start := int64(0); ; start += migrateDigestScanCount {
+			items, err := db.ListObj.LRange(key, khash, start, start+migrateDigestScanCount-1)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				d.size++
+				binary.Write(h, binary.BigEndian, migrateItemSum(item))
+			}
+			if len(items) < migrateDigestScanCount {
+				break
+			}
+		}
+		d.sum = h.Sum64()
+	}
+	return d, nil
+}
+
+func (m *Migrate) addVerified(key []byte, reason string) {
+	m.verifyMu.Lock()
+	defer m.verifyMu.Unlock()
+	if reason == "" {
+		m.verified++
+		return
+	}
+	m.mismatches++
+	if m.mismatches <= config.Runtime().Migrate.VerifyMaxMismatch {
+		m.repairKeys = append(m.repairKeys, append([]byte(nil), key...))
+	}
+	if len(m.failedKeys) < migrateVerifyFailedKeys {
+		m.failedKeys = append(m.failedKeys, migrateMismatch{Key: string(key), Reason: reason})
+	}
+	log.Warnf("migrate verify mismatch slotId:%d key:%s reason:%s", m.slotId, string(key), reason)
+}
+
+// holdsSlot reports whether the source still owns every key of the slot, it
+// does not redirect keys it misses then.
+func (m *Migrate) holdsSlot() bool {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	return m.bulk && m.phase != migratePhaseScan
+}
+
+func (m *Migrate) migrateVerifyKeys(pairs []btools.ScanPair, conn redis.Conn) error {
+	local := make([]*keyDigest, len(pairs))
+	args := make([]interface{}, 0, len(pairs)+1)
+	args = append(args, m.slotId)
+	for i, pair := range pairs {
+		khash, _ := m.getKeyHash(pair.Key)
+		d, err := migrateKeyDigest(m.db, pair.Key, khash)
+		if err != nil {
+			return err
+		}
+		local[i] = d
+		args = append(args, pair.Key)
+	}
+
+	remote, err := redis.Strings(conn.Do(MigrateDigestCmd, args...))
+	if err != nil {
+		log.Errorf("migrate verify digest slotId:%d err:%s", m.slotId, err)
+		return err
+	} else if len(remote) != len(pairs) {
+		return fmt.Errorf("migrate verify digest slotId:%d got %d of %d keys", m.slotId, len(remote), len(pairs))
+	}
+	for i, pair := range pairs {
+		if local[i] == nil || m.isDirty(pair.Key) {
+			continue
+		}
+		m.addVerified(pair.Key, local[i].diff(remote[i]))
+	}
+	return nil
+}
+
+// migrateVerify compares the keys copied to the target with the source and
+// rolls the copy back if too many of them differ.
+func (m *Migrate) migrateVerify(isMaster func() bool) error {
+	m.verifyMu.Lock()
+	m.verified, m.mismatches, m.failedKeys, m.repairKeys = 0, 0, nil, nil
+	m.verifyMu.Unlock()
+
+	conn := m.getConn()
+	defer conn.Close()
+
+	var cursor []byte
+	limit := 1000
+	for {
+		if isMaster == nil || !isMaster() {
+			return errors.New("migrate verify error: server is not master")
+		}
+		if err := m.waitRunnable(); err != nil {
+			return err
+		}
+		next, list, err := m.db.ScanBySlotId(m.slotId, cursor, limit, "*")
+		if err != nil {
+			log.Warnf("migrate verify scan slotId:%d err:%s", m.slotId, err)
+			return err
+		}
+		for i := 0; i < len(list); i += migrateVerifyBatch {
+			j := i + migrateVerifyBatch
+			if j > len(list) {
+				j = len(list)
+			}
+			if err = m.migrateVerifyKeys(list[i:j], conn); err != nil {
+				return err
+			}
+		}
+		if len(list) < limit || bytes.Equal(next, btools.ScanEndCurosr) {
+			break
+		}
+		cursor = next
+	}
+
+	m.verifyMu.Lock()
+	verified, mismatches, repairKeys := m.verified, m.mismatches, m.repairKeys
+	m.repairKeys = nil
+	m.verifyMu.Unlock()
+	log.Infof("migrate verify finish slotId:%d verified:%d mismatches:%d", m.slotId, verified, mismatches)
+	if mismatches <= config.Runtime().Migrate.VerifyMaxMismatch {
+		for _, key := range repairKeys {
+			m.markDirty(key)
+		}
+		return nil
+	}
+	if err := m.migrateRollback(conn); err != nil {
+		return err
+	}
+	return errn.ErrMigrateVerify
+}
+
+// migrateRollback deletes the copy of the slot on the target, the keys of the
+// slot and the dirty ones cover every key the copy sent.
+func (m *Migrate) migrateRollback(conn redis.Conn) error {
+	var cursor []byte
+	limit := 1000
+	for {
+		next, list, err := m.db.ScanBySlotId(m.slotId, cursor, limit, "*")
+		if err != nil {
+			return err
+		}
+		for _, pair := range list {
+			if err = m.migrateBulkDelTarget(pair.Key, conn); err != nil {
+				return err
+			}
+		}
+		if len(list) < limit || bytes.Equal(next, btools.ScanEndCurosr) {
+			break
+		}
+		cursor = next
+	}
+	for _, key := range m.dirtyKeys() {
+		if err := m.migrateBulkDelTarget(key, conn); err != nil {
+			return err
+		}
+	}
+	m.clearDirty()
+	log.Warnf("migrate rollback slotId:%d toHost:%s", m.slotId, m.toHost)
+	return nil
+}
+
+// MigrateDigest returns the digests of keys of a slot, an empty one for a
+// missing key.
+func (b *Bitalos) MigrateDigest(slotId uint32, keys [][]byte) ([][]byte, error) {
+	res := make([][]byte, len(keys))
+	for i, key := range keys {
+		d, err := migrateKeyDigest(b.bitsdb, key, migrateKeyHash(slotId, key))
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			res[i] = []byte{}
+		} else {
+			res[i] = []byte(d.String())
+		}
+	}
+	return res, nil
+}
+
+// migrateVerifyInfo is the verify part of Info.
+func (m *Migrate) migrateVerifyInfo() (int64, int64, []migrateMismatch) {
+	m.verifyMu.Lock()
+	defer m.verifyMu.Unlock()
+	return m.verified, m.mismatches, m.failedKeys
+}
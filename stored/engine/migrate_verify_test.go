@@ -0,0 +1,219 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils/hash"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/utils"
+)
+
+func TestMigrateKeyDigestDiff(t *testing.T) {
+	now := time.Now().UnixMilli()
+	d := &keyDigest{dt: "hash", deadline: now + 60000, size: 3, sum: 0xabc}
+	if r, err := parseKeyDigest(d.String()); err != nil || *r != *d {
+		t.Fatalf("parse digest:%v err:%v", r, err)
+	}
+
+	for _, c := range []struct {
+		remote *keyDigest
+		reason string
+	}{
+		{&keyDigest{dt: "hash", deadline: now + 60500, size: 3, sum: 0xabc}, ""},
+		{&keyDigest{dt: "set", deadline: now + 60000, size: 3, sum: 0xabc}, "type"},
+		{&keyDigest{dt: "hash", deadline: now + 60000, size: 2, sum: 0xabc}, "size"},
+		{&keyDigest{dt: "hash", deadline: now + 60000, size: 3, sum: 0xabd}, "content"},
+		{&keyDigest{dt: "hash", deadline: -1, size: 3, sum: 0xabc}, "ttl"},
+		{&keyDigest{dt: "hash", deadline: now + 90000, size: 3, sum: 0xabc}, "ttl"},
+	} {
+		if reason := d.diff(c.remote.String()); reason != c.reason {
+			t.Fatalf("diff %s got:%q expect:%q", c.remote, reason, c.reason)
+		}
+	}
+	if reason := d.diff(""); reason != "missing" {
+		t.Fatalf("diff missing got:%q", reason)
+	}
+	expired := &keyDigest{dt: "string", deadline: now + 10, size: 1, sum: 1}
+	if reason := expired.diff(""); reason != "" {
+		t.Fatalf("diff expired got:%q", reason)
+	}
+}
+
+// migrateFakeTarget answers every digest with a missing key and every other
+// command with 1, the commands it got are sent to the returned channel.
+func migrateFakeTarget(t *testing.T) (string, chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	cmds := make(chan []string, 100)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					args, err := readFakeCommand(r)
+					if err != nil {
+						return
+					}
+					cmds <- args
+					if strings.EqualFold(args[0], MigrateDigestCmd) {
+						reply := fmt.Sprintf("*%d\r\n", len(args)-2)
+						for i := 2; i < len(args); i++ {
+							reply += "$0\r\n\r\n"
+						}
+						io.WriteString(c, reply)
+					} else {
+						io.WriteString(c, ":1\r\n")
+					}
+				}
+			}(c)
+		}
+	}()
+	return ln.Addr().String(), cmds
+}
+
+func readFakeCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func drainFakeCommands(cmds chan []string) (res [][]string) {
+	for {
+		select {
+		case args := <-cmds:
+			res = append(res, args)
+		default:
+			return res
+		}
+	}
+}
+
+func TestMigrateVerifyRollback(t *testing.T) {
+	config.GlobalConfig.Plugin.OpenRaft = false
+	const testDir = "testmigrateverify"
+	os.RemoveAll(testDir)
+	defer func() {
+		os.RemoveAll(testDir)
+		config.GlobalConfig.Plugin.OpenRaft = true
+	}()
+
+	db, err := NewBitalos(testDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	key := []byte("migrate_verify_k1")
+	khash := hash.Fnv32(key)
+	slot := khash % utils.TotalSlot
+	if err = db.bitsdb.StringObj.Set(key, khash, []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	addr, cmds := migrateFakeTarget(t)
+	prev := config.Runtime()
+	defer config.StoreRuntime(prev)
+	verify := func(maxMismatch int64) (*Migrate, error) {
+		next := *prev
+		next.Migrate.VerifyMaxMismatch = maxMismatch
+		config.StoreRuntime(&next)
+
+		mg := db.NewMigrate(slot, addr, "127.0.0.1:0")
+		t.Cleanup(func() { mg.Conn.Close() })
+		mg.db = db.bitsdb
+		mg.bulk = true
+		mg.initDirty()
+		return mg, mg.migrateVerify(func() bool { return true })
+	}
+
+	mg, err := verify(1)
+	if err != nil {
+		t.Fatalf("verify within max mismatch err:%v", err)
+	}
+	if _, mismatches, failed := mg.migrateVerifyInfo(); mismatches != 1 || len(failed) != 1 || failed[0].Reason != "missing" {
+		t.Fatalf("verify mismatches:%d failed:%v", mismatches, failed)
+	}
+	if !mg.isDirty(key) {
+		t.Fatal("mismatching key not marked dirty")
+	}
+	for _, args := range drainFakeCommands(cmds) {
+		if !strings.EqualFold(args[0], MigrateDigestCmd) {
+			t.Fatalf("unexpected command on target:%v", args)
+		}
+	}
+	mg.clearDirty()
+
+	mg, err = verify(0)
+	if !errors.Is(err, errn.ErrMigrateVerify) {
+		t.Fatalf("verify over max mismatch err:%v", err)
+	}
+	if status := migrateErrStatus(err); status != MigrateStatusRollback {
+		t.Fatalf("verify over max mismatch status:%d", status)
+	}
+	var deleted bool
+	for _, args := range drainFakeCommands(cmds) {
+		if len(args) == 4 && strings.EqualFold(args[0], MigrateWriteCmd) && args[2] == "del" && args[3] == string(key) {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Fatal("copy not deleted on the target")
+	}
+	if mg.isDirty(key) {
+		t.Fatal("dirty keys not cleared by the rollback")
+	}
+}
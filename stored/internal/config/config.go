@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"os"
 	"path"
+	"sync/atomic"
 
 	"github.com/BurntSushi/toml"
 	"github.com/zuoyebang/bitalostored/butils/bytesize"
@@ -34,10 +35,30 @@ type Config struct {
 	RaftNodeHost    RaftNodeHostConfig `toml:"raft_nodehost" mapstructure:"raft_nodehost"`
 	RaftState       RaftStateConfig    `toml:"raft_state" mapstructure:"raft_state"`
 	DynamicDeadline DynamicDeadline    `toml:"dynamic_deadline" mapstructure:"dynamic_deadline"`
+	Tracing         TracingConfig      `toml:"tracing" mapstructure:"tracing"`
+	Admission       AdmissionConfig    `toml:"admission" mapstructure:"admission"`
+	Migrate         MigrateConfig      `toml:"migrate" mapstructure:"migrate"`
 }
 
 var GlobalConfig = NewDefaultConfig()
 
+var runtimeConfig atomic.Pointer[Config]
+
+// Runtime returns the config with the changes of CONFIG SET applied. A published
+// snapshot is never modified, settings changeable at runtime are read from it
+// without locks.
+func Runtime() *Config {
+	if c := runtimeConfig.Load(); c != nil {
+		return c
+	}
+	return GlobalConfig
+}
+
+// StoreRuntime publishes c, a changed copy of Runtime(), as the new snapshot.
+func StoreRuntime(c *Config) {
+	runtimeConfig.Store(c)
+}
+
 func NewDefaultConfig() *Config {
 	c := &Config{}
 	toml.Decode(DefaultConfig, c)
@@ -95,6 +116,15 @@ func (c *Config) CheckIsDegradeSingleNode() bool {
 	return c.Server.DegradeSingleNode
 }
 
+// MigrateToken returns the credential of internal migration connections,
+// empty if they are not authenticated.
+func (c *Config) MigrateToken() string {
+	if c.Migrate.AuthToken != "" {
+		return c.Migrate.AuthToken
+	}
+	return c.Server.Token
+}
+
 func (c *Config) SetDegradeSingleNode() error {
 	c.Plugin.OpenRaft = false
 	c.Server.DegradeSingleNode = true
@@ -122,6 +152,7 @@ func (c *Config) String() string {
 type LogConfig struct {
 	IsDebug      bool   `toml:"is_debug" mapstructure:"is_debug"`
 	RotationTime string `toml:"rotation_time" mapstructure:"rotation_time"`
+	AuditLog     bool   `toml:"audit_log" mapstructure:"audit_log"`
 }
 
 type ServerConfig struct {
@@ -142,8 +173,9 @@ type ServerConfig struct {
 	SlowTTL           timesize.Duration `toml:"slow_ttl" mapstructure:"slow_ttl"`
 	SlowMaxExec       int               `toml:"slow_maxexec" mapstructure:"slow_maxexec"`
 	SlowTopN          int               `toml:"slow_topn" mapstructure:"slow_topn"`
+	SlowLogMaxLen     int               `toml:"slowlog_max_len" mapstructure:"slowlog_max_len"`
 
-	Token             string `toml:"token" mapstructure:"token"`
+	Token             string `toml:"token" mapstructure:"token" secret:"true"`
 	DegradeSingleNode bool   `toml:"degrade_signle_node" mapstructure:"degrade_signle_node"`
 	OpenDistributedTx bool   `toml:"open_distributed_tx" mapstructure:"open_distributed_tx"`
 }
@@ -178,6 +210,10 @@ type BitalosConfig struct {
 	BitmapCacheItemCount            int            `toml:"bitmap_cache_item_count" mapstructure:"bitmap_cache_item_count"`
 	BitpageFlushSize                int            `toml:"bitpage_flush_size" mapstructure:"bitpage_flush_size"`
 	BitpageSplitSize                int            `toml:"bitpage_split_size" mapstructure:"bitpage_split_size"`
+	DiskQuota                       bytesize.Int64 `toml:"disk_quota" mapstructure:"disk_quota"`
+	EvictionPolicy                  string         `toml:"eviction_policy" mapstructure:"eviction_policy"`
+	EvictionSamples                 int            `toml:"eviction_samples" mapstructure:"eviction_samples"`
+	EvictionMaxKeys                 int            `toml:"eviction_max_keys" mapstructure:"eviction_max_keys"`
 }
 
 type RaftQueueConfig struct {
@@ -198,6 +234,20 @@ type RaftNodeHostConfig struct {
 	MaxSnapshotRecvBytesPerSecond bytesize.Int64    `toml:"max_snapshot_recv_bytes_persecod" mapstructure:"max_snapshot_recv_bytes_persecod"`
 }
 
+type TracingConfig struct {
+	Enable         bool    `toml:"enable" mapstructure:"enable"`
+	SampleRatio    float64 `toml:"sample_ratio" mapstructure:"sample_ratio"`
+	Exporter       string  `toml:"exporter" mapstructure:"exporter"`
+	ExporterTarget string  `toml:"exporter_target" mapstructure:"exporter_target"`
+}
+
+// AdmissionConfig holds the thresholds above which writes are rejected, 0 disables a check.
+type AdmissionConfig struct {
+	MinFreeDisk        bytesize.Int64 `toml:"min_free_disk" mapstructure:"min_free_disk"`
+	RaftQueueHighWater int            `toml:"raft_queue_high_water" mapstructure:"raft_queue_high_water"`
+	MaxFollowerLag     int64          `toml:"max_follower_lag" mapstructure:"max_follower_lag"`
+}
+
 type RaftStateConfig struct {
 	Internal       timesize.Duration `toml:"interval" mapstructure:"interval"`
 	AllowMaxOffset int64             `toml:"allow_max_offset" mapstructure:"allow_max_offset"`
@@ -231,3 +281,38 @@ type DynamicDeadline struct {
 	ClientRatios      []int               `toml:"client_ratio_threshold" json:"client_ratio_threshold"`
 	DeadlineThreshold []timesize.Duration `toml:"deadline_threshold" json:"deadline_threshold"`
 }
+
+// MigrateConfig controls how a slot is moved to another group. In bulk mode the
+// slot is shipped as raw record batches of bulk_batch_size instead of being
+// replayed key by key. Up to max_concurrent_slots slots migrate at once and
+// share the max_keys_per_second and max_bytes_per_second throttle, 0 means
+// unlimited. Collections with more than chunk_threshold members are copied
+// chunk_size members at a time into a staging key on the target, 0 disables
+// chunking.
+//
+// With verify set a migration runs in bulk mode and, before the source drops
+// any key, compares the type, ttl, size and content of every copied key with
+// the target. More than verify_max_mismatch differing keys roll the target
+// copy back and leave the slot on the source.
+//
+// Migration and redirect connections authenticate with auth_token, or with
+// server.token if it is empty. With tls_port_offset set every node also serves
+// internal connections over TLS on its port plus the offset, and migrations
+// dial the target there with tls_cert_file and tls_key_file, verifying peers
+// against tls_ca_file.
+type MigrateConfig struct {
+	BulkMode           bool           `toml:"bulk_mode" mapstructure:"bulk_mode"`
+	BulkBatchSize      bytesize.Int64 `toml:"bulk_batch_size" mapstructure:"bulk_batch_size"`
+	MaxConcurrentSlots int            `toml:"max_concurrent_slots" mapstructure:"max_concurrent_slots"`
+	MaxKeysPerSecond   int64          `toml:"max_keys_per_second" mapstructure:"max_keys_per_second"`
+	MaxBytesPerSecond  bytesize.Int64 `toml:"max_bytes_per_second" mapstructure:"max_bytes_per_second"`
+	ChunkThreshold     int64          `toml:"chunk_threshold" mapstructure:"chunk_threshold"`
+	ChunkSize          int            `toml:"chunk_size" mapstructure:"chunk_size"`
+	Verify             bool           `toml:"verify" mapstructure:"verify"`
+	VerifyMaxMismatch  int64          `toml:"verify_max_mismatch" mapstructure:"verify_max_mismatch"`
+	AuthToken          string         `toml:"auth_token" mapstructure:"auth_token" secret:"true"`
+	TLSPortOffset      int            `toml:"tls_port_offset" mapstructure:"tls_port_offset"`
+	TLSCertFile        string         `toml:"tls_cert_file" mapstructure:"tls_cert_file"`
+	TLSKeyFile         string         `toml:"tls_key_file" mapstructure:"tls_key_file"`
+	TLSCAFile          string         `toml:"tls_ca_file" mapstructure:"tls_ca_file"`
+}
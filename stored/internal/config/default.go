@@ -41,6 +41,7 @@ open_gops = false
 [log]
 is_debug = true
 rotation_time = "Daily"
+audit_log = false
 
 [bitalos]
 write_buffer_size = "1gb"
@@ -90,4 +91,31 @@ allow_max_offset = 7500
 [dynamic_deadline]
 client_ratio_threshold = [0,20,50,80,90]
 deadline_threshold = ["1800s","600s","180s","60s","10s"]
+
+[tracing]
+enable = false
+sample_ratio = 0.001
+exporter = "file"
+exporter_target = "/tmp/stored.trace.json"
+
+[admission]
+min_free_disk = 0
+raft_queue_high_water = 0
+max_follower_lag = 0
+
+[migrate]
+bulk_mode = false
+bulk_batch_size = "1mb"
+max_concurrent_slots = 4
+max_keys_per_second = 0
+max_bytes_per_second = 0
+chunk_threshold = 10000
+chunk_size = 500
+verify = false
+verify_max_mismatch = 0
+auth_token = ""
+tls_port_offset = 0
+tls_cert_file = ""
+tls_key_file = ""
+tls_ca_file = ""
 `
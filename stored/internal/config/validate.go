@@ -22,6 +22,7 @@ import (
 
 	"github.com/zuoyebang/bitalostored/butils/bytesize"
 	"github.com/zuoyebang/bitalostored/butils/timesize"
+	"github.com/zuoyebang/bitalostored/butils/tracing"
 	"github.com/zuoyebang/bitalostored/stored/internal/log"
 )
 
@@ -32,8 +33,30 @@ const (
 	MaxCores           = 20
 	MinNetEventLoopNum = 8
 	MaxNetEventLoopNum = 256
+
+	DefaultSlowLogMaxLen = 128
+
+	DefaultEvictionSamples = 5
+	DefaultEvictionMaxKeys = 1000
+)
+
+const (
+	EvictionNoEviction    = "noeviction"
+	EvictionAllKeysLRU    = "allkeys-lru"
+	EvictionVolatileLRU   = "volatile-lru"
+	EvictionVolatileTTL   = "volatile-ttl"
+	EvictionAllKeysRandom = "allkeys-random"
 )
 
+func CheckEvictionPolicy(policy string) bool {
+	switch policy {
+	case EvictionNoEviction, EvictionAllKeysLRU, EvictionVolatileLRU, EvictionVolatileTTL, EvictionAllKeysRandom:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *Config) Validate() error {
 	if err := c.checkServerConfig(); err != nil {
 		return err
@@ -53,6 +76,15 @@ func (c *Config) Validate() error {
 	if err := c.checkRaftClusterConfig(); err != nil {
 		return err
 	}
+	if err := c.checkTracingConfig(); err != nil {
+		return err
+	}
+	if err := c.checkAdmissionConfig(); err != nil {
+		return err
+	}
+	if err := c.checkMigrateConfig(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -74,6 +106,9 @@ func (c *Config) checkServerConfig() error {
 	if c.Server.SlowTime <= 0 {
 		c.Server.SlowTime = timesize.Duration(30 * time.Millisecond)
 	}
+	if c.Server.SlowLogMaxLen <= 0 {
+		c.Server.SlowLogMaxLen = DefaultSlowLogMaxLen
+	}
 	if c.Server.Maxclient < 5000 {
 		c.Server.Maxclient = 5000
 	}
@@ -109,6 +144,21 @@ func (c *Config) checkBitalosConfig() error {
 		c.Bitalos.WriteBufferSize = maxWriteBuffer
 	}
 
+	if c.Bitalos.DiskQuota < 0 {
+		return errors.New("invalid bitalos disk_quota")
+	}
+	if c.Bitalos.EvictionPolicy == "" {
+		c.Bitalos.EvictionPolicy = EvictionNoEviction
+	} else if !CheckEvictionPolicy(c.Bitalos.EvictionPolicy) {
+		return errors.New("invalid bitalos eviction_policy")
+	}
+	if c.Bitalos.EvictionSamples <= 0 {
+		c.Bitalos.EvictionSamples = DefaultEvictionSamples
+	}
+	if c.Bitalos.EvictionMaxKeys <= 0 {
+		c.Bitalos.EvictionMaxKeys = DefaultEvictionMaxKeys
+	}
+
 	return nil
 }
 
@@ -130,3 +180,68 @@ func (c *Config) checkLRUCacheConfig() error {
 func (c *Config) checkRaftClusterConfig() error {
 	return nil
 }
+
+func (c *Config) checkTracingConfig() error {
+	if !c.Tracing.Enable {
+		return nil
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return errors.New("invalid tracing sample_ratio")
+	}
+	if c.Tracing.Exporter != tracing.ExporterFile && c.Tracing.Exporter != tracing.ExporterOTLP {
+		return errors.New("invalid tracing exporter")
+	}
+	if c.Tracing.ExporterTarget == "" {
+		return errors.New("invalid tracing exporter_target")
+	}
+	return nil
+}
+
+func (c *Config) checkAdmissionConfig() error {
+	if c.Admission.MinFreeDisk < 0 {
+		return errors.New("invalid admission min_free_disk")
+	}
+	if c.Admission.RaftQueueHighWater < 0 {
+		return errors.New("invalid admission raft_queue_high_water")
+	}
+	if c.Admission.MaxFollowerLag < 0 {
+		return errors.New("invalid admission max_follower_lag")
+	}
+	return nil
+}
+
+func (c *Config) checkMigrateConfig() error {
+	if c.Migrate.BulkBatchSize < 0 {
+		return errors.New("invalid migrate bulk_batch_size")
+	} else if c.Migrate.BulkBatchSize == 0 {
+		c.Migrate.BulkBatchSize = 1 << 20
+	}
+	if c.Migrate.MaxConcurrentSlots < 0 {
+		return errors.New("invalid migrate max_concurrent_slots")
+	} else if c.Migrate.MaxConcurrentSlots == 0 {
+		c.Migrate.MaxConcurrentSlots = 1
+	}
+	if c.Migrate.MaxKeysPerSecond < 0 {
+		return errors.New("invalid migrate max_keys_per_second")
+	}
+	if c.Migrate.MaxBytesPerSecond < 0 {
+		return errors.New("invalid migrate max_bytes_per_second")
+	}
+	if c.Migrate.ChunkThreshold < 0 {
+		return errors.New("invalid migrate chunk_threshold")
+	}
+	if c.Migrate.ChunkSize < 0 {
+		return errors.New("invalid migrate chunk_size")
+	} else if c.Migrate.ChunkSize == 0 {
+		c.Migrate.ChunkSize = 500
+	}
+	if c.Migrate.VerifyMaxMismatch < 0 {
+		return errors.New("invalid migrate verify_max_mismatch")
+	}
+	if c.Migrate.TLSPortOffset < 0 {
+		return errors.New("invalid migrate tls_port_offset")
+	} else if c.Migrate.TLSPortOffset > 0 && (c.Migrate.TLSCertFile == "" || c.Migrate.TLSKeyFile == "") {
+		return errors.New("migrate tls_port_offset needs tls_cert_file and tls_key_file")
+	}
+	return nil
+}
@@ -46,6 +46,11 @@ var (
 	ErrClientQuit             = errors.New("remote client quit")
 	ErrSlotIdNotMatch         = errors.New("migrate slotId not match")
 	ErrMigrateRunning         = errors.New("migrate running")
+	ErrMigrateNotExist        = errors.New("migrate not exist")
+	ErrMigrateCanceled        = errors.New("migrate canceled")
+	ErrMigrateVerify          = errors.New("migrate verify mismatch")
+	ErrMigrateAuth            = errors.New("ERR invalid migrate auth token")
+	ErrNoMigrateAuth          = errors.New("NOAUTH internal command requires migrateauth")
 	ErrDataType               = errors.New("not support dataType")
 	ErrDbSyncFailRefuse       = errors.New("ERR db syncing/fail, refuse request")
 	ErrNotImplement           = errors.New("command not implement")
@@ -60,6 +65,15 @@ var (
 	ErrUnbalancedQuotes       = errors.New("ERR unbalanced quotes in request")
 	ErrInvalidBulkLength      = errors.New("ERR invalid bulk length")
 	ErrInvalidMultiBulkLength = errors.New("ERR invalid multibulk length")
+	ErrClientPaused           = errors.New("TRYAGAIN server is paused by CLIENT PAUSE")
+	ErrNoSuchClient           = errors.New("ERR No such client")
+	ErrInvalidClientId        = errors.New("ERR Invalid client ID")
+	ErrClientName             = errors.New("ERR Client names cannot contain spaces, newlines or special characters.")
+	ErrClientTimeout          = errors.New("ERR timeout is not an integer or out of range")
+	ErrDiskQuotaOOM           = errors.New("OOM command not allowed when used disk > 'disk_quota'")
+	ErrLowFreeDiskOOM         = errors.New("OOM command not allowed when free disk < 'min_free_disk'")
+	ErrRaftQueueBusy          = errors.New("BUSY command not allowed when raft queue length > 'raft_queue_high_water'")
+	ErrFollowerLagBusy        = errors.New("BUSY command not allowed when follower lag > 'max_follower_lag'")
 )
 
 func CmdEmptyErr(cmd string) error {
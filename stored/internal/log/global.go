@@ -74,6 +74,14 @@ func SlowLog(remoteAddr string, cost int64, raftCost int64, request [][]byte, er
 	log.outputf(TypeSlow, slowFormat, remoteAddr, cost, raftCost, query, status)
 }
 
+func AuditEnabled() bool {
+	return log.AuditEnabled()
+}
+
+func Audit(entry []byte) {
+	log.Audit(entry)
+}
+
 func Info(arg ...interface{}) {
 	log.output(TypeInfo, arg...)
 }
@@ -44,13 +44,15 @@ const (
 )
 
 type Logger struct {
-	debug      bool
-	outWriter  zapcore.WriteSyncer
-	errWriter  zapcore.WriteSyncer
-	slowWriter zapcore.WriteSyncer
-	outLogger  *zap.Logger
-	errLogger  *zap.Logger
-	slowLogger *zap.Logger
+	debug       bool
+	outWriter   zapcore.WriteSyncer
+	errWriter   zapcore.WriteSyncer
+	slowWriter  zapcore.WriteSyncer
+	auditWriter zapcore.WriteSyncer
+	outLogger   *zap.Logger
+	errLogger   *zap.Logger
+	slowLogger  *zap.Logger
+	auditLogger *zap.Logger
 }
 
 func (l *Logger) CloseSync() {
@@ -63,6 +65,9 @@ func (l *Logger) CloseSync() {
 	if l.slowLogger != nil {
 		l.slowLogger.Sync()
 	}
+	if l.auditLogger != nil {
+		l.auditLogger.Sync()
+	}
 }
 
 func (l *Logger) filter(level string) bool {
@@ -181,6 +186,17 @@ func (l *Logger) Show(arg ...interface{}) {
 	l.output(level, list...)
 }
 
+func (l *Logger) AuditEnabled() bool {
+	return l.auditLogger != nil
+}
+
+func (l *Logger) Audit(entry []byte) {
+	if l.auditLogger == nil {
+		return
+	}
+	l.auditLogger.Info(string(entry))
+}
+
 type LevelEnable struct {
 }
 
@@ -192,6 +208,7 @@ type Options struct {
 	IsDebug      bool
 	LogPath      string
 	RotationTime string
+	AuditLog     bool
 }
 
 func NewLogger(opts *Options) *Logger {
@@ -210,6 +227,10 @@ func NewLogger(opts *Options) *Logger {
 	l.outLogger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "out"}), l.outWriter, &LevelEnable{}))
 	l.errLogger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "err"}), l.errWriter, &LevelEnable{}))
 	l.slowLogger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "slow"}), l.slowWriter, &LevelEnable{}))
+	if opts.AuditLog {
+		l.auditWriter = getWriter(logPath+".log.audit", opts.RotationTime)
+		l.auditLogger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "audit"}), l.auditWriter, &LevelEnable{}))
+	}
 	log = l
 	return l
 }
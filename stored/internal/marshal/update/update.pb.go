@@ -26,10 +26,11 @@ type ByteSlice struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	NodeId    *uint64  `protobuf:"varint,1,req,name=NodeId" json:"NodeId,omitempty"`
-	IsMigrate *bool    `protobuf:"varint,2,req,name=IsMigrate" json:"IsMigrate,omitempty"`
-	Data      [][]byte `protobuf:"bytes,3,rep,name=Data" json:"Data,omitempty"`
-	KeyHash   *uint32  `protobuf:"varint,4,req,name=KeyHash" json:"KeyHash,omitempty"`
+	NodeId      *uint64  `protobuf:"varint,1,req,name=NodeId" json:"NodeId,omitempty"`
+	IsMigrate   *bool    `protobuf:"varint,2,req,name=IsMigrate" json:"IsMigrate,omitempty"`
+	Data        [][]byte `protobuf:"bytes,3,rep,name=Data" json:"Data,omitempty"`
+	KeyHash     *uint32  `protobuf:"varint,4,req,name=KeyHash" json:"KeyHash,omitempty"`
+	TraceParent *string  `protobuf:"bytes,5,opt,name=TraceParent" json:"TraceParent,omitempty"`
 }
 
 func (x *ByteSlice) Reset() {
@@ -92,19 +93,29 @@ func (x *ByteSlice) GetKeyHash() uint32 {
 	return 0
 }
 
+func (x *ByteSlice) GetTraceParent() string {
+	if x != nil && x.TraceParent != nil {
+		return *x.TraceParent
+	}
+	return ""
+}
+
 var File_update_proto protoreflect.FileDescriptor
 
 var file_update_proto_rawDesc = []byte{
-	0x0a, 0x0c, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x6f,
-	0x0a, 0x09, 0x42, 0x79, 0x74, 0x65, 0x53, 0x6c, 0x69, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x4e,
-	0x6f, 0x64, 0x65, 0x49, 0x64, 0x18, 0x01, 0x20, 0x02, 0x28, 0x04, 0x52, 0x06, 0x4e, 0x6f, 0x64,
-	0x65, 0x49, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x49, 0x73, 0x4d, 0x69, 0x67, 0x72, 0x61, 0x74, 0x65,
-	0x18, 0x02, 0x20, 0x02, 0x28, 0x08, 0x52, 0x09, 0x49, 0x73, 0x4d, 0x69, 0x67, 0x72, 0x61, 0x74,
-	0x65, 0x12, 0x12, 0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0c, 0x52,
-	0x04, 0x44, 0x61, 0x74, 0x61, 0x12, 0x18, 0x0a, 0x07, 0x4b, 0x65, 0x79, 0x48, 0x61, 0x73, 0x68,
-	0x18, 0x04, 0x20, 0x02, 0x28, 0x0d, 0x52, 0x07, 0x4b, 0x65, 0x79, 0x48, 0x61, 0x73, 0x68, 0x42,
-	0x1e, 0x5a, 0x1c, 0x63, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x2f, 0x6d, 0x61, 0x72, 0x73, 0x68, 0x61,
-	0x6c, 0x2f, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x3b, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65,
+	0x0a, 0x0c, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x91,
+	0x01, 0x0a, 0x09, 0x42, 0x79, 0x74, 0x65, 0x53, 0x6c, 0x69, 0x63, 0x65, 0x12, 0x16, 0x0a, 0x06,
+	0x4e, 0x6f, 0x64, 0x65, 0x49, 0x64, 0x18, 0x01, 0x20, 0x02, 0x28, 0x04, 0x52, 0x06, 0x4e, 0x6f,
+	0x64, 0x65, 0x49, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x49, 0x73, 0x4d, 0x69, 0x67, 0x72, 0x61, 0x74,
+	0x65, 0x18, 0x02, 0x20, 0x02, 0x28, 0x08, 0x52, 0x09, 0x49, 0x73, 0x4d, 0x69, 0x67, 0x72, 0x61,
+	0x74, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0c,
+	0x52, 0x04, 0x44, 0x61, 0x74, 0x61, 0x12, 0x18, 0x0a, 0x07, 0x4b, 0x65, 0x79, 0x48, 0x61, 0x73,
+	0x68, 0x18, 0x04, 0x20, 0x02, 0x28, 0x0d, 0x52, 0x07, 0x4b, 0x65, 0x79, 0x48, 0x61, 0x73, 0x68,
+	0x12, 0x20, 0x0a, 0x0b, 0x54, 0x72, 0x61, 0x63, 0x65, 0x50, 0x61, 0x72, 0x65, 0x6e, 0x74, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x54, 0x72, 0x61, 0x63, 0x65, 0x50, 0x61, 0x72, 0x65,
+	0x6e, 0x74, 0x42, 0x1e, 0x5a, 0x1c, 0x63, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x2f, 0x6d, 0x61, 0x72,
+	0x73, 0x68, 0x61, 0x6c, 0x2f, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x3b, 0x75, 0x70, 0x64, 0x61,
+	0x74, 0x65,
 }
 
 var (
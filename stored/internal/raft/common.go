@@ -294,15 +294,37 @@ func (p *StartRun) Stop() {
 	}
 }
 
-func (p *StartRun) Sync(keyHash uint32, data [][]byte) ([]byte, error) {
+func (p *StartRun) ResizeQueue(workers int) {
+	if p != nil && p.queue != nil {
+		p.queue.Resize(workers)
+	}
+}
+
+func (p *StartRun) QueueLength() int {
+	if p != nil && p.queue != nil {
+		return p.queue.QLength()
+	}
+	return 0
+}
+
+// FollowerLag returns how many log entries the slowest follower is behind, it is 0 unless this node is the leader.
+func (p *StartRun) FollowerLag() uint64 {
+	return order.G_NodeSates.GetRemoteLag(config.GlobalConfig.RaftCluster.ClusterId)
+}
+
+func (p *StartRun) Sync(keyHash uint32, data [][]byte, traceParent string) ([]byte, error) {
 	migrate := false
 
-	b, err := proto.Marshal(&update.ByteSlice{
+	slice := &update.ByteSlice{
 		IsMigrate: &migrate,
 		NodeId:    &p.NodeID,
 		Data:      data,
 		KeyHash:   &keyHash,
-	})
+	}
+	if len(traceParent) > 0 {
+		slice.TraceParent = &traceParent
+	}
+	b, err := proto.Marshal(slice)
 	if err != nil {
 		return nil, err
 	}
@@ -335,6 +357,9 @@ func RaftInit(s *server.Server) {
 
 	s.DoRaftSync = raftInstance.Sync
 	s.DoRaftStop = raftInstance.Stop
+	s.DoRaftQueueResize = raftInstance.ResizeQueue
+	s.RaftQueueLength = raftInstance.QueueLength
+	s.RaftFollowerLag = raftInstance.FollowerLag
 }
 
 func RaftStart(s *server.Server) {
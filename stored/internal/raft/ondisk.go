@@ -99,7 +99,7 @@ func (pD *DiskKV) Update(es []sm.Entry) ([]sm.Entry, error) {
 		}()
 
 		if updateSelf {
-			pD.queue.push(slice.Data, *slice.IsMigrate, *slice.KeyHash)
+			pD.queue.push(slice.Data, *slice.IsMigrate, *slice.KeyHash, slice.GetTraceParent())
 			v.Result.Data = UpdateOtherNodeDoing
 		} else {
 			v.Result.Data = UpdateSelfNodeDoing
@@ -20,6 +20,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/zuoyebang/bitalostored/butils/tracing"
 	"github.com/zuoyebang/bitalostored/butils/unsafe2"
 	"github.com/zuoyebang/bitalostored/stored/internal/log"
 	"github.com/zuoyebang/bitalostored/stored/server"
@@ -31,6 +32,7 @@ const (
 )
 
 type Queue struct {
+	mu      sync.RWMutex
 	workNum uint32
 	length  uint32
 	pD      *DiskKV
@@ -39,9 +41,11 @@ type Queue struct {
 }
 
 type QData struct {
-	data      [][]byte
-	isMigrate bool
-	keyHash   uint32
+	data        [][]byte
+	isMigrate   bool
+	keyHash     uint32
+	pushTime    time.Time
+	traceParent string
 }
 
 func NewQueue(workNum, length int, pD *DiskKV) *Queue {
@@ -53,30 +57,59 @@ func NewQueue(workNum, length int, pD *DiskKV) *Queue {
 	}
 
 	queue := &Queue{
-		workNum: uint32(workNum),
-		length:  uint32(length),
-		qchans:  make([]chan *QData, workNum),
-		pD:      pD,
-	}
-
-	for i := 0; i < workNum; i++ {
-		queue.qchans[i] = make(chan *QData, length)
-		queue.consume(queue.qchans[i])
+		length: uint32(length),
+		pD:     pD,
 	}
+	queue.start(workNum)
 
 	log.Infof("raft consume queue start workNum:%d length:%d", workNum, length)
 	return queue
 }
 
-func (q *Queue) Close() {
+func (q *Queue) start(workNum int) {
+	q.workNum = uint32(workNum)
+	q.qchans = make([]chan *QData, workNum)
+	for i := 0; i < workNum; i++ {
+		q.qchans[i] = make(chan *QData, q.length)
+		q.consume(q.qchans[i])
+	}
+}
+
+func (q *Queue) stop() {
 	for i := range q.qchans {
 		q.qchans[i] <- nil
 	}
 	q.wg.Wait()
+}
+
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.stop()
 	log.Infof("raft consume queue closed")
 }
 
+// Resize changes the number of consume workers. Pushes are blocked while the
+// current workers drain their channels, so the apply order of a key is kept.
+func (q *Queue) Resize(workNum int) {
+	if workNum < DefaultWorkNum {
+		workNum = DefaultWorkNum
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if uint32(workNum) == q.workNum {
+		return
+	}
+	oldWorkNum := q.workNum
+	q.stop()
+	q.start(workNum)
+	log.Infof("raft consume queue resize workNum:%d->%d", oldWorkNum, workNum)
+}
+
 func (q *Queue) QLength() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
 	maxQueueLen := 0
 	for i := range q.qchans {
 		qLen := len(q.qchans[i])
@@ -87,16 +120,21 @@ func (q *Queue) QLength() int {
 	return maxQueueLen
 }
 
-func (q *Queue) push(data [][]byte, isMigrate bool, keyHash uint32) error {
+func (q *Queue) push(data [][]byte, isMigrate bool, keyHash uint32, traceParent string) error {
 	if len(data) < 2 || len(data[1]) <= 0 {
 		return errors.New("raft consume queue push data err")
 	}
 
+	q.mu.RLock()
+	defer q.mu.RUnlock()
 	index := (keyHash + uint32(data[1][len(data[1])/2])) % q.workNum
+	q.pD.s.Info.Stats.RaftApplyPending.Add(1)
 	q.qchans[index] <- &QData{
-		data:      data,
-		isMigrate: isMigrate,
-		keyHash:   keyHash,
+		data:        data,
+		isMigrate:   isMigrate,
+		keyHash:     keyHash,
+		pushTime:    time.Now(),
+		traceParent: traceParent,
 	}
 
 	return nil
@@ -123,7 +161,10 @@ func (q *Queue) consume(qchan chan *QData) {
 				return
 			}
 
+			stats := &q.pD.s.Info.Stats
+			stats.RaftApplyPending.Add(-1)
 			c := server.GetRaftClientFromPool(q.pD.s, qdata.data, qdata.keyHash)
+			c.QueueWaitNs = time.Since(qdata.pushTime).Nanoseconds()
 			if c.Cmd == "script" {
 				if len(c.Args) < 1 {
 					log.Error("invalid script cmd")
@@ -132,10 +173,36 @@ func (q *Queue) consume(qchan chan *QData) {
 				}
 				c.Cmd = c.Cmd + unsafe2.String(server.LowerSlice(c.Args[0]))
 			}
-			if err := c.ApplyDB(0); err != nil {
+			span := q.startApplySpan(c, qdata)
+			err := c.ApplyDB(0)
+			if err != nil {
 				log.Errorf("qchans consume applydb fail command:%s err:%v", c.Cmd, err)
 			}
+			span.SetError(err)
+			span.End()
+			stats.RaftApplyLagUs.Store(time.Since(qdata.pushTime).Microseconds())
 			server.PutRaftClientToPool(c)
 		}
 	}(qchan)
 }
+
+// startApplySpan continues the trace of a replicated command, the queue wait
+// is recorded as a child span from push to dequeue.
+func (q *Queue) startApplySpan(c *server.Client, qdata *QData) *tracing.Span {
+	if len(qdata.traceParent) == 0 {
+		return nil
+	}
+	parent, ok := tracing.ParseTraceparent(qdata.traceParent)
+	if !ok {
+		return nil
+	}
+	span := tracing.StartAt("raft apply "+c.Cmd, tracing.SpanKindInternal, parent, qdata.pushTime)
+	if span == nil {
+		return nil
+	}
+	span.SetAttr("bitalos.node_id", q.pD.nodeID)
+	span.SetAttr("bitalos.is_migrate", qdata.isMigrate)
+	span.StartChildAt("raft queue wait", tracing.SpanKindInternal, qdata.pushTime).End()
+	c.SetTraceSpan(span)
+	return span
+}
@@ -23,6 +23,13 @@ const (
 	INFO     string = "info"
 	TIME     string = "time"
 	SHUTDOWN string = "shutdown"
+	CLIENT   string = "client"
+	MONITOR  string = "monitor"
+	LATENCY  string = "latency"
+	SLOWLOG  string = "slowlog"
+	MEMORY   string = "memory"
+
+	SLOTSTATS string = "slotstats"
 
 	DEL         string = "del"
 	TTL         string = "ttl"
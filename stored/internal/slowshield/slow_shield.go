@@ -30,7 +30,8 @@ import (
 
 type SlowShield struct {
 	mu                sync.RWMutex
-	isOpen            bool
+	statsOnce         sync.Once
+	isOpen            atomic.Bool
 	ttl               timesize.Duration
 	slowTime          timesize.Duration
 	keySlowWindowTime timesize.Duration
@@ -47,51 +48,62 @@ var notCheckCmd = map[string]bool{
 }
 
 func NewSlowShield() *SlowShield {
-	sc := &SlowShield{
-		isOpen: config.GlobalConfig.Server.SlowShield,
-	}
+	sc := &SlowShield{}
 	sc.adjustByGlobalConfig()
-	if sc.isOpen {
+	if sc.isOpen.Load() {
 		sc.doStats()
 	}
 	return sc
 }
 
+// Reload applies the slow shield settings of config.GlobalConfig, it is
+// called by CONFIG SET and resets the collected slow keys.
+func (sc *SlowShield) Reload() {
+	sc.mu.Lock()
+	sc.adjustByGlobalConfig()
+	sc.totalSlowTime.Store(0)
+	sc.mu.Unlock()
+	if sc.isOpen.Load() {
+		sc.doStats()
+	}
+}
+
 func (sc *SlowShield) adjustByGlobalConfig() {
+	cfg := &config.Runtime().Server
 	sc.slowKey = make(map[string]int64, 32)
 	sc.topSlowKey = make(map[string]int64, 16)
-	sc.isOpen = config.GlobalConfig.Server.SlowShield
+	sc.isOpen.Store(cfg.SlowShield)
 
-	if config.GlobalConfig.Server.SlowTTL < timesize.Duration(1*time.Second) {
+	if cfg.SlowTTL < timesize.Duration(1*time.Second) {
 		sc.ttl = timesize.Duration(1 * time.Second)
 	} else {
-		sc.ttl = config.GlobalConfig.Server.SlowTTL
+		sc.ttl = cfg.SlowTTL
 	}
-	if config.GlobalConfig.Server.SlowMaxExec < 100 {
+	if cfg.SlowMaxExec < 100 {
 		sc.maxExec = 100
 	} else {
-		sc.maxExec = config.GlobalConfig.Server.SlowMaxExec
+		sc.maxExec = cfg.SlowMaxExec
 	}
-	if config.GlobalConfig.Server.SlowTopN < 50 {
+	if cfg.SlowTopN < 50 {
 		sc.topN = 50
 	} else {
-		sc.topN = config.GlobalConfig.Server.SlowTopN
+		sc.topN = cfg.SlowTopN
 	}
-	if config.GlobalConfig.Server.SlowTime < timesize.Duration(30*time.Millisecond) {
+	if cfg.SlowTime < timesize.Duration(30*time.Millisecond) {
 		sc.slowTime = timesize.Duration(30 * time.Millisecond)
 	} else {
-		sc.slowTime = config.GlobalConfig.Server.SlowTime
+		sc.slowTime = cfg.SlowTime
 	}
-	if config.GlobalConfig.Server.SlowKeyWindowTime < timesize.Duration(15*time.Millisecond) {
+	if cfg.SlowKeyWindowTime < timesize.Duration(15*time.Millisecond) {
 		sc.keySlowWindowTime = timesize.Duration(15 * time.Millisecond)
 	} else {
-		sc.keySlowWindowTime = config.GlobalConfig.Server.SlowKeyWindowTime
+		sc.keySlowWindowTime = cfg.SlowKeyWindowTime
 	}
 	sc.maxAllowSlowTime = time.Duration(sc.maxExec) * sc.ttl.Duration()
 }
 
 func (sc *SlowShield) CheckSlowShield(cmd string, key []byte) bool {
-	if sc.isOpen {
+	if sc.isOpen.Load() {
 		if len(key) == 0 {
 			return false
 		}
@@ -105,7 +117,7 @@ func (sc *SlowShield) CheckSlowShield(cmd string, key []byte) bool {
 }
 
 func (sc *SlowShield) Send(cmd string, key []byte, cost int64) {
-	if sc.isOpen {
+	if sc.isOpen.Load() {
 		if notCheckCmd[cmd] || cost <= 0 {
 			return
 		}
@@ -118,6 +130,10 @@ func (sc *SlowShield) Send(cmd string, key []byte, cost int64) {
 }
 
 func (sc *SlowShield) doStats() {
+	sc.statsOnce.Do(sc.runStats)
+}
+
+func (sc *SlowShield) runStats() {
 	go func() {
 		dostat := func() {
 			defer func() {
@@ -127,7 +143,11 @@ func (sc *SlowShield) doStats() {
 				}
 			}()
 
-			if sc.totalSlowTime.Load() > sc.maxAllowSlowTime.Nanoseconds() {
+			sc.mu.RLock()
+			maxAllowSlowTime := sc.maxAllowSlowTime
+			sc.mu.RUnlock()
+
+			if sc.totalSlowTime.Load() > maxAllowSlowTime.Nanoseconds() {
 				sc.mu.Lock()
 				lastSlowKey := sc.slowKey
 				totalSlowTime := sc.totalSlowTime.Load()
@@ -168,7 +188,10 @@ func (sc *SlowShield) doStats() {
 
 		for {
 			dostat()
-			time.Sleep(sc.ttl.Duration())
+			sc.mu.RLock()
+			ttl := sc.ttl.Duration()
+			sc.mu.RUnlock()
+			time.Sleep(ttl)
 		}
 	}()
 }
@@ -0,0 +1,131 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+)
+
+const admissionInterval = time.Second
+
+const (
+	admissionOK int32 = iota
+	admissionLowFreeDisk
+	admissionRaftQueue
+	admissionFollowerLag
+)
+
+func admissionStateString(state int32) string {
+	switch state {
+	case admissionLowFreeDisk:
+		return "low_free_disk"
+	case admissionRaftQueue:
+		return "raft_queue"
+	case admissionFollowerLag:
+		return "follower_lag"
+	default:
+		return "ok"
+	}
+}
+
+// admission rejects writes while the disk is nearly full or raft can not keep
+// up, reads are always served.
+type admission struct {
+	state atomic.Int32
+	wg    sync.WaitGroup
+}
+
+// rejectWrite returns the error cmd must fail with under the current state.
+// On low free disk the commands that only shrink data are still accepted.
+func (a *admission) rejectWrite(cmd *Cmd) error {
+	if a == nil || !cmd.Sync {
+		return nil
+	}
+	switch a.state.Load() {
+	case admissionLowFreeDisk:
+		if evictionAllowedCmds[cmd.Name] {
+			return nil
+		}
+		return errn.ErrLowFreeDiskOOM
+	case admissionRaftQueue:
+		return errn.ErrRaftQueueBusy
+	case admissionFollowerLag:
+		return errn.ErrFollowerLagBusy
+	default:
+		return nil
+	}
+}
+
+func (s *Server) RunAdmissionTask() {
+	s.admission.wg.Add(1)
+	go func() {
+		defer s.admission.wg.Done()
+
+		ticker := time.NewTicker(admissionInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.quit:
+				log.Info("RunAdmissionTask receive quit signal")
+				return
+			case <-ticker.C:
+				s.checkAdmission()
+			}
+		}
+	}()
+}
+
+func (s *Server) checkAdmission() {
+	cfg := &config.Runtime().Admission
+	stats := &s.Info.Stats
+	state := admissionOK
+
+	free, err := butils.GetDiskFree(config.GlobalConfig.Server.DBPath)
+	if err == nil {
+		stats.DiskFree.Store(free)
+	}
+	var queueLen int
+	if s.RaftQueueLength != nil {
+		queueLen = s.RaftQueueLength()
+	}
+	var lag uint64
+	if s.RaftFollowerLag != nil {
+		lag = s.RaftFollowerLag()
+	}
+	stats.RaftFollowerLag.Store(lag)
+
+	if minFree := cfg.MinFreeDisk.Int64(); err == nil && minFree > 0 && free < minFree {
+		state = admissionLowFreeDisk
+	} else if cfg.RaftQueueHighWater > 0 && queueLen > cfg.RaftQueueHighWater {
+		state = admissionRaftQueue
+	} else if cfg.MaxFollowerLag > 0 && lag > uint64(cfg.MaxFollowerLag) {
+		state = admissionFollowerLag
+	}
+
+	if old := s.admission.state.Swap(state); old != state {
+		log.Warnf("write admission state changed %s->%s [disk_free:%d] [raft_queue_length:%d] [follower_lag:%d]",
+			admissionStateString(old), admissionStateString(state), free, queueLen, lag)
+		stats.AdmissionState.Store(state)
+		stats.UpdateCache()
+	}
+}
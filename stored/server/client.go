@@ -20,7 +20,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/panjf2000/gnet/v2"
 	"github.com/zuoyebang/bitalostored/butils/hash"
+	"github.com/zuoyebang/bitalostored/butils/tracing"
 	"github.com/zuoyebang/bitalostored/butils/unsafe2"
 	"github.com/zuoyebang/bitalostored/stored/engine"
 	"github.com/zuoyebang/bitalostored/stored/internal/config"
@@ -57,12 +59,19 @@ type Client struct {
 	Writer         *resp.Writer
 	DB             *engine.Bitalos
 	QueryStartTime time.Time
+	QueueWaitNs    int64
 	KeyHash        uint32
 	IsMaster       func() bool
 
 	server            *Server
+	id                int64
+	conn              gnet.Conn
 	remoteAddr        string
+	createTime        time.Time
 	closed            atomic.Bool
+	meta              clientMeta
+	monitor           *Monitor
+	traceSpan         *tracing.Span
 	txState           int
 	txCommandQueued   bool
 	watchKeys         map[string]int64
@@ -72,6 +81,7 @@ type Client struct {
 	prepareUnlockSig  chan struct{}
 	queueCommandDone  chan struct{}
 	prepareUnlockDone chan struct{}
+	internal          bool
 }
 
 func init() {
@@ -105,6 +115,8 @@ func GetVmFromPool(s *Server) *Client {
 
 func PutRaftClientToPool(c *Client) {
 	c.Writer.Reset()
+	c.QueueWaitNs = 0
+	c.traceSpan = nil
 	raftClientPool.Put(c)
 }
 
@@ -114,16 +126,27 @@ func newRaftClient() *Client {
 	}
 }
 
-func newConnClient(s *Server, remoteAddr string) *Client {
+func newConnClient(s *Server, conn gnet.Conn) *Client {
+	c := newClient(s, conn.RemoteAddr().String())
+	c.conn = conn
+	return c
+}
+
+func newClient(s *Server, remoteAddr string) *Client {
 	c := &Client{
 		DB:         s.GetDB(),
 		IsMaster:   s.IsMaster,
 		ParseMarks: make([]int, 0, 1<<4),
 		Reader:     resp.NewReader(),
 		Writer:     resp.NewWriter(),
+		id:         s.clientIdSeq.Add(1),
 		remoteAddr: remoteAddr,
+		createTime: time.Now(),
 		server:     s,
 	}
+	c.meta.multiNum.Store(-1)
+	c.meta.lastActive.Store(c.createTime.UnixNano())
+	s.clients.Store(c.id, c)
 
 	s.Info.Client.ClientTotal.Add(1)
 	s.Info.Client.ClientAlive.Add(1)
@@ -146,6 +169,10 @@ func (c *Client) Close() {
 		c.discard()
 	}
 
+	if c.monitor != nil {
+		c.server.removeMonitor(c.monitor)
+	}
+	c.server.clients.Delete(c.id)
 	c.server.Info.Client.ClientAlive.Add(-1)
 }
 
@@ -155,6 +182,7 @@ func (c *Client) ResetQueryStartTime() {
 
 func (c *Client) FormatData(reqData [][]byte) {
 	c.ResetQueryStartTime()
+	c.QueueWaitNs = 0
 	c.Data = reqData
 	c.Cmd = ""
 	if len(reqData) == 0 {
@@ -171,7 +199,10 @@ func (c *Client) FormatData(reqData [][]byte) {
 }
 
 func (c *Client) HandleRequest(reqData [][]byte, isHashTag bool) (err error) {
+	reqData, traceParent := tracing.SplitCommand(reqData)
+	outerSpan := c.traceSpan
 	c.FormatData(reqData)
+	c.meta.lastActive.Store(c.QueryStartTime.UnixNano())
 
 	if len(c.Cmd) == 0 {
 		err = errn.CmdEmptyErr(c.Cmd)
@@ -179,6 +210,15 @@ func (c *Client) HandleRequest(reqData [][]byte, isHashTag bool) (err error) {
 		return err
 	}
 
+	if outerSpan != nil && !traceParent.IsValid() {
+		traceParent = outerSpan.Context()
+	}
+	c.startTraceSpan(traceParent)
+	defer func() {
+		c.endTraceSpan(err)
+		c.traceSpan = outerSpan
+	}()
+
 	if c.server.openDistributedTx && c.checkCommandEnterQueue() {
 		txReqData := make([][]byte, len(reqData))
 		for i := range reqData {
@@ -227,6 +267,18 @@ func (c *Client) HandleRequest(reqData [][]byte, isHashTag bool) (err error) {
 		c.Writer.WriteError(err)
 		return err
 	}
+	c.meta.lastCmd.Store(&execCmd.Name)
+	if execCmd.Internal && !c.internal && config.GlobalConfig.MigrateToken() != "" {
+		c.Writer.WriteError(errn.ErrNoMigrateAuth)
+		return errn.ErrNoMigrateAuth
+	}
+	if c.server.checkClientPaused(execCmd) {
+		c.Writer.WriteError(errn.ErrClientPaused)
+		return errn.ErrClientPaused
+	}
+	if p := c.server.monitors.Load(); p != nil && c.monitor == nil {
+		c.feedMonitors(*p)
+	}
 	if c.server.openDistributedTx && c.txState&TxStateMulti != 0 && execCmd.NotAllowedInTx {
 		err = fmt.Errorf("ERR %s inside MULTI is not allowed", c.Cmd)
 		c.Writer.WriteError(err)
@@ -250,11 +302,23 @@ func (c *Client) HandleRequest(reqData [][]byte, isHashTag bool) (err error) {
 	} else {
 		c.KeyHash = utils.GetHashTagFnv(c.Keys)
 	}
+	if !execCmd.NoKey {
+		c.server.evictor.touch(c.KeyHash)
+	}
+	if c.server.evictor.rejectWrite(execCmd) {
+		c.Writer.WriteError(errn.ErrDiskQuotaOOM)
+		return errn.ErrDiskQuotaOOM
+	}
+	if err := c.server.admission.rejectWrite(execCmd); err != nil {
+		c.server.Info.Stats.AdmissionRejected.Add(1)
+		c.Writer.WriteError(err)
+		return err
+	}
 
 	var isRedirect bool
 	var lockFunc func()
 
-	if isRedirect, lockFunc = c.DB.CheckRedirectAndLockFunc(c.Cmd, c.Keys, c.KeyHash); lockFunc != nil {
+	if isRedirect, lockFunc = c.DB.CheckRedirectAndLockFunc(c.Cmd, c.Keys, c.KeyHash, c.Args); lockFunc != nil {
 		defer lockFunc()
 	}
 
@@ -263,7 +327,7 @@ func (c *Client) HandleRequest(reqData [][]byte, isHashTag bool) (err error) {
 		if c.server.openDistributedTx {
 			updateKeyModifyTs = c.markWatchKeyModified(execCmd)
 		}
-		err = c.DB.Redirect(c.Cmd, c.Keys, reqData, c.Writer)
+		err = c.DB.Redirect(c.Cmd, c.Keys, c.KeyHash, reqData, c.Writer)
 		if updateKeyModifyTs != nil {
 			updateKeyModifyTs()
 		}
@@ -280,7 +344,10 @@ func (c *Client) HandleRequest(reqData [][]byte, isHashTag bool) (err error) {
 
 func (c *Client) RaftSync() error {
 	start := time.Now()
-	resData, err := c.server.DoRaftSync(c.KeyHash, c.Data)
+	span := c.startChildSpan("raft propose", start)
+	resData, err := c.server.DoRaftSync(c.KeyHash, c.Data, traceParentOf(span))
+	span.SetError(err)
+	span.End()
 	if err != nil {
 		return err
 	}
@@ -308,10 +375,15 @@ func (c *Client) ApplyDB(raftSyncCostNs int64) error {
 		updateKeyModifyTs = c.markWatchKeyModified(execCmd)
 	}
 
-	if err = execCmd.Handler(c); err != nil {
+	applySpan := c.startChildSpan("bitsdb apply", time.Now())
+	err = execCmd.Handler(c)
+	applySpan.SetError(err)
+	applySpan.End()
+	if err != nil {
 		if updateKeyModifyTs != nil {
 			updateKeyModifyTs()
 		}
+		execCmd.stats.record(time.Since(c.QueryStartTime), err)
 		return err
 	}
 	if updateKeyModifyTs != nil {
@@ -319,9 +391,12 @@ func (c *Client) ApplyDB(raftSyncCostNs int64) error {
 	}
 
 	c.server.Info.Stats.TotolCmd.Add(1)
+	c.server.slotStats.record(execCmd, c.KeyHash, c.Args)
 
 	costNs := time.Since(c.QueryStartTime).Nanoseconds()
-	if costNs >= config.GlobalConfig.Server.SlowTime.Int64() {
+	execCmd.stats.record(time.Duration(costNs), nil)
+	slowTimeNs := config.Runtime().Server.SlowTime.Int64()
+	if costNs >= slowTimeNs {
 		if c.server.slowQuery != nil {
 			c.server.slowQuery.Send(c.Cmd, c.Keys, costNs-raftSyncCostNs)
 		}
@@ -329,6 +404,9 @@ func (c *Client) ApplyDB(raftSyncCostNs int64) error {
 		raftSyncCostUs := raftSyncCostNs / 1000
 		log.SlowLog(c.remoteAddr, costUs, raftSyncCostUs, c.Data, err)
 	}
+	if c.QueueWaitNs+costNs >= slowTimeNs {
+		c.server.addSlowLog(c, costNs, raftSyncCostNs)
+	}
 	return err
 }
 
@@ -350,6 +428,8 @@ func (c *Client) checkCommand() bool {
 		return true
 	case resp.SHUTDOWN:
 		return true
+	case resp.CLIENT, resp.MONITOR, resp.LATENCY, resp.SLOWLOG:
+		return true
 	default:
 		return false
 	}
@@ -14,6 +14,14 @@
 
 package server
 
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils/histogram"
+)
+
 type Cmd struct {
 	NArg           int
 	Sync           bool
@@ -22,12 +30,49 @@ type Cmd struct {
 	NotAllowedInTx bool
 	NoKey          bool
 	KeySkip        uint8
+	// Internal commands are only served to connections authenticated by
+	// migrateauth once a migrate token is configured.
+	Internal bool
+
+	stats *cmdStats
+}
+
+type cmdStats struct {
+	calls atomic.Int64
+	usecs atomic.Int64
+	fails atomic.Int64
+	hist  *histogram.Histogram
+}
+
+func (cs *cmdStats) reset() {
+	cs.calls.Store(0)
+	cs.usecs.Store(0)
+	cs.fails.Store(0)
+	cs.hist.Reset()
+}
+
+func (cs *cmdStats) record(cost time.Duration, err error) {
+	if cs == nil {
+		return
+	}
+	cs.calls.Add(1)
+	cs.usecs.Add(cost.Microseconds())
+	cs.hist.Record(cost)
+	if err != nil {
+		cs.fails.Add(1)
+	}
 }
 
 var commands = map[string]*Cmd{}
 
 func AddCommand(list map[string]*Cmd) {
 	for k, v := range list {
+		if len(v.Name) == 0 {
+			v.Name = k
+		}
+		if v.stats == nil {
+			v.stats = &cmdStats{hist: histogram.New()}
+		}
 		commands[k] = v
 	}
 }
@@ -39,3 +84,14 @@ func (s *Server) GetCommand(c string) *Cmd {
 		return nil
 	}
 }
+
+func rangeCommands(f func(name string, cmd *Cmd)) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f(name, commands[name])
+	}
+}
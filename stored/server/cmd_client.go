@@ -0,0 +1,402 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
+)
+
+const (
+	ClientPauseNone int32 = iota
+	ClientPauseWrite
+	ClientPauseAll
+)
+
+func init() {
+	AddCommand(map[string]*Cmd{
+		resp.CLIENT: {Sync: false, Handler: clientCommand, NoKey: true, NotAllowedInTx: true},
+	})
+}
+
+type clientMeta struct {
+	name       atomic.Pointer[string]
+	lastCmd    atomic.Pointer[string]
+	lastActive atomic.Int64
+	noEvict    atomic.Bool
+	multiNum   atomic.Int32
+	watchNum   atomic.Int32
+	qbufSize   atomic.Int32
+	obufSize   atomic.Int32
+}
+
+// clientPauseState is checked by the event loop, so paused commands are rejected
+// with TRYAGAIN instead of blocking every connection served by the same loop.
+// The proxy blocks paused commands like redis, clients talking to stored
+// directly must retry.
+type clientPauseState struct {
+	mode  atomic.Int32
+	until atomic.Int64
+}
+
+func (s *Server) PauseClients(mode int32, timeout time.Duration) {
+	s.clientPause.until.Store(time.Now().Add(timeout).UnixNano())
+	s.clientPause.mode.Store(mode)
+}
+
+func (s *Server) UnpauseClients() {
+	s.clientPause.mode.Store(ClientPauseNone)
+}
+
+func (s *Server) ClientPauseMode() int32 {
+	mode := s.clientPause.mode.Load()
+	if mode != ClientPauseNone && time.Now().UnixNano() >= s.clientPause.until.Load() {
+		s.clientPause.mode.CompareAndSwap(mode, ClientPauseNone)
+		return ClientPauseNone
+	}
+	return mode
+}
+
+func (s *Server) checkClientPaused(execCmd *Cmd) bool {
+	if execCmd.Name == resp.CLIENT {
+		return false
+	}
+	switch s.ClientPauseMode() {
+	case ClientPauseAll:
+		return true
+	case ClientPauseWrite:
+		return execCmd.Sync
+	default:
+		return false
+	}
+}
+
+func (s *Server) GetClients() []*Client {
+	clients := make([]*Client, 0, 128)
+	s.clients.Range(func(_, value any) bool {
+		if c, ok := value.(*Client); ok && !c.closed.Load() {
+			clients = append(clients, c)
+		}
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].id < clients[j].id
+	})
+	return clients
+}
+
+func (c *Client) updateClientMeta() {
+	if c.txState&TxStateMulti != 0 {
+		c.meta.multiNum.Store(int32(len(c.commandQueue)))
+	} else {
+		c.meta.multiNum.Store(-1)
+	}
+	c.meta.watchNum.Store(int32(len(c.watchKeys)))
+	c.meta.qbufSize.Store(int32(c.Reader.Len()))
+	c.meta.obufSize.Store(int32(c.Writer.Buf.Len()))
+}
+
+func (c *Client) GetName() string {
+	if name := c.meta.name.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+func (c *Client) LocalAddr() string {
+	if c.conn == nil {
+		return ""
+	}
+	if addr := c.conn.LocalAddr(); addr != nil {
+		return addr.String()
+	}
+	return ""
+}
+
+func (c *Client) ClientInfo() string {
+	now := time.Now()
+	idle := (now.UnixNano() - c.meta.lastActive.Load()) / int64(time.Second)
+	if idle < 0 {
+		idle = 0
+	}
+	multi := c.meta.multiNum.Load()
+
+	flags := make([]byte, 0, 4)
+	if multi >= 0 {
+		flags = append(flags, 'x')
+	}
+	if c.meta.noEvict.Load() {
+		flags = append(flags, 'e')
+	}
+	if len(flags) == 0 {
+		flags = append(flags, 'N')
+	}
+	lastCmd := "NULL"
+	if cmd := c.meta.lastCmd.Load(); cmd != nil {
+		lastCmd = *cmd
+	}
+
+	buf := make([]byte, 0, 256)
+	buf = append(buf, "id="...)
+	buf = strconv.AppendInt(buf, c.id, 10)
+	buf = append(buf, " addr="...)
+	buf = append(buf, c.remoteAddr...)
+	buf = append(buf, " laddr="...)
+	buf = append(buf, c.LocalAddr()...)
+	buf = append(buf, " name="...)
+	buf = append(buf, c.GetName()...)
+	buf = append(buf, " age="...)
+	buf = strconv.AppendInt(buf, int64(now.Sub(c.createTime)/time.Second), 10)
+	buf = append(buf, " idle="...)
+	buf = strconv.AppendInt(buf, idle, 10)
+	buf = append(buf, " flags="...)
+	buf = append(buf, flags...)
+	buf = append(buf, " db=0 multi="...)
+	buf = strconv.AppendInt(buf, int64(multi), 10)
+	buf = append(buf, " watch="...)
+	buf = strconv.AppendInt(buf, int64(c.meta.watchNum.Load()), 10)
+	buf = append(buf, " qbuf="...)
+	buf = strconv.AppendInt(buf, int64(c.meta.qbufSize.Load()), 10)
+	buf = append(buf, " obl="...)
+	buf = strconv.AppendInt(buf, int64(c.meta.obufSize.Load()), 10)
+	buf = append(buf, " cmd="...)
+	buf = append(buf, lastCmd...)
+	return string(buf)
+}
+
+func clientCommand(c *Client) error {
+	if len(c.Args) == 0 {
+		return errn.CmdParamsErr(resp.CLIENT)
+	}
+
+	args := c.Args[1:]
+	switch unsafe2.String(LowerSlice(c.Args[0])) {
+	case "id":
+		if len(args) != 0 {
+			return errn.CmdParamsErr("client|id")
+		}
+		c.Writer.WriteInteger(c.id)
+	case "getname":
+		if len(args) != 0 {
+			return errn.CmdParamsErr("client|getname")
+		}
+		if name := c.GetName(); len(name) > 0 {
+			c.Writer.WriteBulk([]byte(name))
+		} else {
+			c.Writer.WriteBulk(nil)
+		}
+	case "setname":
+		if len(args) != 1 {
+			return errn.CmdParamsErr("client|setname")
+		}
+		for _, ch := range args[0] {
+			if ch <= ' ' || ch > '~' {
+				return errn.ErrClientName
+			}
+		}
+		if len(args[0]) == 0 {
+			c.meta.name.Store(nil)
+		} else {
+			name := string(args[0])
+			c.meta.name.Store(&name)
+		}
+		c.Writer.WriteStatus(resp.ReplyOK)
+	case "info":
+		if len(args) != 0 {
+			return errn.CmdParamsErr("client|info")
+		}
+		c.updateClientMeta()
+		c.Writer.WriteBulk([]byte(c.ClientInfo() + "\n"))
+	case "list":
+		return clientListCommand(c, args)
+	case "kill":
+		return clientKillCommand(c, args)
+	case "pause":
+		return clientPauseCommand(c, args)
+	case "unpause":
+		if len(args) != 0 {
+			return errn.CmdParamsErr("client|unpause")
+		}
+		c.server.UnpauseClients()
+		c.Writer.WriteStatus(resp.ReplyOK)
+	case "no-evict":
+		if len(args) != 1 {
+			return errn.CmdParamsErr("client|no-evict")
+		}
+		switch unsafe2.String(LowerSlice(args[0])) {
+		case "on":
+			c.meta.noEvict.Store(true)
+		case "off":
+			c.meta.noEvict.Store(false)
+		default:
+			return errn.ErrSyntax
+		}
+		c.Writer.WriteStatus(resp.ReplyOK)
+	default:
+		return errn.ErrSyntax
+	}
+	return nil
+}
+
+func clientListCommand(c *Client, args [][]byte) error {
+	var ids map[int64]struct{}
+	for i := 0; i < len(args); i++ {
+		switch unsafe2.String(LowerSlice(args[i])) {
+		case "type":
+			if i+1 >= len(args) {
+				return errn.ErrSyntax
+			}
+			i++
+			if strings.ToLower(unsafe2.String(args[i])) != "normal" {
+				c.Writer.WriteBulk([]byte{})
+				return nil
+			}
+		case "id":
+			if i+1 >= len(args) {
+				return errn.ErrSyntax
+			}
+			ids = make(map[int64]struct{}, len(args)-i-1)
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseInt(unsafe2.String(args[i]), 10, 64)
+				if err != nil || id <= 0 {
+					return errn.ErrInvalidClientId
+				}
+				ids[id] = struct{}{}
+			}
+		default:
+			return errn.ErrSyntax
+		}
+	}
+
+	c.updateClientMeta()
+	buf := make([]byte, 0, 4096)
+	for _, cl := range c.server.GetClients() {
+		if ids != nil {
+			if _, ok := ids[cl.id]; !ok {
+				continue
+			}
+		}
+		buf = append(buf, cl.ClientInfo()...)
+		buf = append(buf, '\n')
+	}
+	c.Writer.WriteBulk(buf)
+	return nil
+}
+
+func clientKillCommand(c *Client, args [][]byte) error {
+	if len(args) == 0 {
+		return errn.CmdParamsErr("client|kill")
+	}
+
+	var id int64
+	var addr, laddr string
+	skipMe := true
+	oldStyle := len(args) == 1
+	if oldStyle {
+		addr = string(args[0])
+		skipMe = false
+	} else {
+		if len(args)%2 != 0 {
+			return errn.ErrSyntax
+		}
+		for i := 0; i < len(args); i += 2 {
+			value := unsafe2.String(args[i+1])
+			switch unsafe2.String(LowerSlice(args[i])) {
+			case "id":
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || n <= 0 {
+					return errn.ErrInvalidClientId
+				}
+				id = n
+			case "addr":
+				addr = string(args[i+1])
+			case "laddr":
+				laddr = string(args[i+1])
+			case "skipme":
+				switch strings.ToLower(value) {
+				case "yes":
+					skipMe = true
+				case "no":
+					skipMe = false
+				default:
+					return errn.ErrSyntax
+				}
+			case "type":
+				if strings.ToLower(value) != "normal" {
+					c.Writer.WriteInteger(0)
+					return nil
+				}
+			default:
+				return errn.ErrSyntax
+			}
+		}
+	}
+
+	var killed int64
+	for _, cl := range c.server.GetClients() {
+		if skipMe && cl == c {
+			continue
+		}
+		if (id > 0 && cl.id != id) || (len(addr) > 0 && cl.remoteAddr != addr) || (len(laddr) > 0 && cl.LocalAddr() != laddr) {
+			continue
+		}
+		killed++
+		if cl.conn != nil {
+			cl.conn.Close()
+		}
+	}
+
+	if oldStyle {
+		if killed == 0 {
+			return errn.ErrNoSuchClient
+		}
+		c.Writer.WriteStatus(resp.ReplyOK)
+	} else {
+		c.Writer.WriteInteger(killed)
+	}
+	return nil
+}
+
+func clientPauseCommand(c *Client, args [][]byte) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errn.CmdParamsErr("client|pause")
+	}
+
+	timeout, err := strconv.ParseInt(unsafe2.String(args[0]), 10, 64)
+	if err != nil || timeout < 0 {
+		return errn.ErrClientTimeout
+	}
+	mode := ClientPauseAll
+	if len(args) == 2 {
+		switch unsafe2.String(LowerSlice(args[1])) {
+		case "write":
+			mode = ClientPauseWrite
+		case "all":
+		default:
+			return errn.ErrSyntax
+		}
+	}
+
+	c.server.PauseClients(mode, time.Duration(timeout)*time.Millisecond)
+	c.Writer.WriteStatus(resp.ReplyOK)
+	return nil
+}
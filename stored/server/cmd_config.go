@@ -15,17 +15,30 @@
 package server
 
 import (
+	"encoding"
+	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/zuoyebang/bitalostored/butils/timesize"
 	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/btools"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
 	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/glob"
 	"github.com/zuoyebang/bitalostored/stored/internal/resp"
 )
 
 const (
-	CONFIGGET = "GET"
-	CONFIGSET = "SET"
+	CONFIGGET     = "GET"
+	CONFIGSET     = "SET"
+	CONFIGREWRITE = "REWRITE"
+
+	configAutoCompact = "autocompact"
+	configSecretMask  = "******"
 )
 
 func init() {
@@ -34,41 +47,424 @@ func init() {
 	})
 }
 
+// configField is a leaf of config.Config, name is "<section>.<key>" built from the toml tags.
+// secret fields are tagged `secret:"true"` and their values are never echoed back.
+type configField struct {
+	name   string
+	key    string
+	index  []int
+	secret bool
+}
+
+// configSetter marks a config field as changeable at runtime. check validates the
+// parsed value before it is published by config.StoreRuntime, apply makes the
+// running server pick it up. Fields read from config.Runtime on every use need no apply.
+type configSetter struct {
+	check func(v reflect.Value) error
+	apply func(s *Server)
+}
+
+var (
+	configMu     sync.Mutex
+	configFields = buildConfigFields()
+
+	slowShieldSetter = &configSetter{
+		check: checkConfigPositive,
+		apply: func(s *Server) {
+			if s.slowQuery != nil {
+				s.slowQuery.Reload()
+			}
+		},
+	}
+	expireDeletionSetter     = &configSetter{}
+	expireDeletionHourSetter = &configSetter{
+		check: checkConfigHour,
+	}
+
+	// runtimeConfigs leaves out bitalos.cache_size and the bitalos.compact_* windows:
+	// the meta cache is sized and bitalosdb takes its compaction settings when the
+	// db is opened, so they only change through the config file and a restart.
+	runtimeConfigs = map[string]*configSetter{
+		"server.slow_shield":          slowShieldSetter,
+		"server.slow_time":            slowShieldSetter,
+		"server.slow_key_window_time": slowShieldSetter,
+		"server.slow_ttl":             slowShieldSetter,
+		"server.slow_maxexec":         slowShieldSetter,
+		"server.slow_topn":            slowShieldSetter,
+		"server.slowlog_max_len": {
+			check: checkConfigPositive,
+			apply: func(s *Server) {
+				s.slowLog.setMaxLen(config.Runtime().Server.SlowLogMaxLen)
+			},
+		},
+		"server.max_client": {
+			check: checkConfigPositive,
+			apply: func(s *Server) {
+				s.Info.Server.SetMaxClient(config.Runtime().Server.Maxclient)
+			},
+		},
+		"bitalos.expired_deletion_interval":           expireDeletionSetter,
+		"bitalos.expired_deletion_qps_threshold":      expireDeletionSetter,
+		"bitalos.expired_deletion_disable_start_time": expireDeletionHourSetter,
+		"bitalos.expired_deletion_disable_end_time":   expireDeletionHourSetter,
+		"bitalos.io_write_qps_threshold": {
+			apply: func(s *Server) {
+				if qps := config.Runtime().Bitalos.IOWriteLoadQpsThreshold; qps > 0 {
+					btools.MaxIOWriteLoadQPS.Store(qps)
+				}
+			},
+		},
+		"bitalos.disk_quota": {
+			check: checkConfigNonNegative,
+		},
+		"bitalos.eviction_policy": {
+			check: func(v reflect.Value) error {
+				if !config.CheckEvictionPolicy(v.String()) {
+					return fmt.Errorf("unknown eviction policy")
+				}
+				return nil
+			},
+		},
+		"bitalos.eviction_samples":        {check: checkConfigPositive},
+		"bitalos.eviction_max_keys":       {check: checkConfigPositive},
+		"admission.min_free_disk":         {check: checkConfigNonNegative},
+		"admission.raft_queue_high_water": {check: checkConfigNonNegative},
+		"admission.max_follower_lag":      {check: checkConfigNonNegative},
+		"migrate.bulk_mode":               {},
+		"migrate.bulk_batch_size":         {check: checkConfigPositive},
+		"migrate.max_concurrent_slots":    {check: checkConfigPositive},
+		"migrate.max_keys_per_second":     {check: checkConfigNonNegative},
+		"migrate.max_bytes_per_second":    {check: checkConfigNonNegative},
+		"migrate.chunk_threshold":         {check: checkConfigNonNegative},
+		"migrate.chunk_size":              {check: checkConfigPositive},
+		"migrate.verify":                  {},
+		"migrate.verify_max_mismatch":     {check: checkConfigNonNegative},
+		"raft_queue.workers": {
+			check: checkConfigPositive,
+			apply: func(s *Server) {
+				if s.DoRaftQueueResize != nil {
+					s.DoRaftQueueResize(config.Runtime().RaftQueue.Workers)
+				}
+			},
+		},
+	}
+)
+
+func buildConfigFields() []*configField {
+	var fields []*configField
+	typ := reflect.TypeOf(config.Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		section := typ.Field(i)
+		sectionName := configTagName(section)
+		if sectionName == "" || section.Type.Kind() != reflect.Struct {
+			continue
+		}
+		for j := 0; j < section.Type.NumField(); j++ {
+			field := section.Type.Field(j)
+			key := configTagName(field)
+			if key == "" {
+				continue
+			}
+			fields = append(fields, &configField{
+				name:   sectionName + "." + key,
+				key:    key,
+				index:  []int{i, j},
+				secret: field.Tag.Get("secret") == "true",
+			})
+		}
+	}
+	return fields
+}
+
+func configTagName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// lookupConfigField accepts "<section>.<key>" or a bare key that is unique over all sections.
+func lookupConfigField(name string) *configField {
+	var found *configField
+	for _, f := range configFields {
+		if f.name == name {
+			return f
+		}
+		if f.key == name {
+			if found != nil {
+				return nil
+			}
+			found = f
+		}
+	}
+	return found
+}
+
+func formatConfigValue(v reflect.Value) string {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return ""
+		}
+		return string(text)
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatConfigValue(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+func parseConfigValue(typ reflect.Type, val string) (reflect.Value, error) {
+	v := reflect.New(typ)
+	if u, ok := v.Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(val)); err != nil {
+			return v, err
+		}
+		return v.Elem(), nil
+	}
+
+	elem := v.Elem()
+	switch typ.Kind() {
+	case reflect.Bool:
+		switch strings.ToLower(val) {
+		case "yes":
+			elem.SetBool(true)
+		case "no":
+			elem.SetBool(false)
+		default:
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return elem, err
+			}
+			elem.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, typ.Bits())
+		if err != nil {
+			return elem, err
+		}
+		elem.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, typ.Bits())
+		if err != nil {
+			return elem, err
+		}
+		elem.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, typ.Bits())
+		if err != nil {
+			return elem, err
+		}
+		elem.SetFloat(n)
+	case reflect.String:
+		elem.SetString(val)
+	default:
+		return elem, fmt.Errorf("unsupported type %s", typ)
+	}
+	return elem, nil
+}
+
+func checkConfigPositive(v reflect.Value) error {
+	var positive bool
+	if d, ok := v.Interface().(timesize.Duration); ok {
+		positive = d.Duration() > time.Duration(0)
+	} else {
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			positive = v.Int() > 0
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			positive = v.Uint() > 0
+		default:
+			positive = true
+		}
+	}
+	if !positive {
+		return fmt.Errorf("must be greater than 0")
+	}
+	return nil
+}
+
+func checkConfigNonNegative(v reflect.Value) error {
+	if v.Int() < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+func checkConfigHour(v reflect.Value) error {
+	if hour := v.Int(); hour < 0 || hour > 23 {
+		return fmt.Errorf("hour must be in [0,23]")
+	}
+	return nil
+}
+
 func configCommand(c *Client) error {
 	args := c.Args
-	if len(args) < 2 {
+	if len(args) < 1 {
 		return errn.CmdParamsErr(resp.CONFIG)
 	}
 
-	op := strings.ToUpper(unsafe2.String(args[0]))
-	if op != CONFIGSET {
+	switch strings.ToUpper(unsafe2.String(args[0])) {
+	case CONFIGGET:
+		return configGetCommand(c)
+	case CONFIGSET:
+		return configSetCommand(c)
+	case CONFIGREWRITE:
+		return configRewriteCommand(c)
+	default:
 		return errn.ErrNotImplement
 	}
+}
+
+func configGetCommand(c *Client) error {
+	if len(c.Args) < 2 {
+		return errn.CmdParamsErr("config|get")
+	}
+
+	globs := make([]glob.Glob, 0, len(c.Args)-1)
+	for _, arg := range c.Args[1:] {
+		g, err := glob.Compile(strings.ToLower(string(arg)))
+		if err != nil {
+			return errn.ErrSyntax
+		}
+		globs = append(globs, g)
+	}
+	match := func(names ...string) bool {
+		for _, g := range globs {
+			for _, name := range names {
+				if g.Match(name) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	var reply [][]byte
+	if match(configAutoCompact) {
+		autoCompact := "0"
+		if c.server.Info.Server.AutoCompact {
+			autoCompact = "1"
+		}
+		reply = append(reply, []byte(configAutoCompact), []byte(autoCompact))
+	}
+	cfg := reflect.ValueOf(config.Runtime()).Elem()
+	for _, f := range configFields {
+		if !match(f.name, f.key) {
+			continue
+		}
+		value := formatConfigValue(cfg.FieldByIndex(f.index))
+		if f.secret && len(value) > 0 {
+			value = configSecretMask
+		}
+		reply = append(reply, []byte(f.name), []byte(value))
+	}
+	c.Writer.WriteSliceArray(reply)
+	return nil
+}
+
+type configSetPair struct {
+	field  *configField
+	setter *configSetter
+	value  reflect.Value
+}
+
+func configSetCommand(c *Client) error {
+	args := c.Args[1:]
+	if len(args) < 2 || len(args)%2 != 0 {
+		return errn.CmdParamsErr("config|set")
+	}
+
+	autoCompact := -1
+	pairs := make([]configSetPair, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(string(args[i]))
+		val := strings.TrimSpace(string(args[i+1]))
+		if name == configAutoCompact {
+			v, err := strconv.Atoi(val)
+			if err != nil {
+				return errn.ErrValue
+			}
+			autoCompact = v
+			continue
+		}
 
-	configName := strings.ToUpper(unsafe2.String(args[1]))
-	if configName == "AUTOCOMPACT" {
-		if len(args) < 3 {
-			return errn.CmdParamsErr(resp.CONFIG)
+		field := lookupConfigField(name)
+		if field == nil {
+			return fmt.Errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", name)
+		}
+		setter, ok := runtimeConfigs[field.name]
+		if !ok {
+			return fmt.Errorf("ERR CONFIG SET failed - '%s' can not be changed at runtime, edit the config file and restart", field.name)
 		}
-		configValue, err := strconv.Atoi(string(args[2]))
+		typ := reflect.TypeOf(config.Config{}).FieldByIndex(field.index).Type
+		value, err := parseConfigValue(typ, val)
 		if err != nil {
-			return err
+			return fmt.Errorf("ERR CONFIG SET failed - invalid argument '%s' for '%s'", val, field.name)
+		}
+		if setter.check != nil {
+			if err = setter.check(value); err != nil {
+				return fmt.Errorf("ERR CONFIG SET failed - invalid argument '%s' for '%s': %s", val, field.name, err.Error())
+			}
 		}
+		pairs = append(pairs, configSetPair{field: field, setter: setter, value: value})
+	}
 
+	if autoCompact >= 0 {
 		db := c.server.GetDB()
-		if db != nil {
-			if configValue == 1 {
-				db.SetAutoCompact(true)
-				c.server.Info.Server.AutoCompact = true
-			} else {
-				db.SetAutoCompact(false)
-				c.server.Info.Server.AutoCompact = false
-			}
-			c.server.Info.Server.UpdateCache()
-			c.Writer.WriteStatus(resp.ReplyOK)
+		if db == nil {
+			return fmt.Errorf("ERR CONFIG SET failed - '%s' needs an open db", configAutoCompact)
 		}
-	} else {
-		return errn.ErrNotImplement
+		db.SetAutoCompact(autoCompact == 1)
+		c.server.Info.Server.AutoCompact = autoCompact == 1
+		c.server.Info.Server.UpdateCache()
+	}
+
+	configMu.Lock()
+	next := *config.Runtime()
+	cfg := reflect.ValueOf(&next).Elem()
+	for _, p := range pairs {
+		cfg.FieldByIndex(p.field.index).Set(p.value)
+	}
+	config.StoreRuntime(&next)
+	applied := make(map[*configSetter]struct{}, len(pairs))
+	for _, p := range pairs {
+		if _, ok := applied[p.setter]; ok || p.setter.apply == nil {
+			continue
+		}
+		applied[p.setter] = struct{}{}
+		p.setter.apply(c.server)
+	}
+	configMu.Unlock()
+
+	c.Writer.WriteStatus(resp.ReplyOK)
+	return nil
+}
+
+func configRewriteCommand(c *Client) error {
+	if len(c.Args) != 1 {
+		return errn.CmdParamsErr("config|rewrite")
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	cfg := config.Runtime()
+	if cfg.Server.ConfigFile == "" {
+		return fmt.Errorf("ERR The server is running without a config file")
+	}
+	if err := cfg.WriteFile(cfg.Server.ConfigFile); err != nil {
+		return fmt.Errorf("ERR Rewriting config file: %s", err.Error())
 	}
+	c.Writer.WriteStatus(resp.ReplyOK)
 	return nil
 }
@@ -218,6 +218,8 @@ func infoCommand(c *Client) error {
 			info, closer = sinfo.Cluster.Marshal()
 		case "stats":
 			info, closer = sinfo.Stats.Marshal()
+		case "latencystats":
+			info = c.server.latencyStatsInfo()
 		case "_leader_address":
 			info = []byte(sinfo.Cluster.LeaderAddress)
 		case "_server_address":
@@ -0,0 +1,117 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strconv"
+
+	"github.com/zuoyebang/bitalostored/butils/histogram"
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
+)
+
+var latencyPercentiles = []float64{50, 99, 99.9}
+
+func init() {
+	AddCommand(map[string]*Cmd{
+		resp.LATENCY: {Sync: false, Handler: latencyCommand, NoKey: true, NotAllowedInTx: true},
+	})
+}
+
+// ResetStats clears the per-command call counters and latency histograms.
+func (s *Server) ResetStats() {
+	rangeCommands(func(_ string, cmd *Cmd) {
+		if cmd.stats != nil {
+			cmd.stats.reset()
+		}
+	})
+}
+
+func (s *Server) latencyStatsInfo() []byte {
+	buf := make([]byte, 0, 1024)
+	buf = append(buf, "# Latencystats\n"...)
+	rangeCommands(func(name string, cmd *Cmd) {
+		if cmd.stats == nil || cmd.stats.hist.Count() == 0 {
+			return
+		}
+		h := cmd.stats.hist
+		buf = append(buf, "latency_percentiles_usec_"...)
+		buf = append(buf, name...)
+		buf = append(buf, ':')
+		for i, v := range h.Percentiles(latencyPercentiles...) {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, 'p')
+			buf = strconv.AppendFloat(buf, latencyPercentiles[i], 'f', -1, 64)
+			buf = append(buf, '=')
+			buf = strconv.AppendFloat(buf, float64(v), 'f', 3, 64)
+		}
+		buf = append(buf, ",max="...)
+		buf = strconv.AppendFloat(buf, float64(h.Max()), 'f', 3, 64)
+		buf = append(buf, '\n')
+	})
+	return append(buf, '\n')
+}
+
+func latencyCommand(c *Client) error {
+	if len(c.Args) == 0 {
+		return errn.CmdParamsErr(resp.LATENCY)
+	}
+
+	switch unsafe2.String(LowerSlice(c.Args[0])) {
+	case "histogram":
+		var filter map[string]bool
+		if len(c.Args) > 1 {
+			filter = make(map[string]bool, len(c.Args)-1)
+			for _, arg := range c.Args[1:] {
+				filter[string(LowerSlice(arg))] = true
+			}
+		}
+		reply := make([]interface{}, 0, 16)
+		rangeCommands(func(name string, cmd *Cmd) {
+			if cmd.stats == nil || cmd.stats.hist.Count() == 0 {
+				return
+			}
+			if filter != nil && !filter[name] {
+				return
+			}
+			reply = append(reply, []byte(name), histogramReply(cmd.stats.hist))
+		})
+		c.Writer.WriteArray(reply)
+	case "reset":
+		if len(c.Args) != 1 {
+			return errn.CmdParamsErr("latency|reset")
+		}
+		c.server.ResetStats()
+		c.Writer.WriteStatus(resp.ReplyOK)
+	default:
+		return errn.CmdParamsErr(resp.LATENCY)
+	}
+	return nil
+}
+
+func histogramReply(h *histogram.Histogram) []interface{} {
+	bounds, cumulative := h.PowerOfTwoBuckets()
+	buckets := make([]interface{}, 0, 2*len(bounds))
+	for i := range bounds {
+		buckets = append(buckets, bounds[i], cumulative[i])
+	}
+	return []interface{}{
+		[]byte("calls"), h.Count(),
+		[]byte("histogram_usec"), buckets,
+	}
+}
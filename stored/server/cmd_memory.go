@@ -0,0 +1,230 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"github.com/zuoyebang/bitalostored/butils"
+	"github.com/zuoyebang/bitalostored/butils/hash"
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
+	"github.com/zuoyebang/bitalostored/stored/internal/utils"
+)
+
+const memoryUsageDefaultSamples = 5
+
+func init() {
+	AddCommand(map[string]*Cmd{
+		resp.MEMORY: {Sync: false, Handler: memoryCommand, NoKey: true, NotAllowedInTx: true},
+	})
+}
+
+type memoryStats struct {
+	rss          uint64
+	heapAlloc    uint64
+	heapInuse    uint64
+	heapIdle     uint64
+	heapReleased uint64
+	stackInuse   uint64
+	runtimeSys   uint64
+	gcNum        uint32
+
+	metaCacheMax     uint64
+	metaCacheUsed    uint64
+	metaCacheItems   int
+	metaCacheHitRate float64
+
+	bitmapEnable   bool
+	bitmapItems    int
+	bitmapMaxItems int
+	bitmapBytes    uint64
+
+	luaStates int64
+
+	kvStores       int
+	memtableSize   uint64
+	blockCacheSize uint64
+}
+
+func collectMemoryStats(c *Client) *memoryStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	st := &memoryStats{
+		heapAlloc:    ms.HeapAlloc,
+		heapInuse:    ms.HeapInuse,
+		heapIdle:     ms.HeapIdle,
+		heapReleased: ms.HeapReleased,
+		stackInuse:   ms.StackInuse,
+		runtimeSys:   ms.Sys,
+		gcNum:        ms.NumGC,
+		luaStates:    LuaStateCount(),
+	}
+	if su := utils.GetSysUsage(); su != nil {
+		st.rss = uint64(su.MemTotal())
+	}
+
+	cs := c.DB.CacheStats()
+	st.metaCacheMax = cs.MaxMem
+	st.metaCacheUsed = cs.UsedMem
+	st.metaCacheItems = cs.Items
+	if cs.QueryCount > 0 {
+		st.metaCacheHitRate = float64(cs.QueryCount-cs.MissCount) / float64(cs.QueryCount)
+	}
+
+	bs := c.DB.BitmapMemStats()
+	st.bitmapEnable = bs.Enable
+	st.bitmapItems = bs.Items
+	st.bitmapMaxItems = bs.MaxItems
+	st.bitmapBytes = bs.Bytes
+
+	st.kvStores = c.DB.KVStoreNum()
+	st.memtableSize = uint64(config.GlobalConfig.Bitalos.WriteBufferSize.Int64())
+	st.blockCacheSize = uint64(config.GlobalConfig.Bitalos.PageBlockCacheSize.Int64())
+	return st
+}
+
+// tracked is the memory accounted to a subsystem: the Go runtime, the
+// off-heap meta cache and one active memtable per bitalosdb store.
+func (st *memoryStats) tracked() uint64 {
+	return st.runtimeSys + st.metaCacheUsed + uint64(st.kvStores)*st.memtableSize
+}
+
+func (st *memoryStats) reply() []interface{} {
+	var bitmapEnable int64
+	if st.bitmapEnable {
+		bitmapEnable = 1
+	}
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"process.rss", int64(st.rss)},
+		{"runtime.sys", int64(st.runtimeSys)},
+		{"runtime.heap.alloc", int64(st.heapAlloc)},
+		{"runtime.heap.inuse", int64(st.heapInuse)},
+		{"runtime.heap.idle", int64(st.heapIdle)},
+		{"runtime.heap.released", int64(st.heapReleased)},
+		{"runtime.stack.inuse", int64(st.stackInuse)},
+		{"runtime.gc.num", int64(st.gcNum)},
+		{"metacache.max", int64(st.metaCacheMax)},
+		{"metacache.used", int64(st.metaCacheUsed)},
+		{"metacache.items", int64(st.metaCacheItems)},
+		{"metacache.hit.rate", []byte(strconv.FormatFloat(st.metaCacheHitRate, 'f', 6, 64))},
+		{"bitmap.enabled", bitmapEnable},
+		{"bitmap.items", int64(st.bitmapItems)},
+		{"bitmap.max.items", int64(st.bitmapMaxItems)},
+		{"bitmap.bytes", int64(st.bitmapBytes)},
+		{"lua.states", st.luaStates},
+		{"bitalosdb.stores", int64(st.kvStores)},
+		{"bitalosdb.memtable.size", int64(st.memtableSize)},
+		{"bitalosdb.memtable.total", int64(uint64(st.kvStores) * st.memtableSize)},
+		{"bitalosdb.blockcache.size", int64(st.blockCacheSize)},
+		{"tracked.total", int64(st.tracked())},
+	}
+	reply := make([]interface{}, 0, 2*len(fields))
+	for _, f := range fields {
+		reply = append(reply, []byte(f.name), f.value)
+	}
+	return reply
+}
+
+func (st *memoryStats) doctor() []byte {
+	var buf bytes.Buffer
+	if st.metaCacheMax > 0 && st.metaCacheUsed*100 >= st.metaCacheMax*95 && st.metaCacheHitRate < 0.8 {
+		fmt.Fprintf(&buf, "* Meta cache is full (%s of %s) and hit rate is %.2f%%, consider raising bitalos.cache_size.\n",
+			butils.FmtSize(st.metaCacheUsed), butils.FmtSize(st.metaCacheMax), st.metaCacheHitRate*100)
+	}
+	if st.bitmapEnable && st.bitmapMaxItems > 0 && st.bitmapItems*10 >= st.bitmapMaxItems*9 {
+		fmt.Fprintf(&buf, "* Bitmap cache holds %d of %d items (%s), new bitmaps fall back to disk, consider raising bitalos.bitmap_cache_item_count.\n",
+			st.bitmapItems, st.bitmapMaxItems, butils.FmtSize(st.bitmapBytes))
+	}
+	if idle := st.heapIdle - st.heapReleased; idle > 1<<30 && idle > st.heapInuse {
+		fmt.Fprintf(&buf, "* Go heap keeps %s idle but unreleased memory against %s in use, the heap is fragmented or a recent spike has not been returned to the OS yet.\n",
+			butils.FmtSize(idle), butils.FmtSize(st.heapInuse))
+	}
+	if st.luaStates > 1024 {
+		fmt.Fprintf(&buf, "* %d Lua states are alive, long-running or concurrent scripts are holding interpreters.\n", st.luaStates)
+	}
+	if tracked := st.tracked(); st.rss > 0 && st.rss > tracked+tracked/2 {
+		fmt.Fprintf(&buf, "* Process RSS %s is much larger than the %s tracked by subsystems, the rest is likely bitalosdb block cache (%s per store) and immutable memtables.\n",
+			butils.FmtSize(st.rss), butils.FmtSize(tracked), butils.FmtSize(st.blockCacheSize))
+	}
+	if buf.Len() == 0 {
+		return []byte("No memory issues detected.")
+	}
+	return append([]byte("Memory doctor report:\n\n"), buf.Bytes()...)
+}
+
+func memoryCommand(c *Client) error {
+	if len(c.Args) == 0 {
+		return errn.CmdParamsErr(resp.MEMORY)
+	}
+
+	switch unsafe2.String(LowerSlice(c.Args[0])) {
+	case "usage":
+		return memoryUsageCommand(c)
+	case "stats":
+		if len(c.Args) != 1 {
+			return errn.CmdParamsErr("memory|stats")
+		}
+		c.Writer.WriteArray(collectMemoryStats(c).reply())
+	case "doctor":
+		if len(c.Args) != 1 {
+			return errn.CmdParamsErr("memory|doctor")
+		}
+		c.Writer.WriteBulk(collectMemoryStats(c).doctor())
+	default:
+		return errn.CmdParamsErr(resp.MEMORY)
+	}
+	return nil
+}
+
+func memoryUsageCommand(c *Client) error {
+	args := c.Args[1:]
+	if len(args) != 1 && len(args) != 3 {
+		return errn.CmdParamsErr("memory|usage")
+	}
+
+	samples := memoryUsageDefaultSamples
+	if len(args) == 3 {
+		if unsafe2.String(LowerSlice(args[1])) != "samples" {
+			return errn.ErrSyntax
+		}
+		n, err := strconv.Atoi(unsafe2.String(args[2]))
+		if err != nil || n < 0 {
+			return errn.ErrValue
+		}
+		samples = n
+	}
+
+	key := args[0]
+	n, err := c.DB.MemoryUsage(key, hash.Fnv32(key), samples)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		c.Writer.WriteBulk(nil)
+	} else {
+		c.Writer.WriteInteger(n)
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/panjf2000/gnet/v2"
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/stored/engine"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
+)
+
+const (
+	monitorQueueSize  = 4096
+	monitorFlushBatch = 128
+	auditArgMaxLen    = 128
+	auditUserDefault  = "default"
+	monitorRedacted   = "(redacted)"
+)
+
+var auditAdminCmds = map[string]struct{}{
+	resp.SHUTDOWN: {},
+	resp.CONFIG:   {},
+	resp.CLIENT:   {},
+	resp.MONITOR:  {},
+}
+
+func init() {
+	AddCommand(map[string]*Cmd{
+		resp.MONITOR: {Sync: false, Handler: monitorCommand, NoKey: true, NotAllowedInTx: true, Internal: true},
+	})
+}
+
+type MonitorFilter struct {
+	Cmds      map[string]struct{}
+	KeyPrefix []byte
+	Addr      string
+}
+
+func (f *MonitorFilter) match(c *Client) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Cmds) > 0 {
+		if _, ok := f.Cmds[c.Cmd]; !ok {
+			return false
+		}
+	}
+	if len(f.KeyPrefix) > 0 && !bytes.HasPrefix(c.Keys, f.KeyPrefix) {
+		return false
+	}
+	if len(f.Addr) > 0 && f.Addr != c.remoteAddr && !strings.HasPrefix(c.remoteAddr, f.Addr+":") {
+		return false
+	}
+	return true
+}
+
+type Monitor struct {
+	filter  *MonitorFilter
+	conn    gnet.Conn
+	events  chan []byte
+	closeCh chan struct{}
+	closed  atomic.Bool
+	dropped atomic.Int64
+}
+
+func (s *Server) addMonitor(conn gnet.Conn, filter *MonitorFilter) *Monitor {
+	m := &Monitor{
+		filter:  filter,
+		conn:    conn,
+		events:  make(chan []byte, monitorQueueSize),
+		closeCh: make(chan struct{}),
+	}
+
+	s.monitorMu.Lock()
+	var monitors []*Monitor
+	if p := s.monitors.Load(); p != nil {
+		monitors = append(monitors, *p...)
+	}
+	monitors = append(monitors, m)
+	s.monitors.Store(&monitors)
+	s.monitorMu.Unlock()
+
+	go m.run()
+	return m
+}
+
+func (s *Server) removeMonitor(m *Monitor) {
+	if !m.closed.CompareAndSwap(false, true) {
+		return
+	}
+	close(m.closeCh)
+
+	s.monitorMu.Lock()
+	defer s.monitorMu.Unlock()
+	p := s.monitors.Load()
+	if p == nil {
+		return
+	}
+	monitors := make([]*Monitor, 0, len(*p))
+	for _, other := range *p {
+		if other != m {
+			monitors = append(monitors, other)
+		}
+	}
+	if len(monitors) == 0 {
+		s.monitors.Store(nil)
+	} else {
+		s.monitors.Store(&monitors)
+	}
+}
+
+func (s *Server) MonitorNum() int {
+	if p := s.monitors.Load(); p != nil {
+		return len(*p)
+	}
+	return 0
+}
+
+// run writes events outside the event loop with at most one write in flight,
+// so a slow monitor only loses events and never holds up the command path.
+func (m *Monitor) run() {
+	written := make(chan error, 1)
+	buf := make([]byte, 0, 16<<10)
+	for {
+		var event []byte
+		select {
+		case event = <-m.events:
+		case <-m.closeCh:
+			return
+		}
+
+		buf = appendMonitorEvent(buf[:0], event)
+		for i := 0; i < monitorFlushBatch && len(m.events) > 0; i++ {
+			buf = appendMonitorEvent(buf, <-m.events)
+		}
+		if err := m.conn.AsyncWrite(buf, func(_ gnet.Conn, err error) error {
+			written <- err
+			return nil
+		}); err != nil {
+			return
+		}
+
+		select {
+		case err := <-written:
+			if err != nil {
+				return
+			}
+		case <-m.closeCh:
+			return
+		}
+	}
+}
+
+func appendMonitorEvent(buf []byte, event []byte) []byte {
+	buf = append(buf, '+')
+	buf = append(buf, event...)
+	return append(buf, resp.Delims...)
+}
+
+func (c *Client) feedMonitors(monitors []*Monitor) {
+	var event []byte
+	for _, m := range monitors {
+		if !m.filter.match(c) {
+			continue
+		}
+		if event == nil {
+			event = c.formatMonitorEvent()
+		}
+		select {
+		case m.events <- event:
+		default:
+			m.dropped.Add(1)
+		}
+	}
+}
+
+func (c *Client) formatMonitorEvent() []byte {
+	size := 64
+	for _, arg := range c.Data {
+		size += len(arg) + 3
+	}
+	startNano := c.QueryStartTime.UnixNano()
+	buf := make([]byte, 0, size)
+	buf = strconv.AppendInt(buf, startNano/int64(time.Second), 10)
+	buf = append(buf, '.')
+	usec := strconv.AppendInt(make([]byte, 0, 6), (startNano%int64(time.Second))/int64(time.Microsecond), 10)
+	for i := len(usec); i < 6; i++ {
+		buf = append(buf, '0')
+	}
+	buf = append(buf, usec...)
+	buf = append(buf, " [0 "...)
+	buf = append(buf, c.remoteAddr...)
+	buf = append(buf, ']')
+	for i, arg := range c.Data {
+		buf = append(buf, ' ')
+		if c.isSecretArg(i) {
+			buf = strconv.AppendQuote(buf, monitorRedacted)
+		} else {
+			buf = strconv.AppendQuote(buf, unsafe2.String(arg))
+		}
+	}
+	return buf
+}
+
+// isSecretArg reports whether c.Data[i] carries a credential, the migrate token of
+// migrateauth or the value of a secret field in CONFIG SET name value [name value ...].
+func (c *Client) isSecretArg(i int) bool {
+	switch c.Cmd {
+	case engine.MigrateAuthCmd:
+		return i > 0
+	case resp.CONFIG:
+		if i < 3 || i%2 == 0 || !strings.EqualFold(unsafe2.String(c.Data[1]), CONFIGSET) {
+			return false
+		}
+		f := lookupConfigField(strings.ToLower(unsafe2.String(c.Data[i-1])))
+		return f != nil && f.secret
+	default:
+		return false
+	}
+}
+
+// monitorCommand streams the commands served by this node. Stored has no users, so
+// once a migrate token is configured only connections authenticated by migrateauth
+// may monitor. Credentials in the stream are redacted like redis does.
+// Usage: MONITOR [CMD name[,name...]] [PREFIX keyprefix] [ADDR ip|ip:port]
+func monitorCommand(c *Client) error {
+	if c.conn == nil {
+		return errn.ErrNotImplement
+	}
+	if c.monitor != nil {
+		c.Writer.WriteStatus(resp.ReplyOK)
+		return nil
+	}
+
+	var filter *MonitorFilter
+	if len(c.Args) > 0 {
+		if len(c.Args)%2 != 0 {
+			return errn.ErrSyntax
+		}
+		filter = &MonitorFilter{}
+		for i := 0; i < len(c.Args); i += 2 {
+			value := string(c.Args[i+1])
+			switch unsafe2.String(LowerSlice(c.Args[i])) {
+			case "cmd":
+				filter.Cmds = make(map[string]struct{}, 4)
+				for _, cmd := range strings.Split(value, ",") {
+					if cmd = strings.TrimSpace(cmd); len(cmd) > 0 {
+						filter.Cmds[strings.ToLower(cmd)] = struct{}{}
+					}
+				}
+			case "prefix":
+				filter.KeyPrefix = []byte(value)
+			case "addr":
+				filter.Addr = value
+			default:
+				return errn.ErrSyntax
+			}
+		}
+	}
+
+	c.Writer.WriteStatus(resp.ReplyOK)
+	c.monitor = c.server.addMonitor(c.conn, filter)
+	return nil
+}
+
+type auditEntry struct {
+	Time   string   `json:"time"`
+	User   string   `json:"user"`
+	Addr   string   `json:"addr"`
+	Cmd    string   `json:"cmd"`
+	Key    string   `json:"key,omitempty"`
+	Args   []string `json:"args,omitempty"`
+	Admin  bool     `json:"admin,omitempty"`
+	Status string   `json:"status"`
+	CostUs int64    `json:"cost_us"`
+}
+
+// auditCommand records admin and write commands as JSON lines. Stored has no users,
+// commands are attributed to the default user and the peer address.
+func (c *Client) auditCommand(err error) {
+	execCmd, ok := commands[c.Cmd]
+	if !ok {
+		return
+	}
+	_, isAdmin := auditAdminCmds[c.Cmd]
+	if !isAdmin && !execCmd.Sync {
+		return
+	}
+
+	now := time.Now()
+	entry := &auditEntry{
+		Time:   now.Format(time.RFC3339Nano),
+		User:   auditUserDefault,
+		Addr:   c.remoteAddr,
+		Cmd:    execCmd.Name,
+		Admin:  isAdmin,
+		Status: "OK",
+		CostUs: now.Sub(c.QueryStartTime).Microseconds(),
+	}
+	if err != nil {
+		entry.Status = err.Error()
+	}
+	if isAdmin {
+		entry.Args = make([]string, 0, len(c.Args))
+		for i, arg := range c.Args {
+			if c.isSecretArg(i + 1) {
+				entry.Args = append(entry.Args, monitorRedacted)
+				continue
+			}
+			if len(arg) > auditArgMaxLen {
+				arg = arg[:auditArgMaxLen]
+			}
+			entry.Args = append(entry.Args, string(arg))
+		}
+	} else if len(c.Keys) > 0 {
+		key := c.Keys
+		if len(key) > auditArgMaxLen {
+			key = key[:auditArgMaxLen]
+		}
+		entry.Key = string(key)
+	}
+
+	data, jerr := json.Marshal(entry)
+	if jerr != nil {
+		log.Warnf("marshal audit entry failed err:%v", jerr)
+		return
+	}
+	log.Audit(data)
+}
@@ -0,0 +1,71 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strconv"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
+	"github.com/zuoyebang/bitalostored/stored/internal/utils"
+)
+
+func init() {
+	AddCommand(map[string]*Cmd{
+		resp.SLOTSTATS: {Sync: false, Handler: slotStatsCommand, NoKey: true, NotAllowedInTx: true},
+	})
+}
+
+// slotStatsCommand replies the stats of the slots in [start, end] that hold
+// keys or serve traffic: SLOTSTATS [start end]
+func slotStatsCommand(c *Client) error {
+	args := c.Args
+	start, end := uint32(0), utils.TotalSlot-1
+	if len(args) != 0 {
+		if len(args) != 2 {
+			return errn.CmdParamsErr(resp.SLOTSTATS)
+		}
+		s, err := strconv.ParseUint(unsafe2.String(args[0]), 10, 32)
+		if err != nil {
+			return errn.ErrValue
+		}
+		e, err := strconv.ParseUint(unsafe2.String(args[1]), 10, 32)
+		if err != nil || s > e || e >= uint64(utils.TotalSlot) {
+			return errn.ErrValue
+		}
+		start, end = uint32(s), uint32(e)
+	}
+
+	ss := c.server.slotStats
+	res := make([]interface{}, 0, 16)
+	for slot := start; slot <= end; slot++ {
+		st := ss.get(slot)
+		if st.keys == 0 && st.bytes == 0 && st.readQPS == 0 && st.writeQPS == 0 {
+			continue
+		}
+		res = append(res, []interface{}{
+			int64(slot),
+			[]interface{}{
+				"keys", st.keys,
+				"bytes", st.bytes,
+				"read_qps", int64(st.readQPS),
+				"write_qps", int64(st.writeQPS),
+			},
+		})
+	}
+	c.Writer.WriteArray(res)
+	return nil
+}
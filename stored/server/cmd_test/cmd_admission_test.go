@@ -0,0 +1,73 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestAdmissionLowFreeDisk(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	key := "admission_low_free_disk_key"
+	if _, err := c.Do("set", key, "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("config", "set", "min_free_disk", "1125899906842624"); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Do("config", "set", "min_free_disk", "0")
+
+	var err error
+	for i := 0; i < 30; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if _, err = c.Do("set", key, "v"); err != nil {
+			break
+		}
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "OOM") {
+		t.Fatalf("set below min free disk should fail with OOM, err:%v", err)
+	}
+	if v, err := redis.String(c.Do("get", key)); err != nil || v != "v" {
+		t.Fatalf("get below min free disk should succeed, v:%s err:%v", v, err)
+	}
+	info, err := redis.String(c.Do("info"))
+	if err != nil || !strings.Contains(info, "admission_state:low_free_disk") {
+		t.Fatalf("info should report low free disk, err:%v", err)
+	}
+
+	if _, err = c.Do("config", "set", "min_free_disk", "0"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if _, err = c.Do("set", key, "v"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("set after disabling min free disk err:%v", err)
+	}
+	c.Do("del", key)
+
+	if _, err = c.Do("config", "set", "max_follower_lag", "-1"); err == nil {
+		t.Fatal("config set negative max_follower_lag should fail")
+	}
+}
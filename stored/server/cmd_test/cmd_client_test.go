@@ -0,0 +1,119 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestClientCommand(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	if _, err := c.Do("client", "setname", "worker-1"); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := redis.String(c.Do("client", "getname")); err != nil || name != "worker-1" {
+		t.Fatalf("getname name:%s err:%v", name, err)
+	}
+	id, err := redis.Int64(c.Do("client", "id"))
+	if err != nil || id <= 0 {
+		t.Fatalf("client id:%d err:%v", id, err)
+	}
+	if info, err := redis.String(c.Do("client", "info")); err != nil || !strings.Contains(info, "name=worker-1") {
+		t.Fatalf("client info:%s err:%v", info, err)
+	}
+
+	other := getTestConn()
+	defer other.Close()
+	otherId, _ := redis.Int64(other.Do("client", "id"))
+	if list, err := redis.String(c.Do("client", "list", "id", otherId)); err != nil || strings.Count(list, "\n") != 1 {
+		t.Fatalf("client list:%s err:%v", list, err)
+	}
+	if n, err := redis.Int(c.Do("client", "kill", "id", otherId)); err != nil || n != 1 {
+		t.Fatalf("client kill n:%d err:%v", n, err)
+	}
+}
+
+func TestClientPauseWrite(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	if _, err := c.Do("client", "pause", 10000, "write"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("set", "client_pause_key", "v"); err == nil {
+		t.Fatal("write should be rejected while paused")
+	}
+	if _, err := c.Do("get", "client_pause_key"); err != nil {
+		t.Fatalf("read should be allowed while paused err:%v", err)
+	}
+	if _, err := c.Do("client", "unpause"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("set", "client_pause_key", "v"); err != nil {
+		t.Fatalf("write should be allowed after unpause err:%v", err)
+	}
+}
+
+func TestMonitorCommand(t *testing.T) {
+	mc := getTestConn()
+	defer mc.Close()
+	if res, err := redis.String(mc.Do("monitor", "prefix", "monitor_key")); err != nil || res != "OK" {
+		t.Fatalf("monitor res:%s err:%v", res, err)
+	}
+
+	c := getTestConn()
+	defer c.Close()
+	c.Do("set", "other_key", "v")
+	c.Do("set", "monitor_key", "v")
+
+	event, err := redis.String(mc.Receive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(event, `"set" "monitor_key" "v"`) {
+		t.Fatalf("bad monitor event:%s", event)
+	}
+}
+
+func TestMonitorRedact(t *testing.T) {
+	mc := getTestConn()
+	defer mc.Close()
+	if res, err := redis.String(mc.Do("monitor", "cmd", "migrateauth,config")); err != nil || res != "OK" {
+		t.Fatalf("monitor res:%s err:%v", res, err)
+	}
+
+	c := getTestConn()
+	defer c.Close()
+	c.Do("migrateauth", "monitor-secret")
+	c.Do("config", "set", "migrate.auth_token", "monitor-secret")
+
+	for _, want := range []string{
+		`"migrateauth" "(redacted)"`,
+		`"config" "set" "migrate.auth_token" "(redacted)"`,
+	} {
+		event, err := redis.String(mc.Receive())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(event, want) || strings.Contains(event, "monitor-secret") {
+			t.Fatalf("bad monitor event:%s", event)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestConfigCommand(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	if _, err := c.Do("config", "set", "slow_topn", "80", "raft_queue.workers", "40"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := redis.StringMap(c.Do("config", "get", "slow_topn", "raft_queue.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply["server.slow_topn"] != "80" || reply["raft_queue.workers"] != "40" {
+		t.Fatalf("config get:%v", reply)
+	}
+
+	if _, err = c.Do("config", "set", "slow_time", "100ms"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := redis.Strings(c.Do("config", "get", "server.slow_time")); err != nil || len(v) != 2 || v[1] != "100ms" {
+		t.Fatalf("config get slow_time:%v err:%v", v, err)
+	}
+
+	if _, err = c.Do("config", "set", "expired_deletion_disable_start_time", "24"); err == nil {
+		t.Fatal("config set invalid hour should fail")
+	}
+	if _, err = c.Do("config", "set", "cache_size", "1gb"); err == nil {
+		t.Fatal("config set cache_size should fail at runtime")
+	}
+	if _, err = c.Do("config", "set", "compact_start_time", "1"); err == nil {
+		t.Fatal("config set compact_start_time should fail at runtime")
+	}
+	secrets, err := redis.StringMap(c.Do("config", "get", "*token"))
+	if err != nil || len(secrets) != 2 {
+		t.Fatalf("config get secrets:%v err:%v", secrets, err)
+	}
+	for name, v := range secrets {
+		if v != "" && v != "******" {
+			t.Fatalf("config get %s is not masked:%s", name, v)
+		}
+	}
+	if _, err = c.Do("config", "set", "no_such_config", "1"); err == nil {
+		t.Fatal("config set unknown option should fail")
+	}
+	if _, err = c.Do("config", "set", "slow_topn"); err == nil {
+		t.Fatal("config set without value should fail")
+	}
+	if v, err := redis.Strings(c.Do("config", "get", "no_such_*")); err != nil || len(v) != 0 {
+		t.Fatalf("config get no match:%v err:%v", v, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestEvictionNoEviction(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	key := "eviction_noeviction_key"
+	if _, err := c.Do("config", "set", "eviction_policy", "noeviction", "disk_quota", "1"); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Do("config", "set", "disk_quota", "0")
+
+	var err error
+	for i := 0; i < 30; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if _, err = c.Do("set", key, "v"); err != nil {
+			break
+		}
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "OOM") {
+		t.Fatalf("set over disk quota should fail with OOM, err:%v", err)
+	}
+	if _, err = c.Do("del", key); err != nil {
+		t.Fatalf("del over disk quota should succeed, err:%v", err)
+	}
+	var info string
+	for i := 0; i < 60; i++ {
+		if info, err = redis.String(c.Do("info")); err != nil || strings.Contains(info, "disk_quota_exceeded:true") {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil || !strings.Contains(info, "disk_quota_exceeded:true") {
+		t.Fatalf("info should report disk quota exceeded, err:%v", err)
+	}
+
+	if _, err = c.Do("config", "set", "disk_quota", "0"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if _, err = c.Do("set", key, "v"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("set after disabling disk quota err:%v", err)
+	}
+	c.Do("del", key)
+
+	if _, err = c.Do("config", "set", "eviction_policy", "allkeys-lfu"); err == nil {
+		t.Fatal("config set unknown eviction policy should fail")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestLatencyCommand(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	if _, err := c.Do("latency", "reset"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := c.Do("set", "latency_key", "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := redis.String(c.Do("info", "latencystats"))
+	if err != nil || !strings.Contains(info, "latency_percentiles_usec_set:p50=") {
+		t.Fatalf("latencystats info:%s err:%v", info, err)
+	}
+
+	reply, err := redis.Values(c.Do("latency", "histogram", "set"))
+	if err != nil || len(reply) != 2 {
+		t.Fatalf("latency histogram reply:%v err:%v", reply, err)
+	}
+	if name, _ := redis.String(reply[0], nil); name != "set" {
+		t.Fatalf("latency histogram name:%s", name)
+	}
+	hist, err := redis.Values(reply[1], nil)
+	if err != nil || len(hist) != 4 {
+		t.Fatalf("latency histogram:%v err:%v", hist, err)
+	}
+	if calls, _ := redis.Int64(hist[1], nil); calls < 10 {
+		t.Fatalf("latency histogram calls:%d", calls)
+	}
+
+	if _, err = c.Do("latency", "reset"); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err = redis.Values(c.Do("latency", "histogram", "set")); err != nil || len(reply) != 0 {
+		t.Fatalf("latency histogram after reset:%v err:%v", reply, err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestMemoryUsage(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	key := "memory_usage_key"
+	hkey := "memory_usage_hkey"
+	c.Do("del", key, hkey)
+	defer c.Do("del", key, hkey)
+
+	if reply, err := c.Do("memory", "usage", key); err != nil || reply != nil {
+		t.Fatalf("memory usage missing key:%v err:%v", reply, err)
+	}
+
+	if _, err := c.Do("set", key, strings.Repeat("v", 1000)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := redis.Int64(c.Do("memory", "usage", key))
+	if err != nil || n < 1000 {
+		t.Fatalf("memory usage string:%d err:%v", n, err)
+	}
+
+	for i := 0; i < 50; i++ {
+		if _, err = c.Do("hset", hkey, i, strings.Repeat("v", 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sampled, err := redis.Int64(c.Do("memory", "usage", hkey, "samples", 5))
+	if err != nil || sampled < 50*100 {
+		t.Fatalf("memory usage hash:%d err:%v", sampled, err)
+	}
+	all, err := redis.Int64(c.Do("memory", "usage", hkey, "samples", 0))
+	if err != nil || all < 50*100 {
+		t.Fatalf("memory usage hash all:%d err:%v", all, err)
+	}
+
+	if _, err = c.Do("memory", "usage", key, "samples", -1); err == nil {
+		t.Fatal("memory usage negative samples should fail")
+	}
+	if _, err = c.Do("memory", "usage", key, "count", 1); err == nil {
+		t.Fatal("memory usage invalid option should fail")
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	reply, err := redis.Values(c.Do("memory", "stats"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := make(map[string]interface{}, len(reply)/2)
+	for i := 0; i+1 < len(reply); i += 2 {
+		stats[string(reply[i].([]byte))] = reply[i+1]
+	}
+	for _, name := range []string{"runtime.heap.alloc", "metacache.used", "bitmap.items", "lua.states", "bitalosdb.memtable.total"} {
+		if _, ok := stats[name]; !ok {
+			t.Fatalf("memory stats missing %s: %v", name, stats)
+		}
+	}
+	if v, _ := redis.Int64(stats["runtime.heap.alloc"], nil); v <= 0 {
+		t.Fatalf("memory stats heap alloc:%d", v)
+	}
+
+	doctor, err := redis.String(c.Do("memory", "doctor"))
+	if err != nil || len(doctor) == 0 {
+		t.Fatalf("memory doctor:%q err:%v", doctor, err)
+	}
+}
@@ -1,10 +1,14 @@
 package cmd_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/zuoyebang/bitalostored/stored/engine"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
 	"github.com/zuoyebang/bitalostored/stored/internal/utils"
 
 	"github.com/zuoyebang/bitalostored/stored/internal/log"
@@ -177,6 +181,321 @@ func testMigrateSet(t *testing.T) {
 	_check(t, to, 2, "SCARD", key)
 }
 
+func TestMigrateBulk(t *testing.T) {
+	_needCluster(t)
+	hashKey, listKey, delKey := "{bulk}hash", "{bulk}list", "{bulk}del"
+	slotindex := _slot(hashKey)
+
+	from, to := _cluster(t)
+	_check(t, from, "", "DEL", hashKey, listKey, delKey)
+	_check(t, to, "", "DEL", hashKey, listKey, delKey)
+	_check(t, from, "OK", "CONFIG", "SET", "migrate.bulk_mode", "yes")
+	defer _check(t, from, "OK", "CONFIG", "SET", "migrate.bulk_mode", "no")
+	_check(t, from, 2, "HSET", hashKey, "h1", "hello", "h2", "world")
+	_check(t, from, 3, "RPUSH", listKey, "a", "b", "c")
+	_check(t, from, "OK", "SET", delKey, "stale")
+	_check(t, from, "OK", "migrateslots", "localhost", toCluster, slotindex)
+	_check(t, from, 1, "DEL", delKey)
+
+	info := _waitMigrate(t, from, slotindex, engine.MigrateStatusFinish)
+	if !info.Bulk || info.Copied < 2 || info.Fails != 0 {
+		t.Errorf("bulk migrate info: %+v", info)
+	}
+	_check(t, from, "OK", "migrateend", slotindex)
+	_check(t, from, "{}", "migratestatus", slotindex)
+
+	_check(t, from, 0, "HLEN", hashKey)
+	_check(t, to, 2, "HLEN", hashKey)
+	_check(t, to, "world", "HGET", hashKey, "h2")
+	_check(t, to, 3, "LLEN", listKey)
+	_check(t, to, "c", "LINDEX", listKey, 2)
+	_check(t, to, 0, "EXISTS", delKey)
+}
+
+func TestMigrateConcurrent(t *testing.T) {
+	_needCluster(t)
+	key1 := "{concurrent1}kv"
+	slot1, slot2, slot3 := _slot(key1), _slot("{concurrent2}"), _slot("{concurrent3}")
+	var keys2, keys3 []string
+	for i := 0; i < 5; i++ {
+		keys2 = append(keys2, fmt.Sprintf("{concurrent2}kv%d", i))
+		keys3 = append(keys3, fmt.Sprintf("{concurrent3}kv%d", i))
+	}
+
+	from, to := _cluster(t)
+	_check(t, from, "OK", "CONFIG", "SET", "migrate.max_keys_per_second", "2")
+	defer _check(t, from, "OK", "CONFIG", "SET", "migrate.max_keys_per_second", "0")
+	_check(t, from, "OK", "SET", key1, "v1")
+	for i := range keys2 {
+		_check(t, from, "OK", "SET", keys2[i], "v2")
+		_check(t, from, "OK", "SET", keys3[i], "v3")
+	}
+
+	_check(t, from, "OK", "migrateslots", "localhost", toCluster, slot1)
+	_check(t, from, "OK", "migrateslots", "localhost", toCluster, slot2)
+	_check(t, from, "OK", "migratepause", slot2)
+	_check(t, from, "OK", "migrateslots", "localhost", toCluster, slot3)
+
+	infos := _migrateList(t, from)
+	for _, slot := range []uint32{slot1, slot2, slot3} {
+		if infos[slot] == nil {
+			t.Errorf("migratelist misses slot %d", slot)
+		}
+	}
+	last := &migrateInfo{}
+	if reply, err := redis.String(from.Do("migratestatus")); err != nil || json.Unmarshal([]byte(reply), last) != nil || uint32(last.SlotId) != slot3 {
+		t.Errorf("migratestatus without slot: %s err: %v", reply, err)
+	}
+	if info := _migrateInfo(t, from, slot2); info == nil || !info.Paused {
+		t.Fatalf("paused migrate info: %+v", info)
+	}
+	paused := _migrateInfo(t, from, slot2).Total
+	time.Sleep(time.Second)
+	if info := _migrateInfo(t, from, slot2); info.Total != paused || info.Total == len(keys2) {
+		t.Errorf("paused migrate moved keys, info: %+v", info)
+	}
+
+	// a canceled migration that moved keys keeps redirecting them and
+	// resumes from its persisted cursor on the next migrateslots
+	deadline := time.Now().Add(30 * time.Second)
+	for _migrateInfo(t, from, slot3).Total == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	_check(t, from, 0, "migratecancel", slot3)
+	info := _migrateInfo(t, from, slot3)
+	if info == nil || info.Status != engine.MigrateStatusCancel || info.Total == 0 || info.Total == len(keys3) {
+		t.Fatalf("canceled migrate info: %+v", info)
+	}
+	for _, key := range keys3 {
+		_check(t, from, "v3", "GET", key)
+	}
+
+	_check(t, from, "OK", "migrateresume", slot2)
+	_check(t, from, "OK", "migrateslots", "localhost", toCluster, slot3)
+	_waitMigrate(t, from, slot1, engine.MigrateStatusFinish)
+	if info = _waitMigrate(t, from, slot2, engine.MigrateStatusFinish); info.Total != len(keys2) {
+		t.Errorf("resumed migrate info: %+v", info)
+	}
+	if info = _waitMigrate(t, from, slot3, engine.MigrateStatusFinish); info.Total != len(keys3) {
+		t.Errorf("migrate resumed after cancel info: %+v", info)
+	}
+	_check(t, from, "OK", "migrateend", slot1)
+	_check(t, from, "OK", "migrateend", slot2)
+	_check(t, from, "OK", "migrateend", slot3)
+
+	_check(t, from, nil, "GET", key1)
+	_check(t, to, "v1", "GET", key1)
+	for i := range keys2 {
+		_check(t, from, nil, "GET", keys2[i])
+		_check(t, to, "v2", "GET", keys2[i])
+		_check(t, to, "v3", "GET", keys3[i])
+	}
+}
+
+func TestMigrateChunked(t *testing.T) {
+	_needCluster(t)
+	key := "migrate_chunked_zset"
+	slot := utils.GetKeySlotId([]byte(key))
+
+	from, to := _cluster(t)
+	_check(t, from, "", "DEL", key)
+	_check(t, to, "", "DEL", key)
+	_check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_threshold", "100")
+	_check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_size", "10")
+	defer _check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_threshold", "10000")
+	defer _check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_size", "500")
+	for i := 0; i < 1000; i++ {
+		_check(t, from, 1, "ZADD", key, i, fmt.Sprintf("m%d", i))
+	}
+
+	_check(t, from, "OK", "migrateslots", "localhost", toCluster, slot)
+	for i := 0; i < 100; i++ {
+		_check(t, from, "", "ZINCRBY", key, 1000, fmt.Sprintf("m%d", i))
+		_check(t, from, "", "ZREM", key, fmt.Sprintf("m%d", 999-i))
+	}
+	_check(t, from, 10, "ZREMRANGEBYRANK", key, 0, 9)
+
+	if info := _waitMigrate(t, from, slot, engine.MigrateStatusFinish); info.Fails != 0 {
+		t.Errorf("chunked migrate info: %+v", info)
+	}
+	_check(t, from, "OK", "migrateend", slot)
+	_check(t, to, 0, "EXISTS", _stageKey(key))
+	_check(t, to, 890, "ZCARD", key)
+	_check(t, to, "1000", "ZSCORE", key, "m0")
+	_check(t, to, nil, "ZSCORE", key, "m999")
+	_check(t, to, nil, "ZSCORE", key, "m100")
+	_check(t, to, "110", "ZSCORE", key, "m110")
+}
+
+func TestMigrateChunkedSet(t *testing.T) {
+	_needCluster(t)
+	key := "migrate_chunked_set"
+	slot := utils.GetKeySlotId([]byte(key))
+
+	from, to := _cluster(t)
+	_check(t, from, "", "DEL", key)
+	_check(t, to, "", "DEL", key)
+	_check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_threshold", "100")
+	_check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_size", "10")
+	defer _check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_threshold", "10000")
+	defer _check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_size", "500")
+	for i := 0; i < 1000; i++ {
+		_check(t, from, 1, "SADD", key, fmt.Sprintf("m%d", i))
+	}
+
+	_check(t, from, "OK", "migrateslots", "localhost", toCluster, slot)
+	var popped []string
+	for i := 0; i < 10; i++ {
+		members, err := redis.Strings(from.Do("SPOP", key, 5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		popped = append(popped, members...)
+	}
+
+	if info := _waitMigrate(t, from, slot, engine.MigrateStatusFinish); info.Fails != 0 {
+		t.Errorf("chunked migrate info: %+v", info)
+	}
+	_check(t, from, "OK", "migrateend", slot)
+	_check(t, to, 0, "EXISTS", _stageKey(key))
+	_check(t, to, 1000-len(popped), "SCARD", key)
+	for _, member := range popped {
+		_check(t, to, 0, "SISMEMBER", key, member)
+	}
+}
+
+func TestMigrateChunkedList(t *testing.T) {
+	_needCluster(t)
+	key := "migrate_chunked_list"
+	slot := utils.GetKeySlotId([]byte(key))
+
+	from, to := _cluster(t)
+	_check(t, from, "", "DEL", key)
+	_check(t, to, "", "DEL", key)
+	_check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_threshold", "100")
+	_check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_size", "10")
+	defer _check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_threshold", "10000")
+	defer _check(t, from, "OK", "CONFIG", "SET", "migrate.chunk_size", "500")
+	var list []string
+	for i := 0; i < 1000; i++ {
+		list = append(list, fmt.Sprintf("v%d", i))
+		_check(t, from, len(list), "RPUSH", key, list[i])
+	}
+
+	_check(t, from, "OK", "migrateslots", "localhost", toCluster, slot)
+	for i := 0; i < 50; i++ {
+		head := fmt.Sprintf("l%d", i)
+		_check(t, from, "", "LPUSH", key, head)
+		list = append([]string{head}, list...)
+		_check(t, from, "", "RPOP", key)
+		list = list[:len(list)-1]
+		_check(t, from, "", "RPUSH", key, fmt.Sprintf("r%d", i))
+		list = append(list, fmt.Sprintf("r%d", i))
+		_check(t, from, "", "LPOP", key)
+		list = list[1:]
+	}
+	_check(t, from, "OK", "LSET", key, 10, "set")
+	list[10] = "set"
+	_check(t, from, 1, "LREM", key, 1, "v500")
+	for i := range list {
+		if list[i] == "v500" {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	_check(t, from, "OK", "LTRIM", key, 5, -6)
+	list = list[5 : len(list)-5]
+
+	if info := _waitMigrate(t, from, slot, engine.MigrateStatusFinish); info.Fails != 0 {
+		t.Errorf("chunked migrate info: %+v", info)
+	}
+	_check(t, from, "OK", "migrateend", slot)
+	_check(t, to, 0, "EXISTS", _stageKey(key))
+	_check(t, to, len(list), "LLEN", key)
+	for _, i := range []int{0, 5, 445, 446, len(list) - 1} {
+		_check(t, to, list[i], "LINDEX", key, i)
+	}
+}
+
+func TestMigrateWrite(t *testing.T) {
+	_needCluster(t)
+	_, to := _cluster(t)
+	_migrateAuth(t, to)
+	_check(t, to, "OK", "migratewrite", "0", "SET", "migrate_write_kv", "v1")
+	_check(t, to, "OK", "migratewrite", "1", "SET", "{migrate_write}kv", "v2")
+	_check(t, to, "v1", "GET", "migrate_write_kv")
+	_check(t, to, "v2", "GET", "{migrate_write}kv")
+}
+
+func TestMigrateVerify(t *testing.T) {
+	_needCluster(t)
+	key, staleKey := "migrate_verify_kv", "migrate_verify_stale"
+	slot, staleSlot := _slot(key), _slot(staleKey)
+
+	from, to := _cluster(t)
+	_check(t, from, "OK", "CONFIG", "SET", "migrate.verify", "true")
+	defer _check(t, from, "OK", "CONFIG", "SET", "migrate.verify", "false")
+	_check(t, from, "OK", "CONFIG", "SET", "migrate.verify_max_mismatch", "0")
+	_check(t, to, "", "DEL", key, staleKey)
+	_check(t, from, "OK", "SET", key, "v1")
+
+	_check(t, from, "OK", "migrateslots", "localhost", toCluster, slot)
+	if info := _waitMigrate(t, from, slot, engine.MigrateStatusFinish); info.Verified == 0 || info.Mismatches != 0 {
+		t.Errorf("verified migrate info: %+v", info)
+	}
+	_check(t, from, "OK", "migrateend", slot)
+	_check(t, to, "v1", "GET", key)
+
+	// the bulk load keeps a key the target already has, the stale copy
+	// fails the verification and the migration rolls back
+	_check(t, from, "OK", "SET", staleKey, "v1")
+	_check(t, to, "OK", "SET", staleKey, "v2")
+	_check(t, from, "OK", "migrateslots", "localhost", toCluster, staleSlot)
+	info := _waitMigrate(t, from, staleSlot, engine.MigrateStatusRollback)
+	if info.Mismatches != 1 || len(info.FailedKeys) != 1 || info.FailedKeys[0].Key != staleKey || info.FailedKeys[0].Reason != "content" {
+		t.Errorf("rolled back migrate info: %+v", info)
+	}
+	_check(t, to, nil, "GET", staleKey)
+	_check(t, from, "v1", "GET", staleKey)
+	_check(t, from, 1, "migratecancel", staleSlot)
+	_check(t, from, "{}", "migratestatus", staleSlot)
+	_check(t, from, 1, "DEL", staleKey)
+}
+
+// TestMigrateAuth needs the target started with migrate.auth_token, the token
+// is passed in the migrate_token env.
+func TestMigrateAuth(t *testing.T) {
+	_needCluster(t)
+	token := os.Getenv("migrate_token")
+	if token == "" {
+		t.Skip("migrate_token env not set")
+	}
+	key := "migrate_auth_key"
+	slot := utils.GetKeySlotId([]byte(key))
+
+	_, to := _cluster(t)
+	_check(t, to, "", "DEL", key)
+	noAuth := errn.ErrNoMigrateAuth.Error()
+	_check(t, to, noAuth, "migrateload", slot, "")
+	_check(t, to, noAuth, "migrateswitch", 0, key, 0)
+	_check(t, to, noAuth, "migratewrite", 0, "SET", key, "hello")
+	_check(t, to, noAuth, "migratedigest", slot, key)
+	_check(t, to, nil, "GET", key)
+
+	_check(t, to, errn.ErrMigrateAuth.Error(), "migrateauth", token+"_wrong")
+	_check(t, to, noAuth, "migratewrite", 0, "SET", key, "hello")
+
+	_check(t, to, "OK", "migrateauth", token)
+	_check(t, to, "OK", "migratewrite", 0, "SET", key, "hello")
+	_check(t, to, "hello", "GET", key)
+
+	other := _get_leader(t, "localhost:"+toCluster)
+	defer other.Close()
+	_check(t, other, noAuth, "migratewrite", 0, "SET", key, "world")
+	_check(t, to, "hello", "GET", key)
+	_check(t, to, 1, "DEL", key)
+}
+
 var toCluster = "8191"
 var fromCluster = "8291"
 
@@ -210,9 +529,99 @@ func _cluster(t *testing.T) (redis.Conn, redis.Conn) {
 
 	return from, to
 }
+
+// _needCluster skips a test unless the from and to env point at the source
+// and the target of a migration.
+func _needCluster(t *testing.T) {
+	if os.Getenv("from") == "" || os.Getenv("to") == "" {
+		t.Skip("from and to env not set")
+	}
+}
+
+// _migrateAuth makes conn an internal connection with the token of the
+// migrate_token env.
+func _migrateAuth(t *testing.T, conn redis.Conn) {
+	_check(t, conn, "OK", "migrateauth", os.Getenv("migrate_token"))
+}
+
+// _slot returns the slot of key, the one of its hash tag if it has one.
+func _slot(key string) uint32 {
+	return utils.GetHashTagFnv([]byte(key)) % utils.TotalSlot
+}
+
+// _stageKey returns the staging key a chunked migration copies key into.
+func _stageKey(key string) string {
+	return "{" + string(utils.ExtractHashTag([]byte(key))) + "}\x00migrate-stage"
+}
+
+type migrateInfo struct {
+	SlotId     int  `json:"slot_id"`
+	Status     int  `json:"status"`
+	Paused     bool `json:"paused"`
+	Bulk       bool `json:"bulk"`
+	Copied     int  `json:"copied"`
+	Total      int  `json:"total"`
+	Fails      int  `json:"fails"`
+	Verified   int  `json:"verified"`
+	Mismatches int  `json:"mismatches"`
+	FailedKeys []struct {
+		Key    string `json:"key"`
+		Reason string `json:"reason"`
+	} `json:"failed_keys"`
+}
+
+// _migrateInfo returns the migratestatus of slot, nil if it has none.
+func _migrateInfo(t *testing.T, conn redis.Conn, slot uint32) *migrateInfo {
+	reply, err := redis.String(conn.Do("migratestatus", slot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply == "{}" {
+		return nil
+	}
+	info := &migrateInfo{}
+	if err = json.Unmarshal([]byte(reply), info); err != nil {
+		t.Fatalf("migratestatus %d: %s err: %s", slot, reply, err)
+	}
+	return info
+}
+
+// _migrateList returns the migratelist of conn by slot.
+func _migrateList(t *testing.T, conn redis.Conn) map[uint32]*migrateInfo {
+	reply, err := redis.String(conn.Do("migratelist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []*migrateInfo
+	if err = json.Unmarshal([]byte(reply), &list); err != nil {
+		t.Fatalf("migratelist: %s err: %s", reply, err)
+	}
+	infos := make(map[uint32]*migrateInfo, len(list))
+	for _, info := range list {
+		infos[uint32(info.SlotId)] = info
+	}
+	return infos
+}
+
+// _waitMigrate waits for the migration of slot to reach status.
+func _waitMigrate(t *testing.T, conn redis.Conn, slot uint32, status int) *migrateInfo {
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		info := _migrateInfo(t, conn, slot)
+		if info != nil && info.Status == status {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("migrate slot %d info: %+v, want status %d", slot, info, status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
 func _check(t *testing.T, conn redis.Conn, expect interface{}, cmd string, arg ...interface{}) interface{} {
 	reply, err := conn.Do(cmd, arg...)
 	if err != nil {
+		reply = err
 	}
 	switch res := reply.(type) {
 	case []uint8:
@@ -0,0 +1,95 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/zuoyebang/bitalostored/butils/hash"
+)
+
+func TestSlotStats(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	key := "slotstats_key"
+	slot := int64(hash.Fnv32([]byte(key)) % 1024)
+	defer c.Do("del", key)
+
+	var stats map[string]int64
+	for i := 0; i < 150 && stats["keys"] == 0; i++ {
+		if _, err := c.Do("set", key, "value"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Do("get", key); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := redis.Values(c.Do("slotstats", slot, slot))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reply) == 1 {
+			entry, _ := redis.Values(reply[0], nil)
+			if id, _ := redis.Int64(entry[0], nil); id != slot {
+				t.Fatalf("slotstats slot exp:%d act:%d", slot, id)
+			}
+			stats, _ = redis.Int64Map(entry[1], nil)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if stats["keys"] == 0 || stats["bytes"] == 0 {
+		t.Fatalf("slotstats should count the key, stats:%v", stats)
+	}
+
+	slotKeys := func() int64 {
+		reply, err := redis.Values(c.Do("slotstats", slot, slot))
+		if err != nil || len(reply) != 1 {
+			return 0
+		}
+		entry, _ := redis.Values(reply[0], nil)
+		m, _ := redis.Int64Map(entry[1], nil)
+		return m["keys"]
+	}
+	hkey := "{" + key + "}_hash"
+	defer c.Do("del", hkey)
+	keys := slotKeys()
+	if _, err := c.Do("hset", hkey, "f", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if n := slotKeys(); n != keys+1 {
+		t.Fatalf("slotstats keys after create exp:%d act:%d", keys+1, n)
+	}
+	if _, err := c.Do("hset", hkey, "f2", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if n := slotKeys(); n != keys+1 {
+		t.Fatalf("slotstats keys after update exp:%d act:%d", keys+1, n)
+	}
+	if _, err := c.Do("del", hkey, key); err != nil {
+		t.Fatal(err)
+	}
+	if n := slotKeys(); n != keys-1 {
+		t.Fatalf("slotstats keys after del exp:%d act:%d", keys-1, n)
+	}
+
+	if _, err := c.Do("slotstats", 10, 1024); err == nil {
+		t.Fatal("slotstats out of range should fail")
+	}
+	if _, err := c.Do("slotstats", 10); err == nil {
+		t.Fatal("slotstats with one arg should fail")
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestSlowLogCommand(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	if _, err := c.Do("slowlog", "reset"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := redis.Int64(c.Do("slowlog", "len")); err != nil || n != 0 {
+		t.Fatalf("slowlog len:%d err:%v", n, err)
+	}
+	if reply, err := redis.Values(c.Do("slowlog", "get", "-1")); err != nil || len(reply) != 0 {
+		t.Fatalf("slowlog get:%v err:%v", reply, err)
+	}
+	if _, err := c.Do("slowlog", "get", "x"); err == nil {
+		t.Fatal("slowlog get invalid count should fail")
+	}
+	if _, err := c.Do("slowlog", "unknown"); err == nil {
+		t.Fatal("slowlog unknown subcommand should fail")
+	}
+}
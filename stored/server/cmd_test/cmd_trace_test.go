@@ -0,0 +1,37 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd_test
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestTraceCommandPrefix(t *testing.T) {
+	c := getTestConn()
+	defer c.Close()
+
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if reply, err := redis.String(c.Do("trace", traceParent, "set", "trace_key", "v1")); err != nil || reply != "OK" {
+		t.Fatalf("trace set reply:%s err:%v", reply, err)
+	}
+	if reply, err := redis.String(c.Do("trace", traceParent, "get", "trace_key")); err != nil || reply != "v1" {
+		t.Fatalf("trace get reply:%s err:%v", reply, err)
+	}
+	if reply, err := redis.String(c.Do("trace", "invalid", "get", "trace_key")); err != nil || reply != "v1" {
+		t.Fatalf("trace get with invalid context reply:%s err:%v", reply, err)
+	}
+}
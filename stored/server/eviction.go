@@ -0,0 +1,315 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils"
+	"github.com/zuoyebang/bitalostored/stored/engine"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
+	"github.com/zuoyebang/bitalostored/stored/internal/tclock"
+	"github.com/zuoyebang/bitalostored/stored/internal/utils"
+)
+
+const (
+	accessClockSize = 1 << 20
+
+	evictionInterval        = time.Second
+	evictionSlotsRefreshSec = 60
+	evictionPendingKeepSec  = 600
+	evictionSlotRetry       = 16
+	evictionSeekLen         = 2
+)
+
+var errEvictSkip = errors.New("evict key skipped")
+
+// evictionAllowedCmds are the writes still accepted above the disk quota,
+// they only shrink data.
+var evictionAllowedCmds = map[string]bool{
+	resp.DEL: true, resp.KDEL: true,
+	resp.EXPIRE: true, resp.EXPIREAT: true, resp.PEXPIRE: true, resp.PEXPIREAT: true,
+	resp.KEXPIRE: true, resp.KEXPIREAT: true,
+	resp.HDEL: true, resp.HCLEAR: true, resp.HEXPIRE: true, resp.HEXPIREAT: true,
+	resp.SREM: true, resp.SPOP: true, resp.SCLEAR: true, resp.SEXPIRE: true, resp.SEXPIREAT: true,
+	resp.ZREM: true, resp.ZREMRANGEBYRANK: true, resp.ZREMRANGEBYSCORE: true, resp.ZREMRANGEBYLEX: true,
+	resp.ZCLEAR: true, resp.ZEXPIRE: true, resp.ZEXPIREAT: true,
+	resp.LPOP: true, resp.RPOP: true, resp.LREM: true, resp.LTRIM: true, resp.LCLEAR: true,
+	resp.LEXPIRE: true, resp.LEXPIREAT: true,
+}
+
+// accessClock keeps the last access second of keys in hash buckets. Keys
+// sharing a bucket share their access time, which is precise enough for
+// sampled LRU and costs at most one atomic store per command.
+type accessClock struct {
+	base  int64
+	ticks []atomic.Uint32
+}
+
+func newAccessClock() *accessClock {
+	return &accessClock{
+		base:  tclock.GetTimestampSecond(),
+		ticks: make([]atomic.Uint32, accessClockSize),
+	}
+}
+
+func (ac *accessClock) now() uint32 {
+	return uint32(tclock.GetTimestampSecond()-ac.base) + 1
+}
+
+func (ac *accessClock) touch(khash uint32) {
+	tick := &ac.ticks[khash&(accessClockSize-1)]
+	if now := ac.now(); tick.Load() != now {
+		tick.Store(now)
+	}
+}
+
+// idle returns the seconds since the key was last accessed, keys not
+// accessed since start are idle since start.
+func (ac *accessClock) idle(khash uint32) uint32 {
+	return ac.now() - ac.ticks[khash&(accessClockSize-1)].Load()
+}
+
+type evictor struct {
+	clock    *accessClock
+	exceeded atomic.Bool
+	wg       sync.WaitGroup
+
+	// the fields below are only accessed by the eviction task
+	rnd         *rand.Rand
+	slots       []uint32
+	slotsTime   int64
+	lastUsed    int64
+	pending     int64
+	pendingTime int64
+}
+
+func newEvictor() *evictor {
+	return &evictor{
+		clock: newAccessClock(),
+		rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		slots: make([]uint32, 0, utils.TotalSlot),
+	}
+}
+
+func (e *evictor) touch(khash uint32) {
+	if e != nil {
+		e.clock.touch(khash)
+	}
+}
+
+// rejectWrite reports whether cmd must fail with -OOM because the disk quota
+// is exceeded and nothing can be evicted.
+func (e *evictor) rejectWrite(cmd *Cmd) bool {
+	return e != nil && cmd.Sync && e.exceeded.Load() && !evictionAllowedCmds[cmd.Name]
+}
+
+func (s *Server) RunEvictionTask() {
+	cfg := config.Runtime()
+	log.Infof("eviction task start [disk_quota:%d] [policy:%s]",
+		cfg.Bitalos.DiskQuota.Int64(), cfg.Bitalos.EvictionPolicy)
+
+	s.evictor.wg.Add(1)
+	go func() {
+		defer s.evictor.wg.Done()
+
+		ticker := time.NewTicker(evictionInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.quit:
+				log.Info("RunEvictionTask receive quit signal")
+				return
+			case <-ticker.C:
+				s.evictRound()
+			}
+		}
+	}()
+}
+
+func (s *Server) setDiskQuotaExceeded(exceeded bool) {
+	s.evictor.exceeded.Store(exceeded)
+	s.Info.Stats.DiskQuotaExceeded.Store(exceeded)
+}
+
+// evictRound deletes keys chosen by the eviction policy until the disk usage,
+// minus the bytes evicted but not yet reclaimed by compaction, fits the quota.
+func (s *Server) evictRound() {
+	e := s.evictor
+	quota := config.Runtime().Bitalos.DiskQuota.Int64()
+	if quota <= 0 {
+		e.pending = 0
+		s.setDiskQuotaExceeded(false)
+		return
+	}
+
+	db := s.GetDB()
+	if db == nil || s.syncDataDoing.Load() != 0 || s.dbSyncing.Load() != 0 {
+		return
+	}
+
+	now := tclock.GetTimestampSecond()
+	used := butils.GetDirSize(config.GetBitalosDbDataPath())
+	if used < e.lastUsed {
+		e.pending -= e.lastUsed - used
+	}
+	if e.pending < 0 || now-e.pendingTime > evictionPendingKeepSec {
+		e.pending = 0
+	}
+	e.lastUsed = used
+
+	if used <= quota {
+		e.pending = 0
+		s.setDiskQuotaExceeded(false)
+		return
+	}
+
+	policy := config.Runtime().Bitalos.EvictionPolicy
+	if policy == "" || policy == config.EvictionNoEviction {
+		s.setDiskQuotaExceeded(true)
+		return
+	}
+	if s.IsMaster != nil && !s.IsMaster() {
+		s.setDiskQuotaExceeded(false)
+		return
+	}
+
+	need := used - e.pending - quota
+	if need <= 0 {
+		s.setDiskQuotaExceeded(false)
+		return
+	}
+
+	cfg := &config.Runtime().Bitalos
+	maxKeys := cfg.EvictionMaxKeys
+	samples := cfg.EvictionSamples
+	var freed int64
+	var evicted int
+	for attempts := 0; freed < need && evicted < maxKeys && attempts < 2*maxKeys; attempts++ {
+		victim, ok := e.pickVictim(db, policy, samples)
+		if !ok {
+			break
+		}
+		size, err := db.MemoryUsage(victim.Key, victim.KeyHash, 1)
+		if err != nil || size < 0 {
+			continue
+		}
+		if err = s.evictKey(db, victim.Key, victim.KeyHash); err != nil {
+			if err == errEvictSkip {
+				continue
+			}
+			log.Warnf("evict key:%s err:%s", string(victim.Key), err)
+			break
+		}
+		freed += size
+		evicted++
+	}
+
+	if evicted > 0 {
+		e.pending += freed
+		e.pendingTime = now
+		s.Info.Stats.EvictedKeys.Add(int64(evicted))
+		log.Infof("evict keys:%d freed:%d used:%d quota:%d policy:%s", evicted, freed, used, quota, policy)
+	}
+	s.setDiskQuotaExceeded(evicted == 0)
+}
+
+// evictKey proposes a DEL of key through raft and applies it locally, like a
+// DEL sent by a client, so replicas drop the same keys.
+func (s *Server) evictKey(db *engine.Bitalos, key []byte, khash uint32) error {
+	isRedirect, unlockKey := db.CheckRedirectAndLockFunc(resp.DEL, key, khash, [][]byte{key})
+	if unlockKey != nil {
+		defer unlockKey()
+	}
+	if isRedirect {
+		return errEvictSkip
+	}
+
+	if s.isOpenRaft && !config.GlobalConfig.CheckIsDegradeSingleNode() {
+		res, err := s.DoRaftSync(khash, [][]byte{[]byte(resp.DEL), key}, "")
+		if err != nil {
+			return err
+		}
+		if res != nil {
+			return nil
+		}
+	}
+	_, err := db.Del(khash, key)
+	return err
+}
+
+func (e *evictor) pickVictim(db *engine.Bitalos, policy string, samples int) (victim bitsdb.EvictCandidate, ok bool) {
+	switch policy {
+	case config.EvictionAllKeysRandom:
+		if candidates := e.sampleMetaKeys(db, 1, false); len(candidates) > 0 {
+			return candidates[0], true
+		}
+	case config.EvictionAllKeysLRU, config.EvictionVolatileLRU:
+		var maxIdle uint32
+		for _, c := range e.sampleMetaKeys(db, samples, policy == config.EvictionVolatileLRU) {
+			if idle := e.clock.idle(c.KeyHash); !ok || idle > maxIdle {
+				victim, maxIdle, ok = c, idle, true
+			}
+		}
+	case config.EvictionVolatileTTL:
+		for _, c := range db.SampleExpireKeys(samples) {
+			// the expire db keeps stale entries of rewritten keys until they expire
+			if ttl, err := db.PTTl(c.Key, c.KeyHash); err != nil || ttl <= 0 {
+				continue
+			}
+			if !ok || c.ExpireMs < victim.ExpireMs {
+				victim, ok = c, true
+			}
+		}
+		for _, c := range e.sampleMetaKeys(db, samples, true) {
+			if !ok || c.ExpireMs < victim.ExpireMs {
+				victim, ok = c, true
+			}
+		}
+	}
+	return victim, ok
+}
+
+// sampleMetaKeys samples count keys at a random position of a random slot
+// that holds data on this node.
+func (e *evictor) sampleMetaKeys(db *engine.Bitalos, count int, volatile bool) []bitsdb.EvictCandidate {
+	if now := tclock.GetTimestampSecond(); len(e.slots) == 0 || now-e.slotsTime > evictionSlotsRefreshSec {
+		e.slots = e.slots[:0]
+		for slot := uint32(0); slot < utils.TotalSlot; slot++ {
+			if len(db.SampleMetaKeys(slot, nil, 1, false)) > 0 {
+				e.slots = append(e.slots, slot)
+			}
+		}
+		e.slotsTime = now
+	}
+
+	var seek [evictionSeekLen]byte
+	for i := 0; i < evictionSlotRetry && len(e.slots) > 0; i++ {
+		slot := e.slots[e.rnd.Intn(len(e.slots))]
+		e.rnd.Read(seek[:])
+		if candidates := db.SampleMetaKeys(slot, seek[:], count, volatile); len(candidates) > 0 {
+			return candidates
+		}
+	}
+	return nil
+}
@@ -27,13 +27,19 @@ const (
 	deleteTaskQPSThresholdDefault = 20000
 )
 
-func (s *Server) RunDeleteExpireDataTask() {
-	if !config.GlobalConfig.Bitalos.EnableExpiredDeletion {
-		log.Infof("delete expire data task not run, config run_del_expire is false")
-		return
-	}
+type expireDeletionConfig struct {
+	interval       uint64
+	qpsThreshold   uint64
+	disableStart   int
+	disableEnd     int
+	isCheckDisable bool
+}
 
-	deleteTaskInterval := config.GlobalConfig.Bitalos.ExpiredDeletionInterval * 3
+// loadExpireDeletionConfig reads the task settings from config.Runtime on
+// every tick, so CONFIG SET takes effect without restarting the task.
+func loadExpireDeletionConfig() expireDeletionConfig {
+	cfg := &config.Runtime().Bitalos
+	deleteTaskInterval := cfg.ExpiredDeletionInterval * 3
 	if deleteTaskInterval%5 != 0 {
 		deleteTaskInterval = deleteTaskInterval / 5 * 5
 	}
@@ -44,27 +50,39 @@ func (s *Server) RunDeleteExpireDataTask() {
 		deleteTaskInterval = deleteTaskIntervalDefault
 	}
 
-	deleteTaskQPSThreshold := config.GlobalConfig.Bitalos.ExpiredDeletionQpsThreshold
+	deleteTaskQPSThreshold := cfg.ExpiredDeletionQpsThreshold
 	if deleteTaskQPSThreshold == 0 {
 		deleteTaskQPSThreshold = deleteTaskQPSThresholdDefault
 	}
 
-	isCheckDisable := true
-	disableStart := config.GlobalConfig.Bitalos.ExpiredDeletionDisableStartTime
-	disableEnd := config.GlobalConfig.Bitalos.ExpiredDeletionDisableEndTime
-	if disableStart == 0 && disableEnd == 0 {
-		isCheckDisable = false
+	disableStart := cfg.ExpiredDeletionDisableStartTime
+	disableEnd := cfg.ExpiredDeletionDisableEndTime
+
+	return expireDeletionConfig{
+		interval:       deleteTaskInterval,
+		qpsThreshold:   deleteTaskQPSThreshold,
+		disableStart:   disableStart,
+		disableEnd:     disableEnd,
+		isCheckDisable: disableStart != 0 || disableEnd != 0,
+	}
+}
+
+func (s *Server) RunDeleteExpireDataTask() {
+	if !config.GlobalConfig.Bitalos.EnableExpiredDeletion {
+		log.Infof("delete expire data task not run, config run_del_expire is false")
+		return
 	}
 
-	log.Infof("delete expire data task start [interval:%d] [maxQps:%d]", deleteTaskInterval, deleteTaskQPSThreshold)
+	cfg := loadExpireDeletionConfig()
+	log.Infof("delete expire data task start [interval:%d] [maxQps:%d]", cfg.interval, cfg.qpsThreshold)
 
 	s.expireWg.Add(1)
 	go func() {
 		defer s.expireWg.Done()
 
 		var jobId, currentQPS uint64
-		interval := time.Duration(deleteTaskInterval)
-		ticker := time.NewTicker(interval * time.Second)
+		interval := cfg.interval
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
 		defer ticker.Stop()
 
 		for {
@@ -73,14 +91,21 @@ func (s *Server) RunDeleteExpireDataTask() {
 				log.Info("RunDeleteExpireDataTask receive quit signal")
 				return
 			case <-ticker.C:
+				cfg = loadExpireDeletionConfig()
+				if cfg.interval != interval {
+					interval = cfg.interval
+					ticker.Reset(time.Duration(interval) * time.Second)
+					log.Infof("RunDeleteExpireDataTask reset [interval:%d]", interval)
+				}
+
 				currentHour := time.Now().Hour()
-				if isCheckDisable && disableStart <= currentHour && currentHour <= disableEnd {
-					log.Infof("RunDeleteExpireDataTask do nothing disableHour:(%d-%d)", disableStart, disableEnd)
+				if cfg.isCheckDisable && cfg.disableStart <= currentHour && currentHour <= cfg.disableEnd {
+					log.Infof("RunDeleteExpireDataTask do nothing disableHour:(%d-%d)", cfg.disableStart, cfg.disableEnd)
 					continue
 				}
 
 				currentQPS = s.Info.Stats.QPS.Load()
-				if currentQPS >= deleteTaskQPSThreshold {
+				if currentQPS >= cfg.qpsThreshold {
 					log.Infof("RunDeleteExpireDataTask do nothing qps:%d", currentQPS)
 					continue
 				}
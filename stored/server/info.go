@@ -135,6 +135,13 @@ func (ss *SinfoServer) AppendTo(target []byte, pos int) int {
 	return copy(target[pos:], ss.cache)
 }
 
+func (ss *SinfoServer) SetMaxClient(n int64) {
+	ss.mutex.Lock()
+	ss.MaxClient = n
+	ss.mutex.Unlock()
+	ss.UpdateCache()
+}
+
 func (ss *SinfoServer) UpdateCache() {
 	ss.mutex.Lock()
 	defer ss.mutex.Unlock()
@@ -263,6 +270,17 @@ type SinfoStats struct {
 	DbSyncErr     string
 	IsMigrate     atomic.Int32 `json:"is_migrate"`
 
+	RaftApplyPending atomic.Int64
+	RaftApplyLagUs   atomic.Int64
+
+	EvictedKeys       atomic.Int64
+	DiskQuotaExceeded atomic.Bool
+
+	AdmissionState    atomic.Int32
+	AdmissionRejected atomic.Int64
+	DiskFree          atomic.Int64
+	RaftFollowerLag   atomic.Uint64
+
 	mutex sync.RWMutex
 	cache []byte
 }
@@ -294,6 +312,17 @@ func (ss *SinfoStats) UpdateCache() {
 	ss.cache = utils.AppendInfoUint(ss.cache, "instantaneous_ops_per_sec:", ss.QPS.Load())
 	ss.cache = utils.AppendInfoUint(ss.cache, "sync_queue_length:", uint64(ss.QueueLen))
 	ss.cache = utils.AppendInfoUint(ss.cache, "raft_log_index:", ss.RaftLogIndex)
+	ss.cache = utils.AppendInfoInt(ss.cache, "raft_apply_pending:", ss.RaftApplyPending.Load())
+	ss.cache = utils.AppendInfoInt(ss.cache, "raft_apply_lag_us:", ss.RaftApplyLagUs.Load())
+	ss.cache = utils.AppendInfoInt(ss.cache, "evicted_keys:", ss.EvictedKeys.Load())
+	ss.cache = utils.AppendInfoString(ss.cache, "disk_quota_exceeded:", boolToString(ss.DiskQuotaExceeded.Load()))
+	ss.cache = utils.AppendInfoString(ss.cache, "admission_state:", admissionStateString(ss.AdmissionState.Load()))
+	ss.cache = utils.AppendInfoInt(ss.cache, "admission_rejected:", ss.AdmissionRejected.Load())
+	ss.cache = utils.AppendInfoInt(ss.cache, "disk_free:", ss.DiskFree.Load())
+	ss.cache = utils.AppendInfoInt(ss.cache, "min_free_disk:", config.Runtime().Admission.MinFreeDisk.Int64())
+	ss.cache = utils.AppendInfoInt(ss.cache, "raft_queue_high_water:", int64(config.Runtime().Admission.RaftQueueHighWater))
+	ss.cache = utils.AppendInfoUint(ss.cache, "raft_follower_lag:", ss.RaftFollowerLag.Load())
+	ss.cache = utils.AppendInfoInt(ss.cache, "max_follower_lag:", config.Runtime().Admission.MaxFollowerLag)
 	ss.cache = utils.AppendInfoInt(ss.cache, "is_del_expire:", int64(ss.IsDelExpire))
 	ss.cache = utils.AppendInfoInt(ss.cache, "is_migrate:", int64(ss.IsMigrate.Load()))
 	ss.cache = utils.AppendInfoInt(ss.cache, "db_sync_running:", int64(ss.DbSyncRunning.Load()))
@@ -361,6 +390,8 @@ func (sd *SinfoData) UpdateCache() {
 	sd.cache = utils.AppendInfoInt(sd.cache, "disk_raft_nodehost_size:", sd.RaftNodeHostSize)
 	sd.cache = utils.AppendInfoInt(sd.cache, "disk_raft_wal_size:", sd.RaftWalSize)
 	sd.cache = utils.AppendInfoInt(sd.cache, "disk_snapshot_size:", sd.SnapshotSize)
+	sd.cache = utils.AppendInfoInt(sd.cache, "disk_quota:", config.Runtime().Bitalos.DiskQuota.Int64())
+	sd.cache = utils.AppendInfoString(sd.cache, "eviction_policy:", config.Runtime().Bitalos.EvictionPolicy)
 
 	sd.cache = utils.AppendInfoInt(sd.cache, "bithash_compression_type:", int64(config.GlobalConfig.Bitalos.BithashCompressionType))
 	sd.cache = utils.AppendInfoString(sd.cache, "cache_fmt_size:", butils.FmtSize(uint64(config.GlobalConfig.Bitalos.CacheSize.Int64())))
@@ -506,8 +537,10 @@ func RunInfoCollection(s *Server) {
 			if db != nil {
 				db.SetQPS(qps)
 				s.Info.Stats.RaftLogIndex = db.Meta.GetUpdateIndex()
-				if db.Migrate != nil {
-					s.Info.Stats.IsMigrate.Store(db.Migrate.IsMigrate.Load())
+				if db.IsMigrating() {
+					s.Info.Stats.IsMigrate.Store(1)
+				} else {
+					s.Info.Stats.IsMigrate.Store(0)
 				}
 				s.Info.Stats.IsDelExpire = db.GetIsDelExpire()
 			}
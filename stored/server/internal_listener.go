@@ -0,0 +1,116 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+)
+
+const internalReadBufferSize = 64 << 10
+
+// ListenInternal starts the internal tls listener if migrate.tls_port_offset
+// is set. It runs before ListenAndServe, a node that can not listen for the
+// migrations of other nodes must not start.
+func (s *Server) ListenInternal() error {
+	if config.GlobalConfig.Migrate.TLSPortOffset <= 0 {
+		return nil
+	}
+	return s.listenInternalTLS()
+}
+
+// listenInternalTLS serves internal connections, the migrations of other
+// nodes, over tls on the server port plus migrate.tls_port_offset.
+func (s *Server) listenInternalTLS() error {
+	host, port, err := net.SplitHostPort(s.laddr)
+	if err != nil {
+		return err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := config.GlobalConfig.MigrateTLSConfig(true)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(p+config.GlobalConfig.Migrate.TLSPortOffset))
+	ln, err := tls.Listen("tcp", addr, tlsConfig)
+	if err != nil {
+		return err
+	}
+	s.internalLn = ln
+	log.Infof("server internal tls listen addr:%s", addr)
+
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				log.Errorf("server internal accept error %s", err)
+				continue
+			}
+			go s.serveInternalConn(nc)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) serveInternalConn(nc net.Conn) {
+	client := newClient(s, nc.RemoteAddr().String())
+	defer func() {
+		if r := recover(); r != nil {
+			buf := make([]byte, 2048)
+			n := runtime.Stack(buf, false)
+			log.Errorf("internal conn panic err:%v stack:%s", r, unsafe2.String(buf[0:n]))
+		}
+		client.Close()
+		nc.Close()
+	}()
+
+	buf := make([]byte, internalReadBufferSize)
+	for {
+		n, err := nc.Read(buf)
+		if n > 0 {
+			dbSyncStatus := s.Info.Stats.DbSyncStatus
+			if dbSyncStatus == DB_SYNC_RECVING_FAIL || dbSyncStatus == DB_SYNC_RECVING {
+				client.Writer.WriteError(errn.ErrDbSyncFailRefuse)
+				client.Writer.FlushToWriterIO(nc)
+				return
+			}
+			if client.serveRequests(buf[:n], nc) != nil {
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Errorf("internal conn read error %s", err)
+			}
+			return
+		}
+	}
+}
@@ -19,8 +19,10 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	lua "github.com/yuin/gopher-lua"
 	"github.com/yuin/gopher-lua/parse"
@@ -30,6 +32,7 @@ import (
 )
 
 var luaClientPool sync.Pool
+var luaStateCount atomic.Int64
 var LuaCompileCacheCount int16 = 2000
 var ProtectGlobalsLua = "protectGlobals"
 
@@ -92,7 +95,12 @@ func InitLuaPool(s *Server) {
 			requireGlobal(l, "redis", "redis")
 			proto, _ := LoadOrCompileLua(s, ProtectGlobalsLua, protectGlobals)
 			_ = DoCompiledScript(l, proto)
-			return &LuaClient{l, 0}
+			lc := &LuaClient{l, 0}
+			luaStateCount.Add(1)
+			runtime.SetFinalizer(lc, func(*LuaClient) {
+				luaStateCount.Add(-1)
+			})
+			return lc
 		},
 	}
 	for i := 0; i < 16; i++ {
@@ -100,6 +108,12 @@ func InitLuaPool(s *Server) {
 	}
 }
 
+// LuaStateCount returns the number of Lua states not yet reclaimed by the GC,
+// whether pooled, in use or dropped by the pool.
+func LuaStateCount() int64 {
+	return luaStateCount.Load()
+}
+
 func GetLuaClientFromPool() *LuaClient {
 	l := luaClientPool.Get().(*LuaClient)
 	l.Count++
@@ -0,0 +1,127 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/zuoyebang/bitalostored/butils/promtext"
+	"github.com/zuoyebang/bitalostored/stored/engine/bitsdb/bitsdb"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+)
+
+const metricsPrefix = "bitalostored_"
+
+// WritePrometheus writes the server metrics in Prometheus text format,
+// followed by the raft transport metrics and the process metrics.
+func (s *Server) WritePrometheus(w io.Writer) {
+	mw := promtext.NewWriter(metricsPrefix, fmt.Sprintf(`product=%q,group="%d",node="%d",role=%q`,
+		config.GlobalConfig.Server.ProductName,
+		s.Info.Cluster.ClusterId,
+		s.Info.Cluster.CurrentNodeId,
+		s.Info.Cluster.Role))
+
+	mw.Gauge("up", "", promtext.BoolToFloat(!s.IsClosed()))
+	mw.Gauge("cluster_status", "", promtext.BoolToFloat(s.Info.Cluster.Status))
+	mw.Gauge("connected_clients", "", float64(s.Info.Client.ClientAlive.Load()))
+	mw.Counter("clients_total", "", float64(s.Info.Client.ClientTotal.Load()))
+	mw.Counter("commands_total", "", float64(s.Info.Stats.TotolCmd.Load()))
+	mw.Gauge("commands_qps", "", float64(s.Info.Stats.QPS.Load()))
+
+	rangeCommands(func(name string, cmd *Cmd) {
+		if cmd.stats == nil {
+			return
+		}
+		calls := cmd.stats.calls.Load()
+		if calls == 0 {
+			return
+		}
+		usecs := cmd.stats.usecs.Load()
+		labels := fmt.Sprintf(`command=%q`, name)
+		mw.Counter("command_calls_total", labels, float64(calls))
+		mw.Counter("command_failed_total", labels, float64(cmd.stats.fails.Load()))
+		mw.Counter("command_duration_seconds_total", labels, float64(usecs)/1e6)
+		mw.Gauge("command_duration_seconds_avg", labels, float64(usecs)/float64(calls)/1e6)
+		for i, v := range cmd.stats.hist.Percentiles(latencyPercentiles...) {
+			q := strconv.FormatFloat(latencyPercentiles[i]/100, 'f', -1, 64)
+			mw.Gauge("latency_seconds", labels+`,quantile="`+q+`"`, float64(v)/1e6)
+		}
+		mw.Gauge("latency_seconds", labels+`,quantile="1"`, float64(cmd.stats.hist.Max())/1e6)
+	})
+
+	mw.Gauge("raft_queue_length", "", float64(s.Info.Stats.QueueLen))
+	mw.Gauge("raft_apply_pending", "", float64(s.Info.Stats.RaftApplyPending.Load()))
+	mw.Gauge("raft_apply_lag_seconds", "", float64(s.Info.Stats.RaftApplyLagUs.Load())/1e6)
+
+	mw.Gauge("used_size_bytes", "", float64(s.Info.Data.UsedSize))
+	mw.Gauge("data_size_bytes", "", float64(s.Info.Data.DataSize))
+	mw.Gauge("raft_nodehost_size_bytes", "", float64(s.Info.Data.RaftNodeHostSize))
+	mw.Gauge("raft_wal_size_bytes", "", float64(s.Info.Data.RaftWalSize))
+	mw.Gauge("snapshot_size_bytes", "", float64(s.Info.Data.SnapshotSize))
+
+	s.Info.BitalosdbUsage.Range(func(dataType string, u bitsdb.BitsDBUsage) {
+		labels := fmt.Sprintf(`type=%q`, dataType)
+		mw.Gauge("bitsdb_data_disk_bytes", labels, float64(u.DataDiskSize))
+		mw.Gauge("bitsdb_data_flush_mem_time", labels, float64(u.DataFlushMemTime))
+		mw.Gauge("bitsdb_bithash_files", labels, float64(u.DataBithashFileTotal))
+		mw.Gauge("bitsdb_bithash_keys", labels, float64(u.DataBithashKeyTotal))
+		mw.Gauge("bitsdb_bithash_deleted_keys", labels, float64(u.DataBithashDelKeyTotal))
+		mw.Gauge("bitsdb_index_disk_bytes", labels, float64(u.IndexDiskSize))
+		mw.Gauge("bitsdb_index_flush_mem_time", labels, float64(u.IndexFlushMemTime))
+		mw.Gauge("bitsdb_expire_disk_bytes", labels, float64(u.ExpireDiskSize))
+	})
+
+	if db := s.GetDB(); db != nil {
+		updateIndex := db.Meta.GetUpdateIndex()
+		flushIndex := db.Meta.GetFlushIndex()
+		mw.Gauge("raft_applied_index", "", float64(updateIndex))
+		mw.Gauge("raft_flushed_index", "", float64(flushIndex))
+		if updateIndex > flushIndex {
+			mw.Gauge("raft_unflushed_entries", "", float64(updateIndex-flushIndex))
+		} else {
+			mw.Gauge("raft_unflushed_entries", "", 0)
+		}
+
+		cs := db.CacheStats()
+		var hitRate float64
+		if cs.QueryCount > 0 {
+			hitRate = float64(cs.QueryCount-cs.MissCount) / float64(cs.QueryCount)
+		}
+		mw.Counter("cache_queries_total", "", float64(cs.QueryCount))
+		mw.Counter("cache_misses_total", "", float64(cs.MissCount))
+		mw.Gauge("cache_hit_rate", "", hitRate)
+		mw.Gauge("cache_items", "", float64(cs.Items))
+		mw.Gauge("cache_used_bytes", "", float64(cs.UsedMem))
+		mw.Gauge("cache_max_bytes", "", float64(cs.MaxMem))
+
+		mw.Gauge("migrate_running", "", float64(s.Info.Stats.IsMigrate.Load()))
+		for _, mg := range db.Migrates() {
+			ms := mg.Stats()
+			labels := fmt.Sprintf(`slot="%d"`, ms.SlotId)
+			mw.Gauge("migrate_status", labels, float64(ms.Status))
+			mw.Gauge("migrate_paused", labels, promtext.BoolToFloat(ms.Paused))
+			mw.Counter("migrate_copied_keys_total", labels, float64(ms.Copied))
+			mw.Gauge("migrate_keys", labels, float64(ms.Total))
+			mw.Counter("migrate_failed_keys_total", labels, float64(ms.Fails))
+			mw.Gauge("migrate_duration_seconds", labels, ms.Costs.Seconds())
+		}
+	}
+
+	mw.WriteTo(w)
+	metrics.WritePrometheus(w, true)
+}
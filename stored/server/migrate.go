@@ -15,11 +15,16 @@
 package server
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/zuoyebang/bitalostored/stored/engine"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
 	"github.com/zuoyebang/bitalostored/stored/internal/errn"
 	"github.com/zuoyebang/bitalostored/stored/internal/log"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
 )
 
 func migrateSlots(c *Client) error {
@@ -61,22 +66,95 @@ func migrateSlotsRetry(c *Client) error {
 }
 
 func migrateStatus(c *Client) error {
-	if len(c.Args) > 1 {
-		if u, e := strconv.ParseUint(string(c.Args[1]), 10, 64); e != nil {
+	if len(c.Args) > 0 {
+		u, e := strconv.ParseUint(string(c.Args[0]), 10, 32)
+		if e != nil {
 			return e
-		} else if u != c.DB.Meta.GetMigrateSlotid() {
-			return errn.ErrSlotIdNotMatch
 		}
+		if mg := c.DB.GetMigrate(uint32(u)); mg != nil {
+			c.Writer.WriteStatus(mg.Info())
+		} else {
+			c.Writer.WriteStatus("{}")
+		}
+		return nil
 	}
 
-	if c.DB.Migrate != nil {
-		c.Writer.WriteStatus(c.DB.Migrate.Info())
+	if mg := c.DB.GetMigrate(uint32(c.DB.Meta.GetMigrateSlotid())); mg != nil {
+		c.Writer.WriteStatus(mg.Info())
 	} else {
 		c.Writer.WriteStatus("{}")
 	}
 	return nil
 }
 
+func migrateList(c *Client) error {
+	if len(c.Args) != 0 {
+		return errn.CmdParamsErr("migratelist")
+	}
+
+	infos := make([]string, 0, 4)
+	for _, mg := range c.DB.Migrates() {
+		infos = append(infos, mg.Info())
+	}
+	c.Writer.WriteStatus("[" + strings.Join(infos, ",") + "]")
+	return nil
+}
+
+func parseMigrateSlot(c *Client, name string) (uint32, error) {
+	if len(c.Args) != 1 {
+		return 0, errn.CmdParamsErr(name)
+	}
+	slot, e := strconv.ParseUint(string(c.Args[0]), 10, 32)
+	if e != nil {
+		return 0, e
+	}
+	return uint32(slot), nil
+}
+
+func migratePause(c *Client) error {
+	slot, e := parseMigrateSlot(c, "migratepause")
+	if e != nil {
+		return e
+	}
+	if e = c.DB.MigratePause(slot); e != nil {
+		return e
+	}
+
+	c.Writer.WriteStatus("OK")
+	return nil
+}
+
+func migrateResume(c *Client) error {
+	slot, e := parseMigrateSlot(c, "migrateresume")
+	if e != nil {
+		return e
+	}
+	if e = c.DB.MigrateResume(slot); e != nil {
+		return e
+	}
+
+	c.Writer.WriteStatus("OK")
+	return nil
+}
+
+func migrateCancel(c *Client) error {
+	slot, e := parseMigrateSlot(c, "migratecancel")
+	if e != nil {
+		return e
+	}
+	dropped, e := c.DB.MigrateCancel(slot)
+	if e != nil {
+		return e
+	}
+
+	if dropped {
+		c.Writer.WriteInteger(1)
+	} else {
+		c.Writer.WriteInteger(0)
+	}
+	return nil
+}
+
 func migrateEnd(c *Client) error {
 	if len(c.Args) < 1 {
 		return errn.CmdParamsErr("migrateend")
@@ -111,12 +189,111 @@ func migrateRetryEnd(c *Client) error {
 	return nil
 }
 
+func migrateLoad(c *Client) error {
+	if len(c.Args) != 2 {
+		return errn.CmdParamsErr(engine.MigrateLoadCmd)
+	}
+	slot, e := strconv.ParseUint(string(c.Args[0]), 10, 32)
+	if e != nil {
+		return e
+	}
+
+	n, e := c.DB.MigrateLoad(uint32(slot), c.Args[1])
+	if e != nil {
+		log.Warn("migrateload error slots: ", slot, " error: ", e)
+		return e
+	}
+
+	c.Writer.WriteInteger(int64(n))
+	return nil
+}
+
+func migrateSwitch(c *Client) error {
+	if len(c.Args) != 3 {
+		return errn.CmdParamsErr(engine.MigrateSwitchCmd)
+	}
+	size, e := strconv.ParseInt(string(c.Args[2]), 10, 64)
+	if e != nil {
+		return e
+	}
+
+	ok, e := c.DB.MigrateSwitch(c.Args[0], c.Args[1], size)
+	if e != nil {
+		log.Warn("migrateswitch error key: ", string(c.Args[1]), " error: ", e)
+		return e
+	}
+
+	if ok {
+		c.Writer.WriteInteger(1)
+	} else {
+		c.Writer.WriteInteger(0)
+	}
+	return nil
+}
+
+func migrateAuth(c *Client) error {
+	if len(c.Args) != 1 {
+		return errn.CmdParamsErr(engine.MigrateAuthCmd)
+	}
+
+	token := config.GlobalConfig.MigrateToken()
+	if token != "" && subtle.ConstantTimeCompare(c.Args[0], []byte(token)) != 1 {
+		log.Warn("migrateauth fail remote: ", c.remoteAddr)
+		return errn.ErrMigrateAuth
+	}
+	c.internal = true
+	c.Writer.WriteStatus(resp.ReplyOK)
+	return nil
+}
+
+// migrateWrite runs a command sent by a migration like a client of its own,
+// so the command goes through raft and the target checks of its key.
+func migrateWrite(c *Client) error {
+	if len(c.Args) < 2 {
+		return errn.CmdParamsErr(engine.MigrateWriteCmd)
+	}
+
+	vmClient := GetVmFromPool(c.server)
+	defer PutRaftClientToPool(vmClient)
+	_ = vmClient.HandleRequest(c.Args[1:], string(c.Args[0]) == "1")
+	c.Writer.WriteBytes(vmClient.Writer.Bytes())
+	return nil
+}
+
+func migrateDigest(c *Client) error {
+	if len(c.Args) < 2 {
+		return errn.CmdParamsErr(engine.MigrateDigestCmd)
+	}
+	slot, e := strconv.ParseUint(string(c.Args[0]), 10, 32)
+	if e != nil {
+		return e
+	}
+
+	digests, e := c.DB.MigrateDigest(uint32(slot), c.Args[1:])
+	if e != nil {
+		log.Warn("migratedigest error slots: ", slot, " error: ", e)
+		return e
+	}
+
+	c.Writer.WriteSliceArray(digests)
+	return nil
+}
+
 func init() {
 	AddCommand(map[string]*Cmd{
-		"migrateslots":      {Sync: true, Name: "migrateslots host port slotid...", Handler: migrateSlots},
-		"migrateslotsretry": {Sync: true, Name: "migrateslotsretry host port slotid...", Handler: migrateSlotsRetry},
-		"migratestatus":     {Sync: false, Name: "migratestatus slotid", Handler: migrateStatus},
-		"migrateend":        {Sync: true, Name: "migrateend slotid", Handler: migrateEnd},
-		"migrateretryend":   {Sync: true, Name: "migrateretryend slotid", Handler: migrateRetryEnd},
+		"migrateslots":          {Sync: true, Name: "migrateslots host port slotid...", Handler: migrateSlots},
+		"migrateslotsretry":     {Sync: true, Name: "migrateslotsretry host port slotid...", Handler: migrateSlotsRetry},
+		"migratestatus":         {Sync: false, Name: "migratestatus slotid", Handler: migrateStatus},
+		"migratelist":           {Sync: false, Name: "migratelist", Handler: migrateList},
+		"migrateend":            {Sync: true, Name: "migrateend slotid", Handler: migrateEnd},
+		"migrateretryend":       {Sync: true, Name: "migrateretryend slotid", Handler: migrateRetryEnd},
+		"migratepause":          {Sync: false, Name: "migratepause slotid", Handler: migratePause},
+		"migrateresume":         {Sync: false, Name: "migrateresume slotid", Handler: migrateResume},
+		"migratecancel":         {Sync: false, Name: "migratecancel slotid", Handler: migrateCancel},
+		engine.MigrateAuthCmd:   {Sync: false, Name: "migrateauth token", Handler: migrateAuth, NoKey: true, NotAllowedInTx: true},
+		engine.MigrateWriteCmd:  {Sync: false, Name: "migratewrite hashtag cmd args...", Handler: migrateWrite, NoKey: true, NotAllowedInTx: true, Internal: true},
+		engine.MigrateLoadCmd:   {Sync: true, Name: "migrateload slotid dump", Handler: migrateLoad, Internal: true},
+		engine.MigrateSwitchCmd: {Sync: true, Name: "migrateswitch stage key size", Handler: migrateSwitch, Internal: true},
+		engine.MigrateDigestCmd: {Sync: false, Name: "migratedigest slotid key...", Handler: migrateDigest, NoKey: true, Internal: true},
 	})
 }
@@ -17,6 +17,8 @@ package server
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"runtime"
 	"sync"
@@ -45,8 +47,11 @@ type Server struct {
 	IsMaster          func() bool
 	MigrateDelToSlave func(keyHash uint32, data [][]byte) error
 	IsWitness         bool
-	DoRaftSync        func(keyHash uint32, data [][]byte) ([]byte, error)
+	DoRaftSync        func(keyHash uint32, data [][]byte, traceParent string) ([]byte, error)
 	DoRaftStop        func()
+	DoRaftQueueResize func(workers int)
+	RaftQueueLength   func() int
+	RaftFollowerLag   func() uint64
 	laddr             string
 	db                *engine.Bitalos
 	closed            atomic.Bool
@@ -54,6 +59,7 @@ type Server struct {
 	isDebug           bool
 	isOpenRaft        bool
 	slowQuery         *slowshield.SlowShield
+	slowLog           *slowLog
 	recoverLock       sync.Mutex
 	syncDataDoing     atomic.Int32
 	dbSyncing         atomic.Int32
@@ -66,6 +72,15 @@ type Server struct {
 	txParallelCounter atomic.Int32
 	txPrepareWg       sync.WaitGroup
 	cpu               *cpuAdjust
+	clients           sync.Map
+	clientIdSeq       atomic.Int64
+	clientPause       clientPauseState
+	monitorMu         sync.Mutex
+	monitors          atomic.Pointer[[]*Monitor]
+	evictor           *evictor
+	admission         *admission
+	slotStats         *slotStats
+	internalLn        net.Listener
 }
 
 func NewServer() (*Server, error) {
@@ -73,6 +88,7 @@ func NewServer() (*Server, error) {
 		laddr:             config.GlobalConfig.Server.Address,
 		isDebug:           config.GlobalConfig.Log.IsDebug,
 		slowQuery:         slowshield.NewSlowShield(),
+		slowLog:           newSlowLog(config.GlobalConfig.Server.SlowLogMaxLen),
 		quit:              make(chan struct{}),
 		recoverLock:       sync.Mutex{},
 		expireClosedCh:    make(chan struct{}),
@@ -130,6 +146,13 @@ func NewServer() (*Server, error) {
 
 	s.db = db
 	s.RunDeleteExpireDataTask()
+	s.evictor = newEvictor()
+	s.RunEvictionTask()
+	s.admission = &admission{}
+	s.RunAdmissionTask()
+	s.slotStats = &slotStats{}
+	s.watchSlotKeys(db)
+	s.RunSlotStatsTask()
 
 	return s, nil
 }
@@ -160,6 +183,9 @@ func (s *Server) Close() {
 	close(s.quit)
 	close(s.expireClosedCh)
 
+	if s.internalLn != nil {
+		s.internalLn.Close()
+	}
 	if s.eng.Validate() == nil {
 		if err := s.eng.Stop(context.TODO()); err != nil {
 			log.Errorf("server gnet stop error %s", err)
@@ -171,6 +197,9 @@ func (s *Server) Close() {
 
 	if !s.IsWitness {
 		s.expireWg.Wait()
+		s.evictor.wg.Wait()
+		s.admission.wg.Wait()
+		s.slotStats.wg.Wait()
 		s.GetDB().Close()
 	}
 }
@@ -210,7 +239,7 @@ func (s *Server) OnBoot(eng gnet.Engine) (action gnet.Action) {
 }
 
 func (s *Server) OnOpen(conn gnet.Conn) (out []byte, action gnet.Action) {
-	client := newConnClient(s, conn.RemoteAddr().String())
+	client := newConnClient(s, conn)
 	conn.SetContext(client)
 	return
 }
@@ -252,42 +281,56 @@ func (s *Server) OnTraffic(conn gnet.Conn) (action gnet.Action) {
 	}
 
 	readBuf, _ := conn.Next(-1)
-	if client.Reader.Len() > 0 {
-		client.Reader.Write(readBuf)
-		readBuf = client.Reader.Bytes()
+	if err := client.serveRequests(readBuf, conn); err != nil {
+		return gnet.Close
+	}
+	return gnet.None
+}
+
+// serveRequests handles the commands read into readBuf and writes their
+// replies to w, a partial command is kept in the reader of the client until
+// the rest of it is read.
+func (c *Client) serveRequests(readBuf []byte, w io.Writer) error {
+	if c.Reader.Len() > 0 {
+		c.Reader.Write(readBuf)
+		readBuf = c.Reader.Bytes()
 	}
 
-	cmds, writeBackBytes, err := resp.ParseCommands(readBuf[client.Reader.Offset:], client.ParseMarks[:0])
+	cmds, writeBackBytes, err := resp.ParseCommands(readBuf[c.Reader.Offset:], c.ParseMarks[:0])
 	if err != nil {
-		client.Writer.WriteError(err)
-		client.Writer.FlushToWriterIO(conn)
+		c.Writer.WriteError(err)
+		c.Writer.FlushToWriterIO(w)
 		log.Errorf("conn OnTraffic parse commands error %s", err)
-		return gnet.Close
+		return err
 	}
 
 	for i := range cmds {
-		if err = client.HandleRequest(cmds[i].Args, false); err != nil {
+		if err = c.HandleRequest(cmds[i].Args, false); err != nil {
 			log.Errorf("conn OnTraffic handle request error %s", err)
 		}
+		if log.AuditEnabled() {
+			c.auditCommand(err)
+		}
 
-		if _, err = client.Writer.FlushToWriterIO(conn); err != nil {
+		if _, err = c.Writer.FlushToWriterIO(w); err != nil {
 			log.Errorf("conn OnTraffic write error %s", err)
 		}
 	}
+	c.updateClientMeta()
 
 	writeBackBytesLen := len(writeBackBytes)
-	if writeBackBytesLen > 0 && client.Reader.Len() == 0 {
-		client.Reader.Write(writeBackBytes)
+	if writeBackBytesLen > 0 && c.Reader.Len() == 0 {
+		c.Reader.Write(writeBackBytes)
 	}
 
 	if cmds != nil {
-		client.Reader.Offset = client.Reader.Len() - writeBackBytesLen
+		c.Reader.Offset = c.Reader.Len() - writeBackBytesLen
 	}
 
 	if writeBackBytesLen == 0 {
-		client.Reader.Reset()
-		client.Reader.Offset = 0
+		c.Reader.Reset()
+		c.Reader.Offset = 0
 	}
 
-	return gnet.None
+	return nil
 }
@@ -0,0 +1,196 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zuoyebang/bitalostored/stored/engine"
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+	"github.com/zuoyebang/bitalostored/stored/internal/utils"
+)
+
+const (
+	slotStatsTick           = 100 * time.Millisecond
+	slotStatsQPSTicks       = 10
+	slotStatsReconcileTicks = 2
+)
+
+type slotStat struct {
+	keys     atomic.Int64
+	bytes    atomic.Int64
+	reads    atomic.Uint64
+	writes   atomic.Uint64
+	readQPS  atomic.Uint64
+	writeQPS atomic.Uint64
+
+	// the fields below are only accessed by the slot stats task
+	lastReads  uint64
+	lastWrites uint64
+}
+
+// slotStats keeps per-slot key count, approximate size and read/write QPS.
+// Commands update the counters as they are applied, writes add their payload
+// to the size. The engine reports every key that a write creates or deletes
+// to countKey, so the key count follows the writes without scanning. Keys
+// that expire are not reported by any write, the slots are therefore scanned
+// one after another in the background to reconcile the key count and the
+// size with the meta records.
+type slotStats struct {
+	slots  [utils.TotalSlot]slotStat
+	wg     sync.WaitGroup
+	rescan atomic.Bool
+
+	// the fields below are only accessed by the slot stats task
+	reconcileCursor uint32
+}
+
+type slotStatsEntry struct {
+	slot     uint32
+	keys     int64
+	bytes    int64
+	readQPS  uint64
+	writeQPS uint64
+}
+
+func (ss *slotStats) record(cmd *Cmd, khash uint32, args [][]byte) {
+	if ss == nil || cmd.NoKey {
+		return
+	}
+	st := &ss.slots[utils.GetSlotId(khash)]
+	if !cmd.Sync {
+		st.reads.Add(1)
+		return
+	}
+	st.writes.Add(1)
+	if !evictionAllowedCmds[cmd.Name] {
+		var n int
+		for _, arg := range args {
+			n += len(arg)
+		}
+		st.bytes.Add(int64(n))
+	}
+}
+
+// countKey is the key counter of the engine, lua scripts are stored under a
+// slot id above the slot range and are not counted.
+func (ss *slotStats) countKey(slotId uint16, delta int64) {
+	if uint32(slotId) >= utils.TotalSlot {
+		return
+	}
+	ss.slots[slotId].keys.Add(delta)
+}
+
+func (ss *slotStats) get(slot uint32) slotStatsEntry {
+	st := &ss.slots[slot]
+	return slotStatsEntry{
+		slot:     slot,
+		keys:     st.keys.Load(),
+		bytes:    st.bytes.Load(),
+		readQPS:  st.readQPS.Load(),
+		writeQPS: st.writeQPS.Load(),
+	}
+}
+
+func (ss *slotStats) updateQPS(seconds uint64) {
+	for i := range ss.slots {
+		st := &ss.slots[i]
+		reads, writes := st.reads.Load(), st.writes.Load()
+		st.readQPS.Store((reads - st.lastReads) / seconds)
+		st.writeQPS.Store((writes - st.lastWrites) / seconds)
+		st.lastReads, st.lastWrites = reads, writes
+	}
+}
+
+// watchSlotKeys installs the key counter on db and scans all slots again,
+// it is called for every db the server opens.
+func (s *Server) watchSlotKeys(db *engine.Bitalos) {
+	if s.slotStats == nil || db == nil {
+		return
+	}
+	db.SetSlotKeyCounter(s.slotStats.countKey)
+	s.slotStats.rescan.Store(true)
+}
+
+func (s *Server) scanSlotStats(slot uint32) bool {
+	db := s.GetDB()
+	if db == nil || s.syncDataDoing.Load() != 0 || s.dbSyncing.Load() != 0 {
+		return false
+	}
+	st := &s.slotStats.slots[slot]
+	keys, size := db.SlotKeyStats(slot)
+	st.keys.Store(keys)
+	st.bytes.Store(size)
+	return true
+}
+
+// scanAllSlotStats scans every slot and reports whether all scans ran, it
+// gives up early when the server quits.
+func (s *Server) scanAllSlotStats() bool {
+	start := time.Now()
+	done := true
+	for slot := uint32(0); slot < utils.TotalSlot; slot++ {
+		select {
+		case <-s.quit:
+			return false
+		default:
+		}
+		if !s.scanSlotStats(slot) {
+			done = false
+		}
+	}
+	log.Infof("slot stats full scan done:%v cost:%s", done, time.Since(start))
+	return done
+}
+
+func (s *Server) RunSlotStatsTask() {
+	ss := s.slotStats
+	ss.wg.Add(1)
+	go func() {
+		defer ss.wg.Done()
+
+		ticker := time.NewTicker(slotStatsTick)
+		defer ticker.Stop()
+
+		lastQPS := time.Now()
+		for tick := 1; ; tick++ {
+			select {
+			case <-s.quit:
+				log.Info("RunSlotStatsTask receive quit signal")
+				return
+			case <-ticker.C:
+			}
+
+			if tick%slotStatsQPSTicks == 0 {
+				seconds := uint64(time.Since(lastQPS).Seconds() + 0.5)
+				if seconds == 0 {
+					seconds = 1
+				}
+				ss.updateQPS(seconds)
+				lastQPS = time.Now()
+			}
+			if ss.rescan.CompareAndSwap(true, false) && !s.scanAllSlotStats() {
+				ss.rescan.Store(true)
+				continue
+			}
+			if tick%slotStatsReconcileTicks == 0 {
+				s.scanSlotStats(ss.reconcileCursor)
+				ss.reconcileCursor = (ss.reconcileCursor + 1) % utils.TotalSlot
+			}
+		}
+	}()
+}
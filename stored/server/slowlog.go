@@ -0,0 +1,224 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/zuoyebang/bitalostored/butils/unsafe2"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/errn"
+	"github.com/zuoyebang/bitalostored/stored/internal/resp"
+)
+
+const (
+	defaultSlowLogGetNum = 10
+	slowLogMaxArgc       = 32
+	slowLogMaxArgLen     = 128
+)
+
+func init() {
+	AddCommand(map[string]*Cmd{
+		resp.SLOWLOG: {Sync: false, Handler: slowLogCommand, NoKey: true, NotAllowedInTx: true},
+	})
+}
+
+type slowLogEntry struct {
+	id            int64
+	time          int64
+	durationUs    int64
+	args          [][]byte
+	addr          string
+	name          string
+	queueWaitUs   int64
+	raftProposeUs int64
+	applyUs       int64
+}
+
+type slowLog struct {
+	mu      sync.Mutex
+	nextId  int64
+	head    int
+	size    int
+	entries []*slowLogEntry
+}
+
+func newSlowLog(maxLen int) *slowLog {
+	if maxLen <= 0 {
+		maxLen = config.DefaultSlowLogMaxLen
+	}
+	return &slowLog{entries: make([]*slowLogEntry, maxLen)}
+}
+
+func (l *slowLog) add(e *slowLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.id = l.nextId
+	l.nextId++
+	l.entries[l.head] = e
+	l.head = (l.head + 1) % len(l.entries)
+	if l.size < len(l.entries) {
+		l.size++
+	}
+}
+
+// get returns at most n entries, newest first. A negative n returns all entries.
+func (l *slowLog) get(n int) []*slowLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n < 0 || n > l.size {
+		n = l.size
+	}
+	entries := make([]*slowLogEntry, 0, n)
+	pos := l.head
+	for i := 0; i < n; i++ {
+		pos = (pos - 1 + len(l.entries)) % len(l.entries)
+		entries = append(entries, l.entries[pos])
+	}
+	return entries
+}
+
+func (l *slowLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// setMaxLen resizes the ring and keeps the newest entries that still fit.
+func (l *slowLog) setMaxLen(maxLen int) {
+	if maxLen <= 0 {
+		maxLen = config.DefaultSlowLogMaxLen
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if maxLen == len(l.entries) {
+		return
+	}
+	size := l.size
+	if size > maxLen {
+		size = maxLen
+	}
+	entries := make([]*slowLogEntry, maxLen)
+	pos := l.head
+	for i := size - 1; i >= 0; i-- {
+		pos = (pos - 1 + len(l.entries)) % len(l.entries)
+		entries[i] = l.entries[pos]
+	}
+	l.entries = entries
+	l.size = size
+	l.head = size % maxLen
+}
+
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := range l.entries {
+		l.entries[i] = nil
+	}
+	l.head = 0
+	l.size = 0
+}
+
+// addSlowLog records the command of c, costNs is measured from QueryStartTime and
+// already contains raftSyncCostNs on the leader write path.
+func (s *Server) addSlowLog(c *Client, costNs, raftSyncCostNs int64) {
+	s.slowLog.add(&slowLogEntry{
+		time:          c.QueryStartTime.Unix(),
+		durationUs:    (c.QueueWaitNs + costNs) / 1000,
+		args:          slowLogArgs(c.Data),
+		addr:          c.remoteAddr,
+		name:          c.GetName(),
+		queueWaitUs:   c.QueueWaitNs / 1000,
+		raftProposeUs: raftSyncCostNs / 1000,
+		applyUs:       (costNs - raftSyncCostNs) / 1000,
+	})
+}
+
+func slowLogArgs(data [][]byte) [][]byte {
+	argc := len(data)
+	if argc > slowLogMaxArgc {
+		argc = slowLogMaxArgc
+	}
+	args := make([][]byte, 0, argc)
+	for i, arg := range data {
+		if len(args) == slowLogMaxArgc-1 && i < len(data)-1 {
+			args = append(args, []byte("... ("+strconv.Itoa(len(data)-i)+" more arguments)"))
+			break
+		}
+		if len(arg) > slowLogMaxArgLen {
+			b := make([]byte, 0, slowLogMaxArgLen+32)
+			b = append(b, arg[:slowLogMaxArgLen]...)
+			b = append(b, "... ("+strconv.Itoa(len(arg)-slowLogMaxArgLen)+" more bytes)"...)
+			args = append(args, b)
+		} else {
+			args = append(args, append([]byte{}, arg...))
+		}
+	}
+	return args
+}
+
+func slowLogCommand(c *Client) error {
+	if len(c.Args) == 0 {
+		return errn.CmdParamsErr(resp.SLOWLOG)
+	}
+
+	switch unsafe2.String(LowerSlice(c.Args[0])) {
+	case "get":
+		if len(c.Args) > 2 {
+			return errn.CmdParamsErr("slowlog|get")
+		}
+		n := defaultSlowLogGetNum
+		if len(c.Args) == 2 {
+			v, err := strconv.Atoi(unsafe2.String(c.Args[1]))
+			if err != nil || v < -1 {
+				return errn.ErrValue
+			}
+			n = v
+		}
+		entries := c.server.slowLog.get(n)
+		reply := make([]interface{}, 0, len(entries))
+		for _, e := range entries {
+			reply = append(reply, []interface{}{
+				e.id,
+				e.time,
+				e.durationUs,
+				e.args,
+				[]byte(e.addr),
+				[]byte(e.name),
+				[]interface{}{
+					[]byte("queue_wait_us"), e.queueWaitUs,
+					[]byte("raft_propose_us"), e.raftProposeUs,
+					[]byte("apply_us"), e.applyUs,
+				},
+			})
+		}
+		c.Writer.WriteArray(reply)
+	case "len":
+		if len(c.Args) != 1 {
+			return errn.CmdParamsErr("slowlog|len")
+		}
+		c.Writer.WriteInteger(int64(c.server.slowLog.len()))
+	case "reset":
+		if len(c.Args) != 1 {
+			return errn.CmdParamsErr("slowlog|reset")
+		}
+		c.server.slowLog.reset()
+		c.Writer.WriteStatus(resp.ReplyOK)
+	default:
+		return errn.CmdParamsErr(resp.SLOWLOG)
+	}
+	return nil
+}
@@ -149,6 +149,7 @@ func (s *Server) RecoverFromSnapshot(r io.Reader, done <-chan struct{}) error {
 	log.Info("recoverFromSnapshot new db succ")
 
 	s.db = db
+	s.watchSlotKeys(db)
 
 	s.Info.Stats.DbSyncErr = ""
 	s.Info.Stats.DbSyncStatus = DB_SYNC_RECVING_SUCC
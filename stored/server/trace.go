@@ -0,0 +1,96 @@
+// Copyright 2019-2024 Xu Ruibo (hustxurb@163.com) and Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"github.com/zuoyebang/bitalostored/butils/tracing"
+	"github.com/zuoyebang/bitalostored/stored/internal/config"
+	"github.com/zuoyebang/bitalostored/stored/internal/log"
+)
+
+const (
+	tracingServiceName = "bitalostored"
+	traceKeyMaxLen     = 128
+)
+
+// SetupTracing installs the process wide tracer when tracing is enabled.
+func SetupTracing(s *Server) {
+	cfg := config.GlobalConfig.Tracing
+	if !cfg.Enable {
+		return
+	}
+	exporter, err := tracing.NewExporter(cfg.Exporter, cfg.ExporterTarget)
+	if err != nil {
+		log.Warnf("tracing exporter init fail err:%v", err)
+		return
+	}
+	tracing.SetDefault(tracing.NewTracer(tracing.Config{
+		ServiceName: tracingServiceName,
+		SampleRatio: cfg.SampleRatio,
+		Exporter:    exporter,
+		Attributes: []tracing.Attribute{
+			{Key: "bitalos.product", Value: config.GlobalConfig.Server.ProductName},
+			{Key: "bitalos.group_id", Value: config.GlobalConfig.RaftCluster.ClusterId},
+			{Key: "bitalos.node_id", Value: config.GlobalConfig.RaftNodeHost.NodeID},
+			{Key: "bitalos.addr", Value: s.laddr},
+		},
+	}))
+	log.Infof("tracing enabled exporter:%s target:%s sample_ratio:%v", cfg.Exporter, cfg.ExporterTarget, cfg.SampleRatio)
+}
+
+func (c *Client) startTraceSpan(parent tracing.SpanContext) {
+	span := tracing.StartAt(c.Cmd, tracing.SpanKindServer, parent, c.QueryStartTime)
+	if span != nil {
+		span.SetAttr("db.system", "bitalos")
+		span.SetAttr("db.operation", c.Cmd)
+		if len(c.Keys) > 0 {
+			key := c.Keys
+			if len(key) > traceKeyMaxLen {
+				key = key[:traceKeyMaxLen]
+			}
+			span.SetAttr("db.key", string(key))
+		}
+		span.SetAttr("net.peer.name", c.remoteAddr)
+	}
+	c.traceSpan = span
+}
+
+func (c *Client) endTraceSpan(err error) {
+	if c.traceSpan == nil {
+		return
+	}
+	c.traceSpan.SetError(err)
+	c.traceSpan.End()
+	c.traceSpan = nil
+}
+
+// SetTraceSpan hangs the spans recorded by ApplyDB under span, it is used by
+// the raft apply queue for commands replicated from the leader.
+func (c *Client) SetTraceSpan(span *tracing.Span) {
+	c.traceSpan = span
+}
+
+func (c *Client) startChildSpan(name string, start time.Time) *tracing.Span {
+	return c.traceSpan.StartChildAt(name, tracing.SpanKindInternal, start)
+}
+
+func traceParentOf(span *tracing.Span) string {
+	if span == nil {
+		return ""
+	}
+	return span.Context().Traceparent()
+}